@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"github.com/xNatthapol/todo-list/internal/utils"
+)
+
+// runCommand executes an administrative command given on the command line
+func runCommand(ctx context.Context, args []string, cfg *config.Config, loginGuard services.LoginGuard, adminService services.AdminService, jobQueue services.JobQueue) error {
+	switch args[0] {
+	case "unlock-account":
+		if len(args) != 2 {
+			return errors.New("usage: unlock-account <email>")
+		}
+		if cfg.LoginThrottleStore == "memory" {
+			log.Println("WARNING: LOGIN_THROTTLE_STORE is memory; lockouts live in the server process and cannot be lifted from here.")
+		}
+		if err := loginGuard.UnlockAccount(ctx, args[1], models.ClientInfo{UserAgent: "cli"}); err != nil {
+			return fmt.Errorf("failed to unlock account %s: %w", args[1], err)
+		}
+		log.Printf("INFO: Account %s unlocked", args[1])
+		return nil
+	case "grant-admin", "revoke-admin":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: %s <email>", args[0])
+		}
+		role := models.RoleAdmin
+		if args[0] == "revoke-admin" {
+			role = models.RoleUser
+		}
+		if _, err := adminService.SetUserRoleByEmail(ctx, args[1], role); err != nil {
+			return fmt.Errorf("failed to set role of %s: %w", args[1], err)
+		}
+		log.Printf("INFO: User %s now has the %s role", args[1], role)
+		return nil
+	case "generate-vapid-keys":
+		keys, err := utils.GenerateVAPIDKeys()
+		if err != nil {
+			return err
+		}
+		// Printed rather than logged so the lines can be appended to .env directly
+		fmt.Printf("VAPID_PUBLIC_KEY=%s\nVAPID_PRIVATE_KEY=%s\n", keys.PublicKey, keys.PrivateKey)
+		return nil
+	case "worker":
+		if len(args) != 1 {
+			return errors.New("usage: worker")
+		}
+		// Jobs already running are finished before the worker exits
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		jobQueue.Run(ctx)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
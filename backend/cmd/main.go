@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"log"
+	"os"
+	"slices"
+	// User timezones must resolve even where the image has no zoneinfo installed
+	_ "time/tzdata"
 
 	"github.com/xNatthapol/todo-list/internal/config"
 	"github.com/xNatthapol/todo-list/internal/database"
 	"github.com/xNatthapol/todo-list/internal/handlers"
+	"github.com/xNatthapol/todo-list/internal/middleware"
 	"github.com/xNatthapol/todo-list/internal/repositories"
 	"github.com/xNatthapol/todo-list/internal/services"
 	"github.com/xNatthapol/todo-list/internal/utils"
@@ -36,7 +41,9 @@ import (
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
-// @description Type "Bearer" followed by a space and JWT token.
+// @description Type "Bearer" followed by a space and a JWT or personal access token.
+// @securityDefinitions.basic BasicAuth
+// @description Any username with a personal access token as password, for CalDAV clients.
 func main() {
 	cfg, err := config.LoadConfig(".")
 	if err != nil {
@@ -47,6 +54,14 @@ func main() {
 	if err != nil {
 		log.Fatalf("FATAL: Failed to initialize database: %v", err)
 	}
+	if err := repositories.RegisterTenantScope(db); err != nil {
+		log.Fatalf("FATAL: Failed to register tenant scope: %v", err)
+	}
+
+	keyRing, err := utils.NewKeyRing(cfg)
+	if err != nil {
+		log.Fatalf("FATAL: Failed to load JWT signing keys: %v", err)
+	}
 
 	var gcsUploader *utils.GCSUploader
 	if cfg.GCSBucketName != "" && cfg.GCSServiceAccountKeyPath != "" {
@@ -69,27 +84,164 @@ func main() {
 
 	userRepo := repositories.NewUserRepository(db)
 	todoRepo := repositories.NewTodoRepository(db)
+	importJobRepo := repositories.NewImportJobRepository(db)
+	accessTokenRepo := repositories.NewAccessTokenRepository(db)
+	recoveryCodeRepo := repositories.NewRecoveryCodeRepository(db)
+	securityEventRepo := repositories.NewSecurityEventRepository(db)
+	identityRepo := repositories.NewIdentityRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	adminRepo := repositories.NewAdminRepository(db)
+	accountRepo := repositories.NewAccountRepository(db)
+	workspaceRepo := repositories.NewWorkspaceRepository(db)
+	commentRepo := repositories.NewCommentRepository(db)
+	notificationRepo := repositories.NewNotificationRepository(db)
+	jobRepo := repositories.NewJobRepository(db)
+	pushRepo := repositories.NewPushRepository(db)
+	calDAVRepo := repositories.NewCalDAVRepository(db)
+	calendarFeedRepo := repositories.NewCalendarFeedRepository(db)
+	shareLinkRepo := repositories.NewShareLinkRepository(db)
+	statusRepo := repositories.NewStatusRepository(db)
+
+	var loginThrottleStore repositories.LoginThrottleStore
+	if cfg.LoginThrottleStore == "memory" {
+		loginThrottleStore = repositories.NewMemoryLoginThrottleStore()
+	} else {
+		loginThrottleStore = repositories.NewLoginThrottleRepository(db)
+	}
 
-	authService := services.NewAuthService(userRepo, cfg)
-	todoService := services.NewTodoService(todoRepo)
+	mfaSecrets, err := utils.NewSecretBox(cfg.MFAEncryptionKey)
+	if err != nil {
+		log.Fatalf("FATAL: Failed to initialize MFA secret encryption: %v", err)
+	}
+
+	vapidKeys, err := utils.LoadVAPIDKeys(cfg)
+	if err != nil {
+		log.Fatalf("FATAL: Failed to load VAPID keys: %v", err)
+	}
+
+	mailer, err := utils.NewMailer(cfg)
+	if err != nil {
+		log.Fatalf("FATAL: Failed to initialize mailer: %v", err)
+	}
+	eventBus := services.NewEventBus()
+
+	sessionService := services.NewSessionService(sessionRepo, keyRing, cfg)
+	loginGuard := services.NewLoginGuard(loginThrottleStore, userRepo, securityEventRepo, mailer, keyRing, cfg)
+	mfaService := services.NewMFAService(userRepo, recoveryCodeRepo, mfaSecrets, cfg)
+	authService := services.NewAuthService(userRepo, securityEventRepo, mfaService, loginGuard, sessionService, keyRing, cfg)
+	oidcService := services.NewOIDCService(userRepo, identityRepo, securityEventRepo, loginGuard, sessionService, keyRing, cfg)
+	todoService := services.NewTodoService(todoRepo, statusRepo, userRepo, workspaceRepo, eventBus, cfg)
 	uploadService := services.NewUploadService(gcsUploader)
+	commentService := services.NewCommentService(commentRepo, workspaceRepo, userRepo, todoService, eventBus)
+	syncService := services.NewSyncService(todoRepo, todoService)
+	calDAVService := services.NewCalDAVService(todoRepo, calDAVRepo, userRepo, todoService, cfg)
+	calendarFeedService := services.NewCalendarFeedService(calendarFeedRepo, todoRepo, cfg)
+	shareLinkService := services.NewShareLinkService(shareLinkRepo, todoRepo, workspaceRepo, todoService, gcsUploader, loginThrottleStore, cfg)
+	statusService := services.NewStatusService(statusRepo, todoRepo)
+	exportService := services.NewExportService(todoRepo, userRepo, cfg)
+	accessTokenService := services.NewAccessTokenService(accessTokenRepo)
+	profileService := services.NewProfileService(userRepo, securityEventRepo, sessionService, accessTokenService, mfaService, loginGuard, mailer, cfg)
+	adminService := services.NewAdminService(adminRepo, userRepo, securityEventRepo, sessionService, accessTokenService, loginGuard, mailer, cfg)
+	workspaceService := services.NewWorkspaceService(workspaceRepo, userRepo, eventBus, cfg)
+	jobQueue := services.NewJobQueue(jobRepo, cfg)
+	importService := services.NewImportService(todoRepo, statusRepo, importJobRepo, jobQueue, cfg)
+	pushService := services.NewPushService(pushRepo, utils.NewWebPushSender(vapidKeys, cfg.VAPIDSubject), vapidKeys, jobQueue, cfg)
+	notificationService := services.NewNotificationService(notificationRepo, todoRepo, workspaceRepo, userRepo, pushService)
+	eventBus.Subscribe(notificationService.HandleEvents)
+	accountService := services.NewAccountService(accountRepo, userRepo, securityEventRepo, exportService, sessionService, mfaService, loginGuard, gcsUploader, mailer, jobQueue, cfg)
+
+	digestService := services.NewDigestService(userRepo, todoRepo, jobQueue, mailer, cfg)
+	if err := services.RegisterJobs(jobQueue, todoService, syncService, importService, accountService, digestService, pushService, cfg); err != nil {
+		log.Fatalf("FATAL: Failed to register background jobs: %v", err)
+	}
+
+	// Administrative commands share the server's configuration and exit when done
+	if len(os.Args) > 1 {
+		if err := runCommand(context.Background(), os.Args[1:], cfg, loginGuard, adminService, jobQueue); err != nil {
+			log.Fatalf("FATAL: %v", err)
+		}
+		return
+	}
 
-	authHandler := handlers.NewAuthHandler(authService)
+	authHandler := handlers.NewAuthHandler(authService, loginGuard)
+	mfaHandler := handlers.NewMFAHandler(mfaService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService, cfg)
+	jwksHandler := handlers.NewJWKSHandler(keyRing)
 	todoHandler := handlers.NewTodoHandler(todoService)
 	uploadHandler := handlers.NewUploadHandler(uploadService)
+	syncHandler := handlers.NewSyncHandler(syncService)
+	exportHandler := handlers.NewExportHandler(exportService)
+	importHandler := handlers.NewImportHandler(importService)
+	accessTokenHandler := handlers.NewAccessTokenHandler(accessTokenService)
+	sessionHandler := handlers.NewSessionHandler(sessionService)
+	adminHandler := handlers.NewAdminHandler(adminService)
+	profileHandler := handlers.NewProfileHandler(profileService)
+	accountHandler := handlers.NewAccountHandler(accountService)
+	workspaceHandler := handlers.NewWorkspaceHandler(workspaceService)
+	commentHandler := handlers.NewCommentHandler(commentService)
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	digestHandler := handlers.NewDigestHandler(digestService)
+	pushHandler := handlers.NewPushHandler(pushService)
+	calDAVHandler := handlers.NewCalDAVHandler(calDAVService)
+	calendarFeedHandler := handlers.NewCalendarFeedHandler(calendarFeedService)
+	shareLinkHandler := handlers.NewShareLinkHandler(shareLinkService)
+	statusHandler := handlers.NewStatusHandler(statusService)
 
 	app := fiber.New(fiber.Config{
 		AppName: "TodoList App",
+		// Only the import route takes bodies this large; LimitBody holds the others to the default
+		BodyLimit:   services.MaxImportFileSize + 1024*1024,
+		ProxyHeader: cfg.ProxyHeader,
+		// CalDAV clients use the WebDAV methods PROPFIND and REPORT
+		RequestMethods: slices.Concat(fiber.DefaultMethods, handlers.DAVMethods),
 	})
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: cfg.CORSAllowedOrigins,
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-Workspace-ID, X-Share-Password",
 		AllowMethods: "GET, POST, PUT, PATCH, DELETE, OPTIONS",
 	}))
 	app.Use(logger.New())
-
-	handlers.SetupRoutes(app, authHandler, todoHandler, uploadHandler, cfg)
+	app.Use(middleware.LimitBody(fiber.DefaultBodyLimit, handlers.IsImportRequest))
+
+	handlers.SetupRoutes(
+		app,
+		authHandler,
+		mfaHandler,
+		oidcHandler,
+		jwksHandler,
+		todoHandler,
+		uploadHandler,
+		syncHandler,
+		exportHandler,
+		importHandler,
+		accessTokenHandler,
+		sessionHandler,
+		adminHandler,
+		profileHandler,
+		accountHandler,
+		workspaceHandler,
+		commentHandler,
+		notificationHandler,
+		digestHandler,
+		pushHandler,
+		calDAVHandler,
+		calendarFeedHandler,
+		shareLinkHandler,
+		statusHandler,
+		accessTokenService,
+		sessionService,
+		userRepo,
+		workspaceRepo,
+		keyRing,
+	)
+
+	// Reminders, account deletions and other maintenance run as jobs, here or in `worker` processes
+	if cfg.JobWorkerEmbedded {
+		go jobQueue.Run(context.Background())
+	} else {
+		log.Println("INFO: JOB_WORKER_EMBEDDED is false; background jobs only run in worker processes.")
+	}
 
 	log.Printf("INFO: Starting server on port %s", cfg.ServerPort)
 	if err := app.Listen(":" + cfg.ServerPort); err != nil {
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -11,22 +12,87 @@ import (
 
 const insecureDefaultJwtSecret = "insecure_jwt_secret_key_for_dev_only"
 
+const defaultOIDCScopes = "openid email profile"
+
+// OIDCProviderConfig configures one OpenID Connect provider, read from OIDC_<NAME>_* variables
+type OIDCProviderConfig struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
 type Config struct {
-	ServerPort               string        `mapstructure:"SERVER_PORT"`
-	DBHost                   string        `mapstructure:"DB_HOST"`
-	DBPort                   string        `mapstructure:"DB_PORT"`
-	DBUser                   string        `mapstructure:"DB_USER"`
-	DBPassword               string        `mapstructure:"DB_PASSWORD"`
-	DBName                   string        `mapstructure:"DB_NAME"`
-	DBSSLMode                string        `mapstructure:"DB_SSLMODE"`
-	TimeZone                 string        `mapstructure:"TIME_ZONE"`
-	PgAdminEmail             string        `mapstructure:"PGADMIN_DEFAULT_EMAIL"`
-	PgAdminPassword          string        `mapstructure:"PGADMIN_DEFAULT_PASSWORD"`
-	JWTSecret                string        `mapstructure:"JWT_SECRET"`
-	JWTExpiresInDuration     time.Duration `mapstructure:"JWT_EXPIRES_IN_MINUTES"`
-	CORSAllowedOrigins       string        `mapstructure:"CORS_ALLOWED_ORIGINS"`
-	GCSBucketName            string        `mapstructure:"GCS_BUCKET_NAME"`
-	GCSServiceAccountKeyPath string        `mapstructure:"GCS_SERVICE_ACCOUNT_KEY_PATH"`
+	ServerPort                 string        `mapstructure:"SERVER_PORT"`
+	DBHost                     string        `mapstructure:"DB_HOST"`
+	DBPort                     string        `mapstructure:"DB_PORT"`
+	DBUser                     string        `mapstructure:"DB_USER"`
+	DBPassword                 string        `mapstructure:"DB_PASSWORD"`
+	DBName                     string        `mapstructure:"DB_NAME"`
+	DBSSLMode                  string        `mapstructure:"DB_SSLMODE"`
+	TimeZone                   string        `mapstructure:"TIME_ZONE"`
+	PgAdminEmail               string        `mapstructure:"PGADMIN_DEFAULT_EMAIL"`
+	PgAdminPassword            string        `mapstructure:"PGADMIN_DEFAULT_PASSWORD"`
+	JWTSecret                  string        `mapstructure:"JWT_SECRET"`
+	JWTExpiresInDuration       time.Duration `mapstructure:"JWT_EXPIRES_IN_MINUTES"`
+	JWTSigningAlg              string        `mapstructure:"JWT_SIGNING_ALG"`
+	JWTKeysDir                 string        `mapstructure:"JWT_KEYS_DIR"`
+	JWTActiveKeyID             string        `mapstructure:"JWT_ACTIVE_KEY_ID"`
+	JWTAcceptHS256             bool          `mapstructure:"JWT_ACCEPT_HS256"`
+	SessionLastSeenInterval    time.Duration `mapstructure:"SESSION_LAST_SEEN_INTERVAL"`
+	ImpersonationExpiresIn     time.Duration `mapstructure:"IMPERSONATION_EXPIRES_IN"`
+	PasswordResetExpiresIn     time.Duration `mapstructure:"PASSWORD_RESET_EXPIRES_IN"`
+	EmailChangeExpiresIn       time.Duration `mapstructure:"EMAIL_CHANGE_EXPIRES_IN"`
+	ImportUploadDir            string        `mapstructure:"IMPORT_UPLOAD_DIR"`
+	DataExportDir              string        `mapstructure:"DATA_EXPORT_DIR"`
+	DataExportTTL              time.Duration `mapstructure:"DATA_EXPORT_TTL"`
+	AccountDeletionGracePeriod time.Duration `mapstructure:"ACCOUNT_DELETION_GRACE_PERIOD"`
+	AccountMaintenanceInterval time.Duration `mapstructure:"ACCOUNT_MAINTENANCE_INTERVAL"`
+	WorkspaceMaxMembers        int           `mapstructure:"WORKSPACE_MAX_MEMBERS"`
+	WorkspaceMaxTodos          int           `mapstructure:"WORKSPACE_MAX_TODOS"`
+	DueSoonWindow              time.Duration `mapstructure:"DUE_SOON_WINDOW"`
+	DueReminderInterval        time.Duration `mapstructure:"DUE_REMINDER_INTERVAL"`
+	AppEnv                     string        `mapstructure:"APP_ENV"`
+	MailTransport              string        `mapstructure:"MAIL_TRANSPORT"`
+	MailFrom                   string        `mapstructure:"MAIL_FROM"`
+	MailFileDir                string        `mapstructure:"MAIL_FILE_DIR"`
+	SMTPHost                   string        `mapstructure:"SMTP_HOST"`
+	SMTPPort                   string        `mapstructure:"SMTP_PORT"`
+	SMTPUsername               string        `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword               string        `mapstructure:"SMTP_PASSWORD"`
+	VAPIDPublicKey             string        `mapstructure:"VAPID_PUBLIC_KEY"`
+	VAPIDPrivateKey            string        `mapstructure:"VAPID_PRIVATE_KEY"`
+	VAPIDSubject               string        `mapstructure:"VAPID_SUBJECT"`
+	PushTTL                    time.Duration `mapstructure:"PUSH_TTL"`
+	ShareAttachmentURLTTL      time.Duration `mapstructure:"SHARE_ATTACHMENT_URL_TTL"`
+	DigestCheckInterval        time.Duration `mapstructure:"DIGEST_CHECK_INTERVAL"`
+	JobWorkerEmbedded          bool          `mapstructure:"JOB_WORKER_EMBEDDED"`
+	JobWorkerConcurrency       int           `mapstructure:"JOB_WORKER_CONCURRENCY"`
+	JobPollInterval            time.Duration `mapstructure:"JOB_POLL_INTERVAL"`
+	JobTimeout                 time.Duration `mapstructure:"JOB_TIMEOUT"`
+	JobMaxAttempts             int           `mapstructure:"JOB_MAX_ATTEMPTS"`
+	JobRetryBaseDelay          time.Duration `mapstructure:"JOB_RETRY_BASE_DELAY"`
+	JobRetention               time.Duration `mapstructure:"JOB_RETENTION"`
+	JobCleanupSchedule         string        `mapstructure:"JOB_CLEANUP_SCHEDULE"`
+	CORSAllowedOrigins         string        `mapstructure:"CORS_ALLOWED_ORIGINS"`
+	GCSBucketName              string        `mapstructure:"GCS_BUCKET_NAME"`
+	GCSServiceAccountKeyPath   string        `mapstructure:"GCS_SERVICE_ACCOUNT_KEY_PATH"`
+	MFAIssuer                  string        `mapstructure:"MFA_ISSUER"`
+	MFAEncryptionKey           string        `mapstructure:"MFA_ENCRYPTION_KEY"`
+	MFAPendingExpiresIn        time.Duration `mapstructure:"MFA_PENDING_EXPIRES_IN"`
+	ReauthMaxAge               time.Duration `mapstructure:"REAUTH_MAX_AGE"`
+	AppBaseURL                 string        `mapstructure:"APP_BASE_URL"`
+	ProxyHeader                string        `mapstructure:"PROXY_HEADER"`
+	LoginThrottleStore         string        `mapstructure:"LOGIN_THROTTLE_STORE"`
+	LoginMaxFailures           int           `mapstructure:"LOGIN_MAX_FAILURES"`
+	LoginIPMaxFailures         int           `mapstructure:"LOGIN_IP_MAX_FAILURES"`
+	LoginFailureWindow         time.Duration `mapstructure:"LOGIN_FAILURE_WINDOW"`
+	LoginLockoutDuration       time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	APIBaseURL                 string        `mapstructure:"API_BASE_URL"`
+	OIDCProviderNames          string        `mapstructure:"OIDC_PROVIDERS"`
+	OIDCProviders              []OIDCProviderConfig
 }
 
 var AppConfig *Config
@@ -49,7 +115,49 @@ func LoadConfig(path string) (*Config, error) {
 	viper.SetDefault("TIME_ZONE", "Asia/Bangkok")
 	viper.SetDefault("JWT_SECRET", insecureDefaultJwtSecret)
 	viper.SetDefault("JWT_EXPIRES_IN_MINUTES", "60m")
+	viper.SetDefault("JWT_SIGNING_ALG", "HS256")
+	viper.SetDefault("JWT_ACCEPT_HS256", true)
+	viper.SetDefault("SESSION_LAST_SEEN_INTERVAL", "5m")
+	viper.SetDefault("IMPERSONATION_EXPIRES_IN", "30m")
+	viper.SetDefault("PASSWORD_RESET_EXPIRES_IN", "24h")
+	viper.SetDefault("EMAIL_CHANGE_EXPIRES_IN", "24h")
+	viper.SetDefault("IMPORT_UPLOAD_DIR", "./data/imports")
+	viper.SetDefault("DATA_EXPORT_DIR", "./data/exports")
+	viper.SetDefault("DATA_EXPORT_TTL", "168h")
+	viper.SetDefault("ACCOUNT_DELETION_GRACE_PERIOD", "336h")
+	viper.SetDefault("ACCOUNT_MAINTENANCE_INTERVAL", "1h")
+	viper.SetDefault("WORKSPACE_MAX_MEMBERS", 50)
+	viper.SetDefault("WORKSPACE_MAX_TODOS", 10000)
+	viper.SetDefault("DUE_SOON_WINDOW", "24h")
+	viper.SetDefault("DUE_REMINDER_INTERVAL", "15m")
+	viper.SetDefault("APP_ENV", "production")
+	viper.SetDefault("MAIL_TRANSPORT", "file")
+	viper.SetDefault("MAIL_FROM", "TodoList <no-reply@localhost>")
+	viper.SetDefault("MAIL_FILE_DIR", "./data/mail")
+	viper.SetDefault("SMTP_PORT", "587")
+	viper.SetDefault("VAPID_SUBJECT", "mailto:admin@localhost")
+	viper.SetDefault("PUSH_TTL", "24h")
+	viper.SetDefault("SHARE_ATTACHMENT_URL_TTL", "15m")
+	viper.SetDefault("DIGEST_CHECK_INTERVAL", "5m")
+	viper.SetDefault("JOB_WORKER_EMBEDDED", true)
+	viper.SetDefault("JOB_WORKER_CONCURRENCY", 4)
+	viper.SetDefault("JOB_POLL_INTERVAL", "2s")
+	viper.SetDefault("JOB_TIMEOUT", "10m")
+	viper.SetDefault("JOB_MAX_ATTEMPTS", 5)
+	viper.SetDefault("JOB_RETRY_BASE_DELAY", "30s")
+	viper.SetDefault("JOB_RETENTION", "168h")
+	viper.SetDefault("JOB_CLEANUP_SCHEDULE", "0 3 * * *")
 	viper.SetDefault("CORS_ALLOWED_ORIGINS", "*")
+	viper.SetDefault("MFA_ISSUER", "TodoList")
+	viper.SetDefault("MFA_PENDING_EXPIRES_IN", "5m")
+	viper.SetDefault("REAUTH_MAX_AGE", "10m")
+	viper.SetDefault("APP_BASE_URL", "http://localhost:5173")
+	viper.SetDefault("LOGIN_THROTTLE_STORE", "database")
+	viper.SetDefault("LOGIN_MAX_FAILURES", 10)
+	viper.SetDefault("LOGIN_IP_MAX_FAILURES", 100)
+	viper.SetDefault("LOGIN_FAILURE_WINDOW", "15m")
+	viper.SetDefault("LOGIN_LOCKOUT_DURATION", "15m")
+	viper.SetDefault("API_BASE_URL", "http://localhost:8080")
 
 	if err := viper.ReadInConfig(); err == nil {
 		log.Println("INFO: Config file loaded successfully.")
@@ -69,6 +177,46 @@ func LoadConfig(path string) (*Config, error) {
 		log.Printf("!! WARNING: Using default insecure JWT_SECRET ('%s'). Set a proper secret in .env or environment variable for security. !!", insecureDefaultJwtSecret)
 	}
 
+	switch cfg.JWTSigningAlg {
+	case "HS256", "RS256", "EdDSA":
+	default:
+		return nil, fmt.Errorf("invalid JWT_SIGNING_ALG %q (expected HS256, RS256 or EdDSA)", cfg.JWTSigningAlg)
+	}
+
+	// TOTP secrets must outlive JWT_SECRET rotations, so they never share its key
+	if cfg.MFAEncryptionKey == "" {
+		return nil, fmt.Errorf("MFA_ENCRYPTION_KEY is required to encrypt TOTP secrets (deployments that relied on the JWT_SECRET fallback should set it to their current JWT_SECRET)")
+	}
+
+	switch cfg.MailTransport {
+	case "file":
+	case "log":
+		// Emails carry sign-in and reset links, which must not end up in production logs
+		if cfg.AppEnv != "development" {
+			return nil, fmt.Errorf("MAIL_TRANSPORT log is only allowed with APP_ENV=development")
+		}
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("MAIL_TRANSPORT smtp requires SMTP_HOST")
+		}
+	default:
+		return nil, fmt.Errorf("invalid MAIL_TRANSPORT %q (expected log, smtp or file)", cfg.MailTransport)
+	}
+
+	if cfg.JobPollInterval <= 0 || cfg.JobTimeout <= 0 {
+		return nil, fmt.Errorf("JOB_POLL_INTERVAL and JOB_TIMEOUT must be positive")
+	}
+
+	if cfg.LoginThrottleStore != "database" && cfg.LoginThrottleStore != "memory" {
+		return nil, fmt.Errorf("invalid LOGIN_THROTTLE_STORE %q (expected database or memory)", cfg.LoginThrottleStore)
+	}
+
+	providers, err := loadOIDCProviders(cfg.OIDCProviderNames)
+	if err != nil {
+		return nil, err
+	}
+	cfg.OIDCProviders = providers
+
 	if cfg.GCSBucketName == "" || cfg.GCSServiceAccountKeyPath == "" {
 		log.Println("WARNING: GCS_BUCKET_NAME or GCS_SERVICE_ACCOUNT_KEY_PATH not configured. Image upload functionality will be disabled.")
 	}
@@ -78,3 +226,32 @@ func LoadConfig(path string) (*Config, error) {
 
 	return &cfg, nil
 }
+
+// loadOIDCProviders reads the settings of each provider listed in OIDC_PROVIDERS
+func loadOIDCProviders(names string) ([]OIDCProviderConfig, error) {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		viper.SetDefault(prefix+"SCOPES", defaultOIDCScopes)
+		viper.SetDefault(prefix+"DISPLAY_NAME", name)
+		provider := OIDCProviderConfig{
+			Name:         name,
+			DisplayName:  viper.GetString(prefix + "DISPLAY_NAME"),
+			Issuer:       strings.TrimRight(viper.GetString(prefix+"ISSUER"), "/"),
+			ClientID:     viper.GetString(prefix + "CLIENT_ID"),
+			ClientSecret: viper.GetString(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(strings.ReplaceAll(viper.GetString(prefix+"SCOPES"), ",", " ")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %q requires %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		providers = append(providers, provider)
+		log.Printf("INFO: OIDC provider %q configured with issuer %s", name, provider.Issuer)
+	}
+	return providers, nil
+}
@@ -29,10 +29,20 @@ func ConnectDB(cfg *config.Config) (*gorm.DB, error) {
 
 	// Run migrations
 	log.Println("Running database migrations...")
-	err = db.AutoMigrate(&models.User{}, &models.Todo{})
+	// Lists defining their own statuses need existing data prepared once the tables exist
+	seedStatuses := !db.Migrator().HasTable(&models.StatusDefinition{})
+	numberTodos := !db.Migrator().HasColumn(&models.Todo{}, "Position")
+	err = db.AutoMigrate(&models.User{}, &models.Todo{}, &models.TodoChange{}, &models.SyncReceipt{}, &models.ImportJob{}, &models.PersonalAccessToken{}, &models.RecoveryCode{}, &models.LoginThrottle{}, &models.SecurityEvent{}, &models.UserIdentity{}, &models.Session{}, &models.DataExport{}, &models.DeletedAccount{}, &models.Workspace{}, &models.WorkspaceMember{}, &models.TodoWatcher{}, &models.TodoEvent{}, &models.Comment{}, &models.CommentMention{}, &models.Notification{}, &models.NotificationPreference{}, &models.Job{}, &models.JobSchedule{}, &models.PushSubscription{}, &models.CalDAVResource{}, &models.CalendarFeed{}, &models.ShareLink{}, &models.StatusDefinition{}, &models.StatusTransition{}, &models.TodoDependency{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
+
+	if err := backfillTodoChanges(db); err != nil {
+		return nil, fmt.Errorf("failed to backfill todo changes: %w", err)
+	}
+	if err := migrateStatuses(db, seedStatuses, numberTodos); err != nil {
+		return nil, fmt.Errorf("failed to migrate statuses: %w", err)
+	}
 	log.Println("Database migrated successfully")
 
 	// Assign to global variable
@@ -40,3 +50,72 @@ func ConnectDB(cfg *config.Config) (*gorm.DB, error) {
 
 	return db, nil
 }
+
+// backfillTodoChanges records a create change for todos written before the change log existed,
+// so a full sync (cursor 0) returns every todo.
+func backfillTodoChanges(db *gorm.DB) error {
+	result := db.Exec(`INSERT INTO todo_changes (created_at, todo_id, user_id, operation)
+		SELECT NOW(), t.id, t.user_id, ? FROM todos t
+		WHERE NOT EXISTS (SELECT 1 FROM todo_changes c WHERE c.todo_id = t.id)
+		ORDER BY t.id`, models.ChangeCreate)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("INFO: Backfilled %d todo changes", result.RowsAffected)
+	}
+	return nil
+}
+
+// migrateStatuses prepares data written before lists defined their own statuses. With seed, every
+// personal space and workspace gets the default statuses and done todos without a completion
+// time get one; with number, todos are numbered within their board columns in creation order.
+func migrateStatuses(db *gorm.DB, seed, number bool) error {
+	// Status names are unique per list, ignoring case
+	err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_status_definitions_scope_name
+		ON status_definitions (COALESCE(workspace_id, 0), COALESCE(user_id, 0), lower(name))`).Error
+	if err != nil {
+		return err
+	}
+
+	if seed {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, status := range models.DefaultStatuses() {
+				if err := tx.Exec(`INSERT INTO status_definitions (created_at, updated_at, user_id, name, color, position, is_done)
+					SELECT NOW(), NOW(), id, ?, ?, ?, ? FROM users`,
+					status.Name, status.Color, status.Position, status.IsDone).Error; err != nil {
+					return err
+				}
+				if err := tx.Exec(`INSERT INTO status_definitions (created_at, updated_at, workspace_id, name, color, position, is_done)
+					SELECT NOW(), NOW(), id, ?, ?, ?, ? FROM workspaces`,
+					status.Name, status.Color, status.Position, status.IsDone).Error; err != nil {
+					return err
+				}
+			}
+			result := tx.Exec(`UPDATE todos SET completed_at = updated_at WHERE status = ? AND completed_at IS NULL`, models.StatusDone)
+			if result.RowsAffected > 0 {
+				log.Printf("INFO: Backfilled completion times of %d done todos", result.RowsAffected)
+			}
+			return result.Error
+		})
+		if err != nil {
+			return err
+		}
+		log.Println("INFO: Seeded default statuses")
+	}
+
+	if number {
+		result := db.Exec(`UPDATE todos SET position = numbered.position
+			FROM (SELECT id, ROW_NUMBER() OVER (
+				PARTITION BY workspace_id, CASE WHEN workspace_id IS NULL THEN user_id END, status
+				ORDER BY created_at, id) - 1 AS position FROM todos) numbered
+			WHERE todos.id = numbered.id`)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("INFO: Numbered %d todos within their board columns", result.RowsAffected)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type AccessTokenHandler struct {
+	tokenService services.AccessTokenService
+	validate     *validator.Validate
+}
+
+func NewAccessTokenHandler(tokenService services.AccessTokenService) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		tokenService: tokenService,
+		validate:     validator.New(),
+	}
+}
+
+// CreateToken creates a personal access token
+// @Summary Create a personal access token
+// @Description Creates a token for scripts and integrations. The full token is returned only in this response; use it as a Bearer token.
+// @Tags Tokens
+// @Accept json
+// @Produce json
+// @Param token body models.CreateAccessTokenRequest true "Token name, scopes (todos:read, todos:write) and optional expiry"
+// @Security BearerAuth
+// @Success 201 {object} models.CreatedAccessTokenResponse "Token created"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid input"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Called with an access token"
+// @Failure 409 {object} ErrorResponse "Token limit reached"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /tokens [post]
+func (h *AccessTokenHandler) CreateToken(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.CreateAccessTokenRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing create token request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error during token creation: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	token, err := h.tokenService.CreateAccessToken(c.Context(), userID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		log.Printf("Error creating access token for user %d: %v", userID, err)
+		if errors.Is(err, services.ErrInvalidAccessTokenExpiry) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		}
+		if errors.Is(err, services.ErrTooManyAccessTokens) {
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to create access token"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(token)
+}
+
+// ListTokens lists the user's personal access tokens
+// @Summary List personal access tokens
+// @Description Lists the user's tokens with their scopes, expiry and last use. Token values are never returned.
+// @Tags Tokens
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.PersonalAccessToken "List of tokens"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Called with an access token"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /tokens [get]
+func (h *AccessTokenHandler) ListTokens(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	tokens, err := h.tokenService.ListAccessTokens(c.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing access tokens for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve access tokens"})
+	}
+
+	if tokens == nil {
+		tokens = []models.PersonalAccessToken{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(tokens)
+}
+
+// RevokeToken deletes a personal access token
+// @Summary Revoke a personal access token
+// @Description Revokes a token immediately.
+// @Tags Tokens
+// @Produce json
+// @Param id path int true "Token ID"
+// @Security BearerAuth
+// @Success 204 "No Content (Token revoked)"
+// @Failure 400 {object} ErrorResponse "Invalid ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Called with an access token"
+// @Failure 404 {object} ErrorResponse "Token not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /tokens/{id} [delete]
+func (h *AccessTokenHandler) RevokeToken(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	tokenIDStr := c.Params("id")
+	tokenID, err := strconv.ParseUint(tokenIDStr, 10, 32)
+	if err != nil {
+		log.Printf("Invalid token ID format: %s", tokenIDStr)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid token ID format"})
+	}
+
+	err = h.tokenService.RevokeAccessToken(c.Context(), userID, uint(tokenID))
+	if err != nil {
+		log.Printf("Error revoking access token %d for user %d: %v", tokenID, userID, err)
+		if errors.Is(err, services.ErrAccessTokenNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to revoke access token"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
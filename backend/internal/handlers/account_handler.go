@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AccountHandler struct {
+	accountService services.AccountService
+}
+
+func NewAccountHandler(accountService services.AccountService) *AccountHandler {
+	return &AccountHandler{accountService: accountService}
+}
+
+// StartDataExport starts building an archive of the user's personal data
+// @Summary Export personal data
+// @Description Starts a background job that builds a zip archive of the profile, todos, change history, sessions, tokens, linked identities, security events, comments, watched todos, notifications and their preferences, push subscriptions, share links, calendar feeds, workspace memberships and uploaded files. Poll the returned export until it is completed, then download it. Archives are deleted after DATA_EXPORT_TTL.
+// @Tags Profile
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} models.DataExport "Export started"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Called with an access token or while impersonating"
+// @Failure 409 {object} ErrorResponse "An export is already in progress"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /me/export [post]
+func (h *AccountHandler) StartDataExport(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	export, err := h.accountService.StartDataExport(c.Context(), userID, clientInfo(c))
+	if err != nil {
+		log.Printf("Error starting data export for user %d: %v", userID, err)
+		if errors.Is(err, services.ErrDataExportInProgress) {
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to start data export"})
+	}
+
+	c.Location(fmt.Sprintf("/api/me/export/%s", export.ID))
+	return c.Status(fiber.StatusAccepted).JSON(export)
+}
+
+// GetDataExport returns the status of a personal data export
+// @Summary Get data export
+// @Description Returns the status of a personal data export and, once completed, its size and expiry.
+// @Tags Profile
+// @Produce json
+// @Param id path string true "Data export ID"
+// @Security BearerAuth
+// @Success 200 {object} models.DataExport "Data export"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Called with an access token or while impersonating"
+// @Failure 404 {object} ErrorResponse "Data export not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /me/export/{id} [get]
+func (h *AccountHandler) GetDataExport(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	export, err := h.accountService.GetDataExport(c.Context(), userID, c.Params("id"))
+	if err != nil {
+		log.Printf("Error getting data export %s for user %d: %v", c.Params("id"), userID, err)
+		if errors.Is(err, services.ErrDataExportNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve data export"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(export)
+}
+
+// DownloadDataExport sends the archive of a completed personal data export
+// @Summary Download data export
+// @Description Downloads the zip archive of a completed personal data export.
+// @Tags Profile
+// @Produce application/zip
+// @Param id path string true "Data export ID"
+// @Security BearerAuth
+// @Success 200 {file} file "Personal data archive"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Called with an access token or while impersonating"
+// @Failure 404 {object} ErrorResponse "Data export not found or expired"
+// @Failure 409 {object} ErrorResponse "Data export not completed"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /me/export/{id}/download [get]
+func (h *AccountHandler) DownloadDataExport(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	export, err := h.accountService.OpenDataExport(c.Context(), userID, c.Params("id"))
+	if err != nil {
+		log.Printf("Error downloading data export %s for user %d: %v", c.Params("id"), userID, err)
+		switch {
+		case errors.Is(err, services.ErrDataExportNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, services.ErrDataExportNotReady):
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to download data export"})
+	}
+
+	filename := fmt.Sprintf("todolist-data-%s.zip", export.CreatedAt.UTC().Format("2006-01-02"))
+	return c.Download(export.FilePath, filename)
+}
+
+// DeleteAccount schedules the deletion of the authenticated user's account
+// @Summary Delete account
+// @Description Schedules the account for permanent deletion after a cooling-off period (ACCOUNT_DELETION_GRACE_PERIOD, 14 days by default). Until then the account works normally and the deletion can be cancelled. Deletion removes personal todos, history, uploaded files, tokens and sessions; only a hash of the email is kept. Todos created in workspaces stay with the team under a workspace owner. Workspaces of which the user is the only owner must be handed over first; those without other members are deleted.
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Param confirmation body models.DeleteAccountRequest true "Current password, or authentication code for accounts without one"
+// @Security BearerAuth
+// @Success 202 {object} models.AccountDeletionResponse "Deletion scheduled"
+// @Failure 400 {object} ErrorResponse "Invalid input"
+// @Failure 401 {object} ErrorResponse "Unauthorized, or current password or authentication code incorrect"
+// @Failure 403 {object} ErrorResponse "Called with an access token or while impersonating, or an account without a password has to sign in with its identity provider again"
+// @Failure 409 {object} ErrorResponse "Deletion already scheduled, or the user is the only owner of a workspace with other members"
+// @Failure 423 {object} ErrorResponse "Account locked after too many incorrect codes"
+// @Failure 429 {object} ErrorResponse "Too many incorrect codes"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /me [delete]
+func (h *AccountHandler) DeleteAccount(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	sessionID, _ := c.Locals(middleware.SessionIDKey).(string)
+
+	req := new(models.DeleteAccountRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing delete account request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	scheduledAt, err := h.accountService.ScheduleDeletion(c.Context(), userID, sessionID, req.Password, req.Code, clientInfo(c))
+	if err != nil {
+		log.Printf("Error scheduling deletion of user %d: %v", userID, err)
+		if handled, response := reauthErrorResponse(c, err); handled {
+			return response
+		}
+		switch {
+		case errors.Is(err, services.ErrDeletionAlreadyScheduled), errors.Is(err, services.ErrSoleWorkspaceOwner):
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to schedule account deletion"})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(models.AccountDeletionResponse{DeletionScheduledAt: scheduledAt})
+}
+
+// CancelAccountDeletion cancels a scheduled account deletion
+// @Summary Cancel account deletion
+// @Description Cancels the deletion of the account during its cooling-off period.
+// @Tags Profile
+// @Produce json
+// @Security BearerAuth
+// @Success 204 "Deletion cancelled"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Called with an access token or while impersonating"
+// @Failure 404 {object} ErrorResponse "No deletion scheduled"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /me/deletion [delete]
+func (h *AccountHandler) CancelAccountDeletion(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	if err := h.accountService.CancelDeletion(c.Context(), userID, clientInfo(c)); err != nil {
+		log.Printf("Error cancelling deletion of user %d: %v", userID, err)
+		if errors.Is(err, services.ErrDeletionNotScheduled) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to cancel account deletion"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
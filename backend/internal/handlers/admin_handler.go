@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type AdminHandler struct {
+	adminService services.AdminService
+	validate     *validator.Validate
+}
+
+func NewAdminHandler(adminService services.AdminService) *AdminHandler {
+	return &AdminHandler{
+		adminService: adminService,
+		validate:     validator.New(),
+	}
+}
+
+// ListUsers lists and searches users
+// @Summary List users
+// @Description Lists users ordered by ID, optionally filtered by an email substring, role and disabled state. Requires the admin role.
+// @Tags Admin
+// @Produce json
+// @Param q query string false "Email contains"
+// @Param role query string false "Role (user, admin)"
+// @Param disabled query bool false "Only disabled (true) or enabled (false) users"
+// @Param page query int false "Zero-based page number"
+// @Param page_size query int false "Users per page (default 50, max 200)"
+// @Security BearerAuth
+// @Success 200 {object} models.AdminUserListResponse "A page of users"
+// @Failure 400 {object} ErrorResponse "Invalid query parameters"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Not an administrator"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users [get]
+func (h *AdminHandler) ListUsers(c *fiber.Ctx) error {
+	filter := new(models.AdminUserFilter)
+	if err := c.QueryParser(filter); err != nil {
+		log.Printf("Error parsing admin user filter: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid query parameters"})
+	}
+
+	if err := h.validate.Struct(filter); err != nil {
+		log.Printf("Validation error listing users: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	users, err := h.adminService.ListUsers(c.Context(), *filter)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve users"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(users)
+}
+
+// GetUser returns one user
+// @Summary Get a user
+// @Description Returns a user's account details. Requires the admin role.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Security BearerAuth
+// @Success 200 {object} models.User "User"
+// @Failure 400 {object} ErrorResponse "Invalid user ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Not an administrator"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id} [get]
+func (h *AdminHandler) GetUser(c *fiber.Ctx) error {
+	userID, err := adminUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID format"})
+	}
+
+	user, err := h.adminService.GetUser(c.Context(), userID)
+	if err != nil {
+		return adminErrorResponse(c, err, "Failed to retrieve user")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(user)
+}
+
+// GetUserStats returns a user's usage statistics
+// @Summary Get user usage statistics
+// @Description Returns todo counts by status, access token, session and import job counts, and the last login and activity times. Requires the admin role.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Security BearerAuth
+// @Success 200 {object} models.UserStats "Usage statistics"
+// @Failure 400 {object} ErrorResponse "Invalid user ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Not an administrator"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/stats [get]
+func (h *AdminHandler) GetUserStats(c *fiber.Ctx) error {
+	userID, err := adminUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID format"})
+	}
+
+	stats, err := h.adminService.GetUserStats(c.Context(), userID)
+	if err != nil {
+		return adminErrorResponse(c, err, "Failed to retrieve user statistics")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(stats)
+}
+
+// DisableUser disables an account
+// @Summary Disable a user
+// @Description Blocks the user from logging in and signs out all of their sessions. Access tokens stop working while the account is disabled. Requires the admin role.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Security BearerAuth
+// @Success 200 {object} models.User "Disabled user"
+// @Failure 400 {object} ErrorResponse "Invalid user ID format or own account"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Not an administrator"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/disable [post]
+func (h *AdminHandler) DisableUser(c *fiber.Ctx) error {
+	return h.setUserDisabled(c, true)
+}
+
+// EnableUser re-enables a disabled account
+// @Summary Enable a user
+// @Description Allows a disabled user to log in again. Requires the admin role.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Security BearerAuth
+// @Success 200 {object} models.User "Enabled user"
+// @Failure 400 {object} ErrorResponse "Invalid user ID format or own account"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Not an administrator"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/enable [post]
+func (h *AdminHandler) EnableUser(c *fiber.Ctx) error {
+	return h.setUserDisabled(c, false)
+}
+
+func (h *AdminHandler) setUserDisabled(c *fiber.Ctx, disabled bool) error {
+	actorID := c.Locals(middleware.UserIDKey).(uint)
+	userID, err := adminUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID format"})
+	}
+
+	user, err := h.adminService.SetUserDisabled(c.Context(), actorID, userID, disabled, clientInfo(c))
+	if err != nil {
+		return adminErrorResponse(c, err, "Failed to update user")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(user)
+}
+
+// UpdateUserRole changes a user's role
+// @Summary Change a user's role
+// @Description Grants or removes the admin role. Administrators cannot change their own role. Requires the admin role.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param role body models.UpdateUserRoleRequest true "New role (user, admin)"
+// @Security BearerAuth
+// @Success 200 {object} models.User "Updated user"
+// @Failure 400 {object} ErrorResponse "Validation error, invalid input or own account"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Not an administrator"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/role [put]
+func (h *AdminHandler) UpdateUserRole(c *fiber.Ctx) error {
+	actorID := c.Locals(middleware.UserIDKey).(uint)
+	userID, err := adminUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID format"})
+	}
+
+	req := new(models.UpdateUserRoleRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing update role request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error updating role: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	user, err := h.adminService.SetUserRole(c.Context(), actorID, userID, req.Role, clientInfo(c))
+	if err != nil {
+		return adminErrorResponse(c, err, "Failed to update user role")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(user)
+}
+
+// ForcePasswordReset requires a user to choose a new password
+// @Summary Force a password reset
+// @Description Blocks password login, signs out all of the user's sessions, revokes their personal access tokens and emails a link to set a new password. Requires the admin role.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Security BearerAuth
+// @Success 204 "Password reset required"
+// @Failure 400 {object} ErrorResponse "Invalid user ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Not an administrator"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/password-reset [post]
+func (h *AdminHandler) ForcePasswordReset(c *fiber.Ctx) error {
+	actorID := c.Locals(middleware.UserIDKey).(uint)
+	userID, err := adminUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID format"})
+	}
+
+	if err := h.adminService.ForcePasswordReset(c.Context(), actorID, userID, clientInfo(c)); err != nil {
+		return adminErrorResponse(c, err, "Failed to force password reset")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// UnlockUser lifts a login lockout
+// @Summary Unlock a user
+// @Description Lifts a lockout caused by repeated failed logins. Requires the admin role.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Security BearerAuth
+// @Success 204 "Account unlocked"
+// @Failure 400 {object} ErrorResponse "Invalid user ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Not an administrator"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/unlock [post]
+func (h *AdminHandler) UnlockUser(c *fiber.Ctx) error {
+	actorID := c.Locals(middleware.UserIDKey).(uint)
+	userID, err := adminUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID format"})
+	}
+
+	if err := h.adminService.UnlockUser(c.Context(), actorID, userID, clientInfo(c)); err != nil {
+		return adminErrorResponse(c, err, "Failed to unlock user")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ImpersonateUser issues a token that acts as another user
+// @Summary Impersonate a user
+// @Description Starts a short-lived session as the user for support purposes. The token's act claim and the session name the administrator, and the start is recorded in the audit log. Administrators and disabled users cannot be impersonated. Requires the admin role.
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Security BearerAuth
+// @Success 200 {object} models.ImpersonationResponse "Impersonation token"
+// @Failure 400 {object} ErrorResponse "Invalid user ID format or own account"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Not an administrator, or the user cannot be impersonated"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/impersonate [post]
+func (h *AdminHandler) ImpersonateUser(c *fiber.Ctx) error {
+	actorID := c.Locals(middleware.UserIDKey).(uint)
+	userID, err := adminUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID format"})
+	}
+
+	resp, err := h.adminService.Impersonate(c.Context(), actorID, userID, clientInfo(c))
+	if err != nil {
+		return adminErrorResponse(c, err, "Failed to impersonate user")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// ListAuditEvents lists recent security events
+// @Summary List audit events
+// @Description Returns the newest security events, including every administrative action. With user_id, only events about or performed by that user. Requires the admin role.
+// @Tags Admin
+// @Produce json
+// @Param user_id query int false "Only events about or by this user"
+// @Param limit query int false "Maximum number of events (default and max 200)"
+// @Security BearerAuth
+// @Success 200 {array} models.SecurityEvent "Security events, newest first"
+// @Failure 400 {object} ErrorResponse "Invalid query parameters"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Not an administrator"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/audit-events [get]
+func (h *AdminHandler) ListAuditEvents(c *fiber.Ctx) error {
+	var userID *uint
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID format"})
+		}
+		uid := uint(id)
+		userID = &uid
+	}
+
+	events, err := h.adminService.ListSecurityEvents(c.Context(), userID, c.QueryInt("limit"))
+	if err != nil {
+		log.Printf("Error listing audit events: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve audit events"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(events)
+}
+
+func adminUserID(c *fiber.Ctx) (uint, error) {
+	userIDStr := c.Params("id")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		log.Printf("Invalid user ID format: %s", userIDStr)
+		return 0, err
+	}
+	return uint(userID), nil
+}
+
+func adminErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	log.Printf("Admin request failed: %v", err)
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrCannotModifySelf):
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrCannotImpersonateAdmin), errors.Is(err, services.ErrUserDisabled):
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: fallback})
+}
@@ -5,6 +5,9 @@ import (
 	"github.com/xNatthapol/todo-list/internal/models"
 	"github.com/xNatthapol/todo-list/internal/services"
 	"log"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
@@ -12,12 +15,14 @@ import (
 
 type AuthHandler struct {
 	authService services.AuthService
+	loginGuard  services.LoginGuard
 	validate    *validator.Validate
 }
 
-func NewAuthHandler(authService services.AuthService) *AuthHandler {
+func NewAuthHandler(authService services.AuthService, loginGuard services.LoginGuard) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
+		loginGuard:  loginGuard,
 		validate:    validator.New(),
 	}
 }
@@ -39,8 +44,11 @@ type LoginRequest struct {
 // AuthResponse defines the successful authentication response
 // @name AuthResponse
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  *models.User `json:"user"`
+	Token string       `json:"token,omitempty"`
+	User  *models.User `json:"user,omitempty"`
+	// MFARequired is set when the login must be completed at /auth/login/mfa with MFAToken
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
 }
 
 // SignUp handles for user sign up
@@ -82,7 +90,7 @@ func (h *AuthHandler) SignUp(c *fiber.Ctx) error {
 
 // Login handles user login
 // @Summary Log in a user
-// @Description Authenticates a user and returns a JWT token.
+// @Description Authenticates a user and returns a JWT token. When two-factor authentication is enabled, returns mfa_required and a short-lived mfa_token instead.
 // @Tags Auth
 // @Accept json
 // @Produce json
@@ -90,6 +98,9 @@ func (h *AuthHandler) SignUp(c *fiber.Ctx) error {
 // @Success 200 {object} AuthResponse "Login successful"
 // @Failure 400 {object} ErrorResponse "Validation error or invalid input"
 // @Failure 401 {object} ErrorResponse "Invalid credentials"
+// @Failure 403 {object} ErrorResponse "Account disabled or password reset required"
+// @Failure 423 {object} ErrorResponse "Account temporarily locked"
+// @Failure 429 {object} ErrorResponse "Too many failed attempts, retry after the Retry-After header"
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
@@ -105,12 +116,76 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
 	}
 
-	token, user, err := h.authService.LoginUser(c.Context(), req.Email, req.Password)
+	result, err := h.authService.LoginUser(c.Context(), req.Email, req.Password, clientInfo(c))
 	if err != nil {
 		log.Printf("Error logging in user %s: %v", req.Email, err)
+		var blocked *services.LoginBlockedError
+		if errors.As(err, &blocked) {
+			return loginBlockedResponse(c, blocked)
+		}
 		if errors.Is(err, services.ErrInvalidCredentials) {
 			return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: err.Error()})
 		}
+		if errors.Is(err, services.ErrAccountDisabled) || errors.Is(err, services.ErrPasswordResetRequired) {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to login user"})
+	}
+
+	if result.MFAToken != "" {
+		return c.Status(fiber.StatusOK).JSON(AuthResponse{
+			MFARequired: true,
+			MFAToken:    result.MFAToken,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(AuthResponse{
+		Token: result.Token,
+		User:  result.User,
+	})
+}
+
+// LoginMFA completes a two-factor login
+// @Summary Complete a two-factor login
+// @Description Exchanges the mfa_token from /auth/login and a TOTP or recovery code for a JWT token.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param credentials body models.MFALoginRequest true "MFA token and code"
+// @Success 200 {object} AuthResponse "Login successful"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid input"
+// @Failure 401 {object} ErrorResponse "Invalid or expired MFA token or code"
+// @Failure 403 {object} ErrorResponse "Account disabled"
+// @Failure 423 {object} ErrorResponse "Account temporarily locked"
+// @Failure 429 {object} ErrorResponse "Too many failed attempts, retry after the Retry-After header"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/login/mfa [post]
+func (h *AuthHandler) LoginMFA(c *fiber.Ctx) error {
+	req := new(models.MFALoginRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing MFA login request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error during MFA login: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	token, user, err := h.authService.CompleteMFALogin(c.Context(), req.MFAToken, req.Code, req.RecoveryCode, clientInfo(c))
+	if err != nil {
+		log.Printf("Error completing MFA login: %v", err)
+		var blocked *services.LoginBlockedError
+		if errors.As(err, &blocked) {
+			return loginBlockedResponse(c, blocked)
+		}
+		if errors.Is(err, services.ErrInvalidMFAToken) || errors.Is(err, services.ErrInvalidMFACode) || errors.Is(err, services.ErrMFANotEnabled) {
+			return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: err.Error()})
+		}
+		if errors.Is(err, services.ErrAccountDisabled) {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to login user"})
 	}
 
@@ -120,6 +195,98 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	})
 }
 
+// UnlockAccount handles unlocking an account with an emailed token
+// @Summary Unlock a locked account
+// @Description Lifts a lockout caused by repeated failed logins, using the token from the lockout email.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param unlock body models.UnlockAccountRequest true "Unlock token"
+// @Success 204 "Account unlocked"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid input"
+// @Failure 401 {object} ErrorResponse "Invalid or expired unlock token"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/unlock [post]
+func (h *AuthHandler) UnlockAccount(c *fiber.Ctx) error {
+	req := new(models.UnlockAccountRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing unlock request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error during account unlock: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	if err := h.loginGuard.UnlockWithToken(c.Context(), req.Token, clientInfo(c)); err != nil {
+		log.Printf("Error unlocking account: %v", err)
+		if errors.Is(err, services.ErrInvalidUnlockToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to unlock account"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ResetPassword handles setting a new password with an emailed reset token
+// @Summary Reset password
+// @Description Sets a new password using the token from a password reset email, then signs out every session.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param reset body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 204 "Password changed"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid input"
+// @Failure 401 {object} ErrorResponse "Invalid or expired reset token"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/password-reset [post]
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	req := new(models.ResetPasswordRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing password reset request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error during password reset: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	if err := h.authService.ResetPassword(c.Context(), req.Token, req.NewPassword, clientInfo(c)); err != nil {
+		log.Printf("Error resetting password: %v", err)
+		if errors.Is(err, services.ErrInvalidPasswordResetToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to reset password"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// maxUserAgentLength matches the column size used wherever the user agent is stored
+const maxUserAgentLength = 512
+
+func clientInfo(c *fiber.Ctx) models.ClientInfo {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+	return models.ClientInfo{IP: c.IP(), UserAgent: userAgent}
+}
+
+func loginBlockedResponse(c *fiber.Ctx, blocked *services.LoginBlockedError) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+	status := fiber.StatusTooManyRequests
+	if errors.Is(blocked, services.ErrAccountLocked) {
+		status = fiber.StatusLocked
+	}
+	return c.Status(status).JSON(ErrorResponse{Error: blocked.Error()})
+}
+
 // ErrorResponse defines the standard error response format
 // @name ErrorResponse
 type ErrorResponse struct {
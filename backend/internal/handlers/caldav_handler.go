@@ -0,0 +1,552 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	davNamespace       = "DAV:"
+	calDAVNamespace    = "urn:ietf:params:xml:ns:caldav"
+	calServerNamespace = "http://calendarserver.org/ns/"
+
+	// The principal and calendar paths use "me" since the credentials select the user
+	davRootPath       = "/dav/"
+	davPrincipalPath  = "/dav/principals/me/"
+	davHomePath       = "/dav/calendars/me/"
+	davCollectionPath = "/dav/calendars/me/todos/"
+
+	calendarContentType = "text/calendar; charset=utf-8; component=VTODO"
+)
+
+// DAVMethods are the WebDAV methods the app must accept in addition to fiber.DefaultMethods
+var DAVMethods = []string{"PROPFIND", "REPORT"}
+
+var (
+	davCalendarData     = xml.Name{Space: calDAVNamespace, Local: "calendar-data"}
+	davCalendarQuery    = xml.Name{Space: calDAVNamespace, Local: "calendar-query"}
+	davCalendarMultiget = xml.Name{Space: calDAVNamespace, Local: "calendar-multiget"}
+	davSyncCollection   = xml.Name{Space: davNamespace, Local: "sync-collection"}
+)
+
+// davProp is a property of a resource; Value holds its content as raw XML
+type davProp struct {
+	XMLName xml.Name
+	Value   string `xml:",innerxml"`
+}
+
+type davPropList struct {
+	Props []davProp `xml:",any"`
+}
+
+type davPropstat struct {
+	Prop   davPropList `xml:"prop"`
+	Status string      `xml:"status"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"href"`
+	Status    string        `xml:"status,omitempty"`
+	Propstats []davPropstat `xml:"propstat,omitempty"`
+}
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"DAV: multistatus"`
+	Responses []davResponse `xml:"response"`
+	SyncToken string        `xml:"sync-token,omitempty"`
+}
+
+// davPropfind is the body of a PROPFIND request; an empty body asks for all properties
+type davPropfind struct {
+	AllProp  *struct{}   `xml:"DAV: allprop"`
+	PropName *struct{}   `xml:"DAV: propname"`
+	Prop     davPropList `xml:"DAV: prop"`
+}
+
+// davReport is the body of the calendar-query, calendar-multiget and sync-collection reports
+type davReport struct {
+	XMLName   xml.Name
+	AllProp   *struct{}   `xml:"DAV: allprop"`
+	Prop      davPropList `xml:"DAV: prop"`
+	Hrefs     []string    `xml:"DAV: href"`
+	SyncToken string      `xml:"DAV: sync-token"`
+	Filter    struct {
+		CompFilter *models.CalDAVCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+// davPropRequest lists the properties a request asked for
+type davPropRequest struct {
+	allProp  bool
+	propName bool
+	names    []xml.Name
+}
+
+// davResource is a resource and all of its properties
+type davResource struct {
+	href  string
+	props []davProp
+}
+
+type CalDAVHandler struct {
+	calDAVService services.CalDAVService
+}
+
+func NewCalDAVHandler(calDAVService services.CalDAVService) *CalDAVHandler {
+	return &CalDAVHandler{calDAVService: calDAVService}
+}
+
+// WellKnown points CalDAV clients to the service root (RFC 6764)
+func (h *CalDAVHandler) WellKnown(c *fiber.Ctx) error {
+	return c.Redirect(davRootPath, fiber.StatusMovedPermanently)
+}
+
+// Options advertises CalDAV support; clients ask before authenticating
+func (h *CalDAVHandler) Options(c *fiber.Ctx) error {
+	c.Set("DAV", "1, 3, calendar-access")
+	c.Set(fiber.HeaderAllow, "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// Propfind returns the properties of the principal, the calendar home, the todo collection or a
+// todo, and with Depth 1 of the members of a collection
+func (h *CalDAVHandler) Propfind(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	var body davPropfind
+	if len(c.Body()) > 0 {
+		if err := xml.Unmarshal(c.Body(), &body); err != nil {
+			log.Printf("Error parsing PROPFIND body: %v", err)
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse XML"})
+		}
+	}
+	props := davPropRequest{allProp: body.AllProp != nil || len(c.Body()) == 0, propName: body.PropName != nil}
+	for _, prop := range body.Prop.Props {
+		props.names = append(props.names, prop.XMLName)
+	}
+	deep := c.Get("Depth", "infinity") != "0"
+
+	var resources []davResource
+	switch strings.TrimSuffix(c.Path(), "/") + "/" {
+	case davRootPath:
+		resources = append(resources, davRootResource())
+	case davPrincipalPath:
+		resources = append(resources, davPrincipalResource())
+	case davHomePath:
+		resources = append(resources, davHomeResource())
+		if deep {
+			collection, err := h.collectionResource(c)
+			if err != nil {
+				return h.internalError(c, userID, err)
+			}
+			resources = append(resources, collection)
+		}
+	case davCollectionPath:
+		collection, err := h.collectionResource(c)
+		if err != nil {
+			return h.internalError(c, userID, err)
+		}
+		resources = append(resources, collection)
+		if deep {
+			objects, err := h.calDAVService.ListObjects(c.Context(), userID, nil)
+			if err != nil {
+				return h.internalError(c, userID, err)
+			}
+			for _, object := range objects {
+				resources = append(resources, davObjectResource(object))
+			}
+		}
+	default:
+		name, ok := davObjectName(c.Path())
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Resource not found"})
+		}
+		object, err := h.calDAVService.GetObject(c.Context(), userID, name)
+		if err != nil {
+			return h.objectError(c, userID, err)
+		}
+		resources = append(resources, davObjectResource(*object))
+	}
+
+	multistatus := davMultistatus{}
+	for _, resource := range resources {
+		multistatus.Responses = append(multistatus.Responses, resource.response(props))
+	}
+	return sendMultistatus(c, multistatus)
+}
+
+// Report answers the calendar-query, calendar-multiget and sync-collection reports on the todo
+// collection
+func (h *CalDAVHandler) Report(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	var report davReport
+	if err := xml.Unmarshal(c.Body(), &report); err != nil {
+		log.Printf("Error parsing REPORT body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse XML"})
+	}
+	props := davPropRequest{allProp: report.AllProp != nil}
+	for _, prop := range report.Prop.Props {
+		props.names = append(props.names, prop.XMLName)
+	}
+	if !props.allProp && len(props.names) == 0 {
+		props.names = []xml.Name{{Space: davNamespace, Local: "getetag"}}
+	}
+
+	multistatus := davMultistatus{}
+	switch report.XMLName {
+	case davCalendarQuery:
+		objects, err := h.calDAVService.ListObjects(c.Context(), userID, report.Filter.CompFilter)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidCalendarQuery) {
+				return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+			}
+			return h.internalError(c, userID, err)
+		}
+		for _, object := range objects {
+			multistatus.Responses = append(multistatus.Responses, davObjectResource(object).response(props))
+		}
+
+	case davCalendarMultiget:
+		for _, href := range report.Hrefs {
+			name, ok := davObjectName(href)
+			if !ok {
+				multistatus.Responses = append(multistatus.Responses, davStatusResponse(href, fiber.StatusNotFound))
+				continue
+			}
+			object, err := h.calDAVService.GetObject(c.Context(), userID, name)
+			if errors.Is(err, services.ErrCalDAVObjectNotFound) {
+				multistatus.Responses = append(multistatus.Responses, davStatusResponse(href, fiber.StatusNotFound))
+				continue
+			}
+			if err != nil {
+				return h.internalError(c, userID, err)
+			}
+			multistatus.Responses = append(multistatus.Responses, davObjectResource(*object).response(props))
+		}
+
+	case davSyncCollection:
+		result, err := h.calDAVService.SyncCollection(c.Context(), userID, report.SyncToken)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidSyncToken) {
+				return sendDAVError(c, fiber.StatusForbidden, xml.Name{Space: davNamespace, Local: "valid-sync-token"})
+			}
+			return h.internalError(c, userID, err)
+		}
+		for _, object := range result.Changed {
+			multistatus.Responses = append(multistatus.Responses, davObjectResource(object).response(props))
+		}
+		for _, name := range result.Removed {
+			multistatus.Responses = append(multistatus.Responses, davStatusResponse(davObjectHref(name), fiber.StatusNotFound))
+		}
+		if result.Truncated {
+			multistatus.Responses = append(multistatus.Responses, davStatusResponse(davCollectionPath, fiber.StatusInsufficientStorage))
+		}
+		multistatus.SyncToken = result.SyncToken
+
+	default:
+		return sendDAVError(c, fiber.StatusForbidden, xml.Name{Space: davNamespace, Local: "supported-report"})
+	}
+
+	return sendMultistatus(c, multistatus)
+}
+
+// GetObject returns a todo as an iCalendar object
+// @Summary Get a todo as iCalendar
+// @Description Returns the todo stored under name in the CalDAV todo collection as a VCALENDAR holding one VTODO. Authenticate with an access token as the basic auth password.
+// @Tags CalDAV
+// @Produce plain
+// @Param name path string true "Resource name, such as todo-1.ics"
+// @Security BasicAuth
+// @Success 200 {string} string "iCalendar object"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing access token)"
+// @Failure 404 {object} ErrorResponse "Calendar object not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /dav/calendars/me/todos/{name} [get]
+func (h *CalDAVHandler) GetObject(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	name, err := url.PathUnescape(c.Params("name"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: services.ErrCalDAVObjectNotFound.Error()})
+	}
+
+	object, err := h.calDAVService.GetObject(c.Context(), userID, name)
+	if err != nil {
+		return h.objectError(c, userID, err)
+	}
+
+	c.Set(fiber.HeaderETag, object.ETag)
+	c.Set(fiber.HeaderLastModified, object.LastModified.UTC().Format(http.TimeFormat))
+	c.Set(fiber.HeaderContentType, calendarContentType)
+	return c.Status(fiber.StatusOK).Send(object.Data)
+}
+
+// PutObject creates or replaces a todo from an iCalendar object
+// @Summary Create or replace a todo from iCalendar
+// @Description Stores a VCALENDAR holding one VTODO under name. SUMMARY, DESCRIPTION, DUE and STATUS are applied with the same rules as the todo endpoints; other properties are not kept. If-Match and If-None-Match are honoured.
+// @Tags CalDAV
+// @Accept plain
+// @Param name path string true "Resource name"
+// @Security BasicAuth
+// @Success 201 "Todo created"
+// @Success 204 "Todo updated"
+// @Failure 400 {object} ErrorResponse "Invalid calendar object"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing access token)"
+// @Failure 403 {object} ErrorResponse "Missing scope, or the object is not a single VTODO"
+// @Failure 412 {object} ErrorResponse "Precondition failed"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /dav/calendars/me/todos/{name} [put]
+func (h *CalDAVHandler) PutObject(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	name, err := url.PathUnescape(c.Params("name"))
+	if err != nil || strings.Contains(name, "/") {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid resource name"})
+	}
+
+	created, err := h.calDAVService.PutObject(c.Context(), userID, name, c.Body(), davPreconditions(c))
+	if err != nil {
+		return h.objectError(c, userID, err)
+	}
+
+	// No ETag is returned since the stored object differs from the one sent, so clients fetch it
+	if created {
+		return c.SendStatus(fiber.StatusCreated)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// DeleteObject deletes a todo through the CalDAV collection
+// @Summary Delete a todo through CalDAV
+// @Description Deletes the todo stored under name. If-Match is honoured.
+// @Tags CalDAV
+// @Param name path string true "Resource name"
+// @Security BasicAuth
+// @Success 204 "Todo deleted"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing access token)"
+// @Failure 404 {object} ErrorResponse "Calendar object not found"
+// @Failure 412 {object} ErrorResponse "Precondition failed"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /dav/calendars/me/todos/{name} [delete]
+func (h *CalDAVHandler) DeleteObject(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	name, err := url.PathUnescape(c.Params("name"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: services.ErrCalDAVObjectNotFound.Error()})
+	}
+
+	if err := h.calDAVService.DeleteObject(c.Context(), userID, name, davPreconditions(c)); err != nil {
+		return h.objectError(c, userID, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// objectError maps errors of calendar object operations to responses
+func (h *CalDAVHandler) objectError(c *fiber.Ctx, userID uint, err error) error {
+	switch {
+	case errors.Is(err, services.ErrCalDAVObjectNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrCalDAVPrecondition):
+		return c.Status(fiber.StatusPreconditionFailed).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrInvalidCalendarObject):
+		log.Printf("Invalid calendar object from user %d: %v", userID, err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid calendar object", Details: err.Error()})
+	case errors.Is(err, services.ErrUnsupportedComponent):
+		return sendDAVError(c, fiber.StatusForbidden, xml.Name{Space: calDAVNamespace, Local: "supported-calendar-component"})
+	case errors.Is(err, services.ErrWorkspaceTodoQuota):
+		return c.Status(fiber.StatusInsufficientStorage).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrTransitionNotAllowed), errors.Is(err, services.ErrWIPLimitReached), errors.Is(err, services.ErrTodoBlocked):
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+	}
+	return h.internalError(c, userID, err)
+}
+
+func (h *CalDAVHandler) internalError(c *fiber.Ctx, userID uint, err error) error {
+	log.Printf("Error serving CalDAV %s %s for user %d: %v", c.Method(), c.Path(), userID, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to process CalDAV request"})
+}
+
+func davPreconditions(c *fiber.Ctx) models.CalDAVPreconditions {
+	return models.CalDAVPreconditions{IfMatch: c.Get(fiber.HeaderIfMatch), IfNoneMatch: c.Get(fiber.HeaderIfNoneMatch)}
+}
+
+// collectionResource describes the todo collection. Clients poll its CTag and sync token to
+// find out whether anything changed.
+func (h *CalDAVHandler) collectionResource(c *fiber.Ctx) (davResource, error) {
+	token, err := h.calDAVService.SyncToken(c.Context())
+	if err != nil {
+		return davResource{}, err
+	}
+
+	privileges := []string{"read"}
+	if accessToken, ok := c.Locals(middleware.AccessTokenKey).(*models.PersonalAccessToken); !ok || accessToken.HasScope(models.ScopeTodosWrite) {
+		privileges = append(privileges, "write", "write-content", "bind", "unbind")
+	}
+	var privilegeSet strings.Builder
+	for _, privilege := range privileges {
+		privilegeSet.WriteString(`<privilege xmlns="DAV:"><` + privilege + `/></privilege>`)
+	}
+
+	var reports strings.Builder
+	for _, report := range []xml.Name{davCalendarQuery, davCalendarMultiget, davSyncCollection} {
+		reports.WriteString(`<supported-report xmlns="DAV:"><report><` + report.Local + ` xmlns="` + report.Space + `"/></report></supported-report>`)
+	}
+
+	return davResource{href: davCollectionPath, props: []davProp{
+		davDAVProp("resourcetype", `<collection xmlns="DAV:"/><calendar xmlns="`+calDAVNamespace+`"/>`),
+		davDAVProp("displayname", "Todos"),
+		davDAVProp("current-user-principal", davHref(davPrincipalPath)),
+		davDAVProp("current-user-privilege-set", privilegeSet.String()),
+		davDAVProp("supported-report-set", reports.String()),
+		davDAVProp("sync-token", davText(token)),
+		{XMLName: xml.Name{Space: calServerNamespace, Local: "getctag"}, Value: davText(token)},
+		davCalDAVProp("supported-calendar-component-set", `<comp xmlns="`+calDAVNamespace+`" name="VTODO"/>`),
+	}}, nil
+}
+
+func davRootResource() davResource {
+	return davResource{href: davRootPath, props: []davProp{
+		davDAVProp("resourcetype", `<collection xmlns="DAV:"/>`),
+		davDAVProp("current-user-principal", davHref(davPrincipalPath)),
+	}}
+}
+
+func davPrincipalResource() davResource {
+	return davResource{href: davPrincipalPath, props: []davProp{
+		davDAVProp("resourcetype", `<collection xmlns="DAV:"/><principal xmlns="DAV:"/>`),
+		davDAVProp("current-user-principal", davHref(davPrincipalPath)),
+		davDAVProp("principal-URL", davHref(davPrincipalPath)),
+		davCalDAVProp("calendar-home-set", davHref(davHomePath)),
+	}}
+}
+
+func davHomeResource() davResource {
+	return davResource{href: davHomePath, props: []davProp{
+		davDAVProp("resourcetype", `<collection xmlns="DAV:"/>`),
+		davDAVProp("current-user-principal", davHref(davPrincipalPath)),
+	}}
+}
+
+func davObjectResource(object models.CalDAVObject) davResource {
+	return davResource{href: davObjectHref(object.Name), props: []davProp{
+		davDAVProp("resourcetype", ""),
+		davDAVProp("getetag", davText(object.ETag)),
+		davDAVProp("getcontenttype", calendarContentType),
+		davDAVProp("getlastmodified", object.LastModified.UTC().Format(http.TimeFormat)),
+		{XMLName: davCalendarData, Value: davText(string(object.Data))},
+	}}
+}
+
+// response reports the requested properties of the resource. Calendar data is only returned
+// when asked for by name.
+func (r davResource) response(req davPropRequest) davResponse {
+	var found, missing []davProp
+	switch {
+	case req.propName:
+		for _, prop := range r.props {
+			found = append(found, davProp{XMLName: prop.XMLName})
+		}
+	case req.allProp:
+		for _, prop := range r.props {
+			if prop.XMLName != davCalendarData {
+				found = append(found, prop)
+			}
+		}
+	default:
+		for _, name := range req.names {
+			prop, ok := r.prop(name)
+			if ok {
+				found = append(found, prop)
+			} else {
+				missing = append(missing, davProp{XMLName: name})
+			}
+		}
+	}
+
+	response := davResponse{Href: r.href}
+	if len(found) > 0 || len(missing) == 0 {
+		response.Propstats = append(response.Propstats, davPropstat{Prop: davPropList{Props: found}, Status: davStatus(fiber.StatusOK)})
+	}
+	if len(missing) > 0 {
+		response.Propstats = append(response.Propstats, davPropstat{Prop: davPropList{Props: missing}, Status: davStatus(fiber.StatusNotFound)})
+	}
+	return response
+}
+
+func (r davResource) prop(name xml.Name) (davProp, bool) {
+	for _, prop := range r.props {
+		if prop.XMLName == name {
+			return prop, true
+		}
+	}
+	return davProp{}, false
+}
+
+func davDAVProp(name, value string) davProp {
+	return davProp{XMLName: xml.Name{Space: davNamespace, Local: name}, Value: value}
+}
+
+func davCalDAVProp(name, value string) davProp {
+	return davProp{XMLName: xml.Name{Space: calDAVNamespace, Local: name}, Value: value}
+}
+
+func davText(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func davHref(path string) string {
+	return `<href xmlns="DAV:">` + davText(path) + `</href>`
+}
+
+func davStatus(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+func davStatusResponse(href string, code int) davResponse {
+	return davResponse{Href: href, Status: davStatus(code)}
+}
+
+func davObjectHref(name string) string {
+	return davCollectionPath + url.PathEscape(name)
+}
+
+// davObjectName extracts the resource name from the path or URL of a todo in the collection
+func davObjectName(href string) (string, bool) {
+	parsed, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	href = parsed.Path
+	name, ok := strings.CutPrefix(href, davCollectionPath)
+	if !ok || name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+	return name, true
+}
+
+func sendMultistatus(c *fiber.Ctx, multistatus davMultistatus) error {
+	body, err := xml.Marshal(multistatus)
+	if err != nil {
+		log.Printf("Error encoding CalDAV multistatus: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to process CalDAV request"})
+	}
+	c.Set(fiber.HeaderContentType, "application/xml; charset=utf-8")
+	return c.Status(fiber.StatusMultiStatus).Send(append([]byte(xml.Header), body...))
+}
+
+// sendDAVError reports a failed WebDAV precondition or postcondition (RFC 4918, 16)
+func sendDAVError(c *fiber.Ctx, status int, condition xml.Name) error {
+	c.Set(fiber.HeaderContentType, "application/xml; charset=utf-8")
+	return c.Status(status).SendString(xml.Header + `<error xmlns="DAV:"><` + condition.Local + ` xmlns="` + condition.Space + `"/></error>`)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type CalendarFeedHandler struct {
+	feedService services.CalendarFeedService
+	validate    *validator.Validate
+}
+
+func NewCalendarFeedHandler(feedService services.CalendarFeedService) *CalendarFeedHandler {
+	return &CalendarFeedHandler{
+		feedService: feedService,
+		validate:    validator.New(),
+	}
+}
+
+// GetFeed returns the user's calendar feed
+// @Summary Get the calendar feed
+// @Description Returns the user's calendar feed, identified by the first characters of its URL token. The full URL is only shown when the feed is created.
+// @Tags Profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.CalendarFeed "Calendar feed"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 404 {object} ErrorResponse "No calendar feed"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /me/calendar-feed [get]
+func (h *CalendarFeedHandler) GetFeed(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	feed, err := h.feedService.GetFeed(c.Context(), userID)
+	if err != nil {
+		if errors.Is(err, services.ErrCalendarFeedNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		}
+		log.Printf("Error retrieving calendar feed of user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve calendar feed"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(feed)
+}
+
+// CreateFeed issues a new calendar feed URL
+// @Summary Create the calendar feed URL
+// @Description Issues a secret URL of a read-only iCalendar feed of the user's personal todos that have a due date, for subscribing from calendar apps. The URL is only returned here; creating a new one revokes the previous URL. Append ?status= to only include todos with that status and ?component=todo to get VTODOs instead of all-day or timed VEVENTs.
+// @Tags Profile
+// @Produce json
+// @Security BearerAuth
+// @Success 201 {object} models.CreatedCalendarFeedResponse "Calendar feed created"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /me/calendar-feed [post]
+func (h *CalendarFeedHandler) CreateFeed(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	created, err := h.feedService.CreateFeed(c.Context(), userID)
+	if err != nil {
+		log.Printf("Error creating calendar feed for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to create calendar feed"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// RevokeFeed revokes the calendar feed URL
+// @Summary Revoke the calendar feed URL
+// @Description Revokes the user's calendar feed URL. Calendar apps subscribed to it stop receiving updates.
+// @Tags Profile
+// @Security BearerAuth
+// @Success 204 "Calendar feed revoked"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 404 {object} ErrorResponse "No calendar feed"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /me/calendar-feed [delete]
+func (h *CalendarFeedHandler) RevokeFeed(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	if err := h.feedService.RevokeFeed(c.Context(), userID); err != nil {
+		if errors.Is(err, services.ErrCalendarFeedNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		}
+		log.Printf("Error revoking calendar feed of user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to revoke calendar feed"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ServeFeed serves a calendar feed to calendar apps
+// @Summary Get a calendar feed
+// @Description Serves the iCalendar feed behind a secret feed URL without signing in. Times are given in the user's timezone with a matching VTIMEZONE. ETag and Last-Modified are set, and conditional requests are answered with 304 Not Modified.
+// @Tags Profile
+// @Produce text/calendar
+// @Param token path string true "Feed token from the feed URL"
+// @Param status query string false "Only include todos with this status, one of the list's statuses"
+// @Param component query string false "Publish due dates as VEVENTs (event, default) or as VTODOs (todo)" Enums(event, todo)
+// @Success 200 {string} string "iCalendar feed"
+// @Success 304 "Not modified"
+// @Failure 400 {object} ErrorResponse "Invalid query parameters"
+// @Failure 404 {object} ErrorResponse "Invalid or revoked feed URL"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /calendar/{token}.ics [get]
+func (h *CalendarFeedHandler) ServeFeed(c *fiber.Ctx) error {
+	query := new(models.CalendarFeedQuery)
+	if err := c.QueryParser(query); err != nil {
+		log.Printf("Error parsing calendar feed query: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid query parameters"})
+	}
+
+	if err := h.validate.Struct(query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	snapshot, err := h.feedService.OpenFeed(c.Context(), c.Params("token"), *query)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidCalendarFeedToken):
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, services.ErrCalendarFeedLabelFilter):
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		}
+		log.Printf("Error opening calendar feed: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve calendar feed"})
+	}
+
+	c.Set(fiber.HeaderETag, snapshot.ETag)
+	c.Set(fiber.HeaderLastModified, snapshot.LastModified.Format(http.TimeFormat))
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	if c.Fresh() {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	var buf bytes.Buffer
+	if err := h.feedService.WriteFeed(c.Context(), snapshot, &buf); err != nil {
+		log.Printf("Error writing calendar feed of user %d: %v", snapshot.UserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve calendar feed"})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	return c.Status(fiber.StatusOK).Send(buf.Bytes())
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type CommentHandler struct {
+	commentService services.CommentService
+	validate       *validator.Validate
+}
+
+func NewCommentHandler(commentService services.CommentService) *CommentHandler {
+	return &CommentHandler{
+		commentService: commentService,
+		validate:       validator.New(),
+	}
+}
+
+// ListComments lists the comments of a todo item
+// @Summary List comments
+// @Description Lists a page of the todo's top-level comments, oldest first, each with its replies.
+// @Tags Comments
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param page query int false "Zero-based page number"
+// @Param page_size query int false "Top-level comments per page (default 20, max 100)"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.CommentListResponse "Page of comments"
+// @Failure 400 {object} ErrorResponse "Invalid ID format or query parameters"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Todo not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/{id}/comments [get]
+func (h *CommentHandler) ListComments(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	todoID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid todo ID format: %s", c.Params("id"))
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid todo ID format"})
+	}
+
+	filter := new(models.CommentFilter)
+	if err := c.QueryParser(filter); err != nil {
+		log.Printf("Error parsing comment filter: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid query parameters"})
+	}
+
+	if err := h.validate.Struct(filter); err != nil {
+		log.Printf("Validation error in comment filter: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	comments, err := h.commentService.ListComments(c.Context(), userID, uint(todoID), *filter)
+	if err != nil {
+		log.Printf("Error listing comments of todo ID %d for user %d: %v", todoID, userID, err)
+		return commentErrorResponse(c, err, "Failed to retrieve comments")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(comments)
+}
+
+// CreateComment adds a comment to a todo item
+// @Summary Comment on a todo
+// @Description Adds a comment, or a reply when parent_id is set. @email and @name mentions of users with access to the todo are recorded.
+// @Tags Comments
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param comment body models.CreateCommentRequest true "Comment"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 201 {object} models.Comment "Comment created"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid parent comment"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Todo not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/{id}/comments [post]
+func (h *CommentHandler) CreateComment(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	todoID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid todo ID format: %s", c.Params("id"))
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid todo ID format"})
+	}
+
+	req := new(models.CreateCommentRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing create comment request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error creating comment: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	comment, err := h.commentService.CreateComment(c.Context(), userID, uint(todoID), *req)
+	if err != nil {
+		log.Printf("Error commenting on todo ID %d for user %d: %v", todoID, userID, err)
+		return commentErrorResponse(c, err, "Failed to create comment")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(comment)
+}
+
+// UpdateComment edits a comment
+// @Summary Edit a comment
+// @Description Replaces the body of the caller's own comment and marks it as edited. Newly mentioned users are recorded.
+// @Tags Comments
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param commentID path int true "Comment ID"
+// @Param comment body models.UpdateCommentRequest true "New body"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.Comment "Comment updated"
+// @Failure 400 {object} ErrorResponse "Invalid ID format or validation error"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not the author"
+// @Failure 404 {object} ErrorResponse "Todo or comment not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/{id}/comments/{commentID} [patch]
+func (h *CommentHandler) UpdateComment(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	todoID, commentID, err := commentPathIDs(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid todo or comment ID format"})
+	}
+
+	req := new(models.UpdateCommentRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing update comment request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error updating comment: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	comment, err := h.commentService.UpdateComment(c.Context(), userID, todoID, commentID, req.Body)
+	if err != nil {
+		log.Printf("Error updating comment %d for user %d: %v", commentID, userID, err)
+		return commentErrorResponse(c, err, "Failed to update comment")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(comment)
+}
+
+// DeleteComment removes a comment
+// @Summary Delete a comment
+// @Description Deletes a comment. Authors can delete their own comments and workspace owners and admins any comment. A comment with replies is kept as a deleted placeholder.
+// @Tags Comments
+// @Param id path int true "Todo ID"
+// @Param commentID path int true "Comment ID"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 204 "Comment deleted"
+// @Failure 400 {object} ErrorResponse "Invalid ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not allowed to delete this comment"
+// @Failure 404 {object} ErrorResponse "Todo or comment not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/{id}/comments/{commentID} [delete]
+func (h *CommentHandler) DeleteComment(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	todoID, commentID, err := commentPathIDs(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid todo or comment ID format"})
+	}
+
+	if err := h.commentService.DeleteComment(c.Context(), userID, todoID, commentID); err != nil {
+		log.Printf("Error deleting comment %d for user %d: %v", commentID, userID, err)
+		return commentErrorResponse(c, err, "Failed to delete comment")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func commentPathIDs(c *fiber.Ctx) (uint, uint, error) {
+	todoID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid todo ID format: %s", c.Params("id"))
+		return 0, 0, err
+	}
+	commentID, err := strconv.ParseUint(c.Params("commentID"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid comment ID format: %s", c.Params("commentID"))
+		return 0, 0, err
+	}
+	return uint(todoID), uint(commentID), nil
+}
+
+func commentErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, services.ErrTodoNotFound), errors.Is(err, services.ErrCommentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrForbidden), errors.Is(err, services.ErrCommentPermission):
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrInvalidParentComment):
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: fallback})
+}
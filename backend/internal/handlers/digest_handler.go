@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"html/template"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// unsubscribeConfirmPage only asks for confirmation, so mail scanners and link prefetchers that
+// follow the link do not unsubscribe anyone; its form posts back to the same signed URL
+var unsubscribeConfirmPage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Unsubscribe from the daily digest</title>
+</head>
+<body>
+<p>Stop receiving the daily digest email? You can turn it back on in your settings.</p>
+<form method="post" action="?token={{.}}"><button type="submit">Unsubscribe</button></form>
+</body>
+</html>
+`))
+
+type DigestHandler struct {
+	digestService services.DigestService
+}
+
+func NewDigestHandler(digestService services.DigestService) *DigestHandler {
+	return &DigestHandler{digestService: digestService}
+}
+
+// ConfirmUnsubscribe shows the page the unsubscribe link in a digest email opens
+// @Summary Confirm unsubscribing from the daily digest
+// @Description Answers the link in the email body with a page whose button unsubscribes through POST. Opening the link changes nothing, so mail scanners that follow it do not unsubscribe the user.
+// @Tags Profile
+// @Produce html
+// @Param token query string true "Signed token from the digest email"
+// @Success 200 {string} string "Confirmation page"
+// @Router /digest/unsubscribe [get]
+func (h *DigestHandler) ConfirmUnsubscribe(c *fiber.Ctx) error {
+	c.Type("html", "utf-8")
+	return unsubscribeConfirmPage.Execute(c.Status(fiber.StatusOK), c.Query("token"))
+}
+
+// Unsubscribe turns off the daily digest through the signed link in a digest email
+// @Summary Unsubscribe from the daily digest
+// @Description Turns off the daily digest email of the user the signed link was sent to, without signing in. Serves the confirmation page's button and one-click unsubscribe from mail clients (RFC 8058).
+// @Tags Profile
+// @Produce plain
+// @Param token query string true "Signed token from the digest email"
+// @Success 200 {string} string "Unsubscribed"
+// @Failure 400 {object} ErrorResponse "Invalid unsubscribe link"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /digest/unsubscribe [post]
+func (h *DigestHandler) Unsubscribe(c *fiber.Ctx) error {
+	if err := h.digestService.Unsubscribe(c.Context(), c.Query("token")); err != nil {
+		log.Printf("Error unsubscribing from the daily digest: %v", err)
+		if errors.Is(err, services.ErrInvalidUnsubscribeToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to unsubscribe"})
+	}
+
+	return c.Status(fiber.StatusOK).SendString("You have been unsubscribed from the daily digest. You can turn it back on in your settings.")
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type recordingDigestService struct {
+	services.DigestService
+	unsubscribed []string
+}
+
+func (s *recordingDigestService) Unsubscribe(_ context.Context, token string) error {
+	s.unsubscribed = append(s.unsubscribed, token)
+	return nil
+}
+
+func TestDigestUnsubscribeOnlyChangesStateOnPost(t *testing.T) {
+	digest := &recordingDigestService{}
+	handler := NewDigestHandler(digest)
+	app := fiber.New()
+	app.Get("/digest/unsubscribe", handler.ConfirmUnsubscribe)
+	app.Post("/digest/unsubscribe", handler.Unsubscribe)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/digest/unsubscribe?token=a%2Bb%22", nil))
+	if err != nil {
+		t.Fatalf("GET request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusOK || !strings.Contains(string(body), `action="?token=a%2bb%22"`) {
+		t.Fatalf("GET got %d %q, want 200 with a form posting the token back", resp.StatusCode, body)
+	}
+	if len(digest.unsubscribed) != 0 {
+		t.Fatalf("GET unsubscribed %v", digest.unsubscribed)
+	}
+
+	// Mail clients send the RFC 8058 body to the URL from List-Unsubscribe
+	req := httptest.NewRequest("POST", "/digest/unsubscribe?token=a%2Bb%22", strings.NewReader("List-Unsubscribe=One-Click"))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("POST request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK || len(digest.unsubscribed) != 1 || digest.unsubscribed[0] != `a+b"` {
+		t.Fatalf("POST got %d and unsubscribed %v, want 200 and one unsubscribe", resp.StatusCode, digest.unsubscribed)
+	}
+}
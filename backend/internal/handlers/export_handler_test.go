@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// scopedExportService writes the tenant its context is scoped to, and fails like the tenant
+// scope of the repositories does when there is none
+type scopedExportService struct{}
+
+func (scopedExportService) ExportTodos(ctx context.Context, userID uint, _ models.ExportFormat, _ models.TodoFilter, w io.Writer) error {
+	tenant, ok := repositories.TenantFromContext(ctx)
+	if !ok {
+		return repositories.ErrMissingTenant
+	}
+	workspace := "personal"
+	if tenant.WorkspaceID != nil {
+		workspace = fmt.Sprint(*tenant.WorkspaceID)
+	}
+	_, err := fmt.Fprintf(w, "user %d tenant %d/%s", userID, tenant.UserID, workspace)
+	return err
+}
+
+func TestExportTodosStreamsWithinRequestTenant(t *testing.T) {
+	workspaceID := uint(4)
+	for name, tenant := range map[string]models.Tenant{
+		"personal":  {UserID: 7},
+		"workspace": {UserID: 7, WorkspaceID: &workspaceID},
+	} {
+		t.Run(name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				c.Locals(middleware.UserIDKey, uint(7))
+				c.Locals(repositories.TenantKey, tenant)
+				return c.Next()
+			})
+			app.Get("/todos/export", NewExportHandler(scopedExportService{}).ExportTodos)
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/todos/export?format=json", nil))
+			if err != nil {
+				t.Fatalf("export request: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+
+			want := "user 7 tenant 7/personal"
+			if tenant.WorkspaceID != nil {
+				want = "user 7 tenant 7/4"
+			}
+			if resp.StatusCode != fiber.StatusOK || string(body) != want {
+				t.Fatalf("got %d %q, want 200 %q", resp.StatusCode, body, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+	"mime/multipart"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ImportHandler struct {
+	importService services.ImportService
+	validate      *validator.Validate
+}
+
+func NewImportHandler(importService services.ImportService) *ImportHandler {
+	return &ImportHandler{
+		importService: importService,
+		validate:      validator.New(),
+	}
+}
+
+// ImportTodos imports todos from an uploaded file
+// @Summary Import todo items
+// @Description Imports todos from CSV (with optional column mapping), this app's JSON export, a Todoist CSV export or a Trello board JSON export. Rows are validated like created todos and imported in a single transaction; nothing is imported if any row is invalid. Files larger than 1MB are imported by a background job whose progress can be polled.
+// @Tags Todos
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "File to import (max 20MB)"
+// @Param format formData string true "File format" Enums(csv, json, todoist, trello)
+// @Param mapping formData string false "JSON object mapping title, description, status, due_date and image_url to CSV column names"
+// @Param dry_run formData bool false "Validate and preview without importing"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.ImportResult "Import or dry-run result"
+// @Success 202 {object} models.ImportJob "Import job started"
+// @Failure 400 {object} ErrorResponse "Missing file, invalid format, mapping or file"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Read-only workspace role or workspace todo limit reached"
+// @Failure 422 {object} models.ImportResult "Some rows are invalid; nothing was imported"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/import [post]
+func (h *ImportHandler) ImportTodos(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.ImportRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing import form: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse form data"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error during import: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		log.Printf("ERROR: Handler error getting import file from form: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Missing 'file' in form data"})
+	}
+	if fileHeader.Size > services.MaxImportFileSize {
+		log.Printf("WARNING: Import rejected. File size exceeds limit: %d > %d", fileHeader.Size, services.MaxImportFileSize)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: fmt.Sprintf("File size exceeds the limit of %dMB", services.MaxImportFileSize/1024/1024)})
+	}
+
+	if fileHeader.Size > services.AsyncImportThreshold {
+		return h.startImportJob(c, userID, req, fileHeader)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Printf("ERROR: Failed to open import file: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Could not process file upload"})
+	}
+	defer file.Close()
+
+	result, err := h.importService.ImportTodos(c.Context(), userID, *req, file)
+	if err != nil {
+		return importErrorResponse(c, userID, err)
+	}
+
+	if result.ErrorCount > 0 && !result.DryRun {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(result)
+	}
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// startImportJob hands the upload to a background job, which deletes its copy when done
+func (h *ImportHandler) startImportJob(c *fiber.Ctx, userID uint, req *models.ImportRequest, fileHeader *multipart.FileHeader) error {
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Printf("ERROR: Failed to open import file: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Could not process file upload"})
+	}
+	defer file.Close()
+
+	job, err := h.importService.StartImportJob(c.Context(), userID, *req, fileHeader.Filename, file)
+	if err != nil {
+		log.Printf("ERROR: Failed to start import job for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to start import"})
+	}
+
+	c.Location(fmt.Sprintf("/api/todos/import/jobs/%s", job.ID))
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// IsImportRequest reports whether c uploads a file to the import endpoint, the only route that
+// accepts bodies above the default limit
+func IsImportRequest(c *fiber.Ctx) bool {
+	return c.Method() == fiber.MethodPost && strings.HasSuffix(strings.TrimSuffix(c.Path(), "/"), "/todos/import")
+}
+
+// GetImportJob returns the progress and result of a background import
+// @Summary Get import job
+// @Description Returns the status, progress and, once finished, the result of a background import.
+// @Tags Todos
+// @Produce json
+// @Param id path string true "Import job ID"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.ImportJob "Import job"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 404 {object} ErrorResponse "Import job not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/import/jobs/{id} [get]
+func (h *ImportHandler) GetImportJob(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	job, err := h.importService.GetImportJob(c.Context(), userID, c.Params("id"))
+	if err != nil {
+		log.Printf("Error getting import job %s for user %d: %v", c.Params("id"), userID, err)
+		if errors.Is(err, services.ErrImportJobNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve import job"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(job)
+}
+
+func importErrorResponse(c *fiber.Ctx, userID uint, err error) error {
+	log.Printf("Error importing todos for user %d: %v", userID, err)
+	if errors.Is(err, services.ErrInvalidImportFile) || errors.Is(err, services.ErrInvalidImportMapping) || errors.Is(err, services.ErrImportTooManyRows) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	}
+	if errors.Is(err, services.ErrWorkspaceTodoQuota) {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to import todos"})
+}
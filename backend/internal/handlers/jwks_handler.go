@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"github.com/xNatthapol/todo-list/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type JWKSHandler struct {
+	keyRing *utils.KeyRing
+}
+
+func NewJWKSHandler(keyRing *utils.KeyRing) *JWKSHandler {
+	return &JWKSHandler{keyRing: keyRing}
+}
+
+// GetJWKS publishes the token verification keys
+// @Summary Get token verification keys
+// @Description Returns the public keys (JWK Set) that verify JWTs issued by this API, selected by the token's kid header. Empty when tokens are signed with HS256.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} utils.JWKSet "JSON Web Key Set"
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) GetJWKS(c *fiber.Ctx) error {
+	// Short enough that verifiers pick up a newly added key well before it becomes active
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(h.keyRing.JWKS())
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type MFAHandler struct {
+	mfaService services.MFAService
+	validate   *validator.Validate
+}
+
+func NewMFAHandler(mfaService services.MFAService) *MFAHandler {
+	return &MFAHandler{
+		mfaService: mfaService,
+		validate:   validator.New(),
+	}
+}
+
+// EnrollTOTP starts TOTP enrollment
+// @Summary Start TOTP enrollment
+// @Description Generates a new TOTP secret and an otpauth:// provisioning URI to render as a QR code. Two-factor authentication is enabled once a code is confirmed.
+// @Tags MFA
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.TOTPEnrollmentResponse "Secret and provisioning URI"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Called with an access token"
+// @Failure 409 {object} ErrorResponse "Two-factor authentication already enabled"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/mfa/totp/enroll [post]
+func (h *MFAHandler) EnrollTOTP(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	enrollment, err := h.mfaService.BeginTOTPEnrollment(c.Context(), userID)
+	if err != nil {
+		log.Printf("Error starting TOTP enrollment for user %d: %v", userID, err)
+		return mfaErrorResponse(c, err, "Failed to start TOTP enrollment")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(enrollment)
+}
+
+// ConfirmTOTP confirms TOTP enrollment
+// @Summary Confirm TOTP enrollment
+// @Description Verifies a code from the authenticator app, enables two-factor authentication and returns one-time recovery codes. The codes are shown only once.
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Param code body models.ConfirmTOTPRequest true "Current TOTP code"
+// @Security BearerAuth
+// @Success 200 {object} models.RecoveryCodesResponse "Recovery codes"
+// @Failure 400 {object} ErrorResponse "Validation error or enrollment not started"
+// @Failure 401 {object} ErrorResponse "Unauthorized or invalid code"
+// @Failure 403 {object} ErrorResponse "Called with an access token"
+// @Failure 409 {object} ErrorResponse "Two-factor authentication already enabled"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/mfa/totp/confirm [post]
+func (h *MFAHandler) ConfirmTOTP(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.ConfirmTOTPRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing confirm TOTP request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error during TOTP confirmation: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	codes, err := h.mfaService.ConfirmTOTPEnrollment(c.Context(), userID, req.Code)
+	if err != nil {
+		log.Printf("Error confirming TOTP enrollment for user %d: %v", userID, err)
+		return mfaErrorResponse(c, err, "Failed to confirm TOTP enrollment")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableMFA disables two-factor authentication
+// @Summary Disable two-factor authentication
+// @Description Disables TOTP and deletes recovery codes. Requires the password and a current TOTP or recovery code.
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Param reauth body models.MFAReauthRequest true "Password and second factor"
+// @Security BearerAuth
+// @Success 204 "Two-factor authentication disabled"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid input"
+// @Failure 401 {object} ErrorResponse "Unauthorized, wrong password or invalid code"
+// @Failure 403 {object} ErrorResponse "Called with an access token"
+// @Failure 409 {object} ErrorResponse "Two-factor authentication not enabled"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/mfa/disable [post]
+func (h *MFAHandler) DisableMFA(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.MFAReauthRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing MFA re-authentication request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error during MFA re-authentication: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	if err := h.mfaService.DisableTOTP(c.Context(), userID, req.Password, req.Code, req.RecoveryCode); err != nil {
+		log.Printf("Error disabling 2FA for user %d: %v", userID, err)
+		return mfaErrorResponse(c, err, "Failed to disable two-factor authentication")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+// @Summary Regenerate recovery codes
+// @Description Invalidates all existing recovery codes and returns new ones. Requires the password and a current TOTP or recovery code.
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Param reauth body models.MFAReauthRequest true "Password and second factor"
+// @Security BearerAuth
+// @Success 200 {object} models.RecoveryCodesResponse "New recovery codes"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid input"
+// @Failure 401 {object} ErrorResponse "Unauthorized, wrong password or invalid code"
+// @Failure 403 {object} ErrorResponse "Called with an access token"
+// @Failure 409 {object} ErrorResponse "Two-factor authentication not enabled"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/mfa/recovery-codes [post]
+func (h *MFAHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.MFAReauthRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing MFA re-authentication request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error during MFA re-authentication: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(c.Context(), userID, req.Password, req.Code, req.RecoveryCode)
+	if err != nil {
+		log.Printf("Error regenerating recovery codes for user %d: %v", userID, err)
+		return mfaErrorResponse(c, err, "Failed to regenerate recovery codes")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func mfaErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials), errors.Is(err, services.ErrInvalidMFACode):
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrMFAAlreadyEnabled), errors.Is(err, services.ErrMFANotEnabled):
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrMFANotEnrolled):
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: fallback})
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type NotificationHandler struct {
+	notificationService services.NotificationService
+	validate            *validator.Validate
+}
+
+func NewNotificationHandler(notificationService services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{
+		notificationService: notificationService,
+		validate:            validator.New(),
+	}
+}
+
+// MarkAllReadResponse reports how many notifications were marked read
+// @name MarkAllReadResponse
+type MarkAllReadResponse struct {
+	Updated int64 `json:"updated"`
+}
+
+// ListNotifications lists the authenticated user's notifications
+// @Summary List notifications
+// @Description Lists the user's notifications, newest first, with the number of unread notifications.
+// @Tags Notifications
+// @Produce json
+// @Param unread query bool false "Only unread notifications"
+// @Param page query int false "Zero-based page number"
+// @Param page_size query int false "Notifications per page (default 20, max 100)"
+// @Security BearerAuth
+// @Success 200 {object} models.NotificationListResponse "Page of notifications"
+// @Failure 400 {object} ErrorResponse "Invalid query parameters"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /notifications [get]
+func (h *NotificationHandler) ListNotifications(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	filter := new(models.NotificationFilter)
+	if err := c.QueryParser(filter); err != nil {
+		log.Printf("Error parsing notification filter: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid query parameters"})
+	}
+
+	if err := h.validate.Struct(filter); err != nil {
+		log.Printf("Validation error in notification filter: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	notifications, err := h.notificationService.ListNotifications(c.Context(), userID, *filter)
+	if err != nil {
+		log.Printf("Error listing notifications for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve notifications"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(notifications)
+}
+
+// MarkRead marks one notification read
+// @Summary Mark a notification read
+// @Description Marks one of the user's notifications read. Marking a read notification again keeps its read time.
+// @Tags Notifications
+// @Param id path int true "Notification ID"
+// @Security BearerAuth
+// @Success 204 "Notification marked read"
+// @Failure 400 {object} ErrorResponse "Invalid ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 404 {object} ErrorResponse "Notification not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /notifications/{id}/read [post]
+func (h *NotificationHandler) MarkRead(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	notificationID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid notification ID format: %s", c.Params("id"))
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid notification ID format"})
+	}
+
+	if err := h.notificationService.MarkRead(c.Context(), userID, uint(notificationID)); err != nil {
+		log.Printf("Error marking notification %d read for user %d: %v", notificationID, userID, err)
+		if errors.Is(err, services.ErrNotificationNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to mark notification read"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// MarkAllRead marks every notification read
+// @Summary Mark all notifications read
+// @Description Marks all of the user's unread notifications read.
+// @Tags Notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MarkAllReadResponse "Number of notifications marked read"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /notifications/read [post]
+func (h *NotificationHandler) MarkAllRead(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	updated, err := h.notificationService.MarkAllRead(c.Context(), userID)
+	if err != nil {
+		log.Printf("Error marking notifications read for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to mark notifications read"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(MarkAllReadResponse{Updated: updated})
+}
+
+// GetPreferences returns which notification types are enabled
+// @Summary Get notification preferences
+// @Description Returns whether each type of notification (assigned, mentioned, commented, due_soon, workspace_invite) is enabled.
+// @Tags Notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.NotificationPreferences "Preferences"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /notifications/preferences [get]
+func (h *NotificationHandler) GetPreferences(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	preferences, err := h.notificationService.GetPreferences(c.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting notification preferences for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve notification preferences"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(preferences)
+}
+
+// UpdatePreferences enables or disables notification types
+// @Summary Update notification preferences
+// @Description Enables or disables the given notification types; omitted types are unchanged.
+// @Tags Notifications
+// @Accept json
+// @Produce json
+// @Param preferences body models.NotificationPreferences true "Types to change"
+// @Security BearerAuth
+// @Success 200 {object} models.NotificationPreferences "Preferences after the change"
+// @Failure 400 {object} ErrorResponse "Invalid input or unknown notification type"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /notifications/preferences [put]
+func (h *NotificationHandler) UpdatePreferences(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := models.NotificationPreferences{}
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Error parsing notification preferences request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	preferences, err := h.notificationService.UpdatePreferences(c.Context(), userID, req)
+	if err != nil {
+		log.Printf("Error updating notification preferences for user %d: %v", userID, err)
+		if errors.Is(err, services.ErrUnknownNotificationType) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update notification preferences"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(preferences)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const oidcStateCookie = "oidc_state"
+
+type OIDCHandler struct {
+	oidcService services.OIDCService
+	cfg         *config.Config
+}
+
+func NewOIDCHandler(oidcService services.OIDCService, cfg *config.Config) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+		cfg:         cfg,
+	}
+}
+
+// ListProviders lists the configured identity providers
+// @Summary List login providers
+// @Description Lists the OpenID Connect providers users can sign in with.
+// @Tags Auth
+// @Produce json
+// @Success 200 {array} models.OIDCProviderInfo "Configured providers"
+// @Router /auth/oidc/providers [get]
+func (h *OIDCHandler) ListProviders(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(h.oidcService.Providers())
+}
+
+// Login starts an OpenID Connect login
+// @Summary Start login with an identity provider
+// @Description Redirects the browser to the provider using the authorization code flow with PKCE. With reauth the provider is asked to sign the user in again, which accounts without a password need before changing their password or email or deleting themselves.
+// @Tags Auth
+// @Param provider path string true "Provider name"
+// @Param reauth query bool false "Require the user to sign in at the provider again"
+// @Success 302 "Redirect to the identity provider"
+// @Failure 404 {object} ErrorResponse "Unknown provider"
+// @Failure 502 {object} ErrorResponse "Identity provider unavailable"
+// @Router /auth/oidc/{provider}/login [get]
+func (h *OIDCHandler) Login(c *fiber.Ctx) error {
+	provider := c.Params("provider")
+
+	authURL, stateToken, err := h.oidcService.BeginLogin(c.Context(), provider, c.QueryBool("reauth"))
+	if err != nil {
+		log.Printf("Error starting OIDC login with %s: %v", provider, err)
+		if errors.Is(err, services.ErrOIDCProviderNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(ErrorResponse{Error: "Identity provider unavailable"})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateToken,
+		Path:     "/api/auth/oidc",
+		Expires:  time.Now().Add(services.OIDCStateExpiresIn),
+		Secure:   strings.HasPrefix(h.cfg.APIBaseURL, "https://"),
+		HTTPOnly: true,
+		// Lax lets the cookie accompany the top-level redirect back from the provider
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// Callback completes an OpenID Connect login
+// @Summary Complete login with an identity provider
+// @Description Handles the provider redirect and sends the browser to the frontend at /auth/callback with token (or mfa_token when two-factor authentication is enabled, or error) in the URL fragment.
+// @Tags Auth
+// @Param provider path string true "Provider name"
+// @Param code query string false "Authorization code"
+// @Param state query string false "State"
+// @Success 302 "Redirect to the frontend"
+// @Router /auth/oidc/{provider}/callback [get]
+func (h *OIDCHandler) Callback(c *fiber.Ctx) error {
+	provider := c.Params("provider")
+	stateToken := c.Cookies(oidcStateCookie)
+	// The state is single use
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/api/auth/oidc",
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+	})
+
+	if providerError := c.Query("error"); providerError != "" {
+		log.Printf("OIDC provider %s returned error: %s %s", provider, providerError, c.Query("error_description"))
+		return h.redirectToFrontend(c, url.Values{"error": {services.ErrOIDCLoginFailed.Error()}})
+	}
+
+	result, err := h.oidcService.CompleteLogin(c.Context(), provider, c.Query("code"), c.Query("state"), stateToken, clientInfo(c))
+	if err != nil {
+		log.Printf("Error completing OIDC login with %s: %v", provider, err)
+		message := "Failed to login user"
+		if errors.Is(err, services.ErrOIDCProviderNotFound) || errors.Is(err, services.ErrOIDCInvalidState) ||
+			errors.Is(err, services.ErrOIDCEmailNotVerified) || errors.Is(err, services.ErrOIDCLoginFailed) ||
+			errors.Is(err, services.ErrAccountDisabled) || errors.Is(err, services.ErrAccountLocked) ||
+			errors.Is(err, services.ErrTooManyLoginAttempts) {
+			message = err.Error()
+		}
+		return h.redirectToFrontend(c, url.Values{"error": {message}})
+	}
+
+	if result.MFAToken != "" {
+		return h.redirectToFrontend(c, url.Values{"mfa_token": {result.MFAToken}})
+	}
+	return h.redirectToFrontend(c, url.Values{"token": {result.Token}})
+}
+
+// redirectToFrontend passes values in the fragment so they never reach server logs
+func (h *OIDCHandler) redirectToFrontend(c *fiber.Ctx, values url.Values) error {
+	return c.Redirect(strings.TrimRight(h.cfg.AppBaseURL, "/")+"/auth/callback#"+values.Encode(), fiber.StatusFound)
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ProfileHandler struct {
+	profileService services.ProfileService
+	validate       *validator.Validate
+}
+
+func NewProfileHandler(profileService services.ProfileService) *ProfileHandler {
+	return &ProfileHandler{
+		profileService: profileService,
+		validate:       validator.New(),
+	}
+}
+
+// GetProfile returns the authenticated user's profile
+// @Summary Get own profile
+// @Description Returns the account, profile and preferences of the logged-in user.
+// @Tags Profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.User "Profile"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /me [get]
+func (h *ProfileHandler) GetProfile(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	user, err := h.profileService.GetProfile(c.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting profile of user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve profile"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(user)
+}
+
+// UpdateProfile updates the authenticated user's profile and preferences
+// @Summary Update own profile
+// @Description Updates the display name, avatar and preferences. The timezone (IANA name, empty for the server default), week start and default sort are applied when listing and exporting todos. With digest_enabled a daily email of overdue, due-today and yesterday's completed todos is sent at digest_time in that timezone.
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Param profile body models.UpdateProfileRequest true "Fields to update"
+// @Security BearerAuth
+// @Success 200 {object} models.User "Updated profile"
+// @Failure 400 {object} ErrorResponse "Validation error or no fields provided"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Called with an access token"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /me [patch]
+func (h *ProfileHandler) UpdateProfile(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.UpdateProfileRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing update profile request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error updating profile: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	user, err := h.profileService.UpdateProfile(c.Context(), userID, *req)
+	if err != nil {
+		log.Printf("Error updating profile of user %d: %v", userID, err)
+		if errors.Is(err, services.ErrNoProfileFieldsProvided) || errors.Is(err, services.ErrInvalidTimezone) || errors.Is(err, services.ErrInvalidDigestTime) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update profile"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(user)
+}
+
+// ChangePassword changes the authenticated user's password
+// @Summary Change password
+// @Description Changes the password after checking the current one, then signs out every other session and revokes all personal access tokens.
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Param password body models.ChangePasswordRequest true "Current and new password"
+// @Security BearerAuth
+// @Success 204 "Password changed"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid input"
+// @Failure 401 {object} ErrorResponse "Unauthorized, or current password or authentication code incorrect"
+// @Failure 403 {object} ErrorResponse "Called with an access token or while impersonating, or an account without a password has to sign in with its identity provider again"
+// @Failure 423 {object} ErrorResponse "Account locked after too many incorrect codes"
+// @Failure 429 {object} ErrorResponse "Too many incorrect codes"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /me/password [put]
+func (h *ProfileHandler) ChangePassword(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	sessionID, _ := c.Locals(middleware.SessionIDKey).(string)
+
+	req := new(models.ChangePasswordRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing change password request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error changing password: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	if err := h.profileService.ChangePassword(c.Context(), userID, sessionID, req.CurrentPassword, req.Code, req.NewPassword, clientInfo(c)); err != nil {
+		log.Printf("Error changing password of user %d: %v", userID, err)
+		if handled, response := reauthErrorResponse(c, err); handled {
+			return response
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to change password"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RequestEmailChange starts changing the authenticated user's email
+// @Summary Change email
+// @Description Sends a confirmation link to the new address and a notice to the current one. The email changes once the link is used.
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Param email body models.ChangeEmailRequest true "New email and current password"
+// @Security BearerAuth
+// @Success 202 "Confirmation email sent"
+// @Failure 400 {object} ErrorResponse "Validation error or unchanged email"
+// @Failure 401 {object} ErrorResponse "Unauthorized, or current password or authentication code incorrect"
+// @Failure 403 {object} ErrorResponse "Called with an access token or while impersonating, or an account without a password has to sign in with its identity provider again"
+// @Failure 409 {object} ErrorResponse "Email already in use"
+// @Failure 423 {object} ErrorResponse "Account locked after too many incorrect codes"
+// @Failure 429 {object} ErrorResponse "Too many incorrect codes"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /me/email [post]
+func (h *ProfileHandler) RequestEmailChange(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	sessionID, _ := c.Locals(middleware.SessionIDKey).(string)
+
+	req := new(models.ChangeEmailRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing change email request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error changing email: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	if err := h.profileService.RequestEmailChange(c.Context(), userID, sessionID, req.NewEmail, req.CurrentPassword, req.Code, clientInfo(c)); err != nil {
+		log.Printf("Error requesting email change for user %d: %v", userID, err)
+		return emailChangeErrorResponse(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// ConfirmEmailChange completes an email change with the emailed token
+// @Summary Confirm email change
+// @Description Replaces the account email with the new address the token was sent to.
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Param confirmation body models.ConfirmEmailChangeRequest true "Confirmation token"
+// @Success 200 {object} models.User "Updated profile"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid input"
+// @Failure 401 {object} ErrorResponse "Invalid or expired confirmation token"
+// @Failure 409 {object} ErrorResponse "Email already in use"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/email/confirm [post]
+func (h *ProfileHandler) ConfirmEmailChange(c *fiber.Ctx) error {
+	req := new(models.ConfirmEmailChangeRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing confirm email request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error confirming email change: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	user, err := h.profileService.ConfirmEmailChange(c.Context(), req.Token, clientInfo(c))
+	if err != nil {
+		log.Printf("Error confirming email change: %v", err)
+		return emailChangeErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(user)
+}
+
+func emailChangeErrorResponse(c *fiber.Ctx, err error) error {
+	if handled, response := reauthErrorResponse(c, err); handled {
+		return response
+	}
+	switch {
+	case errors.Is(err, services.ErrInvalidEmailChangeToken):
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrEmailUnchanged):
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrUserAlreadyExists):
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "email is already in use"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to change email"})
+}
+
+// reauthErrorResponse writes the response for a failed re-authentication before a credential
+// change, reporting whether err was one
+func reauthErrorResponse(c *fiber.Ctx, err error) (bool, error) {
+	var blocked *services.LoginBlockedError
+	switch {
+	case errors.As(err, &blocked):
+		return true, loginBlockedResponse(c, blocked)
+	case errors.Is(err, services.ErrIncorrectPassword), errors.Is(err, services.ErrInvalidMFACode):
+		return true, c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrReauthenticationRequired):
+		return true, c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+	}
+	return false, nil
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type PushHandler struct {
+	pushService services.PushService
+	validate    *validator.Validate
+}
+
+func NewPushHandler(pushService services.PushService) *PushHandler {
+	return &PushHandler{
+		pushService: pushService,
+		validate:    validator.New(),
+	}
+}
+
+// GetVAPIDPublicKey returns the key browsers subscribe with
+// @Summary Get the VAPID public key
+// @Description Returns the application server key to pass to PushManager.subscribe as applicationServerKey.
+// @Tags Notifications
+// @Produce json
+// @Success 200 {object} models.VAPIDPublicKeyResponse "VAPID public key"
+// @Router /push/vapid-public-key [get]
+func (h *PushHandler) GetVAPIDPublicKey(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(models.VAPIDPublicKeyResponse{PublicKey: h.pushService.VAPIDPublicKey()})
+}
+
+// Subscribe registers a device for push notifications
+// @Summary Subscribe a device to push notifications
+// @Description Stores the browser's PushSubscription (the JSON of PushSubscription.toJSON()). Due-soon reminders and mentions are then pushed to the device even while the app is closed. Subscribing a known endpoint again updates its keys; an endpoint subscribed by another account must be unsubscribed by it first.
+// @Tags Notifications
+// @Accept json
+// @Produce json
+// @Param subscription body models.CreatePushSubscriptionRequest true "Push subscription"
+// @Security BearerAuth
+// @Success 201 {object} models.PushSubscription "Device subscribed"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid endpoint or keys"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 409 {object} ErrorResponse "Endpoint subscribed by another account"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /push/subscriptions [post]
+func (h *PushHandler) Subscribe(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.CreatePushSubscriptionRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing push subscription request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error creating push subscription: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	subscription, err := h.pushService.Subscribe(c.Context(), userID, *req, c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		log.Printf("Error creating push subscription for user %d: %v", userID, err)
+		switch {
+		case errors.Is(err, services.ErrInvalidPushSubscription):
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, services.ErrPushEndpointInUse):
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to subscribe to push notifications"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(subscription)
+}
+
+// ListSubscriptions lists the devices subscribed to push notifications
+// @Summary List push subscriptions
+// @Description Lists the user's devices subscribed to push notifications, newest first.
+// @Tags Notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.PushSubscription "Push subscriptions"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /push/subscriptions [get]
+func (h *PushHandler) ListSubscriptions(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	subscriptions, err := h.pushService.ListSubscriptions(c.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing push subscriptions for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve push subscriptions"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(subscriptions)
+}
+
+// Unsubscribe stops push notifications to a device
+// @Summary Delete a push subscription
+// @Description Stops pushing notifications to one of the user's devices.
+// @Tags Notifications
+// @Param id path int true "Push subscription ID"
+// @Security BearerAuth
+// @Success 204 "Push subscription deleted"
+// @Failure 400 {object} ErrorResponse "Invalid ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 404 {object} ErrorResponse "Push subscription not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /push/subscriptions/{id} [delete]
+func (h *PushHandler) Unsubscribe(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	subscriptionID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid push subscription ID format: %s", c.Params("id"))
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid push subscription ID format"})
+	}
+
+	if err := h.pushService.Unsubscribe(c.Context(), userID, uint(subscriptionID)); err != nil {
+		log.Printf("Error deleting push subscription %d of user %d: %v", subscriptionID, userID, err)
+		if errors.Is(err, services.ErrPushSubscriptionNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to delete push subscription"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
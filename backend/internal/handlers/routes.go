@@ -1,8 +1,9 @@
 package handlers
 
 import (
-	"github.com/xNatthapol/todo-list/internal/config"
 	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/utils"
 
 	_ "github.com/xNatthapol/todo-list/docs"
 
@@ -11,27 +12,223 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupRoutes(app *fiber.App, authHandler *AuthHandler, todoHandler *TodoHandler, uploadHandler *UploadHandler, cfg *config.Config) {
+func SetupRoutes(
+	app *fiber.App,
+	authHandler *AuthHandler,
+	mfaHandler *MFAHandler,
+	oidcHandler *OIDCHandler,
+	jwksHandler *JWKSHandler,
+	todoHandler *TodoHandler,
+	uploadHandler *UploadHandler,
+	syncHandler *SyncHandler,
+	exportHandler *ExportHandler,
+	importHandler *ImportHandler,
+	accessTokenHandler *AccessTokenHandler,
+	sessionHandler *SessionHandler,
+	adminHandler *AdminHandler,
+	profileHandler *ProfileHandler,
+	accountHandler *AccountHandler,
+	workspaceHandler *WorkspaceHandler,
+	commentHandler *CommentHandler,
+	notificationHandler *NotificationHandler,
+	digestHandler *DigestHandler,
+	pushHandler *PushHandler,
+	calDAVHandler *CalDAVHandler,
+	calendarFeedHandler *CalendarFeedHandler,
+	shareLinkHandler *ShareLinkHandler,
+	statusHandler *StatusHandler,
+	accessTokens middleware.AccessTokenAuthenticator,
+	sessions middleware.SessionValidator,
+	users middleware.UserFinder,
+	workspaces middleware.WorkspaceMembershipFinder,
+	keys *utils.KeyRing,
+) {
 	// Swagger Documentation Route
 	app.Get("/swagger/*", fiberSwagger.WrapHandler)
 
+	// Public keys for verifying issued tokens
+	app.Get("/.well-known/jwks.json", jwksHandler.GetJWKS)
+
 	api := app.Group("/api")
+	protected := middleware.Protected(keys, accessTokens, sessions)
+	canRead := middleware.RequireScope(models.ScopeTodosRead)
+	canWrite := middleware.RequireScope(models.ScopeTodosWrite)
+	tenant := middleware.ResolveTenant(workspaces)
 
 	// Auth Routes
 	auth := api.Group("/auth")
 	auth.Post("/signup", authHandler.SignUp)
 	auth.Post("/login", authHandler.Login)
+	auth.Post("/login/mfa", authHandler.LoginMFA)
+	auth.Post("/unlock", authHandler.UnlockAccount)
+	auth.Post("/password-reset", authHandler.ResetPassword)
+	auth.Post("/email/confirm", profileHandler.ConfirmEmailChange)
+
+	// Session Routes
+	sessionRoutes := auth.Group("/sessions", protected, middleware.RejectAccessTokens())
+	sessionRoutes.Get("/", sessionHandler.ListSessions)
+	sessionRoutes.Delete("/", sessionHandler.RevokeOtherSessions)
+	sessionRoutes.Delete("/:id", sessionHandler.RevokeSession)
+
+	// OpenID Connect Routes
+	oidc := auth.Group("/oidc")
+	oidc.Get("/providers", oidcHandler.ListProviders)
+	oidc.Get("/:provider/login", oidcHandler.Login)
+	oidc.Get("/:provider/callback", oidcHandler.Callback)
+
+	// Two-Factor Authentication Routes
+	mfa := auth.Group("/mfa", protected, middleware.RejectAccessTokens())
+	mfa.Post("/totp/enroll", mfaHandler.EnrollTOTP)
+	mfa.Post("/totp/confirm", mfaHandler.ConfirmTOTP)
+	mfa.Post("/disable", mfaHandler.DisableMFA)
+	mfa.Post("/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+
+	// Profile Routes
+	me := api.Group("/me", protected)
+	me.Get("/", profileHandler.GetProfile)
+	me.Patch("/", middleware.RejectAccessTokens(), profileHandler.UpdateProfile)
+	me.Put("/password", middleware.RejectAccessTokens(), middleware.RejectImpersonation(), profileHandler.ChangePassword)
+	me.Post("/email", middleware.RejectAccessTokens(), middleware.RejectImpersonation(), profileHandler.RequestEmailChange)
+
+	// Personal Data and Account Deletion Routes
+	me.Post("/export", middleware.RejectAccessTokens(), middleware.RejectImpersonation(), accountHandler.StartDataExport)
+	me.Get("/export/:id", middleware.RejectAccessTokens(), middleware.RejectImpersonation(), accountHandler.GetDataExport)
+	me.Get("/export/:id/download", middleware.RejectAccessTokens(), middleware.RejectImpersonation(), accountHandler.DownloadDataExport)
+	me.Delete("/", middleware.RejectAccessTokens(), middleware.RejectImpersonation(), accountHandler.DeleteAccount)
+	me.Delete("/deletion", middleware.RejectAccessTokens(), middleware.RejectImpersonation(), accountHandler.CancelAccountDeletion)
+
+	// Calendar Feed Routes; the feed itself is read through its secret URL without signing in
+	me.Get("/calendar-feed", middleware.RejectAccessTokens(), middleware.RejectImpersonation(), calendarFeedHandler.GetFeed)
+	me.Post("/calendar-feed", middleware.RejectAccessTokens(), middleware.RejectImpersonation(), calendarFeedHandler.CreateFeed)
+	me.Delete("/calendar-feed", middleware.RejectAccessTokens(), middleware.RejectImpersonation(), calendarFeedHandler.RevokeFeed)
+	api.Get("/calendar/:token.ics", calendarFeedHandler.ServeFeed)
+
+	// Admin Routes
+	admin := api.Group("/admin", protected, middleware.RejectAccessTokens(), middleware.RequireRole(users, models.RoleAdmin))
+	admin.Get("/users", adminHandler.ListUsers)
+	admin.Get("/users/:id", adminHandler.GetUser)
+	admin.Get("/users/:id/stats", adminHandler.GetUserStats)
+	admin.Post("/users/:id/disable", adminHandler.DisableUser)
+	admin.Post("/users/:id/enable", adminHandler.EnableUser)
+	admin.Put("/users/:id/role", adminHandler.UpdateUserRole)
+	admin.Post("/users/:id/password-reset", adminHandler.ForcePasswordReset)
+	admin.Post("/users/:id/unlock", adminHandler.UnlockUser)
+	admin.Post("/users/:id/impersonate", adminHandler.ImpersonateUser)
+	admin.Get("/audit-events", adminHandler.ListAuditEvents)
+	admin.Put("/workspaces/:id/quota", workspaceHandler.UpdateWorkspaceQuota)
+
+	// Notification Routes
+	notifications := api.Group("/notifications", protected, middleware.RejectAccessTokens())
+	notifications.Get("/", notificationHandler.ListNotifications)
+	notifications.Post("/read", notificationHandler.MarkAllRead)
+	notifications.Get("/preferences", notificationHandler.GetPreferences)
+	notifications.Put("/preferences", notificationHandler.UpdatePreferences)
+	notifications.Post("/:id/read", notificationHandler.MarkRead)
+
+	// Web Push Routes
+	api.Get("/push/vapid-public-key", pushHandler.GetVAPIDPublicKey)
+	push := api.Group("/push/subscriptions", protected, middleware.RejectAccessTokens())
+	push.Post("/", pushHandler.Subscribe)
+	push.Get("/", pushHandler.ListSubscriptions)
+	push.Delete("/:id", pushHandler.Unsubscribe)
+
+	// Digest unsubscribe links are signed and work without signing in; only POST unsubscribes
+	api.Get("/digest/unsubscribe", digestHandler.ConfirmUnsubscribe)
+	api.Post("/digest/unsubscribe", digestHandler.Unsubscribe)
+
+	// Personal Access Token Routes
+	tokens := api.Group("/tokens", protected, middleware.RejectAccessTokens())
+	tokens.Post("/", accessTokenHandler.CreateToken)
+	tokens.Get("/", accessTokenHandler.ListTokens)
+	tokens.Delete("/:id", accessTokenHandler.RevokeToken)
+
+	// Workspace Routes
+	workspace := api.Group("/workspaces", protected)
+	noTokens := middleware.RejectAccessTokens()
+	workspace.Post("/", noTokens, workspaceHandler.CreateWorkspace)
+	workspace.Get("/", noTokens, workspaceHandler.ListWorkspaces)
+	workspace.Get("/:workspaceID", noTokens, workspaceHandler.GetWorkspace)
+	workspace.Patch("/:workspaceID", noTokens, workspaceHandler.UpdateWorkspace)
+	workspace.Delete("/:workspaceID", noTokens, workspaceHandler.DeleteWorkspace)
+	workspace.Get("/:workspaceID/members", noTokens, workspaceHandler.ListMembers)
+	workspace.Post("/:workspaceID/members", noTokens, workspaceHandler.AddMember)
+	workspace.Put("/:workspaceID/members/:userID", noTokens, workspaceHandler.UpdateMemberRole)
+	workspace.Delete("/:workspaceID/members/:userID", noTokens, workspaceHandler.RemoveMember)
+
+	// Todo and Sync Routes work in the personal space or the workspace chosen by the X-Workspace-ID
+	// header, and are mounted again below /workspaces/:workspaceID
+	mountTodoRoutes := func(todo, sync fiber.Router) {
+		todo.Post("/", canWrite, tenant, todoHandler.CreateTodo)
+		todo.Get("/", canRead, tenant, todoHandler.GetTodos)
+		todo.Get("/assigned", canRead, tenant, todoHandler.GetAssignedTodos)
+		todo.Get("/watching", canRead, tenant, todoHandler.GetWatchedTodos)
+		todo.Get("/export", canRead, tenant, exportHandler.ExportTodos)
+		todo.Post("/import", canWrite, tenant, importHandler.ImportTodos)
+		todo.Get("/import/jobs/:id", canRead, tenant, importHandler.GetImportJob)
+		todo.Get("/board", canRead, tenant, statusHandler.GetBoard)
+		todo.Get("/graph", canRead, tenant, todoHandler.GetDependencyGraph)
+		todo.Get("/:id", canRead, tenant, todoHandler.GetTodo)
+		todo.Patch("/:id", canWrite, tenant, todoHandler.UpdateTodo)
+		todo.Put("/:id/status", canWrite, tenant, todoHandler.UpdateTodoStatus)
+		todo.Put("/:id/position", canWrite, tenant, todoHandler.MoveTodo)
+		todo.Get("/:id/transitions", canRead, tenant, todoHandler.GetTransitions)
+		todo.Delete("/:id", canWrite, tenant, todoHandler.DeleteTodo)
+		todo.Put("/:id/assignee", canWrite, tenant, todoHandler.AssignTodo)
+		todo.Get("/:id/watchers", canRead, tenant, todoHandler.GetWatchers)
+		todo.Post("/:id/watchers", canWrite, tenant, todoHandler.AddWatcher)
+		todo.Delete("/:id/watchers/:userID", canWrite, tenant, todoHandler.RemoveWatcher)
+		todo.Post("/:id/blockers", canWrite, tenant, todoHandler.AddBlocker)
+		todo.Delete("/:id/blockers/:blockerID", canWrite, tenant, todoHandler.RemoveBlocker)
+		todo.Get("/:id/comments", canRead, tenant, commentHandler.ListComments)
+		todo.Post("/:id/comments", canWrite, tenant, commentHandler.CreateComment)
+		todo.Patch("/:id/comments/:commentID", canWrite, tenant, commentHandler.UpdateComment)
+		todo.Delete("/:id/comments/:commentID", canWrite, tenant, commentHandler.DeleteComment)
+
+		sync.Get("/", canRead, tenant, syncHandler.Pull)
+		sync.Post("/", canWrite, tenant, syncHandler.Push)
+	}
+	mountTodoRoutes(api.Group("/todos", protected), api.Group("/sync", protected))
+	mountTodoRoutes(workspace.Group("/:workspaceID/todos"), workspace.Group("/:workspaceID/sync"))
+
+	// Status Routes manage the statuses of the personal space or workspace, the columns of its board,
+	// and the workflow rules for moving todos between them
+	mountStatusRoutes := func(statuses fiber.Router) {
+		statuses.Get("/", canRead, tenant, statusHandler.ListStatuses)
+		statuses.Post("/", canWrite, tenant, statusHandler.CreateStatus)
+		statuses.Put("/order", canWrite, tenant, statusHandler.ReorderStatuses)
+		statuses.Get("/transitions", canRead, tenant, statusHandler.ListTransitions)
+		statuses.Post("/transitions", canWrite, tenant, statusHandler.CreateTransition)
+		statuses.Delete("/transitions/:id", canWrite, tenant, statusHandler.DeleteTransition)
+		statuses.Patch("/:id", canWrite, tenant, statusHandler.UpdateStatus)
+		statuses.Delete("/:id", canWrite, tenant, statusHandler.DeleteStatus)
+	}
+	mountStatusRoutes(api.Group("/statuses", protected))
+	mountStatusRoutes(workspace.Group("/:workspaceID/statuses"))
+
+	// Share Link Routes are managed per personal space or workspace like the todo routes; the
+	// links themselves are opened without signing in
+	mountShareRoutes := func(shares fiber.Router) {
+		shares.Post("/", noTokens, tenant, shareLinkHandler.CreateLink)
+		shares.Get("/", noTokens, tenant, shareLinkHandler.ListLinks)
+		shares.Delete("/:id", noTokens, tenant, shareLinkHandler.RevokeLink)
+	}
+	mountShareRoutes(api.Group("/share-links", protected))
+	mountShareRoutes(workspace.Group("/:workspaceID/share-links"))
+	api.Get("/shared/:token", shareLinkHandler.ViewShared)
 
-	// Todo Routes
-	todo := api.Group("/todos", middleware.Protected(cfg))
-	todo.Post("/", todoHandler.CreateTodo)
-	todo.Get("/", todoHandler.GetTodos)
-	todo.Get("/:id", todoHandler.GetTodo)
-	todo.Patch("/:id", todoHandler.UpdateTodo)
-	todo.Put("/:id/status", todoHandler.UpdateTodoStatus)
-	todo.Delete("/:id", todoHandler.DeleteTodo)
+	// CalDAV Routes serve the personal todos to calendar apps, which sign in with an access token
+	// as app password. OPTIONS is answered before authentication.
+	app.Get("/.well-known/caldav", calDAVHandler.WellKnown)
+	app.Add("PROPFIND", "/.well-known/caldav", calDAVHandler.WellKnown)
+	app.Options("/dav/*", calDAVHandler.Options)
+	dav := app.Group("/dav", middleware.AppPassword(accessTokens), tenant)
+	dav.Add("PROPFIND", "/*", canRead, calDAVHandler.Propfind)
+	dav.Add("REPORT", "/calendars/me/todos/", canRead, calDAVHandler.Report)
+	dav.Get("/calendars/me/todos/:name", canRead, calDAVHandler.GetObject)
+	dav.Put("/calendars/me/todos/:name", canWrite, calDAVHandler.PutObject)
+	dav.Delete("/calendars/me/todos/:name", canWrite, calDAVHandler.DeleteObject)
 
 	// Upload Route
-	uploads := api.Group("/uploads", middleware.Protected(cfg))
-	uploads.Post("/images", uploadHandler.UploadImage)
+	uploads := api.Group("/uploads", protected)
+	uploads.Post("/images", canWrite, uploadHandler.UploadImage)
 }
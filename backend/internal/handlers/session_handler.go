@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SessionHandler struct {
+	sessionService services.SessionService
+}
+
+func NewSessionHandler(sessionService services.SessionService) *SessionHandler {
+	return &SessionHandler{sessionService: sessionService}
+}
+
+// RevokedSessionsResponse reports how many sessions were signed out
+// @name RevokedSessionsResponse
+type RevokedSessionsResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+// ListSessions lists the user's active login sessions
+// @Summary List active sessions
+// @Description Lists the devices the user is logged in on, with user agent, IP and last activity. The session making the request has current set.
+// @Tags Sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Session "Active sessions"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Called with an access token"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/sessions [get]
+func (h *SessionHandler) ListSessions(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	currentID, _ := c.Locals(middleware.SessionIDKey).(string)
+
+	sessions, err := h.sessionService.ListSessions(c.Context(), userID, currentID)
+	if err != nil {
+		log.Printf("Error listing sessions for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve sessions"})
+	}
+
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(sessions)
+}
+
+// RevokeSession signs out one session
+// @Summary Revoke a session
+// @Description Signs out a session immediately; its token is rejected from then on. Revoking the current session logs out.
+// @Tags Sessions
+// @Produce json
+// @Param id path string true "Session ID"
+// @Security BearerAuth
+// @Success 204 "No Content (Session revoked)"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Called with an access token"
+// @Failure 404 {object} ErrorResponse "Session not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/sessions/{id} [delete]
+func (h *SessionHandler) RevokeSession(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	sessionID := c.Params("id")
+
+	if err := h.sessionService.RevokeSession(c.Context(), userID, sessionID); err != nil {
+		log.Printf("Error revoking session %s for user %d: %v", sessionID, userID, err)
+		if errors.Is(err, services.ErrSessionNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to revoke session"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RevokeOtherSessions signs out every session except the current one
+// @Summary Revoke all other sessions
+// @Description Signs out all of the user's sessions except the one making the request.
+// @Tags Sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} RevokedSessionsResponse "Number of sessions revoked"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Called with an access token"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /auth/sessions [delete]
+func (h *SessionHandler) RevokeOtherSessions(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	currentID, _ := c.Locals(middleware.SessionIDKey).(string)
+
+	revoked, err := h.sessionService.RevokeOtherSessions(c.Context(), userID, currentID)
+	if err != nil {
+		log.Printf("Error revoking other sessions for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to revoke sessions"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(RevokedSessionsResponse{Revoked: revoked})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SharePasswordHeader carries the password of a password-protected share link
+const SharePasswordHeader = "X-Share-Password"
+
+type ShareLinkHandler struct {
+	shareService services.ShareLinkService
+	validate     *validator.Validate
+}
+
+func NewShareLinkHandler(shareService services.ShareLinkService) *ShareLinkHandler {
+	return &ShareLinkHandler{
+		shareService: shareService,
+		validate:     validator.New(),
+	}
+}
+
+// CreateLink creates a public share link
+// @Summary Create a share link
+// @Description Creates a link that shows a todo, or the whole list when todo_id is omitted, read-only to anyone holding it. In a workspace only owners and admins may share the whole list. The link can expire and be protected by a password. The URL is only returned here.
+// @Tags Sharing
+// @Accept json
+// @Produce json
+// @Param link body models.CreateShareLinkRequest true "Share link"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 201 {object} models.CreatedShareLinkResponse "Share link created"
+// @Failure 400 {object} ErrorResponse "Validation error or expiry in the past"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Todo not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /share-links [post]
+func (h *ShareLinkHandler) CreateLink(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.CreateShareLinkRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing share link request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error creating share link: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	created, err := h.shareService.CreateLink(c.Context(), userID, *req)
+	if err != nil {
+		log.Printf("Error creating share link for user %d: %v", userID, err)
+		return shareLinkErrorResponse(c, err, "Failed to create share link")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// ListLinks lists the share links of the list
+// @Summary List share links
+// @Description Lists the share links of the personal space or workspace, newest first, with how often and when they were last opened.
+// @Tags Sharing
+// @Produce json
+// @Param todo_id query int false "Only list the links of this todo"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {array} models.ShareLink "Share links"
+// @Failure 400 {object} ErrorResponse "Invalid query parameters"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /share-links [get]
+func (h *ShareLinkHandler) ListLinks(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	filter := new(models.ShareLinkFilter)
+	if err := c.QueryParser(filter); err != nil {
+		log.Printf("Error parsing share link filter: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid query parameters"})
+	}
+
+	links, err := h.shareService.ListLinks(c.Context(), filter.TodoID)
+	if err != nil {
+		log.Printf("Error listing share links for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve share links"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(links)
+}
+
+// RevokeLink revokes a share link
+// @Summary Revoke a share link
+// @Description Revokes a share link; it stops working immediately. Creators may revoke their own links, workspace owners and admins any link of the workspace.
+// @Tags Sharing
+// @Param id path int true "Share link ID"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 204 "Share link revoked"
+// @Failure 400 {object} ErrorResponse "Invalid ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Share link not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /share-links/{id} [delete]
+func (h *ShareLinkHandler) RevokeLink(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	linkID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid share link ID format: %s", c.Params("id"))
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid share link ID format"})
+	}
+
+	if err := h.shareService.RevokeLink(c.Context(), userID, uint(linkID)); err != nil {
+		log.Printf("Error revoking share link %d for user %d: %v", linkID, userID, err)
+		return shareLinkErrorResponse(c, err, "Failed to revoke share link")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ViewShared shows what a share link shares
+// @Summary Open a share link
+// @Description Returns the read-only view of the todo or list behind a share link, without signing in. Who created, is assigned to or watches the todos is left out, and uploaded images are given as short-lived URLs. Password-protected links need the password in the X-Share-Password header.
+// @Tags Sharing
+// @Produce json
+// @Param token path string true "Token from the share link"
+// @Param X-Share-Password header string false "Password of a password-protected link"
+// @Success 200 {object} models.SharedView "Shared todo or list"
+// @Failure 401 {object} ErrorResponse "Password missing or wrong"
+// @Failure 404 {object} ErrorResponse "Invalid, revoked or expired link"
+// @Failure 429 {object} ErrorResponse "Too many wrong passwords; retry after the Retry-After header"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /shared/{token} [get]
+func (h *ShareLinkHandler) ViewShared(c *fiber.Ctx) error {
+	view, err := h.shareService.OpenLink(c.Context(), c.Params("token"), c.Get(SharePasswordHeader))
+	if err != nil {
+		var blocked *services.LoginBlockedError
+		if errors.As(err, &blocked) {
+			return loginBlockedResponse(c, blocked)
+		}
+		switch {
+		case errors.Is(err, services.ErrInvalidShareLink):
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+		case errors.Is(err, services.ErrShareLinkPassword):
+			return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: err.Error()})
+		}
+		log.Printf("Error opening share link: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to open share link"})
+	}
+
+	// Shared views must not be kept by shared caches, so revoking a link takes effect at once
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.Status(fiber.StatusOK).JSON(view)
+}
+
+func shareLinkErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, services.ErrTodoNotFound), errors.Is(err, services.ErrShareLinkNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrForbidden), errors.Is(err, services.ErrWorkspacePermission), errors.Is(err, services.ErrShareLinkPermission):
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrInvalidShareLinkExpiry):
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: fallback})
+}
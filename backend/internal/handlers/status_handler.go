@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type StatusHandler struct {
+	statusService services.StatusService
+	validate      *validator.Validate
+}
+
+func NewStatusHandler(statusService services.StatusService) *StatusHandler {
+	return &StatusHandler{
+		statusService: statusService,
+		validate:      validator.New(),
+	}
+}
+
+// ListStatuses lists the statuses of the list
+// @Summary List statuses
+// @Description Lists the statuses todos of the personal space or workspace can be in, in board order. Lists start with the statuses Pending, In Progress and Done.
+// @Tags Statuses
+// @Produce json
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {array} models.StatusDefinition "Statuses"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /statuses [get]
+func (h *StatusHandler) ListStatuses(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	statuses, err := h.statusService.ListStatuses(c.Context())
+	if err != nil {
+		log.Printf("Error listing statuses for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve statuses"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(statuses)
+}
+
+// CreateStatus adds a status to the list
+// @Summary Create a status
+// @Description Adds a status at the end of the board. Names are unique per list, ignoring case. Todos in a status marked is_done are completed. In a workspace only owners and admins may change statuses.
+// @Tags Statuses
+// @Accept json
+// @Produce json
+// @Param status body models.CreateStatusRequest true "Status"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 201 {object} models.StatusDefinition "Status created"
+// @Failure 400 {object} ErrorResponse "Validation error"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 409 {object} ErrorResponse "A status with this name already exists"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /statuses [post]
+func (h *StatusHandler) CreateStatus(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.CreateStatusRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing create status request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error creating status: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	status, err := h.statusService.CreateStatus(c.Context(), *req)
+	if err != nil {
+		log.Printf("Error creating status for user %d: %v", userID, err)
+		return statusErrorResponse(c, err, "Failed to create status")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(status)
+}
+
+// UpdateStatus changes a status
+// @Summary Update a status
+// @Description Changes the name, color, done flag or WIP limit of a status. Renaming a status renames it on its todos; changing the done flag completes or reopens them. A list must keep at least one open and one done status.
+// @Tags Statuses
+// @Accept json
+// @Produce json
+// @Param id path int true "Status ID"
+// @Param status body models.UpdateStatusRequest true "Fields to update"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.StatusDefinition "Status updated"
+// @Failure 400 {object} ErrorResponse "Validation error or no fields provided"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Status not found"
+// @Failure 409 {object} ErrorResponse "Duplicate name or last open or done status"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /statuses/{id} [patch]
+func (h *StatusHandler) UpdateStatus(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	statusID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid status ID format: %s", c.Params("id"))
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid status ID format"})
+	}
+
+	req := new(models.UpdateStatusRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing update status request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error updating status %d: %v", statusID, err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	status, err := h.statusService.UpdateStatus(c.Context(), uint(statusID), *req)
+	if err != nil {
+		log.Printf("Error updating status %d for user %d: %v", statusID, userID, err)
+		return statusErrorResponse(c, err, "Failed to update status")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(status)
+}
+
+// ReorderStatuses changes the order of the statuses
+// @Summary Reorder statuses
+// @Description Sets the board order of the statuses. The request must list every status of the list exactly once.
+// @Tags Statuses
+// @Accept json
+// @Produce json
+// @Param order body models.ReorderStatusesRequest true "Status IDs in their new order"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {array} models.StatusDefinition "Statuses in their new order"
+// @Failure 400 {object} ErrorResponse "Validation error or incomplete order"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /statuses/order [put]
+func (h *StatusHandler) ReorderStatuses(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.ReorderStatusesRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing reorder statuses request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error reordering statuses: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	statuses, err := h.statusService.ReorderStatuses(c.Context(), *req)
+	if err != nil {
+		log.Printf("Error reordering statuses for user %d: %v", userID, err)
+		return statusErrorResponse(c, err, "Failed to reorder statuses")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(statuses)
+}
+
+// DeleteStatus removes a status
+// @Summary Delete a status
+// @Description Deletes a status. Its todos move to the end of the status given by move_to, which is required while the status has todos. A list must keep at least one open and one done status.
+// @Tags Statuses
+// @Param id path int true "Status ID"
+// @Param move_to query int false "Status the todos of the deleted status move to"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 204 "Status deleted"
+// @Failure 400 {object} ErrorResponse "Invalid ID format or move_to status"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Status not found"
+// @Failure 409 {object} ErrorResponse "Status still has todos or is the last open or done status"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /statuses/{id} [delete]
+func (h *StatusHandler) DeleteStatus(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	statusID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid status ID format: %s", c.Params("id"))
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid status ID format"})
+	}
+
+	query := new(models.DeleteStatusQuery)
+	if err := c.QueryParser(query); err != nil {
+		log.Printf("Error parsing delete status query: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid query parameters"})
+	}
+
+	if err := h.statusService.DeleteStatus(c.Context(), uint(statusID), query.MoveTo); err != nil {
+		log.Printf("Error deleting status %d for user %d: %v", statusID, userID, err)
+		return statusErrorResponse(c, err, "Failed to delete status")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListTransitions lists the workflow rules of the list
+// @Summary List status transitions
+// @Description Lists the workflow rules of the personal space or workspace. A status with rules can only be entered through one of them: from from_status_id, or from any status when it is null, and only by assigned todos when requires_assignee is set. Statuses without rules can be entered from any status.
+// @Tags Statuses
+// @Produce json
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {array} models.StatusTransition "Transitions"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /statuses/transitions [get]
+func (h *StatusHandler) ListTransitions(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	transitions, err := h.statusService.ListTransitions(c.Context())
+	if err != nil {
+		log.Printf("Error listing status transitions for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve status transitions"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(transitions)
+}
+
+// CreateTransition adds a workflow rule to the list
+// @Summary Create a status transition
+// @Description Adds a workflow rule. Once a status has a rule, todos can only enter it through one of its rules. In a workspace only owners and admins may change workflow rules.
+// @Tags Statuses
+// @Accept json
+// @Produce json
+// @Param transition body models.CreateStatusTransitionRequest true "Transition"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 201 {object} models.StatusTransition "Transition created"
+// @Failure 400 {object} ErrorResponse "Validation error or statuses not of the list"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 409 {object} ErrorResponse "Transition already exists"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /statuses/transitions [post]
+func (h *StatusHandler) CreateTransition(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.CreateStatusTransitionRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing create transition request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error creating transition: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	transition, err := h.statusService.CreateTransition(c.Context(), *req)
+	if err != nil {
+		log.Printf("Error creating status transition for user %d: %v", userID, err)
+		return statusErrorResponse(c, err, "Failed to create status transition")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(transition)
+}
+
+// DeleteTransition removes a workflow rule
+// @Summary Delete a status transition
+// @Description Deletes a workflow rule. A status whose last rule is deleted can be entered from any status again.
+// @Tags Statuses
+// @Param id path int true "Transition ID"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 204 "Transition deleted"
+// @Failure 400 {object} ErrorResponse "Invalid ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Transition not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /statuses/transitions/{id} [delete]
+func (h *StatusHandler) DeleteTransition(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	transitionID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid transition ID format: %s", c.Params("id"))
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid transition ID format"})
+	}
+
+	if err := h.statusService.DeleteTransition(c.Context(), uint(transitionID)); err != nil {
+		log.Printf("Error deleting status transition %d for user %d: %v", transitionID, userID, err)
+		return statusErrorResponse(c, err, "Failed to delete status transition")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetBoard returns the board of the list
+// @Summary Get the board
+// @Description Returns the todos grouped by status, one column per status in board order with its todos in column order. count is the number of matching todos in the column; over_limit reports columns holding more todos than their WIP limit.
+// @Tags Statuses
+// @Produce json
+// @Param q query string false "Search title and description"
+// @Param limit query int false "Todos returned per column, 100 by default"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.Board "Board"
+// @Failure 400 {object} ErrorResponse "Invalid query parameters"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/board [get]
+func (h *StatusHandler) GetBoard(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	filter := new(models.BoardFilter)
+	if err := c.QueryParser(filter); err != nil {
+		log.Printf("Error parsing board filter: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid query parameters"})
+	}
+
+	if err := h.validate.Struct(filter); err != nil {
+		log.Printf("Validation error in board filter: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	board, err := h.statusService.GetBoard(c.Context(), *filter)
+	if err != nil {
+		log.Printf("Error building board for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve board"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(board)
+}
+
+func statusErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, services.ErrStatusNotFound), errors.Is(err, services.ErrTransitionNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrWorkspacePermission):
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrDuplicateStatus), errors.Is(err, services.ErrStatusInUse), errors.Is(err, services.ErrStatusRequired),
+		errors.Is(err, services.ErrDuplicateTransition):
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrUnknownStatus), errors.Is(err, services.ErrInvalidStatusOrder),
+		errors.Is(err, services.ErrInvalidStatusMove), errors.Is(err, services.ErrNoStatusFields), errors.Is(err, services.ErrInvalidTransition):
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: fallback})
+}
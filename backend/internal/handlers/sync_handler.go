@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type SyncHandler struct {
+	syncService services.SyncService
+	validate    *validator.Validate
+}
+
+func NewSyncHandler(syncService services.SyncService) *SyncHandler {
+	return &SyncHandler{
+		syncService: syncService,
+		validate:    validator.New(),
+	}
+}
+
+// Pull returns todos changed since a cursor
+// @Summary Pull todo changes
+// @Description Returns every todo created, updated or deleted (as a tombstone) since the cursor, with a new cursor. Omit the cursor for a full sync and keep pulling while has_more is true.
+// @Tags Sync
+// @Produce json
+// @Param since query string false "Cursor returned by the previous pull"
+// @Param limit query int false "Maximum number of changes to scan (default 500, max 1000)"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.SyncPullResponse "Changes since the cursor"
+// @Failure 400 {object} ErrorResponse "Invalid cursor"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /sync [get]
+func (h *SyncHandler) Pull(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	resp, err := h.syncService.Pull(c.Context(), userID, c.Query("since"), c.QueryInt("limit", services.DefaultSyncPullLimit))
+	if err != nil {
+		log.Printf("Error pulling changes for user %d: %v", userID, err)
+		if errors.Is(err, services.ErrInvalidSyncCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to pull changes"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// Push applies changes made by a client while offline
+// @Summary Push offline changes
+// @Description Applies a batch of client changes in order. Updates and deletes whose base_seq is older than the server's latest change are reported as conflicts together with the server version. A change whose client_id was already applied, such as one retried after a lost response, is not applied again and is reported as applied with the current server version.
+// @Tags Sync
+// @Accept json
+// @Produce json
+// @Param changes body models.SyncPushRequest true "Offline changes"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.SyncPushResponse "Per-change results"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid input"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /sync [post]
+func (h *SyncHandler) Push(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.SyncPushRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing sync push request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error during sync push: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	resp, err := h.syncService.Push(c.Context(), userID, req.Changes)
+	if err != nil {
+		log.Printf("Error pushing changes for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to push changes"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
@@ -31,10 +31,13 @@ func NewTodoHandler(todoService services.TodoService) *TodoHandler {
 // @Accept json
 // @Produce json
 // @Param todo body models.CreateTodoRequest true "Todo details (title required, description optional)"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
 // @Security BearerAuth
 // @Success 201 {object} models.Todo "Todo created successfully"
 // @Failure 400 {object} ErrorResponse "Validation error or invalid input"
 // @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Read-only workspace role or workspace todo limit reached"
+// @Failure 404 {object} ErrorResponse "Workspace not found"
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Router /todos [post]
 func (h *TodoHandler) CreateTodo(c *fiber.Ctx) error {
@@ -52,9 +55,12 @@ func (h *TodoHandler) CreateTodo(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
 	}
 
-	todo, err := h.todoService.CreateTodo(c.Context(), userID, req.Title, req.Description, req.ImageURL)
+	todo, err := h.todoService.CreateTodo(c.Context(), userID, req.Title, req.Description, req.ImageURL, req.DueDate)
 	if err != nil {
 		log.Printf("Error creating todo for user %d: %v", userID, err)
+		if errors.Is(err, services.ErrWorkspaceTodoQuota) {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to create todo"})
 	}
 
@@ -63,19 +69,88 @@ func (h *TodoHandler) CreateTodo(c *fiber.Ctx) error {
 
 // GetTodos retrieves all todo items for the authenticated user
 // @Summary Get all todo items
-// @Description Retrieves a list of all todo items for the logged-in user.
+// @Description Retrieves a list of all todo items for the logged-in user, optionally filtered.
 // @Tags Todos
 // @Produce json
+// @Param status query string false "Filter by status, one of the list's statuses"
+// @Param q query string false "Search in title and description"
+// @Param due query string false "Due overdue, today or this week, in the user's timezone" Enums(overdue, today, week)
+// @Param sort query string false "Order, defaults to the user's default_sort" Enums(created_desc, created_asc, due_asc, due_desc, title_asc, position)
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
 // @Security BearerAuth
 // @Success 200 {array} models.Todo "List of todo items"
+// @Failure 400 {object} ErrorResponse "Invalid filter"
 // @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Router /todos [get]
 func (h *TodoHandler) GetTodos(c *fiber.Ctx) error {
+	return h.listTodos(c, nil)
+}
+
+// GetAssignedTodos retrieves the todo items assigned to the authenticated user
+// @Summary Get todo items assigned to me
+// @Description Retrieves the todo items of the personal space or workspace that are assigned to the logged-in user, optionally filtered.
+// @Tags Todos
+// @Produce json
+// @Param status query string false "Filter by status, one of the list's statuses"
+// @Param q query string false "Search in title and description"
+// @Param due query string false "Due overdue, today or this week, in the user's timezone" Enums(overdue, today, week)
+// @Param sort query string false "Order, defaults to the user's default_sort" Enums(created_desc, created_asc, due_asc, due_desc, title_asc, position)
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {array} models.Todo "List of todo items"
+// @Failure 400 {object} ErrorResponse "Invalid filter"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/assigned [get]
+func (h *TodoHandler) GetAssignedTodos(c *fiber.Ctx) error {
+	return h.listTodos(c, func(filter *models.TodoFilter, userID uint) {
+		filter.AssigneeID = &userID
+	})
+}
+
+// GetWatchedTodos retrieves the todo items the authenticated user watches
+// @Summary Get todo items I am watching
+// @Description Retrieves the todo items of the personal space or workspace that the logged-in user watches, optionally filtered.
+// @Tags Todos
+// @Produce json
+// @Param status query string false "Filter by status, one of the list's statuses"
+// @Param q query string false "Search in title and description"
+// @Param due query string false "Due overdue, today or this week, in the user's timezone" Enums(overdue, today, week)
+// @Param sort query string false "Order, defaults to the user's default_sort" Enums(created_desc, created_asc, due_asc, due_desc, title_asc, position)
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {array} models.Todo "List of todo items"
+// @Failure 400 {object} ErrorResponse "Invalid filter"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/watching [get]
+func (h *TodoHandler) GetWatchedTodos(c *fiber.Ctx) error {
+	return h.listTodos(c, func(filter *models.TodoFilter, userID uint) {
+		filter.WatcherID = &userID
+	})
+}
+
+// listTodos lists the todos matching the query filter, further restricted by restrict when set
+func (h *TodoHandler) listTodos(c *fiber.Ctx, restrict func(filter *models.TodoFilter, userID uint)) error {
 	// Get user ID from middleware
 	userID := c.Locals(middleware.UserIDKey).(uint)
 
-	todos, err := h.todoService.GetTodosByUserID(c.Context(), userID)
+	filter := new(models.TodoFilter)
+	if err := c.QueryParser(filter); err != nil {
+		log.Printf("Error parsing todo filter: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid query parameters"})
+	}
+
+	if err := h.validate.Struct(filter); err != nil {
+		log.Printf("Validation error in todo filter: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+	if restrict != nil {
+		restrict(filter, userID)
+	}
+
+	todos, err := h.todoService.GetTodosByUserID(c.Context(), userID, *filter)
 	if err != nil {
 		log.Printf("Error getting todos for user %d: %v", userID, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve todos"})
@@ -95,6 +170,7 @@ func (h *TodoHandler) GetTodos(c *fiber.Ctx) error {
 // @Tags Todos
 // @Produce json
 // @Param id path int true "Todo ID"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
 // @Security BearerAuth
 // @Success 200 {object} models.Todo "Todo item details"
 // @Failure 400 {object} ErrorResponse "Invalid ID format"
@@ -135,6 +211,7 @@ func (h *TodoHandler) GetTodo(c *fiber.Ctx) error {
 // @Produce json
 // @Param id path int true "Todo ID" Format(uint)
 // @Param todo body models.UpdateTodoRequest true "Fields to update"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
 // @Security BearerAuth
 // @Success 200 {object} models.Todo "Todo updated successfully"
 // @Failure 400 {object} ErrorResponse "Invalid ID format, validation error, or no update fields provided"
@@ -163,7 +240,7 @@ func (h *TodoHandler) UpdateTodo(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
 	}
 
-	updatedTodo, err := h.todoService.UpdateTodo(c.Context(), userID, uint(todoID), req.Title, req.Description, req.ImageURL)
+	updatedTodo, err := h.todoService.UpdateTodo(c.Context(), userID, uint(todoID), req.Title, req.Description, req.ImageURL, req.DueDate)
 	if err != nil {
 		log.Printf("Error service UpdateTodo for todo ID %d, user %d: %v", todoID, userID, err)
 		if errors.Is(err, services.ErrTodoNotFound) {
@@ -183,18 +260,20 @@ func (h *TodoHandler) UpdateTodo(c *fiber.Ctx) error {
 
 // UpdateTodoStatus updates the status of a specific todo item
 // @Summary Update todo status
-// @Description Updates the status (Pending, In Progress, Done) of a specific todo item.
+// @Description Moves a todo item to the end of another of the list's statuses. Moving into a done status completes the todo and moving out of one reopens it. Statuses at their WIP limit take no more todos. A todo with open blockers is only completed when force is set.
 // @Tags Todos
 // @Accept json
 // @Produce json
 // @Param id path int true "Todo ID"
 // @Param status body models.UpdateTodoStatusRequest true "New status"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
 // @Security BearerAuth
 // @Success 200 {object} models.Todo "Todo updated successfully"
-// @Failure 400 {object} ErrorResponse "Invalid ID format, validation error, or invalid input"
+// @Failure 400 {object} ErrorResponse "Invalid ID format, validation error, or status not defined for the list"
 // @Failure 401 {object} ErrorResponse "Unauthorized"
 // @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 404 {object} ErrorResponse "Todo not found"
+// @Failure 409 {object} TransitionErrorResponse "Transition not allowed by the workflow rules, status at its WIP limit, or open blockers"
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Router /todos/{id}/status [put]
 func (h *TodoHandler) UpdateTodoStatus(c *fiber.Ctx) error {
@@ -217,27 +296,136 @@ func (h *TodoHandler) UpdateTodoStatus(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed: Invalid status value", Details: err.Error()})
 	}
 
-	updatedTodo, err := h.todoService.UpdateTodoStatus(c.Context(), userID, uint(todoID), req.Status)
+	updatedTodo, err := h.todoService.UpdateTodoStatus(c.Context(), userID, uint(todoID), req.Status, req.Force)
 	if err != nil {
 		log.Printf("Error updating status for todo ID %d, user %d: %v", todoID, userID, err)
-		if errors.Is(err, services.ErrTodoNotFound) {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
-		}
-		if errors.Is(err, services.ErrForbidden) {
-			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update todo status"})
+		return todoStatusErrorResponse(c, err, "Failed to update todo status")
 	}
 
 	return c.Status(fiber.StatusOK).JSON(updatedTodo)
 }
 
+// MoveTodo places a todo item on the board
+// @Summary Move a todo on the board
+// @Description Places a todo item at a zero-based position in the column of a status, shifting the other todos of the column. Moving to another status completes or reopens the todo like changing its status, and is refused when that status is at its WIP limit. A todo with open blockers is only completed when force is set.
+// @Tags Todos
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param move body models.MoveTodoRequest true "Status and position"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.Todo "Todo moved"
+// @Failure 400 {object} ErrorResponse "Invalid ID format, validation error, or status not defined for the list"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Todo not found"
+// @Failure 409 {object} TransitionErrorResponse "Transition not allowed by the workflow rules, status at its WIP limit, or open blockers"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/{id}/position [put]
+func (h *TodoHandler) MoveTodo(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	todoIDStr := c.Params("id")
+	todoID, err := strconv.ParseUint(todoIDStr, 10, 32)
+	if err != nil {
+		log.Printf("Invalid todo ID format: %s", todoIDStr)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid todo ID format"})
+	}
+
+	req := new(models.MoveTodoRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing move todo request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error moving todo: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	todo, err := h.todoService.MoveTodo(c.Context(), userID, uint(todoID), *req)
+	if err != nil {
+		log.Printf("Error moving todo ID %d, user %d: %v", todoID, userID, err)
+		return todoStatusErrorResponse(c, err, "Failed to move todo")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(todo)
+}
+
+// GetTransitions lists the statuses a todo item can move to
+// @Summary List allowed status transitions
+// @Description Tells for every other status of the list whether the workflow rules let the todo item move there, with the reason when they do not.
+// @Tags Todos
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.TodoTransitions "Transitions"
+// @Failure 400 {object} ErrorResponse "Invalid ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Todo not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/{id}/transitions [get]
+func (h *TodoHandler) GetTransitions(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	todoIDStr := c.Params("id")
+	todoID, err := strconv.ParseUint(todoIDStr, 10, 32)
+	if err != nil {
+		log.Printf("Invalid todo ID format: %s", todoIDStr)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid todo ID format"})
+	}
+
+	transitions, err := h.todoService.GetTransitions(c.Context(), userID, uint(todoID))
+	if err != nil {
+		log.Printf("Error retrieving transitions of todo ID %d, user %d: %v", todoID, userID, err)
+		return todoStatusErrorResponse(c, err, "Failed to retrieve transitions")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(transitions)
+}
+
+// TransitionErrorResponse reports a status change the workflow rules of the list do not allow
+// @name TransitionErrorResponse
+type TransitionErrorResponse struct {
+	Error           string              `json:"error"`
+	From            models.TodoStatus   `json:"from"`
+	To              models.TodoStatus   `json:"to"`
+	Reason          string              `json:"reason"`
+	AllowedStatuses []models.TodoStatus `json:"allowed_statuses"`
+}
+
+func todoStatusErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	var transition *services.TransitionError
+	if errors.As(err, &transition) {
+		return c.Status(fiber.StatusConflict).JSON(TransitionErrorResponse{
+			Error:           services.ErrTransitionNotAllowed.Error(),
+			From:            transition.From,
+			To:              transition.To,
+			Reason:          transition.Reason,
+			AllowedStatuses: transition.Allowed,
+		})
+	}
+	switch {
+	case errors.Is(err, services.ErrTodoNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrUnknownStatus):
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrWIPLimitReached), errors.Is(err, services.ErrTodoBlocked):
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: fallback})
+}
+
 // DeleteTodo removes a specific todo item
 // @Summary Delete a todo item
 // @Description Deletes a specific todo item by its ID.
 // @Tags Todos
 // @Produce json
 // @Param id path int true "Todo ID"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
 // @Security BearerAuth
 // @Success 204 "No Content (Todo deleted successfully)"
 // @Failure 400 {object} ErrorResponse "Invalid ID format"
@@ -269,3 +457,294 @@ func (h *TodoHandler) DeleteTodo(c *fiber.Ctx) error {
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
+
+// AssignTodo sets or clears the assignee of a todo item
+// @Summary Assign a todo item
+// @Description Makes a member of the todo's space responsible for it, or unassigns it when assignee_id is null. The assignee starts watching the todo.
+// @Tags Todos
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param assignee body models.AssignTodoRequest true "New assignee"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.Todo "Todo assigned"
+// @Failure 400 {object} ErrorResponse "Invalid ID format or assignee is not a member"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Todo not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/{id}/assignee [put]
+func (h *TodoHandler) AssignTodo(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	todoIDStr := c.Params("id")
+	todoID, err := strconv.ParseUint(todoIDStr, 10, 32)
+	if err != nil {
+		log.Printf("Invalid todo ID format: %s", todoIDStr)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid todo ID format"})
+	}
+
+	req := new(models.AssignTodoRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing assign todo request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	todo, err := h.todoService.AssignTodo(c.Context(), userID, uint(todoID), req.AssigneeID)
+	if err != nil {
+		log.Printf("Error assigning todo ID %d for user %d: %v", todoID, userID, err)
+		return todoMemberErrorResponse(c, err, "Failed to assign todo")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(todo)
+}
+
+// GetWatchers lists the watchers of a todo item
+// @Summary List todo watchers
+// @Description Lists the users watching a todo item.
+// @Tags Todos
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {array} models.TodoWatcherResponse "Watchers"
+// @Failure 400 {object} ErrorResponse "Invalid ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Todo not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/{id}/watchers [get]
+func (h *TodoHandler) GetWatchers(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	todoIDStr := c.Params("id")
+	todoID, err := strconv.ParseUint(todoIDStr, 10, 32)
+	if err != nil {
+		log.Printf("Invalid todo ID format: %s", todoIDStr)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid todo ID format"})
+	}
+
+	watchers, err := h.todoService.ListWatchers(c.Context(), userID, uint(todoID))
+	if err != nil {
+		log.Printf("Error listing watchers of todo ID %d for user %d: %v", todoID, userID, err)
+		return todoMemberErrorResponse(c, err, "Failed to retrieve watchers")
+	}
+	if watchers == nil {
+		watchers = []models.TodoWatcherResponse{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(watchers)
+}
+
+// AddWatcher makes a member of the todo's space watch it
+// @Summary Add a todo watcher
+// @Description Makes a member of the todo's space watch the todo item. Adding an existing watcher has no effect.
+// @Tags Todos
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param watcher body models.AddTodoWatcherRequest true "User to add"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {array} models.TodoWatcherResponse "Watchers after the addition"
+// @Failure 400 {object} ErrorResponse "Validation error or user is not a member"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Todo not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/{id}/watchers [post]
+func (h *TodoHandler) AddWatcher(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	todoIDStr := c.Params("id")
+	todoID, err := strconv.ParseUint(todoIDStr, 10, 32)
+	if err != nil {
+		log.Printf("Invalid todo ID format: %s", todoIDStr)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid todo ID format"})
+	}
+
+	req := new(models.AddTodoWatcherRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing add watcher request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error adding watcher: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	watchers, err := h.todoService.AddWatcher(c.Context(), userID, uint(todoID), req.UserID)
+	if err != nil {
+		log.Printf("Error adding watcher to todo ID %d for user %d: %v", todoID, userID, err)
+		return todoMemberErrorResponse(c, err, "Failed to add watcher")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(watchers)
+}
+
+// RemoveWatcher stops a user watching a todo item
+// @Summary Remove a todo watcher
+// @Description Stops a user watching the todo item.
+// @Tags Todos
+// @Param id path int true "Todo ID"
+// @Param userID path int true "Watcher's user ID"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 204 "Watcher removed"
+// @Failure 400 {object} ErrorResponse "Invalid ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Todo or watcher not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/{id}/watchers/{userID} [delete]
+func (h *TodoHandler) RemoveWatcher(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	todoID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid todo ID format: %s", c.Params("id"))
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid todo ID format"})
+	}
+	watcherID, err := strconv.ParseUint(c.Params("userID"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid user ID format: %s", c.Params("userID"))
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid user ID format"})
+	}
+
+	if err := h.todoService.RemoveWatcher(c.Context(), userID, uint(todoID), uint(watcherID)); err != nil {
+		log.Printf("Error removing watcher %d from todo ID %d for user %d: %v", watcherID, todoID, userID, err)
+		return todoMemberErrorResponse(c, err, "Failed to remove watcher")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// AddBlocker makes another todo block a todo item
+// @Summary Add a blocker
+// @Description Records that another todo of the list blocks this todo item. A todo with open blockers can only be completed with force. Links that would make a todo wait on itself, directly or through other todos, are refused.
+// @Tags Todos
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param blocker body models.AddBlockerRequest true "Blocking todo"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.Todo "Todo with its blockers"
+// @Failure 400 {object} ErrorResponse "Invalid ID format, validation error, or todo blocking itself"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Todo or blocker not found"
+// @Failure 409 {object} ErrorResponse "Dependency exists or would create a cycle"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/{id}/blockers [post]
+func (h *TodoHandler) AddBlocker(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	todoIDStr := c.Params("id")
+	todoID, err := strconv.ParseUint(todoIDStr, 10, 32)
+	if err != nil {
+		log.Printf("Invalid todo ID format: %s", todoIDStr)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid todo ID format"})
+	}
+
+	req := new(models.AddBlockerRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing add blocker request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error adding blocker: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	todo, err := h.todoService.AddBlocker(c.Context(), userID, uint(todoID), req.BlockerID)
+	if err != nil {
+		log.Printf("Error adding blocker %d to todo ID %d for user %d: %v", req.BlockerID, todoID, userID, err)
+		return todoDependencyErrorResponse(c, err, "Failed to add blocker")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(todo)
+}
+
+// RemoveBlocker stops a todo blocking a todo item
+// @Summary Remove a blocker
+// @Description Removes the dependency of the todo item on a blocking todo.
+// @Tags Todos
+// @Param id path int true "Todo ID"
+// @Param blockerID path int true "Blocking todo ID"
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 204 "Blocker removed"
+// @Failure 400 {object} ErrorResponse "Invalid ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Todo or dependency not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/{id}/blockers/{blockerID} [delete]
+func (h *TodoHandler) RemoveBlocker(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	todoID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid todo ID format: %s", c.Params("id"))
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid todo ID format"})
+	}
+	blockerID, err := strconv.ParseUint(c.Params("blockerID"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid blocker ID format: %s", c.Params("blockerID"))
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid blocker ID format"})
+	}
+
+	if err := h.todoService.RemoveBlocker(c.Context(), userID, uint(todoID), uint(blockerID)); err != nil {
+		log.Printf("Error removing blocker %d from todo ID %d for user %d: %v", blockerID, todoID, userID, err)
+		return todoDependencyErrorResponse(c, err, "Failed to remove blocker")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetDependencyGraph returns the dependency graph of the list
+// @Summary Get the dependency graph
+// @Description Returns the todos that block or are blocked by other todos, the dependencies between them, and an order of their IDs in which every todo follows its blockers. Todos that are in or wait on a cycle cannot be ordered and are listed under cyclic instead.
+// @Tags Todos
+// @Produce json
+// @Param X-Workspace-ID header int false "Workspace to work in, defaults to the personal space"
+// @Security BearerAuth
+// @Success 200 {object} models.DependencyGraph "Dependency graph"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /todos/graph [get]
+func (h *TodoHandler) GetDependencyGraph(c *fiber.Ctx) error {
+	graph, err := h.todoService.GetDependencyGraph(c.Context())
+	if err != nil {
+		log.Printf("Error building dependency graph: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve dependency graph"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(graph)
+}
+
+// todoDependencyErrorResponse maps errors of the blocker endpoints to responses
+func todoDependencyErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, services.ErrTodoNotFound), errors.Is(err, services.ErrDependencyNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrSelfDependency):
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrDependencyExists), errors.Is(err, services.ErrDependencyCycle):
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: fallback})
+}
+
+// todoMemberErrorResponse maps errors of the assignee and watcher endpoints to responses
+func todoMemberErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, services.ErrTodoNotFound), errors.Is(err, services.ErrWatcherNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrUserNotInTodoScope):
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: fallback})
+}
@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/middleware"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/services"
+	"log"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type WorkspaceHandler struct {
+	workspaceService services.WorkspaceService
+	validate         *validator.Validate
+}
+
+func NewWorkspaceHandler(workspaceService services.WorkspaceService) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		workspaceService: workspaceService,
+		validate:         validator.New(),
+	}
+}
+
+// CreateWorkspace creates a workspace owned by the authenticated user
+// @Summary Create a workspace
+// @Description Creates a workspace with the default quotas and makes the caller its owner. Todo endpoints work in a workspace when called under /workspaces/{workspaceID} or with the X-Workspace-ID header.
+// @Tags Workspaces
+// @Accept json
+// @Produce json
+// @Param workspace body models.CreateWorkspaceRequest true "Workspace details"
+// @Security BearerAuth
+// @Success 201 {object} models.Workspace "Workspace created"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid input"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /workspaces [post]
+func (h *WorkspaceHandler) CreateWorkspace(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	req := new(models.CreateWorkspaceRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing create workspace request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error creating workspace: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	workspace, err := h.workspaceService.CreateWorkspace(c.Context(), userID, *req)
+	if err != nil {
+		log.Printf("Error creating workspace for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to create workspace"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(workspace)
+}
+
+// ListWorkspaces lists the workspaces the authenticated user is a member of
+// @Summary List own workspaces
+// @Description Lists the workspaces the caller belongs to, with the caller's role in each.
+// @Tags Workspaces
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Workspace "Workspaces"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /workspaces [get]
+func (h *WorkspaceHandler) ListWorkspaces(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+
+	workspaces, err := h.workspaceService.ListWorkspaces(c.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing workspaces of user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to retrieve workspaces"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(workspaces)
+}
+
+// GetWorkspace returns a workspace the authenticated user is a member of
+// @Summary Get a workspace
+// @Description Returns the workspace settings, quotas and the caller's role.
+// @Tags Workspaces
+// @Produce json
+// @Param workspaceID path int true "Workspace ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Workspace "Workspace"
+// @Failure 400 {object} ErrorResponse "Invalid workspace ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 404 {object} ErrorResponse "Workspace not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /workspaces/{workspaceID} [get]
+func (h *WorkspaceHandler) GetWorkspace(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	workspaceID, err := pathWorkspaceID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid workspace ID"})
+	}
+
+	workspace, err := h.workspaceService.GetWorkspace(c.Context(), userID, workspaceID)
+	if err != nil {
+		return workspaceErrorResponse(c, err, "Failed to retrieve workspace")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(workspace)
+}
+
+// UpdateWorkspace changes a workspace's settings
+// @Summary Update a workspace
+// @Description Changes the name and description. Requires the owner or admin role.
+// @Tags Workspaces
+// @Accept json
+// @Produce json
+// @Param workspaceID path int true "Workspace ID"
+// @Param workspace body models.UpdateWorkspaceRequest true "Fields to update"
+// @Security BearerAuth
+// @Success 200 {object} models.Workspace "Updated workspace"
+// @Failure 400 {object} ErrorResponse "Validation error or no fields provided"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Workspace role does not allow this"
+// @Failure 404 {object} ErrorResponse "Workspace not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /workspaces/{workspaceID} [patch]
+func (h *WorkspaceHandler) UpdateWorkspace(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	workspaceID, err := pathWorkspaceID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid workspace ID"})
+	}
+
+	req := new(models.UpdateWorkspaceRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing update workspace request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error updating workspace: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	workspace, err := h.workspaceService.UpdateWorkspace(c.Context(), userID, workspaceID, *req)
+	if err != nil {
+		return workspaceErrorResponse(c, err, "Failed to update workspace")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(workspace)
+}
+
+// DeleteWorkspace deletes a workspace with all of its todos
+// @Summary Delete a workspace
+// @Description Permanently deletes the workspace, its todos and memberships. Requires the owner role.
+// @Tags Workspaces
+// @Param workspaceID path int true "Workspace ID"
+// @Security BearerAuth
+// @Success 204 "Workspace deleted"
+// @Failure 400 {object} ErrorResponse "Invalid workspace ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Workspace role does not allow this"
+// @Failure 404 {object} ErrorResponse "Workspace not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /workspaces/{workspaceID} [delete]
+func (h *WorkspaceHandler) DeleteWorkspace(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	workspaceID, err := pathWorkspaceID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid workspace ID"})
+	}
+
+	if err := h.workspaceService.DeleteWorkspace(c.Context(), userID, workspaceID); err != nil {
+		return workspaceErrorResponse(c, err, "Failed to delete workspace")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListMembers lists the members of a workspace
+// @Summary List workspace members
+// @Description Lists the members of the workspace and their roles.
+// @Tags Workspaces
+// @Produce json
+// @Param workspaceID path int true "Workspace ID"
+// @Security BearerAuth
+// @Success 200 {array} models.WorkspaceMemberResponse "Members"
+// @Failure 400 {object} ErrorResponse "Invalid workspace ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 404 {object} ErrorResponse "Workspace not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /workspaces/{workspaceID}/members [get]
+func (h *WorkspaceHandler) ListMembers(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	workspaceID, err := pathWorkspaceID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid workspace ID"})
+	}
+
+	members, err := h.workspaceService.ListMembers(c.Context(), userID, workspaceID)
+	if err != nil {
+		return workspaceErrorResponse(c, err, "Failed to retrieve members")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(members)
+}
+
+// AddMember adds an existing user to a workspace
+// @Summary Add a workspace member
+// @Description Adds the user with the given email to the workspace. Requires the owner or admin role; the member quota applies.
+// @Tags Workspaces
+// @Accept json
+// @Produce json
+// @Param workspaceID path int true "Workspace ID"
+// @Param member body models.AddWorkspaceMemberRequest true "User email and role (admin, member, viewer)"
+// @Security BearerAuth
+// @Success 201 {array} models.WorkspaceMemberResponse "Members after the addition"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid input"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Workspace role does not allow this or member limit reached"
+// @Failure 404 {object} ErrorResponse "Workspace or user not found"
+// @Failure 409 {object} ErrorResponse "User is already a member"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /workspaces/{workspaceID}/members [post]
+func (h *WorkspaceHandler) AddMember(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	workspaceID, err := pathWorkspaceID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid workspace ID"})
+	}
+
+	req := new(models.AddWorkspaceMemberRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing add member request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error adding workspace member: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	members, err := h.workspaceService.AddMember(c.Context(), userID, workspaceID, *req)
+	if err != nil {
+		return workspaceErrorResponse(c, err, "Failed to add member")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(members)
+}
+
+// UpdateMemberRole changes a member's role in a workspace
+// @Summary Change a member's role
+// @Description Changes the role of a member. Requires the owner or admin role; only owners can change owners or grant the owner role. A workspace always keeps one owner.
+// @Tags Workspaces
+// @Accept json
+// @Produce json
+// @Param workspaceID path int true "Workspace ID"
+// @Param userID path int true "Member's user ID"
+// @Param role body models.UpdateWorkspaceMemberRequest true "New role (owner, admin, member, viewer)"
+// @Security BearerAuth
+// @Success 204 "Role changed"
+// @Failure 400 {object} ErrorResponse "Validation error or invalid input"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Workspace role does not allow this"
+// @Failure 404 {object} ErrorResponse "Workspace or member not found"
+// @Failure 409 {object} ErrorResponse "Last owner"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /workspaces/{workspaceID}/members/{userID} [put]
+func (h *WorkspaceHandler) UpdateMemberRole(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	workspaceID, memberID, err := pathWorkspaceMember(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid workspace or user ID"})
+	}
+
+	req := new(models.UpdateWorkspaceMemberRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing update member request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error updating workspace member: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	if err := h.workspaceService.UpdateMemberRole(c.Context(), userID, workspaceID, memberID, req.Role); err != nil {
+		return workspaceErrorResponse(c, err, "Failed to update member")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RemoveMember removes a member from a workspace
+// @Summary Remove a workspace member
+// @Description Removes a member. Members can always leave; removing others requires the owner or admin role. A workspace always keeps one owner.
+// @Tags Workspaces
+// @Param workspaceID path int true "Workspace ID"
+// @Param userID path int true "Member's user ID"
+// @Security BearerAuth
+// @Success 204 "Member removed"
+// @Failure 400 {object} ErrorResponse "Invalid workspace or user ID"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Workspace role does not allow this"
+// @Failure 404 {object} ErrorResponse "Workspace or member not found"
+// @Failure 409 {object} ErrorResponse "Last owner"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /workspaces/{workspaceID}/members/{userID} [delete]
+func (h *WorkspaceHandler) RemoveMember(c *fiber.Ctx) error {
+	userID := c.Locals(middleware.UserIDKey).(uint)
+	workspaceID, memberID, err := pathWorkspaceMember(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid workspace or user ID"})
+	}
+
+	if err := h.workspaceService.RemoveMember(c.Context(), userID, workspaceID, memberID); err != nil {
+		return workspaceErrorResponse(c, err, "Failed to remove member")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// UpdateWorkspaceQuota changes a workspace's quotas
+// @Summary Change workspace quotas
+// @Description Sets the member and todo limits of a workspace; zero means unlimited. Requires the admin role.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Workspace ID"
+// @Param quota body models.UpdateWorkspaceQuotaRequest true "New quotas"
+// @Security BearerAuth
+// @Success 200 {object} models.Workspace "Updated workspace"
+// @Failure 400 {object} ErrorResponse "Validation error or no fields provided"
+// @Failure 401 {object} ErrorResponse "Unauthorized (invalid/missing token)"
+// @Failure 403 {object} ErrorResponse "Not an administrator"
+// @Failure 404 {object} ErrorResponse "Workspace not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/workspaces/{id}/quota [put]
+func (h *WorkspaceHandler) UpdateWorkspaceQuota(c *fiber.Ctx) error {
+	workspaceID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid workspace ID"})
+	}
+
+	req := new(models.UpdateWorkspaceQuotaRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Printf("Error parsing update quota request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		log.Printf("Validation error updating workspace quota: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Validation failed", Details: err.Error()})
+	}
+
+	workspace, err := h.workspaceService.UpdateQuota(c.Context(), uint(workspaceID), *req)
+	if err != nil {
+		return workspaceErrorResponse(c, err, "Failed to update workspace quota")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(workspace)
+}
+
+func pathWorkspaceID(c *fiber.Ctx) (uint, error) {
+	workspaceID, err := strconv.ParseUint(c.Params(middleware.WorkspaceParam), 10, 32)
+	if err != nil {
+		log.Printf("Invalid workspace ID format: %s", c.Params(middleware.WorkspaceParam))
+		return 0, err
+	}
+	return uint(workspaceID), nil
+}
+
+func pathWorkspaceMember(c *fiber.Ctx) (uint, uint, error) {
+	workspaceID, err := pathWorkspaceID(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	memberID, err := strconv.ParseUint(c.Params("userID"), 10, 32)
+	if err != nil {
+		log.Printf("Invalid user ID format: %s", c.Params("userID"))
+		return 0, 0, err
+	}
+	return workspaceID, uint(memberID), nil
+}
+
+func workspaceErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	log.Printf("Workspace request failed: %v", err)
+	switch {
+	case errors.Is(err, services.ErrWorkspaceNotFound), errors.Is(err, services.ErrWorkspaceMemberNotFound), errors.Is(err, services.ErrUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrWorkspacePermission), errors.Is(err, services.ErrWorkspaceMemberQuota):
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrAlreadyWorkspaceMember), errors.Is(err, services.ErrLastWorkspaceOwner):
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrNoWorkspaceFields):
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: fallback})
+}
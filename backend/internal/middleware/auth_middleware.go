@@ -1,8 +1,14 @@
 package middleware
 
 import (
-	"github.com/xNatthapol/todo-list/internal/config"
+	"context"
+	"encoding/base64"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
 	"github.com/xNatthapol/todo-list/internal/utils"
+	"log"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,10 +17,44 @@ import (
 const (
 	AuthorizationHeaderKey = "Authorization"
 	BearerSchema           = "Bearer"
+	BasicSchema            = "Basic"
 	UserIDKey              = "userID"
+	// BasicAuthRealm is announced to clients, such as calendar apps, that sign in with basic auth
+	BasicAuthRealm = "TodoList"
+	// AccessTokenKey holds the *models.PersonalAccessToken when a request is authenticated with one
+	AccessTokenKey = "accessToken"
+	// SessionIDKey holds the login session ID when a request is authenticated with a JWT
+	SessionIDKey = "sessionID"
+	// ImpersonatorIDKey holds the administrator's user ID when a session was started by impersonation
+	ImpersonatorIDKey = "impersonatorID"
+	// WorkspaceHeaderKey selects the workspace a request works in; without it the user's personal space is used
+	WorkspaceHeaderKey = "X-Workspace-ID"
+	// WorkspaceParam is the path parameter that selects the workspace on /workspaces/:workspaceID routes
+	WorkspaceParam = "workspaceID"
 )
 
-func Protected(cfg *config.Config) fiber.Handler {
+// AccessTokenAuthenticator resolves personal access tokens presented as bearer tokens
+type AccessTokenAuthenticator interface {
+	AuthenticateAccessToken(ctx context.Context, token string) (*models.PersonalAccessToken, error)
+}
+
+// UserFinder loads the authenticated user for role checks
+type UserFinder interface {
+	FindByID(ctx context.Context, id uint) (*models.User, error)
+}
+
+// WorkspaceMembershipFinder loads a user's membership of a workspace
+type WorkspaceMembershipFinder interface {
+	FindMembership(ctx context.Context, workspaceID, userID uint) (*models.WorkspaceMember, error)
+}
+
+// SessionValidator checks that the login session behind a JWT has not been revoked
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, sessionID string, userID uint) error
+}
+
+// Protected accepts either a JWT issued at login or a personal access token
+func Protected(keys *utils.KeyRing, accessTokens AccessTokenAuthenticator, sessions SessionValidator) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get(AuthorizationHeaderKey)
 		if authHeader == "" {
@@ -27,14 +67,163 @@ func Protected(cfg *config.Config) fiber.Handler {
 		}
 
 		tokenString := parts[1]
-		claims, err := utils.ValidateJWT(tokenString, cfg)
+		if strings.HasPrefix(tokenString, models.AccessTokenPrefix) {
+			token, err := accessTokens.AuthenticateAccessToken(c.Context(), tokenString)
+			if err != nil {
+				log.Printf("Access token authentication failed: %v", err)
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
+			}
+
+			c.Locals(UserIDKey, token.UserID)
+			c.Locals(AccessTokenKey, token)
+			return c.Next()
+		}
+
+		claims, err := utils.ValidateJWT(keys, tokenString)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token", "details": err.Error()})
 		}
 
+		// Every access token belongs to a session, which is how it is revoked
+		if claims.SessionID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
+		}
+		if err := sessions.ValidateSession(c.Context(), claims.SessionID, claims.UserID); err != nil {
+			log.Printf("Session validation failed for user %d: %v", claims.UserID, err)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Session has been revoked or expired"})
+		}
+		c.Locals(SessionIDKey, claims.SessionID)
+		if claims.Actor != nil {
+			actorID, err := strconv.ParseUint(claims.Actor.Subject, 10, 64)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
+			}
+			c.Locals(ImpersonatorIDKey, uint(actorID))
+		}
+
 		// Set user ID in context locals for handlers to access
 		c.Locals(UserIDKey, claims.UserID)
 
 		return c.Next()
 	}
 }
+
+// AppPassword accepts a personal access token sent as the password of basic auth, for clients
+// such as calendar apps that cannot send bearer tokens, or as a bearer token. The basic auth
+// username is not checked; the token alone identifies the user. Login JWTs are not accepted.
+func AppPassword(accessTokens AccessTokenAuthenticator) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var tokenString string
+		schema, credentials, _ := strings.Cut(c.Get(AuthorizationHeaderKey), " ")
+		switch {
+		case strings.EqualFold(schema, BasicSchema):
+			if decoded, err := base64.StdEncoding.DecodeString(credentials); err == nil {
+				_, tokenString, _ = strings.Cut(string(decoded), ":")
+			}
+		case schema == BearerSchema:
+			tokenString = credentials
+		}
+
+		if strings.HasPrefix(tokenString, models.AccessTokenPrefix) {
+			token, err := accessTokens.AuthenticateAccessToken(c.Context(), tokenString)
+			if err == nil {
+				c.Locals(UserIDKey, token.UserID)
+				c.Locals(AccessTokenKey, token)
+				return c.Next()
+			}
+			log.Printf("App password authentication failed: %v", err)
+		}
+
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="`+BasicAuthRealm+`", charset="UTF-8"`)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "An access token is required as password"})
+	}
+}
+
+// RequireScope rejects requests authenticated with an access token that lacks scope.
+// Requests authenticated with a login JWT have full access.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, ok := c.Locals(AccessTokenKey).(*models.PersonalAccessToken)
+		if ok && !token.HasScope(scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access token is missing the required scope", "details": scope})
+		}
+		return c.Next()
+	}
+}
+
+// RejectAccessTokens restricts a route to interactive logins, e.g. for managing the tokens themselves
+func RejectAccessTokens() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := c.Locals(AccessTokenKey).(*models.PersonalAccessToken); ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This endpoint cannot be used with an access token"})
+		}
+		return c.Next()
+	}
+}
+
+// RejectImpersonation keeps administrators acting as a user away from the user's credentials
+func RejectImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := c.Locals(ImpersonatorIDKey).(uint); ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This endpoint cannot be used while impersonating a user"})
+		}
+		return c.Next()
+	}
+}
+
+// RequireRole restricts a route to users holding one of roles. The role is read from the
+// database so a demotion takes effect immediately, and impersonated sessions are refused.
+func RequireRole(users UserFinder, roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := c.Locals(ImpersonatorIDKey).(uint); ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This endpoint cannot be used while impersonating a user"})
+		}
+
+		userID := c.Locals(UserIDKey).(uint)
+		user, err := users.FindByID(c.Context(), userID)
+		if err != nil {
+			log.Printf("Role check failed for user %d: %v", userID, err)
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Insufficient permissions"})
+		}
+		if user.IsDisabled() || !slices.Contains(roles, user.Role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Insufficient permissions"})
+		}
+		return c.Next()
+	}
+}
+
+// ResolveTenant selects the tenant a request works on from the workspace path parameter or the
+// X-Workspace-ID header, falling back to the user's personal space. Repository queries made with
+// c.Context() are restricted to that tenant. Viewers may only use safe methods.
+func ResolveTenant(workspaces WorkspaceMembershipFinder) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals(UserIDKey).(uint)
+		tenant := models.Tenant{UserID: userID}
+
+		raw := c.Params(WorkspaceParam)
+		if raw == "" {
+			raw = c.Get(WorkspaceHeaderKey)
+		}
+		if raw != "" {
+			workspaceID, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid workspace ID"})
+			}
+			member, err := workspaces.FindMembership(c.Context(), uint(workspaceID), userID)
+			if err != nil {
+				// Non-members are told the workspace does not exist
+				log.Printf("Workspace %d not available to user %d: %v", workspaceID, userID, err)
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Workspace not found"})
+			}
+			if !member.Role.CanWrite() && c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Your workspace role is read-only"})
+			}
+			tenant.WorkspaceID = &member.WorkspaceID
+			tenant.Role = member.Role
+			tenant.MaxTodos = member.Workspace.MaxTodos
+		}
+
+		c.Locals(repositories.TenantKey, tenant)
+		return c.Next()
+	}
+}
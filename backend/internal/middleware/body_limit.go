@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// LimitBody rejects requests whose body is larger than limit unless allowLarger accepts them.
+// The server's BodyLimit covers every route, so it is set to the largest upload any route takes
+// and this middleware holds the other routes to limit.
+func LimitBody(limit int, allowLarger func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if len(c.Request().Body()) > limit && !allowLarger(c) {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "Request body too large"})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// AccessTokenPrefix marks personal access tokens so they can be told apart from JWTs
+const AccessTokenPrefix = "tdl_"
+
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+)
+
+// PersonalAccessToken defines a user-managed API token. Only a hash of the token is stored.
+// @name PersonalAccessToken
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	UserID     uint       `gorm:"not null;index" json:"-"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16);not null" json:"prefix"`
+	TokenHash  string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	Scopes     []string   `gorm:"serializer:json;not null" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	User       User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// HasScope reports whether the token grants scope
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// IsExpired reports whether the token has expired at now
+func (t *PersonalAccessToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// CreateAccessTokenRequest defines the structure for creating a personal access token
+// @name CreateAccessTokenRequest
+type CreateAccessTokenRequest struct {
+	Name      string     `json:"name" validate:"required,min=1,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,unique,dive,oneof=todos:read todos:write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatedAccessTokenResponse returns the full token; it is never shown again
+// @name CreatedAccessTokenResponse
+type CreatedAccessTokenResponse struct {
+	Token string `json:"token"`
+	PersonalAccessToken
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+)
+
+type DataExportStatus string
+
+const (
+	DataExportPending   DataExportStatus = "pending"
+	DataExportRunning   DataExportStatus = "running"
+	DataExportCompleted DataExportStatus = "completed"
+	DataExportFailed    DataExportStatus = "failed"
+)
+
+// DataExport tracks the archive of a user's personal data built in the background
+// @name DataExport
+type DataExport struct {
+	ID         string           `gorm:"type:varchar(36);primarykey" json:"id"`
+	CreatedAt  time.Time        `json:"createdAt"`
+	UpdatedAt  time.Time        `json:"updatedAt"`
+	UserID     uint             `gorm:"not null;index" json:"-"`
+	Status     DataExportStatus `gorm:"type:varchar(20);not null" json:"status"`
+	FilePath   string           `json:"-"`
+	Size       int64            `json:"size,omitempty"`
+	Message    string           `json:"message,omitempty"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+	// ExpiresAt is when the archive is deleted from the server
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+}
+
+// DataExportManifest is written to manifest.json at the root of a personal data archive
+type DataExportManifest struct {
+	Kind         string    `json:"kind"`
+	Version      int       `json:"version"`
+	UserID       uint      `json:"user_id"`
+	ExportedAt   time.Time `json:"exported_at"`
+	Files        []string  `json:"files"`
+	UploadsError string    `json:"uploads_error,omitempty"`
+}
+
+const (
+	// DataExportKind identifies personal data archives
+	DataExportKind = "todolist-personal-data"
+	// DataExportVersion is bumped whenever the archive layout changes incompatibly
+	DataExportVersion = 1
+)
+
+// DeletedAccount is the tombstone kept after an account is erased. It holds no personal
+// data beyond a hash of the email, so repeated erasure requests can be answered.
+type DeletedAccount struct {
+	ID          uint      `gorm:"primarykey"`
+	UserID      uint      `gorm:"not null;uniqueIndex"`
+	EmailHash   string    `gorm:"type:char(64);not null;index"`
+	RequestedAt time.Time `gorm:"not null"`
+	DeletedAt   time.Time `gorm:"not null"`
+}
+
+// DeleteAccountRequest defines the re-authentication required to schedule account deletion
+// @name DeleteAccountRequest
+type DeleteAccountRequest struct {
+	// Password may be empty for accounts that only sign in through an identity provider. They give
+	// Code from their authenticator app instead, or sign in with the provider again first.
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// AccountDeletionResponse reports when a scheduled deletion takes effect
+// @name AccountDeletionResponse
+type AccountDeletionResponse struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+type TodoEventType string
+
+const (
+	TodoEventAssigned   TodoEventType = "assigned"
+	TodoEventUnassigned TodoEventType = "unassigned"
+	TodoEventCommented  TodoEventType = "commented"
+	TodoEventMentioned  TodoEventType = "mentioned"
+)
+
+// TodoEvent records something a user did to a todo. Notifications and the activity feed are
+// built from these events.
+// @name TodoEvent
+type TodoEvent struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	TodoID    uint      `gorm:"not null;index" json:"todo_id"`
+	// UserID is the user who acted
+	UserID uint          `gorm:"not null;index" json:"user_id"`
+	Type   TodoEventType `gorm:"type:varchar(30);not null" json:"type"`
+	// SubjectID is the user the event is about, such as the new or previous assignee or the
+	// mentioned user
+	SubjectID *uint `gorm:"index" json:"subject_id,omitempty"`
+	// CommentID is the comment of comment and mention events
+	CommentID *uint `gorm:"index" json:"comment_id,omitempty"`
+	// WorkspaceID is nil for events in the owner's personal space
+	WorkspaceID *uint `gorm:"index" json:"workspace_id,omitempty"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	DefaultAdminPageSize = 50
+	MaxAdminPageSize     = 200
+)
+
+// AdminUserFilter defines the query parameters for listing users
+// @name AdminUserFilter
+type AdminUserFilter struct {
+	Search   string `query:"q" validate:"max=255"`
+	Role     string `query:"role" validate:"omitempty,oneof=user admin"`
+	Disabled *bool  `query:"disabled"`
+	Page     int    `query:"page" validate:"min=0"`
+	PageSize int    `query:"page_size" validate:"min=0,max=200"`
+}
+
+// AdminUserListResponse is a page of users
+// @name AdminUserListResponse
+type AdminUserListResponse struct {
+	Users    []User `json:"users"`
+	Total    int64  `json:"total"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+}
+
+// UserStats summarizes how much a user uses the application
+// @name UserStats
+type UserStats struct {
+	UserID             uint                 `json:"user_id"`
+	TodoCount          int64                `json:"todo_count"`
+	TodosByStatus      map[TodoStatus]int64 `json:"todos_by_status"`
+	AccessTokenCount   int64                `json:"access_token_count"`
+	ActiveSessionCount int64                `json:"active_session_count"`
+	ImportJobCount     int64                `json:"import_job_count"`
+	LastLoginAt        *time.Time           `json:"last_login_at,omitempty"`
+	LastSeenAt         *time.Time           `json:"last_seen_at,omitempty"`
+}
+
+// UpdateUserRoleRequest defines the structure for changing a user's role
+// @name UpdateUserRoleRequest
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=user admin"`
+}
+
+// ImpersonationResponse returns a token that acts as another user
+// @name ImpersonationResponse
+type ImpersonationResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      *User     `json:"user"`
+}
+
+// ResetPasswordRequest defines the structure for setting a new password with an emailed token
+// @name ResetPasswordRequest
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=6"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+)
+
+// CalDAVResource records the name and UID a CalDAV client gave a todo it created. Other todos
+// are served as todo-<id>.ics. Rows outlive their todo so that sync reports can still name the
+// resource of a deleted todo.
+type CalDAVResource struct {
+	TodoID    uint `gorm:"primarykey;autoIncrement:false"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"not null;index:idx_cal_dav_resources_user_name,priority:1"`
+	Name      string `gorm:"type:varchar(255);not null;index:idx_cal_dav_resources_user_name,priority:2"`
+	UID       string `gorm:"type:varchar(255);not null"`
+	// WorkspaceID is nil for todos in the owner's personal space
+	WorkspaceID *uint `gorm:"index"`
+}
+
+// CalDAVObject is a todo served as a calendar object resource holding a single VTODO
+type CalDAVObject struct {
+	Name         string
+	ETag         string
+	LastModified time.Time
+	Data         []byte
+}
+
+// CalDAVSyncResult lists the calendar objects changed and removed since a sync token
+type CalDAVSyncResult struct {
+	Changed []CalDAVObject
+	// Removed names the resources of todos deleted since the token
+	Removed   []string
+	SyncToken string
+	// Truncated is set when more changes follow; the client repeats the report with SyncToken
+	Truncated bool
+}
+
+// CalDAVPreconditions are the If-Match and If-None-Match headers of a write
+type CalDAVPreconditions struct {
+	IfMatch     string
+	IfNoneMatch string
+}
+
+// CalDAVCompFilter is the comp-filter element of a calendar-query report (RFC 4791)
+type CalDAVCompFilter struct {
+	Name         string             `xml:"name,attr"`
+	IsNotDefined *struct{}          `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *CalDAVTimeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	PropFilters  []CalDAVPropFilter `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+	CompFilters  []CalDAVCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// CalDAVPropFilter is the prop-filter element of a calendar-query report
+type CalDAVPropFilter struct {
+	Name         string           `xml:"name,attr"`
+	IsNotDefined *struct{}        `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *CalDAVTimeRange `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	TextMatch    *CalDAVTextMatch `xml:"urn:ietf:params:xml:ns:caldav text-match"`
+}
+
+// CalDAVTextMatch matches property values containing Value, ignoring ASCII case
+type CalDAVTextMatch struct {
+	Value           string `xml:",chardata"`
+	NegateCondition string `xml:"negate-condition,attr"`
+}
+
+// CalDAVTimeRange bounds a calendar-query with UTC date-times; either end may be open
+type CalDAVTimeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
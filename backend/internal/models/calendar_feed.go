@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+)
+
+// CalendarFeedTokenPrefix marks calendar feed tokens so they can be told apart from other tokens
+const CalendarFeedTokenPrefix = "tdlcal_"
+
+// Components a calendar feed can show todos as
+const (
+	CalendarFeedEvents = "event"
+	CalendarFeedTodos  = "todo"
+)
+
+// CalendarFeed is a user's read-only iCalendar subscription of their dated todos. Anyone with
+// its URL can read the feed, so only a hash of the token is stored and a user has at most one.
+// @name CalendarFeed
+type CalendarFeed struct {
+	ID            uint       `gorm:"primarykey" json:"-"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UserID        uint       `gorm:"not null;uniqueIndex" json:"-"`
+	Prefix        string     `gorm:"type:varchar(16);not null" json:"prefix"`
+	TokenHash     string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	LastFetchedAt *time.Time `json:"last_fetched_at,omitempty"`
+	User          User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// CreatedCalendarFeedResponse returns the feed URL; it is never shown again
+// @name CreatedCalendarFeedResponse
+type CreatedCalendarFeedResponse struct {
+	URL string `json:"url"`
+	// WebcalURL is the same feed with the webcal scheme, which opens the subscribe dialog of
+	// calendar apps
+	WebcalURL string `json:"webcal_url"`
+	CalendarFeed
+}
+
+// CalendarFeedQuery defines the optional query parameters of the feed URL
+type CalendarFeedQuery struct {
+	Status TodoStatus `query:"status" validate:"max=50"`
+	// Label is rejected, since todos have no labels yet
+	Label string `query:"label"`
+	// Component shows due dates as events (the default) or as VTODOs
+	Component string `query:"component" validate:"omitempty,oneof=event todo"`
+}
+
+// CalendarFeedSnapshot identifies the current content of a calendar feed, so that unchanged
+// feeds can be answered with 304 Not Modified without rendering them
+type CalendarFeedSnapshot struct {
+	UserID       uint
+	Query        CalendarFeedQuery
+	Location     *time.Location
+	ETag         string
+	LastModified time.Time
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	DefaultCommentPageSize = 20
+	MaxCommentPageSize     = 100
+)
+
+// Comment is a message in the discussion of a todo. Replies point to a top-level comment
+// through ParentID, so threads are one level deep.
+// @name Comment
+type Comment struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	TodoID    uint      `gorm:"not null;index" json:"todo_id"`
+	// UserID is the author
+	UserID   uint   `gorm:"not null;index" json:"user_id"`
+	ParentID *uint  `gorm:"index" json:"parent_id,omitempty"`
+	Body     string `gorm:"type:text;not null" json:"body"`
+	Edited   bool   `gorm:"not null;default:false" json:"edited"`
+	// Deleted marks a removed comment kept so its replies stay in place; its body is cleared
+	Deleted     bool             `gorm:"not null;default:false" json:"deleted"`
+	WorkspaceID *uint            `gorm:"index" json:"-"`
+	Mentions    []CommentMention `gorm:"foreignKey:CommentID;constraint:OnDelete:CASCADE" json:"mentions"`
+	Replies     []Comment        `gorm:"foreignKey:ParentID;constraint:OnDelete:SET NULL" json:"replies,omitempty"`
+	Todo        Todo             `gorm:"foreignKey:TodoID;constraint:OnDelete:CASCADE" json:"-"`
+	User        User             `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// CommentMention references a user mentioned in a comment
+// @name CommentMention
+type CommentMention struct {
+	ID        uint `gorm:"primarykey" json:"-"`
+	CommentID uint `gorm:"not null;uniqueIndex:idx_comment_mentions_comment_user" json:"-"`
+	UserID    uint `gorm:"not null;uniqueIndex:idx_comment_mentions_comment_user;index" json:"user_id"`
+	User      User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// CreateCommentRequest defines the structure for commenting on a todo. Mentions are written
+// as @email or @name in the body.
+// @name CreateCommentRequest
+type CreateCommentRequest struct {
+	Body string `json:"body" validate:"required,min=1,max=5000"`
+	// ParentID makes the comment a reply; replies to a reply join the parent's thread
+	ParentID *uint `json:"parent_id"`
+}
+
+// UpdateCommentRequest defines the structure for editing a comment
+// @name UpdateCommentRequest
+type UpdateCommentRequest struct {
+	Body string `json:"body" validate:"required,min=1,max=5000"`
+}
+
+// CommentFilter defines the query parameters for listing the comments of a todo
+type CommentFilter struct {
+	Page     int `query:"page" validate:"min=0"`
+	PageSize int `query:"page_size" validate:"min=0,max=100"`
+}
+
+// CommentListResponse is a page of top-level comments with their replies
+// @name CommentListResponse
+type CommentListResponse struct {
+	Comments []Comment `json:"comments"`
+	Total    int64     `json:"total"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+}
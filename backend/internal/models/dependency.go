@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// TodoDependency records that the blocker todo blocks the blocked todo: the blocked todo should
+// not be completed while its blocker is open. Both todos belong to the same list.
+// @name TodoDependency
+type TodoDependency struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	// UserID is the member who added the dependency
+	UserID      uint      `gorm:"not null;index" json:"created_by"`
+	WorkspaceID *uint     `gorm:"index" json:"workspace_id,omitempty"`
+	BlockerID   uint      `gorm:"not null;uniqueIndex:idx_todo_dependencies_pair" json:"blocker_id"`
+	BlockedID   uint      `gorm:"not null;uniqueIndex:idx_todo_dependencies_pair;index" json:"blocked_id"`
+	User        User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Workspace   Workspace `gorm:"foreignKey:WorkspaceID;constraint:OnDelete:CASCADE" json:"-"`
+	Blocker     Todo      `gorm:"foreignKey:BlockerID;constraint:OnDelete:CASCADE" json:"-"`
+	Blocked     Todo      `gorm:"foreignKey:BlockedID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TodoReference identifies a related todo in todo responses
+// @name TodoReference
+type TodoReference struct {
+	ID     uint       `json:"id"`
+	Title  string     `json:"title"`
+	Status TodoStatus `json:"status"`
+	IsDone bool       `json:"is_done"`
+}
+
+// AddBlockerRequest defines the structure for making a todo block another
+// @name AddBlockerRequest
+type AddBlockerRequest struct {
+	BlockerID uint `json:"blocker_id" validate:"required"`
+}
+
+// DependencyGraph is the dependency graph of a list: the todos that block or are blocked by
+// another todo, the blocking relations between them and an order to work on them in
+// @name DependencyGraph
+type DependencyGraph struct {
+	Nodes []TodoReference  `json:"nodes"`
+	Edges []TodoDependency `json:"edges"`
+	// Order lists the todo IDs so that every blocker comes before the todos it blocks
+	Order []uint `json:"order"`
+	// Cyclic lists the todos missing from Order because they are in or wait on a cycle
+	Cyclic []uint `json:"cyclic,omitempty"`
+}
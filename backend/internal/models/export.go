@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+)
+
+type ExportFormat string
+
+const (
+	ExportJSON     ExportFormat = "json"
+	ExportCSV      ExportFormat = "csv"
+	ExportMarkdown ExportFormat = "md"
+	ExportICal     ExportFormat = "ics"
+)
+
+const (
+	// TodoExportKind identifies documents produced by the JSON export
+	TodoExportKind = "todolist-export"
+	// TodoExportVersion is bumped whenever ExportedTodo changes incompatibly
+	TodoExportVersion = 1
+)
+
+// ExportTodosRequest defines the query parameters of the export endpoint
+type ExportTodosRequest struct {
+	Format ExportFormat `query:"format" validate:"required,oneof=json csv md ics"`
+	TodoFilter
+}
+
+// TodoExportDocument defines the JSON export envelope
+// @name TodoExportDocument
+type TodoExportDocument struct {
+	Kind       string         `json:"kind"`
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Todos      []ExportedTodo `json:"todos"`
+}
+
+// ExportedTodo defines every todo field needed to re-import it without loss
+// @name ExportedTodo
+type ExportedTodo struct {
+	ID          uint       `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	ImageURL    string     `json:"image_url"`
+	Status      TodoStatus `json:"status"`
+	DueDate     *time.Time `json:"due_date"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// NewExportedTodo copies the exported fields of a todo
+func NewExportedTodo(todo *Todo) ExportedTodo {
+	return ExportedTodo{
+		ID:          todo.ID,
+		Title:       todo.Title,
+		Description: todo.Description,
+		ImageURL:    todo.ImageURL,
+		Status:      todo.Status,
+		DueDate:     todo.DueDate,
+		CompletedAt: todo.CompletedAt,
+		CreatedAt:   todo.CreatedAt,
+		UpdatedAt:   todo.UpdatedAt,
+	}
+}
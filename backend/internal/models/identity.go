@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links an account at an external OpenID Connect provider to a user
+// @name UserIdentity
+type UserIdentity struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	Provider  string    `gorm:"size:100;not null" json:"provider"`
+	Issuer    string    `gorm:"size:500;not null;uniqueIndex:idx_user_identities_issuer_subject" json:"issuer"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_user_identities_issuer_subject" json:"subject"`
+	Email     string    `json:"email"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// OIDCProviderInfo describes a login provider offered to users
+// @name OIDCProviderInfo
+type OIDCProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+)
+
+type ImportFormat string
+
+const (
+	ImportCSV     ImportFormat = "csv"
+	ImportJSON    ImportFormat = "json"
+	ImportTodoist ImportFormat = "todoist"
+	ImportTrello  ImportFormat = "trello"
+)
+
+type ImportJobStatus string
+
+const (
+	ImportJobPending   ImportJobStatus = "pending"
+	ImportJobRunning   ImportJobStatus = "running"
+	ImportJobCompleted ImportJobStatus = "completed"
+	ImportJobFailed    ImportJobStatus = "failed"
+)
+
+// ImportRequest defines the form fields of the import endpoint (the file is sent as "file")
+type ImportRequest struct {
+	Format ImportFormat `form:"format" validate:"required,oneof=csv json todoist trello"`
+	// Mapping is a JSON object mapping todo fields (title, description, status, due_date, image_url) to CSV column names
+	Mapping string `form:"mapping" validate:"omitempty,json"`
+	DryRun  bool   `form:"dry_run"`
+}
+
+// ImportRowError describes why a row of the import file was rejected
+// @name ImportRowError
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportPreviewItem shows how a row will be imported
+// @name ImportPreviewItem
+type ImportPreviewItem struct {
+	Row         int        `json:"row"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	ImageURL    string     `json:"image_url,omitempty"`
+	Status      TodoStatus `json:"status"`
+	DueDate     *time.Time `json:"due_date,omitempty"`
+}
+
+// ImportResult summarizes an import or dry run. Nothing is imported when any row has an error.
+// @name ImportResult
+type ImportResult struct {
+	DryRun       bool                `json:"dry_run"`
+	TotalRows    int                 `json:"total_rows"`
+	ValidRows    int                 `json:"valid_rows"`
+	ImportedRows int                 `json:"imported_rows"`
+	ErrorCount   int                 `json:"error_count"`
+	Errors       []ImportRowError    `json:"errors" gorm:"serializer:json"`
+	Preview      []ImportPreviewItem `json:"preview,omitempty" gorm:"serializer:json"`
+}
+
+// ImportJob tracks an import of a large file processed in the background
+// @name ImportJob
+type ImportJob struct {
+	ID            string          `gorm:"type:varchar(36);primarykey" json:"id"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	UpdatedAt     time.Time       `json:"updatedAt"`
+	UserID        uint            `gorm:"not null;index" json:"user_id"`
+	WorkspaceID   *uint           `json:"workspace_id,omitempty"`
+	Format        ImportFormat    `gorm:"type:varchar(20);not null" json:"format"`
+	Filename      string          `json:"filename"`
+	Status        ImportJobStatus `gorm:"type:varchar(20);not null" json:"status"`
+	ProcessedRows int             `json:"processed_rows"`
+	Message       string          `json:"message,omitempty"`
+	FinishedAt    *time.Time      `json:"finished_at,omitempty"`
+	ImportResult  `gorm:"embedded"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	// JobDead marks a job that failed on its last attempt; it stays for inspection
+	JobDead JobStatus = "dead"
+)
+
+// Job is a unit of background work in the Postgres-backed queue
+type Job struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Type      string    `gorm:"size:100;not null"`
+	Payload   string    `gorm:"type:text;not null;default:'{}'"`
+	Status    JobStatus `gorm:"type:varchar(20);not null;index:idx_jobs_status_run_at,priority:1"`
+	// RunAt is the earliest time the job may run; retries move it forward
+	RunAt       time.Time `gorm:"not null;index:idx_jobs_status_run_at,priority:2"`
+	Attempts    int       `gorm:"not null;default:0"`
+	MaxAttempts int       `gorm:"not null"`
+	// UniqueKey, when set, keeps a second copy of the job from being queued until the first finishes
+	UniqueKey  *string `gorm:"size:200;uniqueIndex:idx_jobs_unique_key,where:finished_at IS NULL"`
+	LockedBy   string  `gorm:"size:100"`
+	LockedAt   *time.Time
+	LastError  string `gorm:"type:text"`
+	FinishedAt *time.Time
+}
+
+// JobSchedule tracks the next run of a recurring job, shared by every worker process
+type JobSchedule struct {
+	Name      string `gorm:"primarykey;size:100"`
+	UpdatedAt time.Time
+	NextRunAt time.Time `gorm:"not null"`
+	LastRunAt *time.Time
+}
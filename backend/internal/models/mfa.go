@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+// RecoveryCode is a hashed one-time code that replaces a TOTP code when the authenticator is lost
+type RecoveryCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"type:char(64);not null"`
+	UsedAt    *time.Time
+	User      User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+// TOTPEnrollmentResponse returns the secret to add to an authenticator app
+// @name TOTPEnrollmentResponse
+type TOTPEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// RecoveryCodesResponse returns freshly generated recovery codes; they are never shown again
+// @name RecoveryCodesResponse
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ConfirmTOTPRequest defines the structure for confirming TOTP enrollment
+// @name ConfirmTOTPRequest
+type ConfirmTOTPRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// MFAReauthRequest defines the re-authentication required to change 2FA settings
+// @name MFAReauthRequest
+type MFAReauthRequest struct {
+	Password     string `json:"password" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=32"`
+}
+
+// MFALoginRequest defines the second step of a two-factor login
+// @name MFALoginRequest
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=32"`
+}
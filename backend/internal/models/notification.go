@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	DefaultNotificationPageSize = 20
+	MaxNotificationPageSize     = 100
+)
+
+type NotificationType string
+
+const (
+	NotificationAssigned        NotificationType = "assigned"
+	NotificationMentioned       NotificationType = "mentioned"
+	NotificationCommented       NotificationType = "commented"
+	NotificationDueSoon         NotificationType = "due_soon"
+	NotificationWorkspaceInvite NotificationType = "workspace_invite"
+)
+
+// NotificationTypes lists every notification type, in the order preferences are shown
+var NotificationTypes = []NotificationType{
+	NotificationAssigned,
+	NotificationMentioned,
+	NotificationCommented,
+	NotificationDueSoon,
+	NotificationWorkspaceInvite,
+}
+
+// Notification tells a user about something that concerns them
+// @name Notification
+type Notification struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index:idx_notifications_user_created,priority:2" json:"createdAt"`
+	// UserID is the recipient
+	UserID  uint             `gorm:"not null;index:idx_notifications_user_created,priority:1" json:"-"`
+	Type    NotificationType `gorm:"type:varchar(30);not null" json:"type"`
+	Message string           `gorm:"type:text;not null" json:"message"`
+	// ActorID is the user who caused the notification, nil for reminders
+	ActorID     *uint      `json:"actor_id,omitempty"`
+	TodoID      *uint      `json:"todo_id,omitempty"`
+	CommentID   *uint      `json:"comment_id,omitempty"`
+	WorkspaceID *uint      `json:"workspace_id,omitempty"`
+	ReadAt      *time.Time `json:"read_at,omitempty"`
+	User        User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// NotificationPreference records whether a type of event notifies the user. Types without a
+// preference are enabled.
+type NotificationPreference struct {
+	ID      uint             `gorm:"primarykey" json:"-"`
+	UserID  uint             `gorm:"not null;uniqueIndex:idx_notification_preferences_user_type" json:"-"`
+	Type    NotificationType `gorm:"type:varchar(30);not null;uniqueIndex:idx_notification_preferences_user_type" json:"type"`
+	Enabled bool             `gorm:"not null" json:"enabled"`
+	User    User             `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// NotificationPreferences maps each notification type to whether it is enabled
+// @name NotificationPreferences
+type NotificationPreferences map[NotificationType]bool
+
+// NotificationFilter defines the query parameters for listing notifications
+type NotificationFilter struct {
+	Unread   bool `query:"unread"`
+	Page     int  `query:"page" validate:"min=0"`
+	PageSize int  `query:"page_size" validate:"min=0,max=100"`
+}
+
+// NotificationListResponse is a page of notifications, newest first
+// @name NotificationListResponse
+type NotificationListResponse struct {
+	Notifications []Notification `json:"notifications"`
+	Total         int64          `json:"total"`
+	UnreadCount   int64          `json:"unread_count"`
+	Page          int            `json:"page"`
+	PageSize      int            `json:"page_size"`
+}
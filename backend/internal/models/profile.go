@@ -0,0 +1,98 @@
+package models
+
+import (
+	"time"
+)
+
+// Weekday is the first day of the week in a user's calendar
+type Weekday string
+
+const (
+	WeekStartMonday   Weekday = "monday"
+	WeekStartSunday   Weekday = "sunday"
+	WeekStartSaturday Weekday = "saturday"
+)
+
+// Time returns the time.Weekday of d, defaulting to Monday
+func (d Weekday) Time() time.Weekday {
+	switch d {
+	case WeekStartSunday:
+		return time.Sunday
+	case WeekStartSaturday:
+		return time.Saturday
+	default:
+		return time.Monday
+	}
+}
+
+// TodoSort is an ordering of todo lists
+type TodoSort string
+
+const (
+	SortCreatedDesc TodoSort = "created_desc"
+	SortCreatedAsc  TodoSort = "created_asc"
+	SortDueAsc      TodoSort = "due_asc"
+	SortDueDesc     TodoSort = "due_desc"
+	SortTitleAsc    TodoSort = "title_asc"
+	// SortPosition orders todos as in their board column
+	SortPosition TodoSort = "position"
+)
+
+// OrderClause returns the SQL ORDER BY clause of s; todos without a due date sort last.
+// The id tiebreaker keeps pages stable when sort keys are equal.
+func (s TodoSort) OrderClause() string {
+	switch s {
+	case SortCreatedAsc:
+		return "created_at asc, id asc"
+	case SortDueAsc:
+		return "due_date asc nulls last, id asc"
+	case SortDueDesc:
+		return "due_date desc nulls last, id desc"
+	case SortTitleAsc:
+		return "lower(title) asc, id asc"
+	case SortPosition:
+		return "position asc, id asc"
+	default:
+		return "created_at desc, id desc"
+	}
+}
+
+// UpdateProfileRequest defines the structure for updating profile and preferences; omitted fields are unchanged
+// @name UpdateProfileRequest
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name" validate:"omitempty,max=100"`
+	AvatarURL   *string `json:"avatar_url" validate:"omitempty,url,max=2048"`
+	// Timezone is an IANA zone name; empty resets it to the server default
+	Timezone    *string   `json:"timezone" validate:"omitempty,max=64"`
+	Locale      *string   `json:"locale" validate:"omitempty,bcp47_language_tag,max=35"`
+	WeekStart   *Weekday  `json:"week_start" validate:"omitempty,oneof=monday sunday saturday"`
+	DefaultSort *TodoSort `json:"default_sort" validate:"omitempty,oneof=created_desc created_asc due_asc due_desc title_asc position"`
+	// DigestEnabled opts in to or out of the daily digest email, sent at DigestTime in the user's timezone
+	DigestEnabled *bool   `json:"digest_enabled"`
+	DigestTime    *string `json:"digest_time" validate:"omitempty,datetime=15:04"`
+}
+
+// ChangePasswordRequest defines the structure for changing the password
+// @name ChangePasswordRequest
+type ChangePasswordRequest struct {
+	// CurrentPassword may be empty for accounts that only signed in through an identity provider so
+	// far. They give Code from their authenticator app instead, or sign in with the provider again first.
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code" validate:"omitempty,len=6,numeric"`
+	NewPassword     string `json:"new_password" validate:"required,min=6"`
+}
+
+// ChangeEmailRequest defines the structure for requesting an email change
+// @name ChangeEmailRequest
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" validate:"required,email"`
+	// CurrentPassword and Code confirm the change like in ChangePasswordRequest
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code" validate:"omitempty,len=6,numeric"`
+}
+
+// ConfirmEmailChangeRequest defines the structure for confirming an email change with the emailed token
+// @name ConfirmEmailChangeRequest
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" validate:"required"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// PushSubscription is a browser's Web Push subscription on one device
+// @name PushSubscription
+type PushSubscription struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	// Endpoint is the push service URL of the subscription; it is unique to the browser profile
+	Endpoint  string `gorm:"type:text;not null;uniqueIndex" json:"endpoint"`
+	P256dh    string `gorm:"type:varchar(128);not null" json:"-"`
+	Auth      string `gorm:"type:varchar(64);not null" json:"-"`
+	UserAgent string `gorm:"type:text" json:"user_agent,omitempty"`
+	// LastPushedAt is when a message was last accepted by the push service
+	LastPushedAt *time.Time `json:"last_pushed_at,omitempty"`
+	User         User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// PushSubscriptionKeys are the keys of a browser's PushSubscription, as unpadded base64url
+type PushSubscriptionKeys struct {
+	P256dh string `json:"p256dh" validate:"required,max=128"`
+	Auth   string `json:"auth" validate:"required,max=64"`
+}
+
+// CreatePushSubscriptionRequest is the JSON form of a browser's PushSubscription
+// @name CreatePushSubscriptionRequest
+type CreatePushSubscriptionRequest struct {
+	Endpoint string               `json:"endpoint" validate:"required,url,max=2048"`
+	Keys     PushSubscriptionKeys `json:"keys" validate:"required"`
+}
+
+// VAPIDPublicKeyResponse is the application server key browsers subscribe with
+// @name VAPIDPublicKeyResponse
+type VAPIDPublicKeyResponse struct {
+	PublicKey string `json:"public_key"`
+}
+
+// PushMessage is the JSON payload shown by the service worker as a notification
+type PushMessage struct {
+	Title          string           `json:"title"`
+	Body           string           `json:"body"`
+	Type           NotificationType `json:"type"`
+	NotificationID uint             `json:"notification_id,omitempty"`
+	TodoID         *uint            `json:"todo_id,omitempty"`
+	WorkspaceID    *uint            `json:"workspace_id,omitempty"`
+	URL            string           `json:"url,omitempty"`
+}
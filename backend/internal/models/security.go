@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+)
+
+// SecurityEventType identifies what a security event records
+type SecurityEventType string
+
+const (
+	SecurityEventAccountLocked   SecurityEventType = "account_locked"
+	SecurityEventAccountUnlocked SecurityEventType = "account_unlocked"
+	SecurityEventIPThrottled     SecurityEventType = "ip_throttled"
+	SecurityEventIdentityLinked  SecurityEventType = "identity_linked"
+	SecurityEventUserDisabled    SecurityEventType = "user_disabled"
+	SecurityEventUserEnabled     SecurityEventType = "user_enabled"
+	SecurityEventRoleChanged     SecurityEventType = "role_changed"
+	SecurityEventPasswordReset   SecurityEventType = "password_reset_forced"
+	SecurityEventPasswordChanged SecurityEventType = "password_changed"
+	SecurityEventImpersonation   SecurityEventType = "impersonation_started"
+	SecurityEventEmailChangeReq  SecurityEventType = "email_change_requested"
+	SecurityEventEmailChanged    SecurityEventType = "email_changed"
+	SecurityEventDataExported    SecurityEventType = "data_export_requested"
+	SecurityEventDeletionReq     SecurityEventType = "account_deletion_scheduled"
+	SecurityEventDeletionCancel  SecurityEventType = "account_deletion_cancelled"
+	SecurityEventAccountDeleted  SecurityEventType = "account_deleted"
+)
+
+// ClientInfo describes the client a request came from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// LoginThrottle counts recent failed logins for one key, such as an account or a client IP
+type LoginThrottle struct {
+	Key           string `gorm:"primaryKey;size:320"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// IsLocked reports whether the key is locked at t
+func (l *LoginThrottle) IsLocked(t time.Time) bool {
+	return l.LockedUntil != nil && l.LockedUntil.After(t)
+}
+
+// SecurityEvent is an append-only record of security-relevant actions
+// @name SecurityEvent
+type SecurityEvent struct {
+	ID        uint              `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time         `gorm:"index" json:"created_at"`
+	Type      SecurityEventType `gorm:"type:varchar(50);not null;index" json:"type"`
+	UserID    *uint             `gorm:"index" json:"user_id,omitempty"`
+	// ActorID is the administrator who performed the action, if any
+	ActorID   *uint  `gorm:"index" json:"actor_id,omitempty"`
+	Email     string `gorm:"size:320" json:"email,omitempty"`
+	IP        string `gorm:"size:64" json:"ip,omitempty"`
+	UserAgent string `gorm:"size:512" json:"user_agent,omitempty"`
+	Details   string `gorm:"type:text" json:"details,omitempty"`
+}
+
+// UnlockAccountRequest defines the structure for unlocking an account with an emailed token
+// @name UnlockAccountRequest
+type UnlockAccountRequest struct {
+	Token string `json:"token" validate:"required"`
+}
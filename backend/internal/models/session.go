@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// Session records a login; its ID is carried in the sid claim of the issued JWT
+// @name Session
+type Session struct {
+	ID         string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UserID     uint      `gorm:"not null;index" json:"-"`
+	UserAgent  string    `gorm:"size:512" json:"user_agent"`
+	IP         string    `gorm:"size:64" json:"ip"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// AuthenticatedAt is when the user last proved who they are for this session: the password or
+	// second factor check, or the identity provider's auth_time. Zero when the provider did not say.
+	AuthenticatedAt time.Time  `json:"-"`
+	RevokedAt       *time.Time `gorm:"index" json:"-"`
+	// ImpersonatorID is the administrator acting as the user in this session
+	ImpersonatorID *uint `json:"impersonator_id,omitempty"`
+	// Current marks the session the request was made with
+	Current bool `gorm:"-" json:"current"`
+	User    User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// IsActive reports whether the session can still authenticate requests at t
+func (s *Session) IsActive(t time.Time) bool {
+	return s.RevokedAt == nil && s.ExpiresAt.After(t)
+}
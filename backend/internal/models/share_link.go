@@ -0,0 +1,90 @@
+package models
+
+import (
+	"time"
+)
+
+// ShareLinkTokenPrefix marks share link tokens so they can be told apart from other tokens
+const ShareLinkTokenPrefix = "tdlshr_"
+
+// ShareLink gives anyone holding its URL a read-only view of one todo, or of every todo of its
+// tenant when TodoID is nil. Only a hash of the token is stored.
+// @name ShareLink
+type ShareLink struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	// UserID is the member who created the link
+	UserID      uint   `gorm:"not null;index" json:"created_by"`
+	WorkspaceID *uint  `gorm:"index" json:"workspace_id,omitempty"`
+	TodoID      *uint  `gorm:"index" json:"todo_id,omitempty"`
+	Prefix      string `gorm:"type:varchar(16);not null" json:"prefix"`
+	TokenHash   string `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	// PasswordHash is empty for links that need no password
+	PasswordHash   string     `json:"-"`
+	HasPassword    bool       `gorm:"not null;default:false" json:"has_password"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	AccessCount    int64      `gorm:"not null;default:0" json:"access_count"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	User           User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Workspace      Workspace  `gorm:"foreignKey:WorkspaceID;constraint:OnDelete:CASCADE" json:"-"`
+	Todo           *Todo      `gorm:"foreignKey:TodoID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// IsExpired reports whether the link has expired at now
+func (l *ShareLink) IsExpired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// CreateShareLinkRequest defines the structure for creating a share link; without todo_id the
+// link shares the whole list
+// @name CreateShareLinkRequest
+type CreateShareLinkRequest struct {
+	TodoID    *uint      `json:"todo_id"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Password  string     `json:"password" validate:"omitempty,min=8,max=72"`
+}
+
+// CreatedShareLinkResponse returns the full link; it is never shown again
+// @name CreatedShareLinkResponse
+type CreatedShareLinkResponse struct {
+	URL string `json:"url"`
+	ShareLink
+}
+
+// SharedTodo is the read-only view of a todo shown through a share link. It leaves out who
+// created, is assigned to or watches the todo.
+// @name SharedTodo
+type SharedTodo struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	Status      TodoStatus `json:"status"`
+	DueDate     *time.Time `json:"due_date,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	// AttachmentURL is a short-lived URL of the uploaded image, valid until attachments_expire_at
+	AttachmentURL string `json:"attachment_url,omitempty"`
+}
+
+// Kinds of shared views
+const (
+	SharedTodoKind = "todo"
+	SharedListKind = "list"
+)
+
+// SharedView is what a share link shows: Todo for a link to one todo, Todos for a list
+// @name SharedView
+type SharedView struct {
+	Kind string `json:"kind" enums:"todo,list"`
+	// Name is the workspace name of a shared workspace list
+	Name                string       `json:"name,omitempty"`
+	Todo                *SharedTodo  `json:"todo,omitempty"`
+	Todos               []SharedTodo `json:"todos,omitempty"`
+	ExpiresAt           *time.Time   `json:"expires_at,omitempty"`
+	AttachmentsExpireAt *time.Time   `json:"attachments_expire_at,omitempty"`
+}
+
+// ShareLinkFilter narrows the listed share links to those of one todo
+type ShareLinkFilter struct {
+	TodoID *uint `query:"todo_id"`
+}
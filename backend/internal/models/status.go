@@ -0,0 +1,149 @@
+package models
+
+import (
+	"time"
+)
+
+// StatusDefinition is a status todos of a list can be in: a column of its board. Each list, the
+// personal space of a user or a workspace, defines its own statuses.
+// @name StatusDefinition
+type StatusDefinition struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// UserID owns the statuses of a personal space and is nil for workspace statuses
+	UserID      *uint      `gorm:"index" json:"-"`
+	WorkspaceID *uint      `gorm:"index" json:"workspace_id,omitempty"`
+	Name        TodoStatus `gorm:"type:varchar(50);not null" json:"name"`
+	Color       string     `gorm:"type:varchar(7);not null" json:"color"`
+	Position    int        `gorm:"not null;default:0" json:"position"`
+	// IsDone marks statuses that complete a todo; todos in them have a completion time
+	IsDone bool `gorm:"not null;default:false" json:"is_done"`
+	// WIPLimit caps the todos that can be moved into the status; zero means no limit
+	WIPLimit  int       `gorm:"not null;default:0" json:"wip_limit"`
+	User      *User     `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Workspace Workspace `gorm:"foreignKey:WorkspaceID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// DefaultStatusColor is given to statuses created without a color
+const DefaultStatusColor = "#9CA3AF"
+
+// DefaultStatuses returns the statuses every list starts with, which are the statuses todos
+// had before lists could define their own
+func DefaultStatuses() []StatusDefinition {
+	return []StatusDefinition{
+		{Name: StatusPending, Color: DefaultStatusColor, Position: 0},
+		{Name: StatusInProgress, Color: "#3B82F6", Position: 1},
+		{Name: StatusDone, Color: "#10B981", Position: 2, IsDone: true},
+	}
+}
+
+// CreateStatusRequest defines the structure for adding a status to a list
+// @name CreateStatusRequest
+type CreateStatusRequest struct {
+	Name     TodoStatus `json:"name" validate:"required,min=1,max=50"`
+	Color    string     `json:"color" validate:"omitempty,hexcolor"`
+	IsDone   bool       `json:"is_done"`
+	WIPLimit int        `json:"wip_limit" validate:"min=0"`
+}
+
+// UpdateStatusRequest defines the status settings that can be changed; renaming a status
+// renames it on its todos
+// @name UpdateStatusRequest
+type UpdateStatusRequest struct {
+	Name     *TodoStatus `json:"name" validate:"omitempty,min=1,max=50"`
+	Color    *string     `json:"color" validate:"omitempty,hexcolor"`
+	IsDone   *bool       `json:"is_done"`
+	WIPLimit *int        `json:"wip_limit" validate:"omitempty,min=0"`
+}
+
+// ReorderStatusesRequest lists every status of the list in its new order
+// @name ReorderStatusesRequest
+type ReorderStatusesRequest struct {
+	StatusIDs []uint `json:"status_ids" validate:"required,min=1,unique"`
+}
+
+// DeleteStatusQuery names the status the todos of a deleted status move to
+type DeleteStatusQuery struct {
+	MoveTo *uint `query:"move_to"`
+}
+
+// MoveTodoRequest places a todo at a position in a board column, changing its status when the
+// column is another status
+// @name MoveTodoRequest
+type MoveTodoRequest struct {
+	Status TodoStatus `json:"status" validate:"required,min=1,max=50"`
+	// Position is the zero-based index in the column; larger values move the todo to the end
+	Position int `json:"position" validate:"min=0"`
+	// Force completes the todo even while todos blocking it are open
+	Force bool `json:"force"`
+}
+
+// BoardFilter defines the optional filters of the board
+type BoardFilter struct {
+	Search string `query:"q" validate:"max=255"`
+	// Limit bounds the todos returned per column; Count is always the full count
+	Limit int `query:"limit" validate:"omitempty,min=1,max=500"`
+}
+
+// BoardColumn is a status of the board with its todos in their column order
+// @name BoardColumn
+type BoardColumn struct {
+	Status StatusDefinition `json:"status"`
+	Todos  []Todo           `json:"todos"`
+	Count  int64            `json:"count"`
+	// OverLimit reports a column holding more todos than its WIP limit
+	OverLimit bool `json:"over_limit"`
+}
+
+// Board lists the todos of a list grouped by status, in the order of the statuses
+// @name Board
+type Board struct {
+	Columns []BoardColumn `json:"columns"`
+}
+
+// StatusTransition is a workflow rule of a list. A status with rules can only be entered through
+// one of them; statuses without rules can be entered from any status.
+// @name StatusTransition
+type StatusTransition struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	// UserID owns the rules of a personal space and is nil for workspace rules
+	UserID      *uint `gorm:"index" json:"-"`
+	WorkspaceID *uint `gorm:"index" json:"workspace_id,omitempty"`
+	// FromStatusID is the status the rule allows leaving, nil for any status
+	FromStatusID *uint `gorm:"index" json:"from_status_id"`
+	ToStatusID   uint  `gorm:"not null;index" json:"to_status_id"`
+	// RequiresAssignee only lets assigned todos through the rule
+	RequiresAssignee bool              `gorm:"not null;default:false" json:"requires_assignee"`
+	User             *User             `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Workspace        Workspace         `gorm:"foreignKey:WorkspaceID;constraint:OnDelete:CASCADE" json:"-"`
+	FromStatus       *StatusDefinition `gorm:"foreignKey:FromStatusID;constraint:OnDelete:CASCADE" json:"-"`
+	ToStatus         StatusDefinition  `gorm:"foreignKey:ToStatusID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// CreateStatusTransitionRequest defines the structure for adding a workflow rule; without
+// from_status_id the rule applies to todos coming from any status
+// @name CreateStatusTransitionRequest
+type CreateStatusTransitionRequest struct {
+	FromStatusID     *uint `json:"from_status_id"`
+	ToStatusID       uint  `json:"to_status_id" validate:"required"`
+	RequiresAssignee bool  `json:"requires_assignee"`
+}
+
+// TodoTransition tells whether a todo can move to a status, and why not when it cannot
+// @name TodoTransition
+type TodoTransition struct {
+	StatusID uint       `json:"status_id"`
+	Status   TodoStatus `json:"status"`
+	IsDone   bool       `json:"is_done"`
+	Allowed  bool       `json:"allowed"`
+	Reason   string     `json:"reason,omitempty"`
+}
+
+// TodoTransitions lists the moves from a todo's current status to every other status of its list
+// @name TodoTransitions
+type TodoTransitions struct {
+	Current     TodoStatus       `json:"current"`
+	Transitions []TodoTransition `json:"transitions"`
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+)
+
+type ChangeOperation string
+
+const (
+	ChangeCreate ChangeOperation = "create"
+	ChangeUpdate ChangeOperation = "update"
+	ChangeDelete ChangeOperation = "delete"
+)
+
+// TodoChange records a single write to a todo. Seq is a monotonic cursor shared by all users.
+// @name TodoChange
+type TodoChange struct {
+	Seq       uint64          `gorm:"primarykey;index:idx_todo_changes_user_seq,priority:2;index:idx_todo_changes_workspace_seq,priority:2" json:"seq"`
+	CreatedAt time.Time       `json:"createdAt"`
+	TodoID    uint            `gorm:"not null;index" json:"todo_id"`
+	UserID    uint            `gorm:"not null;index:idx_todo_changes_user_seq,priority:1" json:"user_id"`
+	Operation ChangeOperation `gorm:"type:varchar(10);not null" json:"operation"`
+	// WorkspaceID is nil for changes in the owner's personal space
+	WorkspaceID *uint `gorm:"index:idx_todo_changes_workspace_seq,priority:1" json:"-"`
+}
+
+// SyncReceipt remembers the todo a client change was applied to, so a client retrying a push
+// after a lost response gets the earlier result instead of applying the change twice
+type SyncReceipt struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_sync_receipts_client,priority:1"`
+	ClientID  string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_sync_receipts_client,priority:2"`
+	// WorkspaceID is nil for changes pushed to the user's personal space
+	WorkspaceID *uint `gorm:"index"`
+	TodoID      uint  `gorm:"not null"`
+	User        User  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+// SyncChange describes the latest server state of a todo changed since the cursor
+// @name SyncChange
+type SyncChange struct {
+	Seq       uint64          `json:"seq"`
+	Operation ChangeOperation `json:"operation"`
+	TodoID    uint            `json:"todo_id"`
+	Deleted   bool            `json:"deleted"`
+	Todo      *Todo           `json:"todo,omitempty"`
+}
+
+// SyncPullResponse defines the response of a delta sync pull
+// @name SyncPullResponse
+type SyncPullResponse struct {
+	Changes []SyncChange `json:"changes"`
+	Cursor  string       `json:"cursor"`
+	HasMore bool         `json:"has_more"`
+}
+
+// SyncClientChange defines a single change made by a client while offline
+// @name SyncClientChange
+type SyncClientChange struct {
+	ClientID    string          `json:"client_id" validate:"required,max=64"`
+	Operation   ChangeOperation `json:"operation" validate:"required,oneof=create update delete"`
+	TodoID      uint            `json:"todo_id" validate:"required_unless=Operation create"`
+	BaseSeq     uint64          `json:"base_seq"`
+	Title       *string         `json:"title" validate:"omitempty,min=1,max=255"`
+	Description *string         `json:"description" validate:"omitempty,max=1000"`
+	ImageURL    *string         `json:"image_url" validate:"omitempty,url"`
+	Status      *TodoStatus     `json:"status" validate:"omitempty,min=1,max=50"`
+	DueDate     *time.Time      `json:"due_date"`
+}
+
+// SyncPushRequest defines a batch of offline changes to apply
+// @name SyncPushRequest
+type SyncPushRequest struct {
+	Changes []SyncClientChange `json:"changes" validate:"required,max=500,dive"`
+}
+
+type SyncResultStatus string
+
+const (
+	SyncApplied  SyncResultStatus = "applied"
+	SyncConflict SyncResultStatus = "conflict"
+	SyncRejected SyncResultStatus = "rejected"
+)
+
+// SyncChangeResult reports the outcome of a single client change
+// @name SyncChangeResult
+type SyncChangeResult struct {
+	ClientID string           `json:"client_id"`
+	Status   SyncResultStatus `json:"status"`
+	TodoID   uint             `json:"todo_id,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	// Server holds the current server version of the todo after an applied change or on conflict
+	Server *SyncChange `json:"server,omitempty"`
+}
+
+// SyncPushResponse defines the response of a delta sync push
+// @name SyncPushResponse
+type SyncPushResponse struct {
+	Results []SyncChangeResult `json:"results"`
+}
@@ -4,8 +4,10 @@ import (
 	"time"
 )
 
+// TodoStatus is the name of one of the statuses defined by the todo's list
 type TodoStatus string
 
+// Names of the default statuses of a list
 const (
 	StatusPending    TodoStatus = "Pending"
 	StatusInProgress TodoStatus = "In Progress"
@@ -21,29 +23,123 @@ type Todo struct {
 	Title       string     `gorm:"not null" json:"title"`
 	Description string     `json:"description,omitempty"`
 	ImageURL    string     `gorm:"type:text" json:"image_url,omitempty"`
-	Status      TodoStatus `gorm:"type:varchar(20);default:'Pending';not null" json:"status"`
+	Status      TodoStatus `gorm:"type:varchar(50);not null" json:"status"`
+	// Position orders the todo within the board column of its status
+	Position int        `gorm:"not null;default:0" json:"position"`
+	DueDate  *time.Time `json:"due_date,omitempty"`
+	// CompletedAt is when the todo was last moved to a done status, nil while it is not done
+	CompletedAt *time.Time `gorm:"index" json:"completed_at,omitempty"`
 	UserID      uint       `gorm:"not null" json:"user_id"`
 	User        User       `gorm:"foreignKey:UserID" json:"-"`
+	// WorkspaceID is nil for todos in the owner's personal space
+	WorkspaceID *uint     `gorm:"index" json:"workspace_id,omitempty"`
+	Workspace   Workspace `gorm:"foreignKey:WorkspaceID;constraint:OnDelete:CASCADE" json:"-"`
+	// AssigneeID is the member responsible for the todo, nil when unassigned
+	AssigneeID *uint `gorm:"index" json:"assignee_id,omitempty"`
+	Assignee   *User `gorm:"foreignKey:AssigneeID;constraint:OnDelete:SET NULL" json:"-"`
+	// ReminderSentFor is the due date a due-soon reminder was last sent for
+	ReminderSentFor *time.Time `json:"-"`
+	// CommentCount is computed when todos are read and is not stored
+	CommentCount int64 `gorm:"->;-:migration" json:"comment_count"`
+	// BlockedBy and Blocking are the todos blocking this todo and blocked by it, loaded with the todo
+	BlockedBy []TodoReference `gorm:"-" json:"blocked_by,omitempty"`
+	Blocking  []TodoReference `gorm:"-" json:"blocking,omitempty"`
+}
+
+// IsDone reports whether the todo is in a status marked as done
+func (t *Todo) IsDone() bool {
+	return t.CompletedAt != nil
+}
+
+// HasOpenBlockers reports whether a todo blocking this todo is not done yet
+func (t *Todo) HasOpenBlockers() bool {
+	for _, blocker := range t.BlockedBy {
+		if !blocker.IsDone {
+			return true
+		}
+	}
+	return false
+}
+
+// TodoWatcher subscribes a user to the changes of a todo
+// @name TodoWatcher
+type TodoWatcher struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	CreatedAt time.Time `json:"watching_since"`
+	TodoID    uint      `gorm:"not null;uniqueIndex:idx_todo_watchers_todo_user" json:"todo_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_todo_watchers_todo_user;index" json:"user_id"`
+	Todo      Todo      `gorm:"foreignKey:TodoID;constraint:OnDelete:CASCADE" json:"-"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TodoWatcherResponse describes a user watching a todo
+// @name TodoWatcherResponse
+type TodoWatcherResponse struct {
+	UserID        uint      `json:"user_id"`
+	Email         string    `json:"email"`
+	DisplayName   string    `json:"display_name,omitempty"`
+	WatchingSince time.Time `json:"watching_since"`
 }
 
 // CreateTodoRequest defines the structure for creating a todo
 // @name CreateTodoRequest
 type CreateTodoRequest struct {
-	Title       string `json:"title" validate:"required,min=1,max=255"`
-	Description string `json:"description" validate:"max=1000"`
-	ImageURL    string `json:"image_url" validate:"omitempty,url"`
+	Title       string     `json:"title" validate:"required,min=1,max=255"`
+	Description string     `json:"description" validate:"max=1000"`
+	ImageURL    string     `json:"image_url" validate:"omitempty,url"`
+	DueDate     *time.Time `json:"due_date"`
 }
 
 // UpdateTodoRequest defines the structure for updating todo content
 // @name UpdateTodoRequest
 type UpdateTodoRequest struct {
-	Title       *string `json:"title" validate:"omitempty,min=1,max=255"`
-	Description *string `json:"description" validate:"omitempty,max=1000"`
-	ImageURL    *string `json:"image_url" validate:"omitempty"`
+	Title       *string    `json:"title" validate:"omitempty,min=1,max=255"`
+	Description *string    `json:"description" validate:"omitempty,max=1000"`
+	ImageURL    *string    `json:"image_url" validate:"omitempty"`
+	DueDate     *time.Time `json:"due_date"`
 }
 
 // UpdateTodoStatusRequest defines the structure for updating todo status
 // @name UpdateTodoStatusRequest
 type UpdateTodoStatusRequest struct {
-	Status TodoStatus `json:"status" validate:"required,oneof=Pending 'In Progress' Done"`
+	Status TodoStatus `json:"status" validate:"required,min=1,max=50"`
+	// Force completes the todo even while todos blocking it are open
+	Force bool `json:"force"`
+}
+
+// AssignTodoRequest defines the structure for assigning a todo; a null assignee_id unassigns it
+// @name AssignTodoRequest
+type AssignTodoRequest struct {
+	AssigneeID *uint `json:"assignee_id"`
+}
+
+// AddTodoWatcherRequest defines the structure for adding a watcher to a todo
+// @name AddTodoWatcherRequest
+type AddTodoWatcherRequest struct {
+	UserID uint `json:"user_id" validate:"required"`
+}
+
+// Values of the due filter, evaluated in the user's timezone
+const (
+	DueOverdue  = "overdue"
+	DueToday    = "today"
+	DueThisWeek = "week"
+)
+
+// TodoFilter defines the optional filters shared by the list and export endpoints
+type TodoFilter struct {
+	Status TodoStatus `query:"status" validate:"max=50"`
+	Search string     `query:"q" validate:"max=255"`
+	Due    string     `query:"due" validate:"omitempty,oneof=overdue today week"`
+	// Sort defaults to the user's default_sort preference
+	Sort TodoSort `query:"sort" validate:"omitempty,oneof=created_desc created_asc due_asc due_desc title_asc position"`
+	// DueAfter and DueBefore bound due dates as [DueAfter, DueBefore); they are resolved from Due
+	DueAfter    *time.Time `query:"-"`
+	DueBefore   *time.Time `query:"-"`
+	ExcludeDone bool       `query:"-"`
+	// Limit bounds the number of todos returned, zero for all
+	Limit int `query:"-"`
+	// AssigneeID and WatcherID restrict the list to todos assigned to or watched by a user
+	AssigneeID *uint `query:"-"`
+	WatcherID  *uint `query:"-"`
 }
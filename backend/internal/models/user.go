@@ -4,6 +4,11 @@ import (
 	"time"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 // User defines the user model
 // @name User
 type User struct {
@@ -11,6 +16,41 @@ type User struct {
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 	Email     string    `gorm:"uniqueIndex;not null" json:"email"`
-	Password  string    `gorm:"not null" json:"-"` // '-' hides password in JSON responses
+	Password  string    `gorm:"not null" json:"-"` // '-' hides password in JSON responses; empty for accounts that only sign in through an identity provider
 	Todos     []Todo    `gorm:"foreignKey:UserID" json:"-"`
+	// TOTPSecret is encrypted at rest; it is set during enrollment and kept only while 2FA is enabled
+	TOTPSecret      string `json:"-"`
+	TOTPEnabled     bool   `gorm:"not null;default:false" json:"totp_enabled"`
+	TOTPLastCounter int64  `gorm:"not null;default:0" json:"-"` // last accepted time step, prevents code replay
+	Role            string `gorm:"type:varchar(20);not null;default:'user'" json:"role"`
+	// DisabledAt is set while an administrator has disabled the account
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	// PasswordResetRequired blocks password login until the user sets a new password
+	PasswordResetRequired  bool       `gorm:"not null;default:false" json:"password_reset_required"`
+	PasswordResetTokenHash string     `gorm:"type:varchar(64)" json:"-"`
+	PasswordResetExpiresAt *time.Time `json:"-"`
+	// Profile and preferences; an empty Timezone falls back to the server's TIME_ZONE
+	DisplayName string   `gorm:"size:100" json:"display_name"`
+	AvatarURL   string   `gorm:"type:text" json:"avatar_url,omitempty"`
+	Timezone    string   `gorm:"size:64" json:"timezone"`
+	Locale      string   `gorm:"size:35" json:"locale"`
+	WeekStart   Weekday  `gorm:"type:varchar(10);not null;default:'monday'" json:"week_start"`
+	DefaultSort TodoSort `gorm:"type:varchar(20);not null;default:'created_desc'" json:"default_sort"`
+	// DigestEnabled opts in to a daily email sent at DigestTime (HH:MM, local time); DigestSentOn
+	// is the local date of the last digest
+	DigestEnabled bool   `gorm:"not null;default:false;index" json:"digest_enabled"`
+	DigestTime    string `gorm:"type:varchar(5);not null;default:'08:00'" json:"digest_time"`
+	DigestSentOn  string `gorm:"type:varchar(10)" json:"-"`
+	// PendingEmail waits for confirmation through the link sent to it before replacing Email
+	PendingEmail         string     `gorm:"size:320" json:"pending_email,omitempty"`
+	EmailChangeTokenHash string     `gorm:"type:varchar(64)" json:"-"`
+	EmailChangeExpiresAt *time.Time `json:"-"`
+	// Set while a requested deletion waits out its cooling-off period; the account is erased at DeletionScheduledAt
+	DeletionRequestedAt *time.Time `json:"-"`
+	DeletionScheduledAt *time.Time `gorm:"index" json:"deletion_scheduled_at,omitempty"`
+}
+
+// IsDisabled reports whether an administrator has disabled the account
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
 }
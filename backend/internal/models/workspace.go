@@ -0,0 +1,128 @@
+package models
+
+import (
+	"time"
+)
+
+// WorkspaceRole is a member's role within one workspace
+type WorkspaceRole string
+
+const (
+	// WorkspaceRoleOwner can do everything, including deleting the workspace
+	WorkspaceRoleOwner WorkspaceRole = "owner"
+	// WorkspaceRoleAdmin manages members and settings
+	WorkspaceRoleAdmin WorkspaceRole = "admin"
+	// WorkspaceRoleMember reads and writes todos
+	WorkspaceRoleMember WorkspaceRole = "member"
+	// WorkspaceRoleViewer only reads todos
+	WorkspaceRoleViewer WorkspaceRole = "viewer"
+)
+
+// CanManage reports whether the role may change members and settings
+func (r WorkspaceRole) CanManage() bool {
+	return r == WorkspaceRoleOwner || r == WorkspaceRoleAdmin
+}
+
+// CanWrite reports whether the role may change todos
+func (r WorkspaceRole) CanWrite() bool {
+	return r != WorkspaceRoleViewer
+}
+
+// Workspace is an isolated space whose members share its todos
+// @name Workspace
+type Workspace struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Name        string    `gorm:"size:100;not null" json:"name"`
+	Description string    `gorm:"type:text" json:"description,omitempty"`
+	// Quotas are set by site administrators; zero means unlimited
+	MaxMembers int `gorm:"not null;default:0" json:"max_members"`
+	MaxTodos   int `gorm:"not null;default:0" json:"max_todos"`
+	// Role is the requesting user's role, filled in when listing their workspaces
+	Role WorkspaceRole `gorm:"-" json:"role,omitempty"`
+}
+
+// WorkspaceMember grants a user a role in a workspace
+// @name WorkspaceMember
+type WorkspaceMember struct {
+	ID          uint          `gorm:"primarykey" json:"-"`
+	CreatedAt   time.Time     `json:"joined_at"`
+	UpdatedAt   time.Time     `json:"-"`
+	WorkspaceID uint          `gorm:"not null;uniqueIndex:idx_workspace_members_workspace_user" json:"workspace_id"`
+	UserID      uint          `gorm:"not null;uniqueIndex:idx_workspace_members_workspace_user;index" json:"user_id"`
+	Role        WorkspaceRole `gorm:"type:varchar(20);not null" json:"role"`
+	Workspace   Workspace     `gorm:"foreignKey:WorkspaceID;constraint:OnDelete:CASCADE" json:"-"`
+	User        User          `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// WorkspaceMemberResponse describes a member of a workspace
+// @name WorkspaceMemberResponse
+type WorkspaceMemberResponse struct {
+	UserID      uint          `json:"user_id"`
+	Email       string        `json:"email"`
+	DisplayName string        `json:"display_name,omitempty"`
+	Role        WorkspaceRole `json:"role"`
+	JoinedAt    time.Time     `json:"joined_at"`
+}
+
+// CreateWorkspaceRequest defines the structure for creating a workspace
+// @name CreateWorkspaceRequest
+type CreateWorkspaceRequest struct {
+	Name        string `json:"name" validate:"required,min=1,max=100"`
+	Description string `json:"description" validate:"max=1000"`
+}
+
+// UpdateWorkspaceRequest defines the workspace settings that can be changed
+// @name UpdateWorkspaceRequest
+type UpdateWorkspaceRequest struct {
+	Name        *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Description *string `json:"description" validate:"omitempty,max=1000"`
+}
+
+// AddWorkspaceMemberRequest defines the structure for adding an existing user to a workspace
+// @name AddWorkspaceMemberRequest
+type AddWorkspaceMemberRequest struct {
+	Email string        `json:"email" validate:"required,email"`
+	Role  WorkspaceRole `json:"role" validate:"required,oneof=admin member viewer"`
+}
+
+// UpdateWorkspaceMemberRequest defines the structure for changing a member's role
+// @name UpdateWorkspaceMemberRequest
+type UpdateWorkspaceMemberRequest struct {
+	Role WorkspaceRole `json:"role" validate:"required,oneof=owner admin member viewer"`
+}
+
+// UpdateWorkspaceQuotaRequest defines the quotas site administrators can set; zero means unlimited
+// @name UpdateWorkspaceQuotaRequest
+type UpdateWorkspaceQuotaRequest struct {
+	MaxMembers *int `json:"max_members" validate:"omitempty,min=0"`
+	MaxTodos   *int `json:"max_todos" validate:"omitempty,min=0"`
+}
+
+// Tenant is the owner of the todos a request works on: a workspace, or the user's personal
+// space when WorkspaceID is nil
+type Tenant struct {
+	UserID      uint
+	WorkspaceID *uint
+	Role        WorkspaceRole
+	// MaxTodos is the workspace's todo quota, zero for unlimited
+	MaxTodos int
+}
+
+// TenantOwned is implemented by models whose rows belong to a tenant. Queries on them are
+// restricted to the tenant of the request automatically.
+type TenantOwned interface {
+	tenantOwned()
+}
+
+func (Todo) tenantOwned()             {}
+func (TodoChange) tenantOwned()       {}
+func (TodoEvent) tenantOwned()        {}
+func (Comment) tenantOwned()          {}
+func (CalDAVResource) tenantOwned()   {}
+func (ShareLink) tenantOwned()        {}
+func (StatusDefinition) tenantOwned() {}
+func (StatusTransition) tenantOwned() {}
+func (TodoDependency) tenantOwned()   {}
+func (SyncReceipt) tenantOwned()      {}
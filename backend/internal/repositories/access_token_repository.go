@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AccessTokenRepository interface {
+	CreateAccessToken(ctx context.Context, token *models.PersonalAccessToken) error
+	FindAccessTokensByUserID(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error)
+	FindAccessTokenByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error)
+	DeleteAccessToken(ctx context.Context, userID, id uint) error
+	DeleteAccessTokensByUserID(ctx context.Context, userID uint) (int64, error)
+	UpdateLastUsed(ctx context.Context, id uint, usedAt time.Time) error
+}
+
+type accessTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewAccessTokenRepository(db *gorm.DB) AccessTokenRepository {
+	return &accessTokenRepository{db: db}
+}
+
+func (r *accessTokenRepository) CreateAccessToken(ctx context.Context, token *models.PersonalAccessToken) error {
+	result := r.db.WithContext(ctx).Create(token)
+	return result.Error
+}
+
+func (r *accessTokenRepository) FindAccessTokensByUserID(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at desc").Find(&tokens)
+	return tokens, result.Error
+}
+
+func (r *accessTokenRepository) FindAccessTokenByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	result := r.db.WithContext(ctx).Preload("User").Where("token_hash = ?", tokenHash).First(&token)
+	return &token, result.Error
+}
+
+func (r *accessTokenRepository) DeleteAccessToken(ctx context.Context, userID, id uint) error {
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.PersonalAccessToken{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *accessTokenRepository) DeleteAccessTokensByUserID(ctx context.Context, userID uint) (int64, error) {
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.PersonalAccessToken{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *accessTokenRepository) UpdateLastUsed(ctx context.Context, id uint, usedAt time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.PersonalAccessToken{}).Where("id = ?", id).UpdateColumn("last_used_at", usedAt)
+	return result.Error
+}
@@ -0,0 +1,264 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccountRepository holds personal data exports and the erasure of whole accounts
+type AccountRepository interface {
+	CreateDataExport(ctx context.Context, export *models.DataExport) error
+	FindDataExportByID(ctx context.Context, id string) (*models.DataExport, error)
+	FindActiveDataExport(ctx context.Context, userID uint) (*models.DataExport, error)
+	FindExpiredDataExports(ctx context.Context, now time.Time) ([]models.DataExport, error)
+	FindDataExportsByUserID(ctx context.Context, userID uint) ([]models.DataExport, error)
+	UpdateDataExport(ctx context.Context, export *models.DataExport) error
+	DeleteDataExport(ctx context.Context, id string) error
+	// FindUserRecords loads every row of dest's table that belongs to the user in any tenant, oldest first
+	FindUserRecords(ctx context.Context, userID uint, dest any) error
+	FindUsersDueForDeletion(ctx context.Context, now time.Time) ([]models.User, error)
+	// FindHandedOverImageURLs returns the image URLs of the user's todos in workspaces with other
+	// members, which PurgeUser hands to another member rather than deleting
+	FindHandedOverImageURLs(ctx context.Context, userID uint) ([]string, error)
+	// FindSoleOwnedWorkspaces returns the workspaces with other members of which the user is the only owner
+	FindSoleOwnedWorkspaces(ctx context.Context, userID uint) ([]models.Workspace, error)
+	// PurgeUser deletes the user and their personal data in one transaction and records the tombstone.
+	// Todos, activity and other shared rows the user created in workspaces are handed to a workspace
+	// owner, with the user's comments there emptied and marked deleted. Workspaces left without an
+	// owner are handed to another member and those without other members are deleted.
+	PurgeUser(ctx context.Context, userID uint, tombstone *models.DeletedAccount) error
+}
+
+type accountRepository struct {
+	db *gorm.DB
+}
+
+func NewAccountRepository(db *gorm.DB) AccountRepository {
+	return &accountRepository{db: db}
+}
+
+func (r *accountRepository) CreateDataExport(ctx context.Context, export *models.DataExport) error {
+	result := r.db.WithContext(ctx).Create(export)
+	return result.Error
+}
+
+func (r *accountRepository) FindDataExportByID(ctx context.Context, id string) (*models.DataExport, error) {
+	var export models.DataExport
+	result := r.db.WithContext(ctx).Where("id = ?", id).First(&export)
+	return &export, result.Error
+}
+
+func (r *accountRepository) FindActiveDataExport(ctx context.Context, userID uint) (*models.DataExport, error) {
+	var export models.DataExport
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND status IN ?", userID, []models.DataExportStatus{models.DataExportPending, models.DataExportRunning}).
+		First(&export)
+	return &export, result.Error
+}
+
+func (r *accountRepository) FindExpiredDataExports(ctx context.Context, now time.Time) ([]models.DataExport, error) {
+	var exports []models.DataExport
+	result := r.db.WithContext(ctx).Where("expires_at <= ?", now).Find(&exports)
+	return exports, result.Error
+}
+
+func (r *accountRepository) FindDataExportsByUserID(ctx context.Context, userID uint) ([]models.DataExport, error) {
+	var exports []models.DataExport
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&exports)
+	return exports, result.Error
+}
+
+func (r *accountRepository) UpdateDataExport(ctx context.Context, export *models.DataExport) error {
+	result := r.db.WithContext(ctx).Save(export)
+	return result.Error
+}
+
+func (r *accountRepository) DeleteDataExport(ctx context.Context, id string) error {
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&models.DataExport{})
+	return result.Error
+}
+
+func (r *accountRepository) FindUserRecords(ctx context.Context, userID uint, dest any) error {
+	stmt := &gorm.Statement{DB: r.db}
+	if err := stmt.Parse(dest); err != nil {
+		return err
+	}
+	// Tables without a creation time are in the order their rows were inserted
+	order := "created_at"
+	if stmt.Schema.LookUpField("CreatedAt") == nil {
+		order = stmt.Schema.PrioritizedPrimaryField.DBName
+	}
+	result := r.db.WithContext(crossTenant(ctx)).Where("user_id = ?", userID).Order(order).Find(dest)
+	return result.Error
+}
+
+func (r *accountRepository) FindHandedOverImageURLs(ctx context.Context, userID uint) ([]string, error) {
+	var urls []string
+	result := r.db.WithContext(crossTenant(ctx)).Model(&models.Todo{}).
+		Where("user_id = ? AND workspace_id IS NOT NULL AND image_url <> ''", userID).
+		Where("EXISTS (SELECT 1 FROM workspace_members others WHERE others.workspace_id = todos.workspace_id AND others.user_id <> ?)", userID).
+		Pluck("image_url", &urls)
+	return urls, result.Error
+}
+
+func (r *accountRepository) FindUsersDueForDeletion(ctx context.Context, now time.Time) ([]models.User, error) {
+	var users []models.User
+	result := r.db.WithContext(ctx).Where("deletion_scheduled_at <= ?", now).Find(&users)
+	return users, result.Error
+}
+
+// soleOwnerCondition matches memberships of user ? in which they are the workspace's only owner
+const soleOwnerCondition = "workspace_members.user_id = ? AND workspace_members.role = ? AND NOT EXISTS " +
+	"(SELECT 1 FROM workspace_members owners WHERE owners.workspace_id = workspace_members.workspace_id AND owners.role = ? AND owners.user_id <> workspace_members.user_id)"
+
+func (r *accountRepository) FindSoleOwnedWorkspaces(ctx context.Context, userID uint) ([]models.Workspace, error) {
+	var workspaces []models.Workspace
+	result := r.db.WithContext(ctx).
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where(soleOwnerCondition, userID, models.WorkspaceRoleOwner, models.WorkspaceRoleOwner).
+		Where("EXISTS (SELECT 1 FROM workspace_members others WHERE others.workspace_id = workspaces.id AND others.user_id <> ?)", userID).
+		Order("workspaces.name").
+		Find(&workspaces)
+	return workspaces, result.Error
+}
+
+func (r *accountRepository) PurgeUser(ctx context.Context, userID uint, tombstone *models.DeletedAccount) error {
+	return r.db.WithContext(crossTenant(ctx)).Transaction(func(tx *gorm.DB) error {
+		if err := handOverOwnedWorkspaces(tx, userID); err != nil {
+			return err
+		}
+
+		// The user's workspace comments are removed the way deleting them in the app does, so
+		// replies stay in their threads
+		err := tx.Where("comment_id IN (SELECT id FROM comments WHERE user_id = ? AND workspace_id IS NOT NULL)", userID).
+			Delete(&models.CommentMention{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.Comment{}).Where("user_id = ? AND workspace_id IS NOT NULL", userID).
+			Updates(map[string]any{"body": "", "deleted": true}).Error
+		if err != nil {
+			return err
+		}
+
+		// Rows the team relies on stay in their workspace under the longest-standing other owner
+		shared := []any{&models.TodoEvent{}, &models.Comment{}, &models.TodoDependency{}, &models.CalDAVResource{}, &models.ShareLink{}, &models.TodoChange{}, &models.Todo{}}
+		for _, model := range shared {
+			if err := reassignWorkspaceRows(tx, model, userID); err != nil {
+				return err
+			}
+		}
+
+		// What is left is the user's own: the personal-space rows of the tables handed over above,
+		// and records about the user wherever they are, such as watches and memberships
+		owned := []struct {
+			model    any
+			personal bool
+		}{
+			{model: &models.TodoEvent{}, personal: true},
+			{model: &models.CommentMention{}},
+			{model: &models.Comment{}, personal: true},
+			{model: &models.TodoWatcher{}},
+			{model: &models.TodoDependency{}, personal: true},
+			{model: &models.CalDAVResource{}, personal: true},
+			{model: &models.ShareLink{}, personal: true},
+			{model: &models.StatusTransition{}},
+			{model: &models.StatusDefinition{}},
+			{model: &models.TodoChange{}, personal: true},
+			{model: &models.SyncReceipt{}},
+			{model: &models.Todo{}, personal: true},
+			{model: &models.ImportJob{}},
+			{model: &models.DataExport{}},
+			{model: &models.PersonalAccessToken{}},
+			{model: &models.RecoveryCode{}},
+			{model: &models.UserIdentity{}},
+			{model: &models.Session{}},
+			{model: &models.WorkspaceMember{}},
+			{model: &models.Notification{}},
+			{model: &models.NotificationPreference{}},
+			{model: &models.PushSubscription{}},
+			{model: &models.CalendarFeed{}},
+		}
+		for _, row := range owned {
+			query := tx.Where("user_id = ?", userID)
+			if row.personal {
+				query = query.Where("workspace_id IS NULL")
+			}
+			if err := query.Delete(row.model).Error; err != nil {
+				return err
+			}
+		}
+
+		// Events by other users keep their meaning without saying who they were about
+		err = tx.Model(&models.TodoEvent{}).Where("subject_id = ?", userID).Update("subject_id", nil).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.Notification{}).Where("actor_id = ?", userID).Update("actor_id", nil).Error
+		if err != nil {
+			return err
+		}
+
+		// The audit trail is kept, stripped of anything that identifies the person
+		err = tx.Model(&models.SecurityEvent{}).Where("user_id = ?", userID).
+			Updates(map[string]any{"email": "", "ip": "", "user_agent": "", "details": ""}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&models.User{}, userID).Error; err != nil {
+			return err
+		}
+		return tx.Create(tombstone).Error
+	})
+}
+
+// handOverOwnedWorkspaces makes sure no workspace is left without an owner: each workspace the
+// user is the only owner of passes to its longest-standing admin, or member, and is deleted when
+// nobody else belongs to it
+func handOverOwnedWorkspaces(tx *gorm.DB, userID uint) error {
+	var workspaceIDs []uint
+	err := tx.Model(&models.WorkspaceMember{}).
+		Where(soleOwnerCondition, userID, models.WorkspaceRoleOwner, models.WorkspaceRoleOwner).
+		Pluck("workspace_id", &workspaceIDs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, workspaceID := range workspaceIDs {
+		var successor models.WorkspaceMember
+		err := tx.Where("workspace_id = ? AND user_id <> ?", workspaceID, userID).
+			Order("CASE role WHEN 'admin' THEN 0 WHEN 'member' THEN 1 ELSE 2 END, created_at").
+			First(&successor).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := deleteWorkspace(tx, workspaceID); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&successor).Update("role", models.WorkspaceRoleOwner).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reassignWorkspaceRows hands the user's rows of model in workspaces to the longest-standing
+// other owner of each workspace
+func reassignWorkspaceRows(tx *gorm.DB, model any, userID uint) error {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	owner := gorm.Expr("(SELECT owners.user_id FROM workspace_members owners WHERE owners.workspace_id = "+stmt.Table+".workspace_id"+
+		" AND owners.role = ? AND owners.user_id <> ? ORDER BY owners.created_at LIMIT 1)", models.WorkspaceRoleOwner, userID)
+	return tx.Model(model).Where("user_id = ? AND workspace_id IS NOT NULL", userID).Update("user_id", owner).Error
+}
@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AdminRepository holds queries that span users for administrators
+type AdminRepository interface {
+	SearchUsers(ctx context.Context, filter models.AdminUserFilter) ([]models.User, int64, error)
+	GetUserStats(ctx context.Context, userID uint, now time.Time) (*models.UserStats, error)
+}
+
+type adminRepository struct {
+	db *gorm.DB
+}
+
+func NewAdminRepository(db *gorm.DB) AdminRepository {
+	return &adminRepository{db: db}
+}
+
+func (r *adminRepository) SearchUsers(ctx context.Context, filter models.AdminUserFilter) ([]models.User, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.User{})
+	if filter.Search != "" {
+		query = query.Where("email ILIKE ?", "%"+filter.Search+"%")
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			query = query.Where("disabled_at IS NOT NULL")
+		} else {
+			query = query.Where("disabled_at IS NULL")
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	result := query.Order("id").Offset(filter.Page * filter.PageSize).Limit(filter.PageSize).Find(&users)
+	return users, total, result.Error
+}
+
+func (r *adminRepository) GetUserStats(ctx context.Context, userID uint, now time.Time) (*models.UserStats, error) {
+	// Counts cover the user's todos in every workspace as well as their personal ones
+	db := r.db.WithContext(crossTenant(ctx))
+	stats := &models.UserStats{UserID: userID, TodosByStatus: map[models.TodoStatus]int64{}}
+
+	var byStatus []struct {
+		Status models.TodoStatus
+		Count  int64
+	}
+	if err := db.Model(&models.Todo{}).Select("status, COUNT(*) AS count").
+		Where("user_id = ?", userID).Group("status").Scan(&byStatus).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range byStatus {
+		stats.TodosByStatus[row.Status] = row.Count
+		stats.TodoCount += row.Count
+	}
+
+	if err := db.Model(&models.PersonalAccessToken{}).Where("user_id = ?", userID).Count(&stats.AccessTokenCount).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.ImportJob{}).Where("user_id = ?", userID).Count(&stats.ImportJobCount).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Count(&stats.ActiveSessionCount).Error; err != nil {
+		return nil, err
+	}
+
+	var activity struct {
+		LastLoginAt *time.Time
+		LastSeenAt  *time.Time
+	}
+	if err := db.Model(&models.Session{}).
+		Select("MAX(created_at) AS last_login_at, MAX(last_seen_at) AS last_seen_at").
+		Where("user_id = ? AND impersonator_id IS NULL", userID).
+		Scan(&activity).Error; err != nil {
+		return nil, err
+	}
+	stats.LastLoginAt = activity.LastLoginAt
+	stats.LastSeenAt = activity.LastSeenAt
+	return stats, nil
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// CalDAVRepository stores the resource names CalDAV clients chose for the todos they created.
+// Queries are restricted to the tenant in the context.
+type CalDAVRepository interface {
+	FindResourceByName(ctx context.Context, name string) (*models.CalDAVResource, error)
+	FindResourcesByTodoIDs(ctx context.Context, todoIDs []uint) ([]models.CalDAVResource, error)
+	// SaveResource records the resource of a todo, replacing a stale resource of the same name
+	// left behind by a deleted todo
+	SaveResource(ctx context.Context, resource *models.CalDAVResource) error
+}
+
+type calDAVRepository struct {
+	db *gorm.DB
+}
+
+func NewCalDAVRepository(db *gorm.DB) CalDAVRepository {
+	return &calDAVRepository{db: db}
+}
+
+func (r *calDAVRepository) FindResourceByName(ctx context.Context, name string) (*models.CalDAVResource, error) {
+	var resource models.CalDAVResource
+	result := conn(ctx, r.db).Where("name = ?", name).Order("created_at desc").First(&resource)
+	return &resource, result.Error
+}
+
+func (r *calDAVRepository) FindResourcesByTodoIDs(ctx context.Context, todoIDs []uint) ([]models.CalDAVResource, error) {
+	var resources []models.CalDAVResource
+	if len(todoIDs) == 0 {
+		return resources, nil
+	}
+	result := conn(ctx, r.db).Where("todo_id IN ?", todoIDs).Find(&resources)
+	return resources, result.Error
+}
+
+func (r *calDAVRepository) SaveResource(ctx context.Context, resource *models.CalDAVResource) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("name = ?", resource.Name).Delete(&models.CalDAVResource{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(resource).Error
+	})
+}
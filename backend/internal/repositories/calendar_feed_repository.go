@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CalendarFeedRepository interface {
+	// SaveFeed creates the user's feed, or replaces the token of the existing one
+	SaveFeed(ctx context.Context, feed *models.CalendarFeed) error
+	FindFeedByUserID(ctx context.Context, userID uint) (*models.CalendarFeed, error)
+	FindFeedByHash(ctx context.Context, tokenHash string) (*models.CalendarFeed, error)
+	DeleteFeed(ctx context.Context, userID uint) error
+	UpdateLastFetched(ctx context.Context, id uint, fetchedAt time.Time) error
+}
+
+type calendarFeedRepository struct {
+	db *gorm.DB
+}
+
+func NewCalendarFeedRepository(db *gorm.DB) CalendarFeedRepository {
+	return &calendarFeedRepository{db: db}
+}
+
+func (r *calendarFeedRepository) SaveFeed(ctx context.Context, feed *models.CalendarFeed) error {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"created_at", "prefix", "token_hash", "last_fetched_at"}),
+	}).Create(feed)
+	return result.Error
+}
+
+func (r *calendarFeedRepository) FindFeedByUserID(ctx context.Context, userID uint) (*models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&feed)
+	return &feed, result.Error
+}
+
+func (r *calendarFeedRepository) FindFeedByHash(ctx context.Context, tokenHash string) (*models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+	result := r.db.WithContext(ctx).Preload("User").Where("token_hash = ?", tokenHash).First(&feed)
+	return &feed, result.Error
+}
+
+func (r *calendarFeedRepository) DeleteFeed(ctx context.Context, userID uint) error {
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.CalendarFeed{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *calendarFeedRepository) UpdateLastFetched(ctx context.Context, id uint, fetchedAt time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.CalendarFeed{}).Where("id = ?", id).UpdateColumn("last_fetched_at", fetchedAt)
+	return result.Error
+}
@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type CommentRepository interface {
+	// CreateComment creates the comment with its mentions and records events in the same transaction
+	CreateComment(ctx context.Context, comment *models.Comment, events []models.TodoEvent) error
+	// FindCommentByID returns the comment with its mentions
+	FindCommentByID(ctx context.Context, id uint) (*models.Comment, error)
+	// FindComments returns a page of the todo's top-level comments with their replies, oldest first,
+	// and the number of top-level comments
+	FindComments(ctx context.Context, todoID uint, page, pageSize int) ([]models.Comment, int64, error)
+	CountReplies(ctx context.Context, commentID uint) (int64, error)
+	// UpdateComment saves the comment's body, replaces its mentions and records events
+	UpdateComment(ctx context.Context, comment *models.Comment, events []models.TodoEvent) error
+	// MarkCommentDeleted clears the comment but keeps it in place for its replies
+	MarkCommentDeleted(ctx context.Context, id uint) error
+	DeleteComment(ctx context.Context, id uint) error
+}
+
+type commentRepository struct {
+	db *gorm.DB
+}
+
+func NewCommentRepository(db *gorm.DB) CommentRepository {
+	return &commentRepository{db: db}
+}
+
+// createCommentEvents links events to the comment and stores them
+func createCommentEvents(tx *gorm.DB, comment *models.Comment, events []models.TodoEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	for i := range events {
+		events[i].CommentID = &comment.ID
+	}
+	return tx.Create(&events).Error
+}
+
+func (r *commentRepository) CreateComment(ctx context.Context, comment *models.Comment, events []models.TodoEvent) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(comment).Error; err != nil {
+			return err
+		}
+		return createCommentEvents(tx, comment, events)
+	})
+}
+
+func (r *commentRepository) FindCommentByID(ctx context.Context, id uint) (*models.Comment, error) {
+	var comment models.Comment
+	result := r.db.WithContext(ctx).Preload("Mentions").First(&comment, id)
+	return &comment, result.Error
+}
+
+func (r *commentRepository) FindComments(ctx context.Context, todoID uint, page, pageSize int) ([]models.Comment, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.Comment{}).Where("todo_id = ? AND parent_id IS NULL", todoID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var comments []models.Comment
+	result := query.
+		Preload("Mentions").
+		Preload("Replies", func(db *gorm.DB) *gorm.DB { return db.Order("created_at, id") }).
+		Preload("Replies.Mentions").
+		Order("created_at, id").
+		Offset(page * pageSize).
+		Limit(pageSize).
+		Find(&comments)
+	return comments, total, result.Error
+}
+
+func (r *commentRepository) CountReplies(ctx context.Context, commentID uint) (int64, error) {
+	var count int64
+	result := r.db.WithContext(ctx).Model(&models.Comment{}).Where("parent_id = ?", commentID).Count(&count)
+	return count, result.Error
+}
+
+func (r *commentRepository) UpdateComment(ctx context.Context, comment *models.Comment, events []models.TodoEvent) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(comment).Select("body", "edited").Updates(comment).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("comment_id = ?", comment.ID).Delete(&models.CommentMention{}).Error; err != nil {
+			return err
+		}
+		if len(comment.Mentions) > 0 {
+			for i := range comment.Mentions {
+				comment.Mentions[i].ID = 0
+				comment.Mentions[i].CommentID = comment.ID
+			}
+			if err := tx.Create(&comment.Mentions).Error; err != nil {
+				return err
+			}
+		}
+		return createCommentEvents(tx, comment, events)
+	})
+}
+
+func (r *commentRepository) MarkCommentDeleted(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Comment{}).Where("id = ?", id).
+			Updates(map[string]any{"body": "", "deleted": true}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("comment_id = ?", id).Delete(&models.CommentMention{}).Error
+	})
+}
+
+func (r *commentRepository) DeleteComment(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.Comment{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type IdentityRepository interface {
+	FindIdentity(ctx context.Context, issuer, subject string) (*models.UserIdentity, error)
+	CreateIdentity(ctx context.Context, identity *models.UserIdentity) error
+	// CreateUserWithIdentity creates a user without a local password together with its first identity
+	CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.UserIdentity) error
+}
+
+type identityRepository struct {
+	db *gorm.DB
+}
+
+func NewIdentityRepository(db *gorm.DB) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) FindIdentity(ctx context.Context, issuer, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	result := r.db.WithContext(ctx).Where("issuer = ? AND subject = ?", issuer, subject).First(&identity)
+	return &identity, result.Error
+}
+
+func (r *identityRepository) CreateIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	result := r.db.WithContext(ctx).Create(identity)
+	return result.Error
+}
+
+func (r *identityRepository) CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.UserIdentity) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
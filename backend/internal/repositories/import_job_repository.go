@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type ImportJobRepository interface {
+	CreateImportJob(ctx context.Context, job *models.ImportJob) error
+	FindImportJobByID(ctx context.Context, id string) (*models.ImportJob, error)
+	UpdateImportJob(ctx context.Context, job *models.ImportJob) error
+	UpdateImportProgress(ctx context.Context, id string, processedRows int) error
+}
+
+type importJobRepository struct {
+	db *gorm.DB
+}
+
+func NewImportJobRepository(db *gorm.DB) ImportJobRepository {
+	return &importJobRepository{db: db}
+}
+
+func (r *importJobRepository) CreateImportJob(ctx context.Context, job *models.ImportJob) error {
+	result := conn(ctx, r.db).Create(job)
+	return result.Error
+}
+
+func (r *importJobRepository) FindImportJobByID(ctx context.Context, id string) (*models.ImportJob, error) {
+	var job models.ImportJob
+	result := conn(ctx, r.db).Where("id = ?", id).First(&job)
+	return &job, result.Error
+}
+
+func (r *importJobRepository) UpdateImportJob(ctx context.Context, job *models.ImportJob) error {
+	result := conn(ctx, r.db).Save(job)
+	return result.Error
+}
+
+func (r *importJobRepository) UpdateImportProgress(ctx context.Context, id string, processedRows int) error {
+	result := conn(ctx, r.db).Model(&models.ImportJob{}).Where("id = ?", id).Update("processed_rows", processedRows)
+	return result.Error
+}
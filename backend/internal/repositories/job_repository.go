@@ -0,0 +1,193 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrJobNotLocked is returned when recording the outcome of a job the worker no longer holds,
+// because it was released as stale and claimed again
+var ErrJobNotLocked = errors.New("job is not locked by this worker")
+
+type JobRepository interface {
+	// EnqueueJob adds the job unless a job with the same unique key is unfinished; it reports
+	// whether the job was added
+	EnqueueJob(ctx context.Context, job *models.Job) (bool, error)
+	// ClaimJobs locks up to limit due jobs for workerID and counts the attempt. Jobs locked by
+	// other workers are skipped, so several workers can claim concurrently.
+	ClaimJobs(ctx context.Context, workerID string, limit int, now time.Time) ([]models.Job, error)
+	// CompleteJob, RetryJob and BuryJob only change a job still locked by workerID and return
+	// ErrJobNotLocked otherwise
+	CompleteJob(ctx context.Context, id uint, workerID string, now time.Time) error
+	// RetryJob releases the job to run again at runAt
+	RetryJob(ctx context.Context, id uint, workerID string, runAt time.Time, lastError string) error
+	// BuryJob moves the job to the dead-letter state
+	BuryJob(ctx context.Context, id uint, workerID string, lastError string, now time.Time) error
+	// RequeueStaleJobs releases running jobs locked before lockedBefore, whose worker has died.
+	// Jobs that have used all their attempts are buried instead, so a job that kills its worker
+	// is not retried forever. It returns the numbers of jobs requeued and buried.
+	RequeueStaleJobs(ctx context.Context, lockedBefore, now time.Time) (int64, int64, error)
+	DeleteFinishedJobs(ctx context.Context, finishedBefore time.Time) (int64, error)
+	// EnsureSchedule creates the schedule, or brings its next run forward to nextRunAt
+	EnsureSchedule(ctx context.Context, name string, nextRunAt time.Time) error
+	// FireSchedule enqueues job if the schedule is due at now and moves it to nextRunAt. It
+	// reports false when the schedule is not due or another worker is firing it.
+	FireSchedule(ctx context.Context, name string, now, nextRunAt time.Time, job *models.Job) (bool, error)
+}
+
+type jobRepository struct {
+	db *gorm.DB
+}
+
+func NewJobRepository(db *gorm.DB) JobRepository {
+	return &jobRepository{db: db}
+}
+
+func enqueueJob(tx *gorm.DB, job *models.Job) (bool, error) {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(job)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *jobRepository) EnqueueJob(ctx context.Context, job *models.Job) (bool, error) {
+	return enqueueJob(r.db.WithContext(ctx), job)
+}
+
+func (r *jobRepository) ClaimJobs(ctx context.Context, workerID string, limit int, now time.Time) ([]models.Job, error) {
+	var jobs []models.Job
+	result := r.db.WithContext(ctx).Raw(`
+		UPDATE jobs
+		SET status = ?, locked_by = ?, locked_at = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE status = ? AND run_at <= ?
+			ORDER BY run_at, id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		models.JobRunning, workerID, now, now, models.JobPending, now, limit,
+	).Scan(&jobs)
+	return jobs, result.Error
+}
+
+// finishJob applies updates to the job if workerID still holds it
+func (r *jobRepository) finishJob(ctx context.Context, id uint, workerID string, updates map[string]any) error {
+	result := r.db.WithContext(ctx).Model(&models.Job{}).
+		Where("id = ? AND status = ? AND locked_by = ?", id, models.JobRunning, workerID).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrJobNotLocked
+	}
+	return nil
+}
+
+func (r *jobRepository) CompleteJob(ctx context.Context, id uint, workerID string, now time.Time) error {
+	return r.finishJob(ctx, id, workerID, map[string]any{
+		"status":      models.JobSucceeded,
+		"finished_at": now,
+		"locked_by":   "",
+		"locked_at":   nil,
+		"last_error":  "",
+	})
+}
+
+func (r *jobRepository) RetryJob(ctx context.Context, id uint, workerID string, runAt time.Time, lastError string) error {
+	return r.finishJob(ctx, id, workerID, map[string]any{
+		"status":     models.JobPending,
+		"run_at":     runAt,
+		"locked_by":  "",
+		"locked_at":  nil,
+		"last_error": lastError,
+	})
+}
+
+func (r *jobRepository) BuryJob(ctx context.Context, id uint, workerID string, lastError string, now time.Time) error {
+	return r.finishJob(ctx, id, workerID, map[string]any{
+		"status":      models.JobDead,
+		"finished_at": now,
+		"locked_by":   "",
+		"locked_at":   nil,
+		"last_error":  lastError,
+	})
+}
+
+func (r *jobRepository) RequeueStaleJobs(ctx context.Context, lockedBefore, now time.Time) (int64, int64, error) {
+	const stopped = "worker stopped while running the job"
+	var requeued, buried int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Job{}).
+			Where("status = ? AND locked_at < ? AND attempts >= max_attempts", models.JobRunning, lockedBefore).
+			Updates(map[string]any{
+				"status":      models.JobDead,
+				"finished_at": now,
+				"locked_by":   "",
+				"locked_at":   nil,
+				"last_error":  stopped + " on its last attempt",
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		buried = result.RowsAffected
+
+		result = tx.Model(&models.Job{}).
+			Where("status = ? AND locked_at < ?", models.JobRunning, lockedBefore).
+			Updates(map[string]any{
+				"status":     models.JobPending,
+				"locked_by":  "",
+				"locked_at":  nil,
+				"last_error": stopped,
+			})
+		requeued = result.RowsAffected
+		return result.Error
+	})
+	return requeued, buried, err
+}
+
+func (r *jobRepository) DeleteFinishedJobs(ctx context.Context, finishedBefore time.Time) (int64, error) {
+	// Dead jobs are kept until someone has looked at them
+	result := r.db.WithContext(ctx).
+		Where("status = ? AND finished_at < ?", models.JobSucceeded, finishedBefore).
+		Delete(&models.Job{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *jobRepository) EnsureSchedule(ctx context.Context, name string, nextRunAt time.Time) error {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "name"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"next_run_at": gorm.Expr("LEAST(job_schedules.next_run_at, EXCLUDED.next_run_at)"),
+		}),
+	}).Create(&models.JobSchedule{Name: name, NextRunAt: nextRunAt})
+	return result.Error
+}
+
+func (r *jobRepository) FireSchedule(ctx context.Context, name string, now, nextRunAt time.Time, job *models.Job) (bool, error) {
+	fired := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var schedule models.JobSchedule
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("name = ? AND next_run_at <= ?", name, now).
+			First(&schedule).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := enqueueJob(tx, job); err != nil {
+			return err
+		}
+		fired = true
+		return tx.Model(&schedule).Updates(map[string]any{"next_run_at": nextRunAt, "last_run_at": now}).Error
+	})
+	return fired, err
+}
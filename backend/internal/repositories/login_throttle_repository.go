@@ -0,0 +1,214 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginThrottleStore keeps failed login counters. The database implementation shares
+// counters between replicas; the in-memory one suits single-instance deployments.
+type LoginThrottleStore interface {
+	// Get returns the counter for key, or a zero counter if none exists
+	Get(ctx context.Context, key string) (*models.LoginThrottle, error)
+	// RecordFailure increments the counter, restarting it when the last failure is older than window
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*models.LoginThrottle, error)
+	// Reserve counts an attempt as failed before its outcome is known, like RecordFailure, if
+	// allow accepts the current counter. The check and the increment are atomic, so parallel
+	// attempts cannot all pass allow; allow's error is returned when it refuses.
+	Reserve(ctx context.Context, key string, now time.Time, window time.Duration, allow func(current *models.LoginThrottle) error) (*models.LoginThrottle, error)
+	// Release takes back one reserved failure, for an attempt that turned out not to fail
+	Release(ctx context.Context, key string) error
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type loginThrottleRepository struct {
+	db *gorm.DB
+}
+
+func NewLoginThrottleRepository(db *gorm.DB) LoginThrottleStore {
+	return &loginThrottleRepository{db: db}
+}
+
+func (r *loginThrottleRepository) Get(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	err := r.db.WithContext(ctx).Where("key = ?", key).First(&throttle).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.LoginThrottle{Key: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+func (r *loginThrottleRepository) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	err := r.db.WithContext(ctx).Raw(`INSERT INTO login_throttles (key, failures, last_failure_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING key, failures, last_failure_at, locked_until`,
+		key, now, now.Add(-window)).Scan(&throttle).Error
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+func (r *loginThrottleRepository) Reserve(ctx context.Context, key string, now time.Time, window time.Duration, allow func(current *models.LoginThrottle) error) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// A new key gets an empty counter first, so there always is a row to lock
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginThrottle{Key: key}).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&throttle).Error; err != nil {
+			return err
+		}
+		if err := allow(&throttle); err != nil {
+			return err
+		}
+		if throttle.LastFailureAt.Before(now.Add(-window)) {
+			throttle.Failures = 0
+		}
+		throttle.Failures++
+		throttle.LastFailureAt = now
+		return tx.Model(&throttle).Updates(map[string]any{"failures": throttle.Failures, "last_failure_at": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+func (r *loginThrottleRepository) Release(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).Model(&models.LoginThrottle{}).
+		Where("key = ? AND failures > 0", key).
+		Update("failures", gorm.Expr("failures - 1")).Error
+}
+
+func (r *loginThrottleRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	throttle := models.LoginThrottle{Key: key, LastFailureAt: time.Now(), LockedUntil: &until}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"locked_until"}),
+	}).Create(&throttle).Error
+}
+
+func (r *loginThrottleRepository) Reset(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).Where("key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
+
+// memoryPruneThreshold is the number of entries above which stale counters are dropped
+const memoryPruneThreshold = 10000
+
+type memoryLoginThrottleStore struct {
+	mu      sync.Mutex
+	entries map[string]models.LoginThrottle
+}
+
+func NewMemoryLoginThrottleStore() LoginThrottleStore {
+	return &memoryLoginThrottleStore{entries: make(map[string]models.LoginThrottle)}
+}
+
+func (s *memoryLoginThrottleStore) Get(_ context.Context, key string) (*models.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	throttle, ok := s.entries[key]
+	if !ok {
+		throttle = models.LoginThrottle{Key: key}
+	}
+	return &throttle, nil
+}
+
+func (s *memoryLoginThrottleStore) RecordFailure(_ context.Context, key string, now time.Time, window time.Duration) (*models.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) >= memoryPruneThreshold {
+		s.prune(now, window)
+	}
+
+	throttle, ok := s.entries[key]
+	if !ok || throttle.LastFailureAt.Before(now.Add(-window)) {
+		throttle.Key = key
+		throttle.Failures = 0
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = now
+	s.entries[key] = throttle
+	return &throttle, nil
+}
+
+func (s *memoryLoginThrottleStore) Reserve(_ context.Context, key string, now time.Time, window time.Duration, allow func(current *models.LoginThrottle) error) (*models.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) >= memoryPruneThreshold {
+		s.prune(now, window)
+	}
+
+	throttle, ok := s.entries[key]
+	if !ok {
+		throttle = models.LoginThrottle{Key: key}
+	}
+	if err := allow(&throttle); err != nil {
+		return nil, err
+	}
+	if throttle.LastFailureAt.Before(now.Add(-window)) {
+		throttle.Failures = 0
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = now
+	s.entries[key] = throttle
+	return &throttle, nil
+}
+
+func (s *memoryLoginThrottleStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if throttle, ok := s.entries[key]; ok && throttle.Failures > 0 {
+		throttle.Failures--
+		s.entries[key] = throttle
+	}
+	return nil
+}
+
+func (s *memoryLoginThrottleStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	throttle, ok := s.entries[key]
+	if !ok {
+		throttle = models.LoginThrottle{Key: key, LastFailureAt: time.Now()}
+	}
+	throttle.LockedUntil = &until
+	s.entries[key] = throttle
+	return nil
+}
+
+func (s *memoryLoginThrottleStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// prune drops counters whose window has passed and that are not locked; callers hold mu
+func (s *memoryLoginThrottleStore) prune(now time.Time, window time.Duration) {
+	for key, throttle := range s.entries {
+		if throttle.LastFailureAt.Before(now.Add(-window)) && !throttle.IsLocked(now) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type NotificationRepository interface {
+	CreateNotifications(ctx context.Context, notifications []models.Notification) error
+	// FindNotifications returns a page of the user's notifications, newest first, and their total
+	FindNotifications(ctx context.Context, userID uint, unreadOnly bool, page, pageSize int) ([]models.Notification, int64, error)
+	CountUnread(ctx context.Context, userID uint) (int64, error)
+	// MarkRead marks the user's notification read; it is not found when it belongs to someone else
+	MarkRead(ctx context.Context, userID, id uint, at time.Time) error
+	MarkAllRead(ctx context.Context, userID uint, at time.Time) (int64, error)
+	FindPreferences(ctx context.Context, userID uint) ([]models.NotificationPreference, error)
+	// FindDisabledUserIDs returns which of userIDs turned off notifications of type
+	FindDisabledUserIDs(ctx context.Context, userIDs []uint, notificationType models.NotificationType) ([]uint, error)
+	SavePreferences(ctx context.Context, preferences []models.NotificationPreference) error
+}
+
+type notificationRepository struct {
+	db *gorm.DB
+}
+
+func NewNotificationRepository(db *gorm.DB) NotificationRepository {
+	return &notificationRepository{db: db}
+}
+
+func (r *notificationRepository) CreateNotifications(ctx context.Context, notifications []models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	result := r.db.WithContext(ctx).CreateInBatches(notifications, createBatchSize)
+	return result.Error
+}
+
+func (r *notificationRepository) FindNotifications(ctx context.Context, userID uint, unreadOnly bool, page, pageSize int) ([]models.Notification, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.Notification{}).Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var notifications []models.Notification
+	result := query.Order("created_at desc, id desc").Offset(page * pageSize).Limit(pageSize).Find(&notifications)
+	return notifications, total, result.Error
+}
+
+func (r *notificationRepository) CountUnread(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	result := r.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Count(&count)
+	return count, result.Error
+}
+
+func (r *notificationRepository) MarkRead(ctx context.Context, userID, id uint, at time.Time) error {
+	// Reading a notification again keeps the time it was first read
+	result := r.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", at))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *notificationRepository) MarkAllRead(ctx context.Context, userID uint, at time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", at)
+	return result.RowsAffected, result.Error
+}
+
+func (r *notificationRepository) FindPreferences(ctx context.Context, userID uint) ([]models.NotificationPreference, error) {
+	var preferences []models.NotificationPreference
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&preferences)
+	return preferences, result.Error
+}
+
+func (r *notificationRepository) FindDisabledUserIDs(ctx context.Context, userIDs []uint, notificationType models.NotificationType) ([]uint, error) {
+	var disabled []uint
+	if len(userIDs) == 0 {
+		return disabled, nil
+	}
+	result := r.db.WithContext(ctx).Model(&models.NotificationPreference{}).
+		Where("user_id IN ? AND type = ? AND NOT enabled", userIDs, notificationType).
+		Pluck("user_id", &disabled)
+	return disabled, result.Error
+}
+
+func (r *notificationRepository) SavePreferences(ctx context.Context, preferences []models.NotificationPreference) error {
+	if len(preferences) == 0 {
+		return nil
+	}
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled"}),
+	}).Create(&preferences)
+	return result.Error
+}
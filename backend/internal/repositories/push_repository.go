@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PushRepository interface {
+	// SaveSubscription creates the subscription, or updates the keys of the user's subscription
+	// with the same endpoint. It returns gorm.ErrDuplicatedKey when another user subscribed the
+	// endpoint, which must be unsubscribed first so nobody can redirect another user's pushes.
+	SaveSubscription(ctx context.Context, subscription *models.PushSubscription) error
+	FindSubscriptions(ctx context.Context, userID uint) ([]models.PushSubscription, error)
+	FindSubscriptionsByUserIDs(ctx context.Context, userIDs []uint) ([]models.PushSubscription, error)
+	FindSubscriptionByID(ctx context.Context, id uint) (*models.PushSubscription, error)
+	DeleteSubscription(ctx context.Context, userID, id uint) error
+	// PruneSubscription deletes a subscription the push service no longer accepts
+	PruneSubscription(ctx context.Context, id uint) error
+	MarkPushed(ctx context.Context, id uint, now time.Time) error
+}
+
+type pushRepository struct {
+	db *gorm.DB
+}
+
+func NewPushRepository(db *gorm.DB) PushRepository {
+	return &pushRepository{db: db}
+}
+
+func (r *pushRepository) SaveSubscription(ctx context.Context, subscription *models.PushSubscription) error {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "endpoint"}},
+		DoUpdates: clause.AssignmentColumns([]string{"p256dh", "auth", "user_agent", "updated_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: "push_subscriptions", Name: "user_id"}, Value: subscription.UserID},
+		}},
+	}).Create(subscription)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrDuplicatedKey
+	}
+	return nil
+}
+
+func (r *pushRepository) FindSubscriptions(ctx context.Context, userID uint) ([]models.PushSubscription, error) {
+	var subscriptions []models.PushSubscription
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at desc").Find(&subscriptions)
+	return subscriptions, result.Error
+}
+
+func (r *pushRepository) FindSubscriptionsByUserIDs(ctx context.Context, userIDs []uint) ([]models.PushSubscription, error) {
+	var subscriptions []models.PushSubscription
+	if len(userIDs) == 0 {
+		return subscriptions, nil
+	}
+	result := r.db.WithContext(ctx).Where("user_id IN ?", userIDs).Find(&subscriptions)
+	return subscriptions, result.Error
+}
+
+func (r *pushRepository) FindSubscriptionByID(ctx context.Context, id uint) (*models.PushSubscription, error) {
+	var subscription models.PushSubscription
+	result := r.db.WithContext(ctx).First(&subscription, id)
+	return &subscription, result.Error
+}
+
+func (r *pushRepository) DeleteSubscription(ctx context.Context, userID, id uint) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.PushSubscription{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *pushRepository) PruneSubscription(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.PushSubscription{}, id)
+	return result.Error
+}
+
+func (r *pushRepository) MarkPushed(ctx context.Context, id uint, now time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.PushSubscription{}).
+		Where("id = ?", id).
+		UpdateColumn("last_pushed_at", now)
+	return result.Error
+}
@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type SecurityEventRepository interface {
+	CreateSecurityEvent(ctx context.Context, event *models.SecurityEvent) error
+	// FindSecurityEvents returns the newest events, optionally only those about userID
+	FindSecurityEvents(ctx context.Context, userID *uint, limit int) ([]models.SecurityEvent, error)
+}
+
+type securityEventRepository struct {
+	db *gorm.DB
+}
+
+func NewSecurityEventRepository(db *gorm.DB) SecurityEventRepository {
+	return &securityEventRepository{db: db}
+}
+
+func (r *securityEventRepository) CreateSecurityEvent(ctx context.Context, event *models.SecurityEvent) error {
+	result := r.db.WithContext(ctx).Create(event)
+	return result.Error
+}
+
+func (r *securityEventRepository) FindSecurityEvents(ctx context.Context, userID *uint, limit int) ([]models.SecurityEvent, error) {
+	query := r.db.WithContext(ctx).Order("id desc").Limit(limit)
+	if userID != nil {
+		query = query.Where("user_id = ? OR actor_id = ?", *userID, *userID)
+	}
+	var events []models.SecurityEvent
+	result := query.Find(&events)
+	return events, result.Error
+}
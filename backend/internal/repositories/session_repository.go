@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	FindSessionByID(ctx context.Context, id string) (*models.Session, error)
+	FindActiveSessionsByUserID(ctx context.Context, userID uint, now time.Time) ([]models.Session, error)
+	UpdateLastSeen(ctx context.Context, id string, seenAt time.Time) error
+	RevokeSession(ctx context.Context, userID uint, id string, revokedAt time.Time) error
+	// RevokeOtherSessions revokes every active session of the user except keepID and returns how many were revoked
+	RevokeOtherSessions(ctx context.Context, userID uint, keepID string, revokedAt time.Time) (int64, error)
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	result := r.db.WithContext(ctx).Create(session)
+	return result.Error
+}
+
+func (r *sessionRepository) FindSessionByID(ctx context.Context, id string) (*models.Session, error) {
+	var session models.Session
+	result := r.db.WithContext(ctx).Where("id = ?", id).First(&session)
+	return &session, result.Error
+}
+
+func (r *sessionRepository) FindActiveSessionsByUserID(ctx context.Context, userID uint, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at desc").
+		Find(&sessions)
+	return sessions, result.Error
+}
+
+func (r *sessionRepository) UpdateLastSeen(ctx context.Context, id string, seenAt time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.Session{}).Where("id = ?", id).UpdateColumn("last_seen_at", seenAt)
+	return result.Error
+}
+
+func (r *sessionRepository) RevokeSession(ctx context.Context, userID uint, id string, revokedAt time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		UpdateColumn("revoked_at", revokedAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *sessionRepository) RevokeOtherSessions(ctx context.Context, userID uint, keepID string, revokedAt time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+		UpdateColumn("revoked_at", revokedAt)
+	return result.RowsAffected, result.Error
+}
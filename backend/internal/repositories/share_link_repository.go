@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ShareLinkRepository stores share links. Queries are restricted to the tenant in the context,
+// except the lookup and access tracking of links opened by their token.
+type ShareLinkRepository interface {
+	CreateLink(ctx context.Context, link *models.ShareLink) error
+	// FindLinks returns the tenant's links, newest first, only those of one todo when todoID is set
+	FindLinks(ctx context.Context, todoID *uint) ([]models.ShareLink, error)
+	FindLinkByID(ctx context.Context, id uint) (*models.ShareLink, error)
+	DeleteLink(ctx context.Context, id uint) error
+	// FindLinkByHash looks a link up in every tenant, with its creator and workspace
+	FindLinkByHash(ctx context.Context, tokenHash string) (*models.ShareLink, error)
+	RecordAccess(ctx context.Context, id uint, accessedAt time.Time) error
+}
+
+type shareLinkRepository struct {
+	db *gorm.DB
+}
+
+func NewShareLinkRepository(db *gorm.DB) ShareLinkRepository {
+	return &shareLinkRepository{db: db}
+}
+
+func (r *shareLinkRepository) CreateLink(ctx context.Context, link *models.ShareLink) error {
+	return r.db.WithContext(ctx).Create(link).Error
+}
+
+func (r *shareLinkRepository) FindLinks(ctx context.Context, todoID *uint) ([]models.ShareLink, error) {
+	var links []models.ShareLink
+	query := r.db.WithContext(ctx).Order("created_at desc, id desc")
+	if todoID != nil {
+		query = query.Where("todo_id = ?", *todoID)
+	}
+	result := query.Find(&links)
+	return links, result.Error
+}
+
+func (r *shareLinkRepository) FindLinkByID(ctx context.Context, id uint) (*models.ShareLink, error) {
+	var link models.ShareLink
+	result := r.db.WithContext(ctx).First(&link, id)
+	return &link, result.Error
+}
+
+func (r *shareLinkRepository) DeleteLink(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.ShareLink{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *shareLinkRepository) FindLinkByHash(ctx context.Context, tokenHash string) (*models.ShareLink, error) {
+	var link models.ShareLink
+	result := r.db.WithContext(crossTenant(ctx)).Preload("User").Preload("Workspace").
+		Where("token_hash = ?", tokenHash).First(&link)
+	return &link, result.Error
+}
+
+func (r *shareLinkRepository) RecordAccess(ctx context.Context, id uint, accessedAt time.Time) error {
+	result := r.db.WithContext(crossTenant(ctx)).Model(&models.ShareLink{}).Where("id = ?", id).UpdateColumns(map[string]any{
+		"access_count":     gorm.Expr("access_count + 1"),
+		"last_accessed_at": accessedAt,
+	})
+	return result.Error
+}
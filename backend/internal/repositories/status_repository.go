@@ -0,0 +1,166 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StatusRepository stores the statuses and workflow rules defined by lists. Queries are restricted to the tenant in
+// the context. Changes that affect todos are recorded in the tenant's change feed.
+type StatusRepository interface {
+	// FindStatuses returns the tenant's statuses in board order
+	FindStatuses(ctx context.Context) ([]models.StatusDefinition, error)
+	CreateStatus(ctx context.Context, status *models.StatusDefinition) error
+	// CreateDefaultStatuses adds statuses, skipping names the tenant already has
+	CreateDefaultStatuses(ctx context.Context, statuses []models.StatusDefinition) error
+	// UpdateStatus saves status and carries a new name or done flag over to the todos that were
+	// in previous
+	UpdateStatus(ctx context.Context, status *models.StatusDefinition, previous models.StatusDefinition, now time.Time) error
+	// SaveOrder saves the positions of statuses
+	SaveOrder(ctx context.Context, statuses []models.StatusDefinition) error
+	// DeleteStatus removes a status, first moving its todos to the end of moveTo when set
+	DeleteStatus(ctx context.Context, status *models.StatusDefinition, moveTo *models.StatusDefinition, now time.Time) error
+	// FindTransitions returns the tenant's workflow rules
+	FindTransitions(ctx context.Context) ([]models.StatusTransition, error)
+	CreateTransition(ctx context.Context, transition *models.StatusTransition) error
+	DeleteTransition(ctx context.Context, id uint) error
+}
+
+type statusRepository struct {
+	db *gorm.DB
+}
+
+func NewStatusRepository(db *gorm.DB) StatusRepository {
+	return &statusRepository{db: db}
+}
+
+func (r *statusRepository) FindStatuses(ctx context.Context) ([]models.StatusDefinition, error) {
+	var statuses []models.StatusDefinition
+	result := r.db.WithContext(ctx).Order("position asc, id asc").Find(&statuses)
+	return statuses, result.Error
+}
+
+func (r *statusRepository) CreateStatus(ctx context.Context, status *models.StatusDefinition) error {
+	return r.db.WithContext(ctx).Create(status).Error
+}
+
+func (r *statusRepository) CreateDefaultStatuses(ctx context.Context, statuses []models.StatusDefinition) error {
+	// Concurrent requests may seed the same list; the unique index on names keeps one copy
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&statuses).Error
+}
+
+func (r *statusRepository) UpdateStatus(ctx context.Context, status *models.StatusDefinition, previous models.StatusDefinition, now time.Time) error {
+	if status.Name == previous.Name && status.IsDone == previous.IsDone {
+		return r.db.WithContext(ctx).Save(status).Error
+	}
+
+	return r.withTodoChanges(ctx, func(tx *gorm.DB) ([]models.TodoChange, error) {
+		if err := tx.Save(status).Error; err != nil {
+			return nil, err
+		}
+		return moveTodos(tx, previous.Name, status, 0, now)
+	})
+}
+
+func (r *statusRepository) SaveOrder(ctx context.Context, statuses []models.StatusDefinition) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, status := range statuses {
+			if err := tx.Model(&models.StatusDefinition{}).Where("id = ?", status.ID).Update("position", status.Position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *statusRepository) DeleteStatus(ctx context.Context, status *models.StatusDefinition, moveTo *models.StatusDefinition, now time.Time) error {
+	return r.withTodoChanges(ctx, func(tx *gorm.DB) ([]models.TodoChange, error) {
+		var changes []models.TodoChange
+		if moveTo != nil {
+			// Moved todos keep their order, after the todos already in moveTo
+			var offset int
+			err := tx.Model(&models.Todo{}).Where("status = ?", moveTo.Name).
+				Select("COALESCE(MAX(position) + 1, 0)").Scan(&offset).Error
+			if err != nil {
+				return nil, err
+			}
+			if changes, err = moveTodos(tx, status.Name, moveTo, offset, now); err != nil {
+				return nil, err
+			}
+		}
+		result := tx.Delete(&models.StatusDefinition{}, status.ID)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return changes, nil
+	})
+}
+
+func (r *statusRepository) FindTransitions(ctx context.Context) ([]models.StatusTransition, error) {
+	var transitions []models.StatusTransition
+	result := r.db.WithContext(ctx).Order("id asc").Find(&transitions)
+	return transitions, result.Error
+}
+
+func (r *statusRepository) CreateTransition(ctx context.Context, transition *models.StatusTransition) error {
+	return r.db.WithContext(ctx).Create(transition).Error
+}
+
+func (r *statusRepository) DeleteTransition(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.StatusTransition{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// withTodoChanges runs write like the todo repository's writes, so the changes it makes to
+// todos are ordered with every other change of the tenant
+func (r *statusRepository) withTodoChanges(ctx context.Context, write func(tx *gorm.DB) ([]models.TodoChange, error)) error {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return ErrMissingTenant
+	}
+	todos := &todoRepository{db: r.db}
+	return todos.withChanges(ctx, tenant.UserID, write)
+}
+
+// moveTodos puts the todos in status from into status to, shifting their positions by offset
+// and setting or clearing their completion time to match to
+func moveTodos(tx *gorm.DB, from models.TodoStatus, to *models.StatusDefinition, offset int, now time.Time) ([]models.TodoChange, error) {
+	var todos []models.Todo
+	if err := tx.Select("id", "user_id").Where("status = ?", from).Find(&todos).Error; err != nil {
+		return nil, err
+	}
+	if len(todos) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(todos))
+	changes := make([]models.TodoChange, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+		changes[i] = models.TodoChange{TodoID: todo.ID, UserID: todo.UserID, Operation: models.ChangeUpdate}
+	}
+
+	var completedAt any
+	if to.IsDone {
+		completedAt = gorm.Expr("COALESCE(completed_at, ?)", now)
+	}
+	err := tx.Model(&models.Todo{}).Where("id IN ?", ids).Updates(map[string]any{
+		"status":       to.Name,
+		"position":     gorm.Expr("position + ?", offset),
+		"completed_at": completedAt,
+	}).Error
+	return changes, err
+}
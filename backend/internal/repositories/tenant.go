@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrMissingTenant is returned for queries on tenant-owned tables made without a tenant in the
+// context. Failing closed means a forgotten tenant can never read or change another tenant's rows.
+var ErrMissingTenant = errors.New("query on a tenant-owned table without a tenant")
+
+type tenantKey struct{}
+
+type crossTenantKey struct{}
+
+// TenantKey is the context key of the request's models.Tenant. Handlers pass c.Context() to
+// services, so middleware stores the tenant with c.Locals(TenantKey, tenant).
+var TenantKey = tenantKey{}
+
+// WithTenant returns a copy of ctx whose queries are restricted to tenant
+func WithTenant(ctx context.Context, tenant models.Tenant) context.Context {
+	return context.WithValue(ctx, TenantKey, tenant)
+}
+
+// TenantFromContext returns the tenant queries made with ctx are restricted to
+func TenantFromContext(ctx context.Context) (models.Tenant, bool) {
+	tenant, ok := ctx.Value(TenantKey).(models.Tenant)
+	return tenant, ok
+}
+
+// crossTenant lifts tenant scoping for maintenance that spans tenants, such as erasing an
+// account. It is unexported so only this package can decide a query may cross tenants.
+func crossTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, crossTenantKey{}, true)
+}
+
+// RegisterTenantScope installs callbacks that add the tenant's condition to every query,
+// update and delete on tenant-owned tables and assign the tenant to created rows
+func RegisterTenantScope(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register("tenant:query", scopeToTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("tenant:row", scopeToTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenant:update", scopeToTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("tenant:delete", scopeToTenant); err != nil {
+		return err
+	}
+	return callbacks.Create().Before("gorm:create").Register("tenant:create", assignTenant)
+}
+
+// tenantFor returns the tenant of a statement on a tenant-owned table. It returns false when
+// the statement needs no scoping, and records ErrMissingTenant when it has no tenant.
+func tenantFor(db *gorm.DB) (models.Tenant, bool) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return models.Tenant{}, false
+	}
+	if _, owned := reflect.New(stmt.Schema.ModelType).Interface().(models.TenantOwned); !owned {
+		return models.Tenant{}, false
+	}
+	if stmt.Context.Value(crossTenantKey{}) != nil {
+		return models.Tenant{}, false
+	}
+
+	tenant, ok := TenantFromContext(stmt.Context)
+	if !ok {
+		db.AddError(ErrMissingTenant)
+		return models.Tenant{}, false
+	}
+	return tenant, true
+}
+
+func scopeToTenant(db *gorm.DB) {
+	tenant, ok := tenantFor(db)
+	if !ok {
+		return
+	}
+
+	workspaceID := clause.Column{Table: clause.CurrentTable, Name: "workspace_id"}
+	if tenant.WorkspaceID != nil {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: workspaceID, Value: *tenant.WorkspaceID},
+		}})
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: workspaceID, Value: nil},
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "user_id"}, Value: tenant.UserID},
+	}})
+}
+
+func assignTenant(db *gorm.DB) {
+	tenant, ok := tenantFor(db)
+	if !ok {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField("WorkspaceID")
+	if field == nil {
+		db.AddError(ErrMissingTenant)
+		return
+	}
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := field.Set(db.Statement.Context, reflect.Indirect(rv.Index(i)), tenant.WorkspaceID); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+	case reflect.Struct:
+		if err := field.Set(db.Statement.Context, rv, tenant.WorkspaceID); err != nil {
+			db.AddError(err)
+		}
+	}
+}
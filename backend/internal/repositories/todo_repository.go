@@ -3,18 +3,78 @@ package repositories
 import (
 	"context"
 	"github.com/xNatthapol/todo-list/internal/models"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// syncLockNamespace is the first key of the per-user advisory lock that serializes todo writes,
+// so change sequence numbers of a single user are always committed in order.
+const syncLockNamespace = 26001
+
+// workspaceSyncLockNamespace is the same lock for a workspace, whose members share one change feed
+const workspaceSyncLockNamespace = 26002
+
 type TodoRepository interface {
 	CreateTodo(ctx context.Context, todo *models.Todo) error
-	FindTodosByUserID(ctx context.Context, userID uint) ([]models.Todo, error)
+	CreateTodos(ctx context.Context, userID uint, todos []models.Todo) error
+	FindTodos(ctx context.Context, filter models.TodoFilter) ([]models.Todo, error)
+	StreamTodos(ctx context.Context, filter models.TodoFilter, fn func(todo *models.Todo) error) error
+	CountTodos(ctx context.Context) (int64, error)
 	FindTodoByID(ctx context.Context, id uint) (*models.Todo, error)
 	UpdateTodo(ctx context.Context, todo *models.Todo) error
 	DeleteTodo(ctx context.Context, id uint) error
+	// InTransaction runs fn in one transaction holding the tenant's write lock. Todo, CalDAV and
+	// import job queries made with the context fn is given join the transaction, so their writes
+	// commit or roll back together with fn.
+	InTransaction(ctx context.Context, userID uint, fn func(ctx context.Context) error) error
+	FindTodosByIDs(ctx context.Context, ids []uint) ([]models.Todo, error)
+	// CountTodosByStatus counts the matching todos of each status
+	CountTodosByStatus(ctx context.Context, filter models.TodoFilter) (map[models.TodoStatus]int64, error)
+	// NextPosition returns the position after the last todo in the column of status
+	NextPosition(ctx context.Context, status models.TodoStatus) (int, error)
+	// MoveTodo saves the todo and renumbers column, the todos of its status in their new order
+	MoveTodo(ctx context.Context, todo *models.Todo, column []models.Todo) error
+	FindChangesSince(ctx context.Context, since uint64, limit int) ([]models.TodoChange, error)
+	FindLatestChange(ctx context.Context, todoID uint) (*models.TodoChange, error)
+	// FindLatestTenantChange returns the most recent change to any of the tenant's todos
+	FindLatestTenantChange(ctx context.Context) (*models.TodoChange, error)
+	LatestChangeSeq(ctx context.Context) (uint64, error)
+	// FindSyncReceipt returns the receipt of the user's client change with clientID
+	FindSyncReceipt(ctx context.Context, userID uint, clientID string) (*models.SyncReceipt, error)
+	// CreateSyncReceipt saves the receipt unless the client change already has one
+	CreateSyncReceipt(ctx context.Context, receipt *models.SyncReceipt) error
+	// PurgeSyncReceipts deletes the receipts of every tenant created before cutoff
+	PurgeSyncReceipts(ctx context.Context, cutoff time.Time) (int64, error)
+	// AssignTodo saves the todo's new assignee and records event in the same transaction
+	AssignTodo(ctx context.Context, todo *models.Todo, event *models.TodoEvent) error
+	FindWatchers(ctx context.Context, todoID uint) ([]models.TodoWatcherResponse, error)
+	// AddWatcher adds the watcher unless the user already watches the todo
+	AddWatcher(ctx context.Context, watcher *models.TodoWatcher) error
+	RemoveWatcher(ctx context.Context, todoID, userID uint) error
+	// FindDependencies returns every dependency between the tenant's todos
+	FindDependencies(ctx context.Context) ([]models.TodoDependency, error)
+	// FindTodoReferences returns references to the tenant's todos with ids
+	FindTodoReferences(ctx context.Context, ids []uint) ([]models.TodoReference, error)
+	// CreateDependency saves the dependency and records an update of both todos. check is given
+	// the tenant's dependencies under the tenant's write lock and can refuse the new one; it
+	// returns gorm.ErrDuplicatedKey when the todos are already linked.
+	CreateDependency(ctx context.Context, dependency *models.TodoDependency, check func(dependencies []models.TodoDependency) error) error
+	// DeleteDependency removes the dependency and records an update of both todos
+	DeleteDependency(ctx context.Context, blockerID, blockedID uint) error
+	// FindTodosDueForReminder returns unfinished todos of every tenant due in (now, before] that
+	// have not been reminded of their current due date
+	FindTodosDueForReminder(ctx context.Context, now, before time.Time, limit int) ([]models.Todo, error)
+	MarkReminderSent(ctx context.Context, todoID uint, dueDate time.Time) error
+	// FindDigestTodos returns the user's personal todos and the todos assigned to them in workspaces they belong to
+	// that are unfinished and due before dueBefore, or were completed in [completedFrom, completedTo)
+	FindDigestTodos(ctx context.Context, userID uint, dueBefore, completedFrom, completedTo time.Time, limit int) ([]models.Todo, error)
 }
 
+// Every query below is restricted to the tenant in ctx by the callbacks of RegisterTenantScope,
+// so none of them filters by owner itself.
+
 type todoRepository struct {
 	db *gorm.DB
 }
@@ -23,30 +83,323 @@ func NewTodoRepository(db *gorm.DB) TodoRepository {
 	return &todoRepository{db: db}
 }
 
+// todoColumns selects todos with their comment counts, computed by one subquery per statement
+// rather than a query per todo
+const todoColumns = "todos.*, (SELECT COUNT(*) FROM comments WHERE comments.todo_id = todos.id AND NOT comments.deleted) AS comment_count"
+
+// createBatchSize bounds the number of rows per INSERT statement for bulk writes
+const createBatchSize = 500
+
+// withChange runs write inside a transaction that also appends a change to the tenant's feed
+func (r *todoRepository) withChange(ctx context.Context, userID uint, write func(tx *gorm.DB) (*models.TodoChange, error)) error {
+	return r.withChanges(ctx, userID, func(tx *gorm.DB) ([]models.TodoChange, error) {
+		change, err := write(tx)
+		if err != nil {
+			return nil, err
+		}
+		return []models.TodoChange{*change}, nil
+	})
+}
+
+// withChanges is withChange for writes touching several todos of the same tenant
+func (r *todoRepository) withChanges(ctx context.Context, userID uint, write func(tx *gorm.DB) ([]models.TodoChange, error)) error {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return ErrMissingTenant
+	}
+	namespace, key := syncLockNamespace, int32(userID)
+	if tenant.WorkspaceID != nil {
+		namespace, key = workspaceSyncLockNamespace, int32(*tenant.WorkspaceID)
+	}
+
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", namespace, key).Error; err != nil {
+			return err
+		}
+		changes, err := write(tx)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(changes, createBatchSize).Error
+	})
+}
+
+func (r *todoRepository) InTransaction(ctx context.Context, userID uint, fn func(ctx context.Context) error) error {
+	return r.withChanges(ctx, userID, func(tx *gorm.DB) ([]models.TodoChange, error) {
+		return nil, fn(withTx(ctx, tx))
+	})
+}
+
 func (r *todoRepository) CreateTodo(ctx context.Context, todo *models.Todo) error {
-	result := r.db.WithContext(ctx).Create(todo)
-	return result.Error
+	return r.withChange(ctx, todo.UserID, func(tx *gorm.DB) (*models.TodoChange, error) {
+		if err := tx.Create(todo).Error; err != nil {
+			return nil, err
+		}
+		return &models.TodoChange{TodoID: todo.ID, UserID: todo.UserID, Operation: models.ChangeCreate}, nil
+	})
 }
 
-func (r *todoRepository) FindTodosByUserID(ctx context.Context, userID uint) ([]models.Todo, error) {
+// filteredTodos builds the query shared by listing and streaming the tenant's todos
+func (r *todoRepository) filteredTodos(ctx context.Context, filter models.TodoFilter) *gorm.DB {
+	query := r.matchingTodos(ctx, filter).Select(todoColumns)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	return query.Order(filter.Sort.OrderClause())
+}
+
+// matchingTodos restricts a query to the tenant's todos that match filter
+func (r *todoRepository) matchingTodos(ctx context.Context, filter models.TodoFilter) *gorm.DB {
+	query := conn(ctx, r.db).Model(&models.Todo{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Search != "" {
+		pattern := "%" + filter.Search + "%"
+		query = query.Where("(title ILIKE ? OR description ILIKE ?)", pattern, pattern)
+	}
+	if filter.DueAfter != nil {
+		query = query.Where("due_date >= ?", *filter.DueAfter)
+	}
+	if filter.DueBefore != nil {
+		query = query.Where("due_date < ?", *filter.DueBefore)
+	}
+	if filter.ExcludeDone {
+		query = query.Where("completed_at IS NULL")
+	}
+	if filter.AssigneeID != nil {
+		query = query.Where("assignee_id = ?", *filter.AssigneeID)
+	}
+	if filter.WatcherID != nil {
+		query = query.Where("id IN (SELECT todo_id FROM todo_watchers WHERE user_id = ?)", *filter.WatcherID)
+	}
+	return query
+}
+
+// CreateTodos inserts all todos in a single transaction; either every todo is created or none is
+func (r *todoRepository) CreateTodos(ctx context.Context, userID uint, todos []models.Todo) error {
+	return r.withChanges(ctx, userID, func(tx *gorm.DB) ([]models.TodoChange, error) {
+		if len(todos) == 0 {
+			return nil, nil
+		}
+		if err := tx.CreateInBatches(todos, createBatchSize).Error; err != nil {
+			return nil, err
+		}
+		changes := make([]models.TodoChange, len(todos))
+		for i := range todos {
+			changes[i] = models.TodoChange{TodoID: todos[i].ID, UserID: userID, Operation: models.ChangeCreate}
+		}
+		return changes, nil
+	})
+}
+
+func (r *todoRepository) FindTodos(ctx context.Context, filter models.TodoFilter) ([]models.Todo, error) {
 	var todos []models.Todo
-	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at desc").Find(&todos)
-	return todos, result.Error
+	if err := r.filteredTodos(ctx, filter).Find(&todos).Error; err != nil {
+		return nil, err
+	}
+	return todos, r.loadDependencies(ctx, todos)
+}
+
+// StreamTodos calls fn for each matching todo while reading rows from the cursor,
+// so large lists are never loaded into memory at once.
+func (r *todoRepository) StreamTodos(ctx context.Context, filter models.TodoFilter, fn func(todo *models.Todo) error) error {
+	rows, err := r.filteredTodos(ctx, filter).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todo models.Todo
+		if err := r.db.ScanRows(rows, &todo); err != nil {
+			return err
+		}
+		if err := fn(&todo); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *todoRepository) CountTodos(ctx context.Context) (int64, error) {
+	var count int64
+	result := conn(ctx, r.db).Model(&models.Todo{}).Count(&count)
+	return count, result.Error
 }
 
 func (r *todoRepository) FindTodoByID(ctx context.Context, id uint) (*models.Todo, error) {
 	var todo models.Todo
-	result := r.db.WithContext(ctx).First(&todo, id)
-	return &todo, result.Error
+	if err := conn(ctx, r.db).Select(todoColumns).First(&todo, id).Error; err != nil {
+		return &todo, err
+	}
+	todos := []models.Todo{todo}
+	if err := r.loadDependencies(ctx, todos); err != nil {
+		return nil, err
+	}
+	return &todos[0], nil
 }
 
 func (r *todoRepository) UpdateTodo(ctx context.Context, todo *models.Todo) error {
-	result := r.db.WithContext(ctx).Save(todo)
-	return result.Error
+	return r.withChange(ctx, todo.UserID, func(tx *gorm.DB) (*models.TodoChange, error) {
+		if err := tx.Save(todo).Error; err != nil {
+			return nil, err
+		}
+		return &models.TodoChange{TodoID: todo.ID, UserID: todo.UserID, Operation: models.ChangeUpdate}, nil
+	})
+}
+
+func (r *todoRepository) CountTodosByStatus(ctx context.Context, filter models.TodoFilter) (map[models.TodoStatus]int64, error) {
+	var rows []struct {
+		Status models.TodoStatus
+		Count  int64
+	}
+	result := r.matchingTodos(ctx, filter).Select("status, COUNT(*) AS count").Group("status").Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	counts := make(map[models.TodoStatus]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *todoRepository) NextPosition(ctx context.Context, status models.TodoStatus) (int, error) {
+	var next int
+	result := conn(ctx, r.db).Model(&models.Todo{}).Where("status = ?", status).
+		Select("COALESCE(MAX(position) + 1, 0)").Scan(&next)
+	return next, result.Error
+}
+
+func (r *todoRepository) MoveTodo(ctx context.Context, todo *models.Todo, column []models.Todo) error {
+	return r.withChanges(ctx, todo.UserID, func(tx *gorm.DB) ([]models.TodoChange, error) {
+		if err := tx.Save(todo).Error; err != nil {
+			return nil, err
+		}
+		changes := []models.TodoChange{{TodoID: todo.ID, UserID: todo.UserID, Operation: models.ChangeUpdate}}
+		for i := range column {
+			other := &column[i]
+			if other.ID == todo.ID || other.Position == i {
+				continue
+			}
+			if err := tx.Model(&models.Todo{}).Where("id = ?", other.ID).Update("position", i).Error; err != nil {
+				return nil, err
+			}
+			other.Position = i
+			changes = append(changes, models.TodoChange{TodoID: other.ID, UserID: other.UserID, Operation: models.ChangeUpdate})
+		}
+		return changes, nil
+	})
 }
 
 func (r *todoRepository) DeleteTodo(ctx context.Context, id uint) error {
-	result := r.db.WithContext(ctx).Delete(&models.Todo{}, id)
+	var todo models.Todo
+	if err := conn(ctx, r.db).Select("id", "user_id").First(&todo, id).Error; err != nil {
+		return err
+	}
+
+	return r.withChange(ctx, todo.UserID, func(tx *gorm.DB) (*models.TodoChange, error) {
+		result := tx.Delete(&models.Todo{}, id)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return &models.TodoChange{TodoID: id, UserID: todo.UserID, Operation: models.ChangeDelete}, nil
+	})
+}
+
+func (r *todoRepository) FindTodosByIDs(ctx context.Context, ids []uint) ([]models.Todo, error) {
+	var todos []models.Todo
+	if len(ids) == 0 {
+		return todos, nil
+	}
+	if err := conn(ctx, r.db).Select(todoColumns).Where("id IN ?", ids).Find(&todos).Error; err != nil {
+		return nil, err
+	}
+	return todos, r.loadDependencies(ctx, todos)
+}
+
+func (r *todoRepository) FindChangesSince(ctx context.Context, since uint64, limit int) ([]models.TodoChange, error) {
+	var changes []models.TodoChange
+	result := conn(ctx, r.db).
+		Where("seq > ?", since).
+		Order("seq asc").
+		Limit(limit).
+		Find(&changes)
+	return changes, result.Error
+}
+
+func (r *todoRepository) FindLatestChange(ctx context.Context, todoID uint) (*models.TodoChange, error) {
+	var change models.TodoChange
+	result := conn(ctx, r.db).Where("todo_id = ?", todoID).Order("seq desc").First(&change)
+	return &change, result.Error
+}
+
+func (r *todoRepository) FindLatestTenantChange(ctx context.Context) (*models.TodoChange, error) {
+	var change models.TodoChange
+	result := conn(ctx, r.db).Order("seq desc").First(&change)
+	return &change, result.Error
+}
+
+func (r *todoRepository) FindSyncReceipt(ctx context.Context, userID uint, clientID string) (*models.SyncReceipt, error) {
+	var receipt models.SyncReceipt
+	result := conn(ctx, r.db).Where("user_id = ? AND client_id = ?", userID, clientID).First(&receipt)
+	return &receipt, result.Error
+}
+
+func (r *todoRepository) CreateSyncReceipt(ctx context.Context, receipt *models.SyncReceipt) error {
+	return conn(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).Create(receipt).Error
+}
+
+func (r *todoRepository) PurgeSyncReceipts(ctx context.Context, cutoff time.Time) (int64, error) {
+	result := r.db.WithContext(crossTenant(ctx)).Where("created_at < ?", cutoff).Delete(&models.SyncReceipt{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *todoRepository) LatestChangeSeq(ctx context.Context) (uint64, error) {
+	var seq uint64
+	result := conn(ctx, r.db).Model(&models.TodoChange{}).
+		Select("COALESCE(MAX(seq), 0)").
+		Scan(&seq)
+	return seq, result.Error
+}
+
+func (r *todoRepository) AssignTodo(ctx context.Context, todo *models.Todo, event *models.TodoEvent) error {
+	return r.withChange(ctx, todo.UserID, func(tx *gorm.DB) (*models.TodoChange, error) {
+		if err := tx.Model(todo).Update("assignee_id", todo.AssigneeID).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Create(event).Error; err != nil {
+			return nil, err
+		}
+		return &models.TodoChange{TodoID: todo.ID, UserID: todo.UserID, Operation: models.ChangeUpdate}, nil
+	})
+}
+
+func (r *todoRepository) FindWatchers(ctx context.Context, todoID uint) ([]models.TodoWatcherResponse, error) {
+	var watchers []models.TodoWatcherResponse
+	result := conn(ctx, r.db).Model(&models.TodoWatcher{}).
+		Select("todo_watchers.user_id, users.email, users.display_name, todo_watchers.created_at AS watching_since").
+		Joins("JOIN users ON users.id = todo_watchers.user_id").
+		Where("todo_watchers.todo_id = ?", todoID).
+		Order("todo_watchers.created_at").
+		Scan(&watchers)
+	return watchers, result.Error
+}
+
+func (r *todoRepository) AddWatcher(ctx context.Context, watcher *models.TodoWatcher) error {
+	result := conn(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).Create(watcher)
+	return result.Error
+}
+
+func (r *todoRepository) RemoveWatcher(ctx context.Context, todoID, userID uint) error {
+	result := conn(ctx, r.db).Where("todo_id = ? AND user_id = ?", todoID, userID).Delete(&models.TodoWatcher{})
 	if result.Error != nil {
 		return result.Error
 	}
@@ -55,3 +408,159 @@ func (r *todoRepository) DeleteTodo(ctx context.Context, id uint) error {
 	}
 	return nil
 }
+
+func (r *todoRepository) FindDependencies(ctx context.Context) ([]models.TodoDependency, error) {
+	var dependencies []models.TodoDependency
+	result := conn(ctx, r.db).Order("id asc").Find(&dependencies)
+	return dependencies, result.Error
+}
+
+func (r *todoRepository) FindTodoReferences(ctx context.Context, ids []uint) ([]models.TodoReference, error) {
+	var references []models.TodoReference
+	if len(ids) == 0 {
+		return references, nil
+	}
+	result := conn(ctx, r.db).Model(&models.Todo{}).
+		Select("id, title, status, completed_at IS NOT NULL AS is_done").
+		Where("id IN ?", ids).
+		Order("id asc").
+		Scan(&references)
+	return references, result.Error
+}
+
+func (r *todoRepository) CreateDependency(ctx context.Context, dependency *models.TodoDependency, check func(dependencies []models.TodoDependency) error) error {
+	return r.withDependencyChanges(ctx, dependency.BlockerID, dependency.BlockedID, func(tx *gorm.DB) error {
+		var dependencies []models.TodoDependency
+		if err := tx.Order("id asc").Find(&dependencies).Error; err != nil {
+			return err
+		}
+		if err := check(dependencies); err != nil {
+			return err
+		}
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "blocker_id"}, {Name: "blocked_id"}},
+			DoNothing: true,
+		}).Create(dependency)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrDuplicatedKey
+		}
+		return nil
+	})
+}
+
+func (r *todoRepository) DeleteDependency(ctx context.Context, blockerID, blockedID uint) error {
+	return r.withDependencyChanges(ctx, blockerID, blockedID, func(tx *gorm.DB) error {
+		result := tx.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&models.TodoDependency{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// withDependencyChanges runs write and records an update of both todos of a dependency, whose
+// blocked and blocking lists change with it
+func (r *todoRepository) withDependencyChanges(ctx context.Context, blockerID, blockedID uint, write func(tx *gorm.DB) error) error {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return ErrMissingTenant
+	}
+	return r.withChanges(ctx, tenant.UserID, func(tx *gorm.DB) ([]models.TodoChange, error) {
+		if err := write(tx); err != nil {
+			return nil, err
+		}
+		var todos []models.Todo
+		if err := tx.Select("id", "user_id").Where("id IN ?", []uint{blockerID, blockedID}).Find(&todos).Error; err != nil {
+			return nil, err
+		}
+		changes := make([]models.TodoChange, len(todos))
+		for i, todo := range todos {
+			changes[i] = models.TodoChange{TodoID: todo.ID, UserID: todo.UserID, Operation: models.ChangeUpdate}
+		}
+		return changes, nil
+	})
+}
+
+// loadDependencies fills in the blocked and blocking lists of todos
+func (r *todoRepository) loadDependencies(ctx context.Context, todos []models.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+	dependencies, err := r.FindDependencies(ctx)
+	if err != nil || len(dependencies) == 0 {
+		return err
+	}
+
+	loaded := make(map[uint]*models.Todo, len(todos))
+	for i := range todos {
+		loaded[todos[i].ID] = &todos[i]
+	}
+	var related []uint
+	for _, dependency := range dependencies {
+		if loaded[dependency.BlockedID] != nil {
+			related = append(related, dependency.BlockerID)
+		}
+		if loaded[dependency.BlockerID] != nil {
+			related = append(related, dependency.BlockedID)
+		}
+	}
+	references, err := r.FindTodoReferences(ctx, related)
+	if err != nil {
+		return err
+	}
+	byID := make(map[uint]models.TodoReference, len(references))
+	for _, reference := range references {
+		byID[reference.ID] = reference
+	}
+
+	for _, dependency := range dependencies {
+		if todo := loaded[dependency.BlockedID]; todo != nil {
+			todo.BlockedBy = append(todo.BlockedBy, byID[dependency.BlockerID])
+		}
+		if todo := loaded[dependency.BlockerID]; todo != nil {
+			todo.Blocking = append(todo.Blocking, byID[dependency.BlockedID])
+		}
+	}
+	return nil
+}
+
+// Reminders are sent by a background job on behalf of every tenant
+
+func (r *todoRepository) FindTodosDueForReminder(ctx context.Context, now, before time.Time, limit int) ([]models.Todo, error) {
+	var todos []models.Todo
+	result := r.db.WithContext(crossTenant(ctx)).
+		Where("due_date > ? AND due_date <= ?", now, before).
+		Where("completed_at IS NULL").
+		Where("reminder_sent_for IS NULL OR reminder_sent_for <> due_date").
+		Order("due_date").
+		Limit(limit).
+		Find(&todos)
+	return todos, result.Error
+}
+
+func (r *todoRepository) MarkReminderSent(ctx context.Context, todoID uint, dueDate time.Time) error {
+	result := r.db.WithContext(crossTenant(ctx)).Model(&models.Todo{}).
+		Where("id = ?", todoID).
+		UpdateColumn("reminder_sent_for", dueDate)
+	return result.Error
+}
+
+// Digests are sent by a background job and cover the user's todos across workspaces
+
+func (r *todoRepository) FindDigestTodos(ctx context.Context, userID uint, dueBefore, completedFrom, completedTo time.Time, limit int) ([]models.Todo, error) {
+	var todos []models.Todo
+	result := r.db.WithContext(crossTenant(ctx)).
+		Where("(workspace_id IS NULL AND user_id = ?) OR (assignee_id = ? AND workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = ?))", userID, userID, userID).
+		Where("(completed_at IS NULL AND due_date < ?) OR (completed_at >= ? AND completed_at < ?)",
+			dueBefore, completedFrom, completedTo).
+		Order("due_date asc nulls last, id asc").
+		Limit(limit).
+		Find(&todos)
+	return todos, result.Error
+}
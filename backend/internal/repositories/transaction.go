@@ -0,0 +1,24 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type txKey struct{}
+
+// withTx returns a copy of ctx whose queries run in tx
+func withTx(ctx context.Context, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// conn returns the handle for queries made with ctx: the transaction ctx was given by
+// TodoRepository.InTransaction, or db outside of one. Repositories whose writes can take part
+// in such a transaction query through conn.
+func conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
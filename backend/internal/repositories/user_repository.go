@@ -11,6 +11,16 @@ type UserRepository interface {
 	CreateUser(ctx context.Context, user *models.User) error
 	FindByEmail(ctx context.Context, email string) (*models.User, error)
 	FindByID(ctx context.Context, id uint) (*models.User, error)
+	FindByPasswordResetTokenHash(ctx context.Context, tokenHash string) (*models.User, error)
+	FindByEmailChangeTokenHash(ctx context.Context, tokenHash string) (*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	AdvanceTOTPCounter(ctx context.Context, userID uint, counter int64) (bool, error)
+	// FindDigestSubscribers returns the active users who opted in to the daily digest
+	FindDigestSubscribers(ctx context.Context) ([]models.User, error)
+	// MarkDigestSent records the local date of the user's digest; it returns false when the
+	// digest of that date was already recorded
+	MarkDigestSent(ctx context.Context, userID uint, date string) (bool, error)
+	SetDigestEnabled(ctx context.Context, userID uint, enabled bool) error
 }
 
 type userRepository struct {
@@ -37,3 +47,57 @@ func (r *userRepository) FindByID(ctx context.Context, id uint) (*models.User, e
 	result := r.db.WithContext(ctx).First(&user, id)
 	return &user, result.Error
 }
+
+func (r *userRepository) FindByPasswordResetTokenHash(ctx context.Context, tokenHash string) (*models.User, error) {
+	var user models.User
+	result := r.db.WithContext(ctx).Where("password_reset_token_hash = ?", tokenHash).First(&user)
+	return &user, result.Error
+}
+
+func (r *userRepository) FindByEmailChangeTokenHash(ctx context.Context, tokenHash string) (*models.User, error) {
+	var user models.User
+	result := r.db.WithContext(ctx).Where("email_change_token_hash = ?", tokenHash).First(&user)
+	return &user, result.Error
+}
+
+func (r *userRepository) UpdateUser(ctx context.Context, user *models.User) error {
+	result := r.db.WithContext(ctx).Save(user)
+	return result.Error
+}
+
+// AdvanceTOTPCounter stores counter as the last accepted TOTP time step. It returns false when a
+// code for the same or a later step was already accepted, so each code can only be used once.
+func (r *userRepository) AdvanceTOTPCounter(ctx context.Context, userID uint, counter int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND totp_last_counter < ?", userID, counter).
+		UpdateColumn("totp_last_counter", counter)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *userRepository) FindDigestSubscribers(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	result := r.db.WithContext(ctx).
+		Where("digest_enabled AND disabled_at IS NULL AND deletion_scheduled_at IS NULL").
+		Find(&users)
+	return users, result.Error
+}
+
+func (r *userRepository) MarkDigestSent(ctx context.Context, userID uint, date string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND (digest_sent_on IS NULL OR digest_sent_on <> ?)", userID, date).
+		UpdateColumn("digest_sent_on", date)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *userRepository) SetDigestEnabled(ctx context.Context, userID uint, enabled bool) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ?", userID).
+		UpdateColumn("digest_enabled", enabled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package repositories
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type WorkspaceRepository interface {
+	// CreateWorkspace creates the workspace together with its first owner
+	CreateWorkspace(ctx context.Context, workspace *models.Workspace, ownerID uint) error
+	FindWorkspaceByID(ctx context.Context, id uint) (*models.Workspace, error)
+	// FindWorkspacesByUserID returns the user's workspaces with Role set to their role in each
+	FindWorkspacesByUserID(ctx context.Context, userID uint) ([]models.Workspace, error)
+	UpdateWorkspace(ctx context.Context, workspace *models.Workspace) error
+	// DeleteWorkspace deletes the workspace with its members, todos, change history and events
+	DeleteWorkspace(ctx context.Context, id uint) error
+	// FindMembership returns the user's membership with the workspace preloaded
+	FindMembership(ctx context.Context, workspaceID, userID uint) (*models.WorkspaceMember, error)
+	FindMembers(ctx context.Context, workspaceID uint) ([]models.WorkspaceMemberResponse, error)
+	CountMembers(ctx context.Context, workspaceID uint, role models.WorkspaceRole) (int64, error)
+	CreateMember(ctx context.Context, member *models.WorkspaceMember) error
+	UpdateMemberRole(ctx context.Context, workspaceID, userID uint, role models.WorkspaceRole) error
+	DeleteMember(ctx context.Context, workspaceID, userID uint) error
+}
+
+type workspaceRepository struct {
+	db *gorm.DB
+}
+
+func NewWorkspaceRepository(db *gorm.DB) WorkspaceRepository {
+	return &workspaceRepository{db: db}
+}
+
+func (r *workspaceRepository) CreateWorkspace(ctx context.Context, workspace *models.Workspace, ownerID uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(workspace).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.WorkspaceMember{
+			WorkspaceID: workspace.ID,
+			UserID:      ownerID,
+			Role:        models.WorkspaceRoleOwner,
+		}).Error
+	})
+}
+
+func (r *workspaceRepository) FindWorkspaceByID(ctx context.Context, id uint) (*models.Workspace, error) {
+	var workspace models.Workspace
+	result := r.db.WithContext(ctx).First(&workspace, id)
+	return &workspace, result.Error
+}
+
+func (r *workspaceRepository) FindWorkspacesByUserID(ctx context.Context, userID uint) ([]models.Workspace, error) {
+	var members []models.WorkspaceMember
+	result := r.db.WithContext(ctx).Preload("Workspace").Where("user_id = ?", userID).Order("workspace_id").Find(&members)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	workspaces := make([]models.Workspace, len(members))
+	for i, member := range members {
+		workspaces[i] = member.Workspace
+		workspaces[i].Role = member.Role
+	}
+	return workspaces, nil
+}
+
+func (r *workspaceRepository) UpdateWorkspace(ctx context.Context, workspace *models.Workspace) error {
+	result := r.db.WithContext(ctx).Save(workspace)
+	return result.Error
+}
+
+func (r *workspaceRepository) DeleteWorkspace(ctx context.Context, id uint) error {
+	return r.db.WithContext(crossTenant(ctx)).Transaction(func(tx *gorm.DB) error {
+		return deleteWorkspace(tx, id)
+	})
+}
+
+// deleteWorkspace deletes a workspace within tx, which must be cross-tenant
+func deleteWorkspace(tx *gorm.DB, id uint) error {
+	for _, model := range []any{&models.TodoEvent{}, &models.TodoChange{}, &models.Todo{}, &models.WorkspaceMember{}} {
+		if err := tx.Where("workspace_id = ?", id).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	result := tx.Delete(&models.Workspace{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *workspaceRepository) FindMembership(ctx context.Context, workspaceID, userID uint) (*models.WorkspaceMember, error) {
+	var member models.WorkspaceMember
+	result := r.db.WithContext(ctx).Preload("Workspace").
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+		First(&member)
+	return &member, result.Error
+}
+
+func (r *workspaceRepository) FindMembers(ctx context.Context, workspaceID uint) ([]models.WorkspaceMemberResponse, error) {
+	var members []models.WorkspaceMemberResponse
+	result := r.db.WithContext(ctx).Model(&models.WorkspaceMember{}).
+		Select("workspace_members.user_id, users.email, users.display_name, workspace_members.role, workspace_members.created_at AS joined_at").
+		Joins("JOIN users ON users.id = workspace_members.user_id").
+		Where("workspace_members.workspace_id = ?", workspaceID).
+		Order("workspace_members.created_at").
+		Scan(&members)
+	return members, result.Error
+}
+
+// CountMembers counts the workspace's members, or only those with role when it is not empty
+func (r *workspaceRepository) CountMembers(ctx context.Context, workspaceID uint, role models.WorkspaceRole) (int64, error) {
+	var count int64
+	query := r.db.WithContext(ctx).Model(&models.WorkspaceMember{}).Where("workspace_id = ?", workspaceID)
+	if role != "" {
+		query = query.Where("role = ?", role)
+	}
+	result := query.Count(&count)
+	return count, result.Error
+}
+
+func (r *workspaceRepository) CreateMember(ctx context.Context, member *models.WorkspaceMember) error {
+	result := r.db.WithContext(ctx).Create(member)
+	return result.Error
+}
+
+func (r *workspaceRepository) UpdateMemberRole(ctx context.Context, workspaceID, userID uint, role models.WorkspaceRole) error {
+	result := r.db.WithContext(ctx).Model(&models.WorkspaceMember{}).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+		Update("role", role)
+	return result.Error
+}
+
+// DeleteMember removes the membership, unassigns the user's todos in the workspace and stops the
+// user watching them
+func (r *workspaceRepository) DeleteMember(ctx context.Context, workspaceID, userID uint) error {
+	return r.db.WithContext(crossTenant(ctx)).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).Delete(&models.WorkspaceMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		err := tx.Where("user_id = ? AND todo_id IN (SELECT id FROM todos WHERE workspace_id = ?)", userID, workspaceID).
+			Delete(&models.TodoWatcher{}).Error
+		if err != nil {
+			return err
+		}
+		return unassignMember(tx, workspaceID, userID)
+	})
+}
+
+// unassignMember clears a former member's assignments and records them in the workspace's change
+// feed, under the lock todo writes take, so synced clients see the todos unassigned
+func unassignMember(tx *gorm.DB, workspaceID, userID uint) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", workspaceSyncLockNamespace, int32(workspaceID)).Error; err != nil {
+		return err
+	}
+	var todoIDs []uint
+	err := tx.Model(&models.Todo{}).Where("workspace_id = ? AND assignee_id = ?", workspaceID, userID).Pluck("id", &todoIDs).Error
+	if err != nil || len(todoIDs) == 0 {
+		return err
+	}
+	if err := tx.Model(&models.Todo{}).Where("id IN ?", todoIDs).Update("assignee_id", nil).Error; err != nil {
+		return err
+	}
+
+	changes := make([]models.TodoChange, 0, len(todoIDs))
+	for _, todoID := range todoIDs {
+		changes = append(changes, models.TodoChange{TodoID: todoID, UserID: userID, Operation: models.ChangeUpdate, WorkspaceID: &workspaceID})
+	}
+	return tx.CreateInBatches(changes, createBatchSize).Error
+}
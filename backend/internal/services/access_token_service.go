@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxAccessTokensPerUser = 50
+	// lastUsedResolution limits how often a token's last-used time is written
+	lastUsedResolution             = time.Minute
+	accessTokenBytes               = 32
+	accessTokenPrefixDisplayLength = len(models.AccessTokenPrefix) + 6
+)
+
+var (
+	ErrAccessTokenNotFound      = errors.New("access token not found")
+	ErrInvalidAccessToken       = errors.New("invalid or expired access token")
+	ErrInvalidAccessTokenExpiry = errors.New("expiry must be in the future")
+	ErrTooManyAccessTokens      = errors.New("access token limit reached")
+)
+
+type AccessTokenService interface {
+	CreateAccessToken(ctx context.Context, userID uint, name string, scopes []string, expiresAt *time.Time) (*models.CreatedAccessTokenResponse, error)
+	ListAccessTokens(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error)
+	RevokeAccessToken(ctx context.Context, userID, tokenID uint) error
+	// RevokeAllAccessTokens deletes every token of the user and reports how many there were
+	RevokeAllAccessTokens(ctx context.Context, userID uint) (int64, error)
+	AuthenticateAccessToken(ctx context.Context, token string) (*models.PersonalAccessToken, error)
+}
+
+type accessTokenService struct {
+	tokenRepo repositories.AccessTokenRepository
+}
+
+func NewAccessTokenService(tokenRepo repositories.AccessTokenRepository) AccessTokenService {
+	return &accessTokenService{tokenRepo: tokenRepo}
+}
+
+func (s *accessTokenService) CreateAccessToken(ctx context.Context, userID uint, name string, scopes []string, expiresAt *time.Time) (*models.CreatedAccessTokenResponse, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrInvalidAccessTokenExpiry
+	}
+
+	existing, err := s.tokenRepo.FindAccessTokensByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxAccessTokensPerUser {
+		return nil, ErrTooManyAccessTokens
+	}
+
+	raw, err := utils.GenerateRandomToken(models.AccessTokenPrefix, accessTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    raw[:accessTokenPrefixDisplayLength],
+		TokenHash: utils.HashToken(raw),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.tokenRepo.CreateAccessToken(ctx, token); err != nil {
+		return nil, err
+	}
+
+	return &models.CreatedAccessTokenResponse{Token: raw, PersonalAccessToken: *token}, nil
+}
+
+func (s *accessTokenService) ListAccessTokens(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error) {
+	return s.tokenRepo.FindAccessTokensByUserID(ctx, userID)
+}
+
+func (s *accessTokenService) RevokeAccessToken(ctx context.Context, userID, tokenID uint) error {
+	err := s.tokenRepo.DeleteAccessToken(ctx, userID, tokenID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAccessTokenNotFound
+	}
+	return err
+}
+
+func (s *accessTokenService) RevokeAllAccessTokens(ctx context.Context, userID uint) (int64, error) {
+	return s.tokenRepo.DeleteAccessTokensByUserID(ctx, userID)
+}
+
+// AuthenticateAccessToken resolves a raw token to its record and records when it was last used
+func (s *accessTokenService) AuthenticateAccessToken(ctx context.Context, raw string) (*models.PersonalAccessToken, error) {
+	if !strings.HasPrefix(raw, models.AccessTokenPrefix) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	token, err := s.tokenRepo.FindAccessTokenByHash(ctx, utils.HashToken(raw))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if token.IsExpired(now) || token.User.IsDisabled() {
+		return nil, ErrInvalidAccessToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedResolution {
+		if err := s.tokenRepo.UpdateLastUsed(ctx, token.ID, now); err != nil {
+			log.Printf("WARNING: Failed to update last use of access token %d: %v", token.ID, err)
+		}
+		token.LastUsedAt = &now
+	}
+
+	return token, nil
+}
@@ -0,0 +1,537 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// dataExportStaleAfter is how long an export may stay unfinished before it is taken as lost, such
+// as one started before exports ran on the job queue or whose job ran out of attempts
+const dataExportStaleAfter = 24 * time.Hour
+
+var (
+	ErrDataExportNotFound       = errors.New("data export not found")
+	ErrDataExportInProgress     = errors.New("a data export is already in progress")
+	ErrDataExportNotReady       = errors.New("data export is not ready for download")
+	ErrDeletionAlreadyScheduled = errors.New("account deletion is already scheduled")
+	ErrDeletionNotScheduled     = errors.New("no account deletion is scheduled")
+	ErrSoleWorkspaceOwner       = errors.New("transfer ownership of the workspaces you are the only owner of first")
+)
+
+// AccountService exports a user's personal data and erases accounts after a cooling-off period
+type AccountService interface {
+	// StartDataExport queues a job that builds an archive of everything stored about the user
+	StartDataExport(ctx context.Context, userID uint, client models.ClientInfo) (*models.DataExport, error)
+	// RunDataExport builds the archive of a queued export; exports already finished are skipped
+	RunDataExport(ctx context.Context, exportID string) error
+	GetDataExport(ctx context.Context, userID uint, exportID string) (*models.DataExport, error)
+	// OpenDataExport returns a completed export whose archive can be downloaded from FilePath
+	OpenDataExport(ctx context.Context, userID uint, exportID string) (*models.DataExport, error)
+	// ScheduleDeletion re-authenticates the user like a password change before scheduling the deletion
+	ScheduleDeletion(ctx context.Context, userID uint, sessionID, password, code string, client models.ClientInfo) (time.Time, error)
+	CancelDeletion(ctx context.Context, userID uint, client models.ClientInfo) error
+	// PurgeDueAccounts erases every account whose cooling-off period has ended
+	PurgeDueAccounts(ctx context.Context) (int, error)
+	PurgeExpiredExports(ctx context.Context) (int, error)
+}
+
+// dataExportJob is the payload of JobRunDataExport
+type dataExportJob struct {
+	ExportID string `json:"export_id"`
+}
+
+type accountService struct {
+	accountRepo   repositories.AccountRepository
+	userRepo      repositories.UserRepository
+	eventRepo     repositories.SecurityEventRepository
+	exportService ExportService
+	loginGuard    LoginGuard
+	reauth        reauthenticator
+	uploader      *utils.GCSUploader
+	mailer        utils.Mailer
+	jobs          JobQueue
+	cfg           *config.Config
+}
+
+func NewAccountService(accountRepo repositories.AccountRepository, userRepo repositories.UserRepository, eventRepo repositories.SecurityEventRepository, exportService ExportService, sessions SessionService, mfa MFAService, loginGuard LoginGuard, uploader *utils.GCSUploader, mailer utils.Mailer, jobs JobQueue, cfg *config.Config) AccountService {
+	if uploader == nil {
+		log.Println("WARNING: AccountService created without a GCS uploader. Uploaded files are neither exported nor deleted with accounts.")
+	}
+	return &accountService{
+		accountRepo:   accountRepo,
+		userRepo:      userRepo,
+		eventRepo:     eventRepo,
+		exportService: exportService,
+		loginGuard:    loginGuard,
+		reauth:        reauthenticator{sessions: sessions, mfa: mfa, loginGuard: loginGuard, cfg: cfg},
+		uploader:      uploader,
+		mailer:        mailer,
+		jobs:          jobs,
+		cfg:           cfg,
+	}
+}
+
+func (s *accountService) StartDataExport(ctx context.Context, userID uint, client models.ClientInfo) (*models.DataExport, error) {
+	active, err := s.accountRepo.FindActiveDataExport(ctx, userID)
+	switch {
+	case err == nil && time.Since(active.CreatedAt) < dataExportStaleAfter:
+		return nil, ErrDataExportInProgress
+	case err == nil:
+		active.Status = models.DataExportFailed
+		active.Message = "Export failed"
+		if err := s.accountRepo.UpdateDataExport(ctx, active); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	export := &models.DataExport{
+		ID:     uuid.NewString(),
+		UserID: userID,
+		Status: models.DataExportPending,
+	}
+	if err := s.accountRepo.CreateDataExport(ctx, export); err != nil {
+		return nil, err
+	}
+
+	recordSecurityEvent(ctx, s.eventRepo, &models.SecurityEvent{
+		Type:      models.SecurityEventDataExported,
+		UserID:    &userID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   "export " + export.ID,
+	})
+
+	if _, err := s.jobs.Enqueue(ctx, JobRunDataExport, dataExportJob{ExportID: export.ID}, JobOptions{}); err != nil {
+		export.Status = models.DataExportFailed
+		export.Message = "Export failed"
+		if err := s.accountRepo.UpdateDataExport(ctx, export); err != nil {
+			log.Printf("ERROR: Failed to mark data export %s as failed: %v", export.ID, err)
+		}
+		return nil, err
+	}
+	return export, nil
+}
+
+func (s *accountService) RunDataExport(ctx context.Context, exportID string) error {
+	export, err := s.accountRepo.FindDataExportByID(ctx, exportID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if export.Status == models.DataExportCompleted || export.Status == models.DataExportFailed {
+		return nil
+	}
+
+	// An export left running by a stopped worker is rebuilt from scratch
+	export.Status = models.DataExportRunning
+	if err := s.accountRepo.UpdateDataExport(ctx, export); err != nil {
+		return fmt.Errorf("failed to mark data export %s as running: %w", export.ID, err)
+	}
+
+	path := filepath.Join(s.cfg.DataExportDir, export.ID+".zip")
+	size, err := s.writeArchive(ctx, export.UserID, path)
+
+	now := time.Now()
+	export.FinishedAt = &now
+	if err != nil {
+		log.Printf("ERROR: Data export %s failed: %v", export.ID, err)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("WARNING: Failed to remove incomplete data export %s: %v", path, err)
+		}
+		export.Status = models.DataExportFailed
+		export.Message = "Export failed"
+	} else {
+		expiresAt := now.Add(s.cfg.DataExportTTL)
+		export.Status = models.DataExportCompleted
+		export.FilePath = path
+		export.Size = size
+		export.ExpiresAt = &expiresAt
+	}
+
+	if err := s.accountRepo.UpdateDataExport(ctx, export); err != nil {
+		return fmt.Errorf("failed to save result of data export %s: %w", export.ID, err)
+	}
+	return nil
+}
+
+// writeArchive writes a zip of the user's data to path and returns its size
+func (s *accountService) writeArchive(ctx context.Context, userID uint, path string) (int64, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return 0, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	manifest := models.DataExportManifest{
+		Kind:       models.DataExportKind,
+		Version:    models.DataExportVersion,
+		UserID:     userID,
+		ExportedAt: time.Now().UTC(),
+	}
+
+	if err := writeArchiveJSON(zw, "profile.json", user); err != nil {
+		return 0, err
+	}
+	manifest.Files = append(manifest.Files, "profile.json")
+
+	w, err := zw.Create("todos.json")
+	if err != nil {
+		return 0, err
+	}
+	personal := repositories.WithTenant(ctx, models.Tenant{UserID: userID})
+	if err := s.exportService.ExportTodos(personal, userID, models.ExportJSON, models.TodoFilter{}, w); err != nil {
+		return 0, fmt.Errorf("exporting todos: %w", err)
+	}
+	manifest.Files = append(manifest.Files, "todos.json")
+
+	records := []struct {
+		name string
+		dest any
+	}{
+		{"history.json", &[]models.TodoChange{}},
+		{"sessions.json", &[]models.Session{}},
+		{"access_tokens.json", &[]models.PersonalAccessToken{}},
+		{"identities.json", &[]models.UserIdentity{}},
+		{"import_jobs.json", &[]models.ImportJob{}},
+		{"security_events.json", &[]models.SecurityEvent{}},
+		{"comments.json", &[]models.Comment{}},
+		{"watched_todos.json", &[]models.TodoWatcher{}},
+		{"notifications.json", &[]models.Notification{}},
+		{"notification_preferences.json", &[]models.NotificationPreference{}},
+		{"push_subscriptions.json", &[]models.PushSubscription{}},
+		{"share_links.json", &[]models.ShareLink{}},
+		{"calendar_feeds.json", &[]models.CalendarFeed{}},
+		{"workspace_memberships.json", &[]models.WorkspaceMember{}},
+	}
+	for _, record := range records {
+		if err := s.accountRepo.FindUserRecords(ctx, userID, record.dest); err != nil {
+			return 0, fmt.Errorf("loading %s: %w", record.name, err)
+		}
+		if err := writeArchiveJSON(zw, record.name, record.dest); err != nil {
+			return 0, err
+		}
+		manifest.Files = append(manifest.Files, record.name)
+	}
+
+	uploads, err := s.writeUploads(ctx, zw, userID)
+	if err != nil {
+		// The rest of the archive is still useful; the manifest says what is missing
+		log.Printf("WARNING: Data export of user %d is missing uploaded files: %v", userID, err)
+		manifest.UploadsError = err.Error()
+	}
+	manifest.Files = append(manifest.Files, uploads...)
+
+	if err := writeArchiveJSON(zw, "manifest.json", manifest); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// writeUploads copies the user's files from object storage into the uploads/ folder of the archive
+func (s *accountService) writeUploads(ctx context.Context, zw *zip.Writer, userID uint) ([]string, error) {
+	if s.uploader == nil {
+		return nil, ErrGCSConfigMissing
+	}
+	prefix := userUploadPrefix(userID)
+	objects, err := s.uploader.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, object := range objects {
+		name := "uploads/" + strings.TrimPrefix(object, prefix)
+		if err := copyObject(ctx, s.uploader, zw, object, name); err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func copyObject(ctx context.Context, uploader *utils.GCSUploader, zw *zip.Writer, object, name string) error {
+	r, err := uploader.OpenObject(ctx, object)
+	if err != nil {
+		return fmt.Errorf("opening object '%s': %w", object, err)
+	}
+	defer r.Close()
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func writeArchiveJSON(zw *zip.Writer, name string, v any) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func (s *accountService) GetDataExport(ctx context.Context, userID uint, exportID string) (*models.DataExport, error) {
+	export, err := s.accountRepo.FindDataExportByID(ctx, exportID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDataExportNotFound
+		}
+		return nil, err
+	}
+	// Don't reveal other users' exports
+	if export.UserID != userID {
+		return nil, ErrDataExportNotFound
+	}
+	return export, nil
+}
+
+func (s *accountService) OpenDataExport(ctx context.Context, userID uint, exportID string) (*models.DataExport, error) {
+	export, err := s.GetDataExport(ctx, userID, exportID)
+	if err != nil {
+		return nil, err
+	}
+	if export.Status != models.DataExportCompleted {
+		return nil, ErrDataExportNotReady
+	}
+	if export.ExpiresAt != nil && time.Now().After(*export.ExpiresAt) {
+		return nil, ErrDataExportNotFound
+	}
+	return export, nil
+}
+
+func (s *accountService) ScheduleDeletion(ctx context.Context, userID uint, sessionID, password, code string, client models.ClientInfo) (time.Time, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, ErrUserNotFound
+		}
+		return time.Time{}, err
+	}
+	if err := s.reauth.verify(ctx, user, sessionID, password, code, client); err != nil {
+		return time.Time{}, err
+	}
+	if user.DeletionScheduledAt != nil {
+		return time.Time{}, ErrDeletionAlreadyScheduled
+	}
+	// Teams are not left without an owner; workspaces nobody else belongs to go with the account
+	owned, err := s.accountRepo.FindSoleOwnedWorkspaces(ctx, user.ID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(owned) > 0 {
+		return time.Time{}, ErrSoleWorkspaceOwner
+	}
+
+	now := time.Now()
+	scheduledAt := now.Add(s.cfg.AccountDeletionGracePeriod)
+	user.DeletionRequestedAt = &now
+	user.DeletionScheduledAt = &scheduledAt
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return time.Time{}, err
+	}
+
+	recordSecurityEvent(ctx, s.eventRepo, &models.SecurityEvent{
+		Type:      models.SecurityEventDeletionReq,
+		UserID:    &user.ID,
+		Email:     user.Email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   "deletion scheduled for " + scheduledAt.UTC().Format(time.RFC3339),
+	})
+
+	body := fmt.Sprintf("Your account and all of its data will be permanently deleted on %s.\n\n"+
+		"To keep your account, sign in and cancel the deletion before then:\n%s",
+		scheduledAt.UTC().Format(time.RFC1123), strings.TrimRight(s.cfg.AppBaseURL, "/")+"/settings")
+	if err := s.mailer.Send(ctx, user.Email, "Your account is scheduled for deletion", body); err != nil {
+		log.Printf("WARNING: Failed to send deletion notice to user %d: %v", user.ID, err)
+	}
+	return scheduledAt, nil
+}
+
+func (s *accountService) CancelDeletion(ctx context.Context, userID uint, client models.ClientInfo) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if user.DeletionScheduledAt == nil {
+		return ErrDeletionNotScheduled
+	}
+
+	user.DeletionRequestedAt = nil
+	user.DeletionScheduledAt = nil
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	recordSecurityEvent(ctx, s.eventRepo, &models.SecurityEvent{
+		Type:      models.SecurityEventDeletionCancel,
+		UserID:    &user.ID,
+		Email:     user.Email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+	return nil
+}
+
+func (s *accountService) PurgeDueAccounts(ctx context.Context) (int, error) {
+	users, err := s.accountRepo.FindUsersDueForDeletion(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for i := range users {
+		if err := s.purgeAccount(ctx, &users[i]); err != nil {
+			// Left scheduled, so the next run tries again
+			log.Printf("ERROR: Failed to delete account of user %d: %v", users[i].ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purgeAccount removes the user's files before their rows, so a failure never leaves files
+// behind that nothing refers to any more. Images of workspace todos handed to another member
+// stay with those todos.
+func (s *accountService) purgeAccount(ctx context.Context, user *models.User) error {
+	if s.uploader != nil {
+		urls, err := s.accountRepo.FindHandedOverImageURLs(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		kept := make(map[string]bool, len(urls))
+		for _, url := range urls {
+			if name, ok := s.uploader.ObjectName(url); ok {
+				kept[name] = true
+			}
+		}
+
+		objects, err := s.uploader.ListObjects(ctx, userUploadPrefix(user.ID))
+		if err != nil {
+			return err
+		}
+		for _, object := range objects {
+			if kept[object] {
+				continue
+			}
+			if err := s.uploader.DeleteObject(ctx, object); err != nil {
+				return err
+			}
+		}
+	} else {
+		log.Printf("WARNING: GCS is not configured; uploaded files of user %d are not deleted", user.ID)
+	}
+
+	exports, err := s.accountRepo.FindDataExportsByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if err := removeExportFile(export); err != nil {
+			return err
+		}
+	}
+
+	tombstone := &models.DeletedAccount{
+		UserID:    user.ID,
+		EmailHash: utils.HashToken(strings.ToLower(user.Email)),
+		DeletedAt: time.Now(),
+	}
+	tombstone.RequestedAt = tombstone.DeletedAt
+	if user.DeletionRequestedAt != nil {
+		tombstone.RequestedAt = *user.DeletionRequestedAt
+	}
+	if err := s.accountRepo.PurgeUser(ctx, user.ID, tombstone); err != nil {
+		return err
+	}
+
+	if err := s.loginGuard.ForgetAccount(ctx, user.Email); err != nil {
+		log.Printf("WARNING: Failed to clear login throttle of deleted user %d: %v", user.ID, err)
+	}
+	recordSecurityEvent(ctx, s.eventRepo, &models.SecurityEvent{
+		Type:   models.SecurityEventAccountDeleted,
+		UserID: &user.ID,
+	})
+
+	body := "Your account and all of its data have been permanently deleted."
+	if err := s.mailer.Send(ctx, user.Email, "Your account has been deleted", body); err != nil {
+		log.Printf("WARNING: Failed to send deletion confirmation to user %d: %v", user.ID, err)
+	}
+	log.Printf("INFO: Deleted account of user %d", user.ID)
+	return nil
+}
+
+func removeExportFile(export models.DataExport) error {
+	if export.FilePath == "" {
+		return nil
+	}
+	if err := os.Remove(export.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *accountService) PurgeExpiredExports(ctx context.Context) (int, error) {
+	exports, err := s.accountRepo.FindExpiredDataExports(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, export := range exports {
+		if err := removeExportFile(export); err != nil {
+			log.Printf("ERROR: Failed to remove data export %s: %v", export.ID, err)
+			continue
+		}
+		if err := s.accountRepo.DeleteDataExport(ctx, export.ID); err != nil {
+			log.Printf("ERROR: Failed to delete data export %s: %v", export.ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
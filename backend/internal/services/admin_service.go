@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxAuditEvents bounds how many security events one audit log request returns
+const maxAuditEvents = 200
+
+var (
+	ErrCannotModifySelf       = errors.New("administrators cannot disable, demote or impersonate themselves")
+	ErrCannotImpersonateAdmin = errors.New("administrators cannot be impersonated")
+	ErrUserDisabled           = errors.New("user is disabled")
+)
+
+// AdminService manages other users' accounts. Every change is recorded as a security
+// event naming the administrator as its actor.
+type AdminService interface {
+	ListUsers(ctx context.Context, filter models.AdminUserFilter) (*models.AdminUserListResponse, error)
+	GetUser(ctx context.Context, userID uint) (*models.User, error)
+	GetUserStats(ctx context.Context, userID uint) (*models.UserStats, error)
+	SetUserDisabled(ctx context.Context, actorID, userID uint, disabled bool, client models.ClientInfo) (*models.User, error)
+	SetUserRole(ctx context.Context, actorID, userID uint, role string, client models.ClientInfo) (*models.User, error)
+	// SetUserRoleByEmail changes a role from the command line, where there is no acting administrator
+	SetUserRoleByEmail(ctx context.Context, email, role string) (*models.User, error)
+	ForcePasswordReset(ctx context.Context, actorID, userID uint, client models.ClientInfo) error
+	UnlockUser(ctx context.Context, actorID, userID uint, client models.ClientInfo) error
+	Impersonate(ctx context.Context, actorID, userID uint, client models.ClientInfo) (*models.ImpersonationResponse, error)
+	ListSecurityEvents(ctx context.Context, userID *uint, limit int) ([]models.SecurityEvent, error)
+}
+
+type adminService struct {
+	adminRepo    repositories.AdminRepository
+	userRepo     repositories.UserRepository
+	eventRepo    repositories.SecurityEventRepository
+	sessions     SessionService
+	accessTokens AccessTokenService
+	loginGuard   LoginGuard
+	mailer       utils.Mailer
+	cfg          *config.Config
+}
+
+func NewAdminService(adminRepo repositories.AdminRepository, userRepo repositories.UserRepository, eventRepo repositories.SecurityEventRepository, sessions SessionService, accessTokens AccessTokenService, loginGuard LoginGuard, mailer utils.Mailer, cfg *config.Config) AdminService {
+	return &adminService{
+		adminRepo:    adminRepo,
+		userRepo:     userRepo,
+		eventRepo:    eventRepo,
+		sessions:     sessions,
+		accessTokens: accessTokens,
+		loginGuard:   loginGuard,
+		mailer:       mailer,
+		cfg:          cfg,
+	}
+}
+
+func (s *adminService) ListUsers(ctx context.Context, filter models.AdminUserFilter) (*models.AdminUserListResponse, error) {
+	if filter.PageSize <= 0 {
+		filter.PageSize = models.DefaultAdminPageSize
+	}
+	filter.PageSize = min(filter.PageSize, models.MaxAdminPageSize)
+
+	users, total, err := s.adminRepo.SearchUsers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if users == nil {
+		users = []models.User{}
+	}
+	return &models.AdminUserListResponse{Users: users, Total: total, Page: filter.Page, PageSize: filter.PageSize}, nil
+}
+
+func (s *adminService) GetUser(ctx context.Context, userID uint) (*models.User, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *adminService) GetUserStats(ctx context.Context, userID uint) (*models.UserStats, error) {
+	if _, err := s.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.adminRepo.GetUserStats(ctx, userID, time.Now())
+}
+
+// SetUserDisabled disables or re-enables an account; disabling signs out all of its sessions
+func (s *adminService) SetUserDisabled(ctx context.Context, actorID, userID uint, disabled bool, client models.ClientInfo) (*models.User, error) {
+	if actorID == userID {
+		return nil, ErrCannotModifySelf
+	}
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsDisabled() == disabled {
+		return user, nil
+	}
+
+	eventType := models.SecurityEventUserEnabled
+	user.DisabledAt = nil
+	if disabled {
+		now := time.Now()
+		eventType = models.SecurityEventUserDisabled
+		user.DisabledAt = &now
+	}
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	details := "account enabled"
+	if disabled {
+		revoked, err := s.sessions.RevokeAllSessions(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		details = fmt.Sprintf("account disabled, %d session(s) revoked", revoked)
+	}
+	s.recordEvent(ctx, eventType, actorID, user, client, details)
+	return user, nil
+}
+
+func (s *adminService) SetUserRole(ctx context.Context, actorID, userID uint, role string, client models.ClientInfo) (*models.User, error) {
+	// Demoting yourself could leave no administrator to undo it
+	if actorID == userID {
+		return nil, ErrCannotModifySelf
+	}
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == role {
+		return user, nil
+	}
+
+	previous := user.Role
+	user.Role = role
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	s.recordEvent(ctx, models.SecurityEventRoleChanged, actorID, user, client, fmt.Sprintf("role changed from %s to %s", previous, role))
+	return user, nil
+}
+
+func (s *adminService) SetUserRoleByEmail(ctx context.Context, email, role string) (*models.User, error) {
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if user.Role == role {
+		return user, nil
+	}
+
+	previous := user.Role
+	user.Role = role
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	recordSecurityEvent(ctx, s.eventRepo, &models.SecurityEvent{
+		Type:      models.SecurityEventRoleChanged,
+		UserID:    &user.ID,
+		Email:     user.Email,
+		UserAgent: "cli",
+		Details:   fmt.Sprintf("role changed from %s to %s", previous, role),
+	})
+	return user, nil
+}
+
+// ForcePasswordReset blocks password login, signs out every session, revokes every personal
+// access token and emails a reset link
+func (s *adminService) ForcePasswordReset(ctx context.Context, actorID, userID uint, client models.ClientInfo) error {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateRandomToken("", 32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(s.cfg.PasswordResetExpiresIn)
+	user.PasswordResetRequired = true
+	user.PasswordResetTokenHash = utils.HashToken(token)
+	user.PasswordResetExpiresAt = &expiresAt
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	revoked, err := s.sessions.RevokeAllSessions(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	revokedTokens, err := s.accessTokens.RevokeAllAccessTokens(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	s.recordEvent(ctx, models.SecurityEventPasswordReset, actorID, user, client, fmt.Sprintf("password reset forced, %d session(s) and %d access token(s) revoked", revoked, revokedTokens))
+
+	link := strings.TrimRight(s.cfg.AppBaseURL, "/") + "/reset-password?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("An administrator has required you to choose a new password.\n\n"+
+		"Set a new password before %s:\n%s\n\n"+
+		"You have been signed out of all devices, and your personal access tokens have been revoked.",
+		expiresAt.UTC().Format(time.RFC1123), link)
+	if err := s.mailer.Send(ctx, user.Email, "Please reset your password", body); err != nil {
+		log.Printf("WARNING: Failed to send password reset email to user %d: %v", user.ID, err)
+	}
+	return nil
+}
+
+func (s *adminService) UnlockUser(ctx context.Context, actorID, userID uint, client models.ClientInfo) error {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.loginGuard.ClearLockout(ctx, user.Email); err != nil {
+		return err
+	}
+	s.recordEvent(ctx, models.SecurityEventAccountUnlocked, actorID, user, client, "unlocked by administrator")
+	return nil
+}
+
+// Impersonate starts a short-lived session as another user. The token carries the administrator
+// in its act claim, the session keeps the impersonator ID and the start is recorded in the audit log.
+func (s *adminService) Impersonate(ctx context.Context, actorID, userID uint, client models.ClientInfo) (*models.ImpersonationResponse, error) {
+	if actorID == userID {
+		return nil, ErrCannotModifySelf
+	}
+	admin, err := s.GetUser(ctx, actorID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == models.RoleAdmin {
+		return nil, ErrCannotImpersonateAdmin
+	}
+	if user.IsDisabled() {
+		return nil, ErrUserDisabled
+	}
+
+	token, expiresAt, err := s.sessions.StartImpersonation(ctx, admin, user, client)
+	if err != nil {
+		return nil, err
+	}
+	s.recordEvent(ctx, models.SecurityEventImpersonation, actorID, user, client,
+		fmt.Sprintf("impersonated by %s until %s", admin.Email, expiresAt.UTC().Format(time.RFC3339)))
+
+	user.Password = ""
+	return &models.ImpersonationResponse{Token: token, ExpiresAt: expiresAt, User: user}, nil
+}
+
+func (s *adminService) ListSecurityEvents(ctx context.Context, userID *uint, limit int) ([]models.SecurityEvent, error) {
+	if limit <= 0 || limit > maxAuditEvents {
+		limit = maxAuditEvents
+	}
+	events, err := s.eventRepo.FindSecurityEvents(ctx, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []models.SecurityEvent{}
+	}
+	return events, nil
+}
+
+func (s *adminService) recordEvent(ctx context.Context, eventType models.SecurityEventType, actorID uint, user *models.User, client models.ClientInfo, details string) {
+	recordSecurityEvent(ctx, s.eventRepo, &models.SecurityEvent{
+		Type:      eventType,
+		UserID:    &user.ID,
+		ActorID:   &actorID,
+		Email:     user.Email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   details,
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/xNatthapol/todo-list/internal/models"
 	"github.com/xNatthapol/todo-list/internal/repositories"
 	"github.com/xNatthapol/todo-list/internal/utils"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -15,20 +16,41 @@ var (
 	ErrUserAlreadyExists  = errors.New("user with this email already exists")
 	ErrUserNotFound       = errors.New("user not found")
 	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidMFAToken    = errors.New("invalid or expired two-factor login token")
+	// ErrAccountDisabled is only returned after the credentials check so it does not reveal which accounts exist
+	ErrAccountDisabled           = errors.New("account has been disabled by an administrator")
+	ErrPasswordResetRequired     = errors.New("a password reset is required, use the link sent to your email")
+	ErrInvalidPasswordResetToken = errors.New("invalid or expired password reset token")
 )
 
+// LoginResult holds either an access token or, when two-factor authentication is enabled,
+// an MFA pending token that must be exchanged through CompleteMFALogin
+type LoginResult struct {
+	Token    string
+	MFAToken string
+	User     *models.User
+}
+
 type AuthService interface {
 	SignUpUser(ctx context.Context, email, password string) (*models.User, error)
-	LoginUser(ctx context.Context, email, password string) (string, *models.User, error)
+	LoginUser(ctx context.Context, email, password string, client models.ClientInfo) (*LoginResult, error)
+	CompleteMFALogin(ctx context.Context, mfaToken, code, recoveryCode string, client models.ClientInfo) (string, *models.User, error)
+	// ResetPassword sets a new password with a token from a forced reset and signs out every session
+	ResetPassword(ctx context.Context, token, newPassword string, client models.ClientInfo) error
 }
 
 type authService struct {
-	userRepo repositories.UserRepository
-	cfg      *config.Config
+	userRepo   repositories.UserRepository
+	eventRepo  repositories.SecurityEventRepository
+	mfaService MFAService
+	loginGuard LoginGuard
+	sessions   SessionService
+	keys       *utils.KeyRing
+	cfg        *config.Config
 }
 
-func NewAuthService(userRepo repositories.UserRepository, cfg *config.Config) AuthService {
-	return &authService{userRepo: userRepo, cfg: cfg}
+func NewAuthService(userRepo repositories.UserRepository, eventRepo repositories.SecurityEventRepository, mfaService MFAService, loginGuard LoginGuard, sessions SessionService, keys *utils.KeyRing, cfg *config.Config) AuthService {
+	return &authService{userRepo: userRepo, eventRepo: eventRepo, mfaService: mfaService, loginGuard: loginGuard, sessions: sessions, keys: keys, cfg: cfg}
 }
 
 func (s *authService) SignUpUser(ctx context.Context, email, password string) (*models.User, error) {
@@ -62,28 +84,147 @@ func (s *authService) SignUpUser(ctx context.Context, email, password string) (*
 	return newUser, nil
 }
 
-func (s *authService) LoginUser(ctx context.Context, email, password string) (string, *models.User, error) {
+func (s *authService) LoginUser(ctx context.Context, email, password string, client models.ClientInfo) (*LoginResult, error) {
+	// Refuse throttled attempts before spending a bcrypt compare on them. The attempt counts as
+	// failed until the password is known to be right.
+	if err := s.loginGuard.BeginAttempt(ctx, email, client); err != nil {
+		return nil, err
+	}
+
 	// Check if user already exists
 	user, err := s.userRepo.FindByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", nil, ErrInvalidCredentials
+			return nil, s.loginFailed(ctx, email, nil, client, ErrInvalidCredentials)
 		}
-		return "", nil, err
+		return nil, err
 	}
 
 	// Check password
 	if !utils.CheckPasswordHash(password, user.Password) {
-		return "", nil, ErrInvalidCredentials
+		return nil, s.loginFailed(ctx, email, user, client, ErrInvalidCredentials)
+	}
+	if err := s.loginGuard.ReleaseAttempt(ctx, email); err != nil {
+		return nil, err
+	}
+	if user.IsDisabled() {
+		return nil, ErrAccountDisabled
+	}
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	// With 2FA enabled the password only earns a short-lived token for the second step
+	if user.TOTPEnabled {
+		mfaToken, err := utils.GeneratePurposeJWT(s.keys, user.ID, utils.PurposeMFAPending, s.cfg.MFAPendingExpiresIn, s.cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFAToken: mfaToken}, nil
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user.ID, s.cfg)
+	if err := s.loginGuard.RecordSuccess(ctx, email); err != nil {
+		return nil, err
+	}
+
+	// Generate JWT token bound to a new session
+	token, err := s.sessions.StartSession(ctx, user, client, time.Now())
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
 	// Return an empty string instead of a password hash in the response object
+	user.Password = ""
+	return &LoginResult{Token: token, User: user}, nil
+}
+
+func (s *authService) CompleteMFALogin(ctx context.Context, mfaToken, code, recoveryCode string, client models.ClientInfo) (string, *models.User, error) {
+	claims, err := utils.ValidatePurposeJWT(s.keys, mfaToken, utils.PurposeMFAPending)
+	if err != nil {
+		return "", nil, ErrInvalidMFAToken
+	}
+
+	user, err := s.userRepo.FindByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil, ErrInvalidMFAToken
+		}
+		return "", nil, err
+	}
+	if user.IsDisabled() {
+		return "", nil, ErrAccountDisabled
+	}
+
+	// Second factor failures count towards the same lockout as wrong passwords
+	if err := s.loginGuard.BeginAttempt(ctx, user.Email, client); err != nil {
+		return "", nil, err
+	}
+	if err := s.mfaService.VerifySecondFactor(ctx, user, code, recoveryCode); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			return "", nil, s.loginFailed(ctx, user.Email, user, client, err)
+		}
+		return "", nil, err
+	}
+	if err := s.loginGuard.RecordSuccess(ctx, user.Email); err != nil {
+		return "", nil, err
+	}
+
+	token, err := s.sessions.StartSession(ctx, user, client, time.Now())
+	if err != nil {
+		return "", nil, err
+	}
+
 	user.Password = ""
 	return token, user, nil
 }
+
+func (s *authService) ResetPassword(ctx context.Context, token, newPassword string, client models.ClientInfo) error {
+	user, err := s.userRepo.FindByPasswordResetTokenHash(ctx, utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidPasswordResetToken
+		}
+		return err
+	}
+	if user.PasswordResetExpiresAt == nil || time.Now().After(*user.PasswordResetExpiresAt) {
+		return ErrInvalidPasswordResetToken
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+	user.PasswordResetRequired = false
+	user.PasswordResetTokenHash = ""
+	user.PasswordResetExpiresAt = nil
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	// Whoever knew the old password must not keep a session or a lockout
+	if _, err := s.sessions.RevokeAllSessions(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := s.loginGuard.RecordSuccess(ctx, user.Email); err != nil {
+		return err
+	}
+
+	recordSecurityEvent(ctx, s.eventRepo, &models.SecurityEvent{
+		Type:      models.SecurityEventPasswordChanged,
+		UserID:    &user.ID,
+		Email:     user.Email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   "password set with reset token",
+	})
+	return nil
+}
+
+// loginFailed records a failed attempt and returns cause, or the error from recording it
+func (s *authService) loginFailed(ctx context.Context, email string, user *models.User, client models.ClientInfo, cause error) error {
+	if err := s.loginGuard.RecordFailure(ctx, email, user, client); err != nil {
+		return err
+	}
+	return cause
+}
@@ -0,0 +1,626 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCalDAVObjectNotFound  = errors.New("calendar object not found")
+	ErrCalDAVPrecondition    = errors.New("calendar object does not match the request's preconditions")
+	ErrInvalidCalendarObject = errors.New("invalid calendar object")
+	ErrUnsupportedComponent  = errors.New("calendar objects must hold a single VTODO")
+	ErrInvalidSyncToken      = errors.New("invalid sync token")
+	ErrInvalidCalendarQuery  = errors.New("invalid calendar-query filter")
+)
+
+const (
+	// calDAVSyncTokenPrefix makes sync tokens URIs, as RFC 6578 requires
+	calDAVSyncTokenPrefix = "urn:todolist:sync:"
+	// maxCalDAVSyncChanges bounds the changes read for one sync-collection report
+	maxCalDAVSyncChanges = 1000
+)
+
+// calDAVDefaultName matches the resource names of todos not created through CalDAV
+var calDAVDefaultName = regexp.MustCompile(`^todo-(\d+)\.ics$`)
+
+// CalDAVService serves the todos of the request's tenant as a CalDAV collection of VTODO
+// calendar objects. Writes go through TodoService, so its ownership and quota rules apply.
+type CalDAVService interface {
+	// SyncToken returns the token of the collection's current state, also used as its CTag
+	SyncToken(ctx context.Context) (string, error)
+	// ListObjects returns the calendar objects matching filter, or every object when it is nil
+	ListObjects(ctx context.Context, userID uint, filter *models.CalDAVCompFilter) ([]models.CalDAVObject, error)
+	GetObject(ctx context.Context, userID uint, name string) (*models.CalDAVObject, error)
+	// PutObject creates or replaces the todo stored as name and reports whether it was created
+	PutObject(ctx context.Context, userID uint, name string, data []byte, preconditions models.CalDAVPreconditions) (bool, error)
+	DeleteObject(ctx context.Context, userID uint, name string, preconditions models.CalDAVPreconditions) error
+	// SyncCollection reports the objects changed and removed since token; an empty token
+	// reports every object
+	SyncCollection(ctx context.Context, userID uint, token string) (*models.CalDAVSyncResult, error)
+}
+
+type calDAVService struct {
+	todoRepo    repositories.TodoRepository
+	calDAVRepo  repositories.CalDAVRepository
+	userRepo    repositories.UserRepository
+	todoService TodoService
+	validate    *validator.Validate
+	cfg         *config.Config
+}
+
+func NewCalDAVService(todoRepo repositories.TodoRepository, calDAVRepo repositories.CalDAVRepository, userRepo repositories.UserRepository, todoService TodoService, cfg *config.Config) CalDAVService {
+	return &calDAVService{
+		todoRepo:    todoRepo,
+		calDAVRepo:  calDAVRepo,
+		userRepo:    userRepo,
+		todoService: todoService,
+		validate:    validator.New(),
+		cfg:         cfg,
+	}
+}
+
+func formatCalDAVSyncToken(seq uint64) string {
+	return calDAVSyncTokenPrefix + strconv.FormatUint(seq, 10)
+}
+
+func parseCalDAVSyncToken(token string) (uint64, error) {
+	raw, ok := strings.CutPrefix(token, calDAVSyncTokenPrefix)
+	if !ok {
+		return 0, ErrInvalidSyncToken
+	}
+	seq, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidSyncToken
+	}
+	return seq, nil
+}
+
+func (s *calDAVService) SyncToken(ctx context.Context) (string, error) {
+	seq, err := s.todoRepo.LatestChangeSeq(ctx)
+	if err != nil {
+		return "", err
+	}
+	return formatCalDAVSyncToken(seq), nil
+}
+
+func (s *calDAVService) ListObjects(ctx context.Context, userID uint, filter *models.CalDAVCompFilter) ([]models.CalDAVObject, error) {
+	todos, err := s.todoService.GetTodosByUserID(ctx, userID, models.TodoFilter{Sort: models.SortCreatedAsc})
+	if err != nil {
+		return nil, err
+	}
+	resources, err := s.resourcesOf(ctx, todos)
+	if err != nil {
+		return nil, err
+	}
+
+	var loc *time.Location
+	if filter != nil {
+		loc = loadPreferences(ctx, s.userRepo, userID, s.cfg).Location
+	}
+	objects := make([]models.CalDAVObject, 0, len(todos))
+	for i := range todos {
+		object, err := calDAVObject(&todos[i], resources[todos[i].ID])
+		if err != nil {
+			return nil, err
+		}
+		if filter != nil {
+			matched, err := matchCalendarObject(object, *filter, loc)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+		}
+		objects = append(objects, *object)
+	}
+	return objects, nil
+}
+
+func (s *calDAVService) GetObject(ctx context.Context, userID uint, name string) (*models.CalDAVObject, error) {
+	todo, resource, err := s.findTodo(ctx, userID, name)
+	if err != nil {
+		return nil, err
+	}
+	return calDAVObject(todo, resource)
+}
+
+func (s *calDAVService) PutObject(ctx context.Context, userID uint, name string, data []byte, preconditions models.CalDAVPreconditions) (bool, error) {
+	calendar, err := utils.ParseICalendar(bytes.NewReader(data))
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidCalendarObject, err)
+	}
+	vtodo, err := singleVTodo(calendar)
+	if err != nil {
+		return false, err
+	}
+	loc := loadPreferences(ctx, s.userRepo, userID, s.cfg).Location
+	req, status, uid, err := todoFromVTodo(vtodo, loc)
+	if err != nil {
+		return false, err
+	}
+	if err := s.validate.Struct(req); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidCalendarObject, err)
+	}
+
+	// The todo, its resource name and its status are written in one transaction, so a PUT that
+	// fails, such as on a refused status move, changes nothing and a retry cannot duplicate the todo
+	created := false
+	err = s.todoRepo.InTransaction(ctx, userID, func(ctx context.Context) error {
+		todo, resource, err := s.findTodo(ctx, userID, name)
+		if err != nil && !errors.Is(err, ErrCalDAVObjectNotFound) {
+			return err
+		}
+		var current *models.CalDAVObject
+		if todo != nil {
+			if current, err = calDAVObject(todo, resource); err != nil {
+				return err
+			}
+		}
+		if !preconditionsHold(current, preconditions) {
+			return ErrCalDAVPrecondition
+		}
+
+		if todo == nil {
+			// Names of the todo-<id>.ics form are reserved for todos not created through CalDAV
+			if calDAVDefaultName.MatchString(name) {
+				return fmt.Errorf("%w: resource name %q is reserved", ErrInvalidCalendarObject, name)
+			}
+			todo, err = s.todoService.CreateTodo(ctx, userID, req.Title, req.Description, "", req.DueDate)
+			if err != nil {
+				return err
+			}
+			if err := s.calDAVRepo.SaveResource(ctx, &models.CalDAVResource{TodoID: todo.ID, UserID: userID, Name: name, UID: uid}); err != nil {
+				return err
+			}
+			created = true
+			return s.applyICalStatus(ctx, userID, todo, status)
+		}
+
+		// A VTODO without DUE leaves the due date unchanged, since todos cannot have it cleared
+		if _, err := s.todoService.UpdateTodo(ctx, userID, todo.ID, &req.Title, &req.Description, nil, req.DueDate); err != nil {
+			return err
+		}
+		return s.applyICalStatus(ctx, userID, todo, status)
+	})
+	if err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+// applyICalStatus moves the todo to the list's status closest to a VTODO STATUS. Todos whose
+// status is already exported as that STATUS keep it, so custom statuses survive a round trip.
+func (s *calDAVService) applyICalStatus(ctx context.Context, userID uint, todo *models.Todo, status string) error {
+	if status == icalStatus(todo) {
+		return nil
+	}
+	name, done := models.StatusPending, false
+	switch status {
+	case "IN-PROCESS":
+		name = models.StatusInProgress
+	case "COMPLETED":
+		name, done = models.StatusDone, true
+	}
+	resolved, err := s.todoService.ResolveStatus(ctx, name, done)
+	if err != nil {
+		return err
+	}
+	_, err = s.todoService.UpdateTodoStatus(ctx, userID, todo.ID, resolved, false)
+	return err
+}
+
+func (s *calDAVService) DeleteObject(ctx context.Context, userID uint, name string, preconditions models.CalDAVPreconditions) error {
+	todo, resource, err := s.findTodo(ctx, userID, name)
+	if err != nil {
+		return err
+	}
+	current, err := calDAVObject(todo, resource)
+	if err != nil {
+		return err
+	}
+	if !preconditionsHold(current, preconditions) {
+		return ErrCalDAVPrecondition
+	}
+	return s.todoService.DeleteTodo(ctx, userID, todo.ID)
+}
+
+func (s *calDAVService) SyncCollection(ctx context.Context, userID uint, token string) (*models.CalDAVSyncResult, error) {
+	if token == "" {
+		// The token is read first so that changes made while listing are reported again
+		seq, err := s.todoRepo.LatestChangeSeq(ctx)
+		if err != nil {
+			return nil, err
+		}
+		objects, err := s.ListObjects(ctx, userID, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &models.CalDAVSyncResult{Changed: objects, SyncToken: formatCalDAVSyncToken(seq)}, nil
+	}
+
+	since, err := parseCalDAVSyncToken(token)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := s.todoRepo.FindChangesSince(ctx, since, maxCalDAVSyncChanges+1)
+	if err != nil {
+		return nil, err
+	}
+	result := &models.CalDAVSyncResult{SyncToken: token, Truncated: len(changes) > maxCalDAVSyncChanges}
+	if result.Truncated {
+		changes = changes[:maxCalDAVSyncChanges]
+	}
+	if len(changes) == 0 {
+		return result, nil
+	}
+	result.SyncToken = formatCalDAVSyncToken(changes[len(changes)-1].Seq)
+
+	// Each todo is reported once, in the state after its latest change
+	latest := make(map[uint]models.TodoChange, len(changes))
+	ids := make([]uint, 0, len(changes))
+	for _, change := range changes {
+		if _, seen := latest[change.TodoID]; !seen {
+			ids = append(ids, change.TodoID)
+		}
+		latest[change.TodoID] = change
+	}
+	todos, err := s.todoRepo.FindTodosByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	todosByID := make(map[uint]*models.Todo, len(todos))
+	for i := range todos {
+		todosByID[todos[i].ID] = &todos[i]
+	}
+	resources, err := s.resourcesOf(ctx, nil, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		todo := todosByID[id]
+		if latest[id].Operation == models.ChangeDelete || todo == nil {
+			result.Removed = append(result.Removed, calDAVName(id, resources[id]))
+			continue
+		}
+		object, err := calDAVObject(todo, resources[id])
+		if err != nil {
+			return nil, err
+		}
+		result.Changed = append(result.Changed, *object)
+	}
+	return result, nil
+}
+
+// findTodo resolves a resource name to the todo stored under it
+func (s *calDAVService) findTodo(ctx context.Context, userID uint, name string) (*models.Todo, *models.CalDAVResource, error) {
+	var todoID uint
+	resource, err := s.calDAVRepo.FindResourceByName(ctx, name)
+	switch {
+	case err == nil:
+		todoID = resource.TodoID
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		resource = nil
+		match := calDAVDefaultName.FindStringSubmatch(name)
+		if match == nil {
+			return nil, nil, ErrCalDAVObjectNotFound
+		}
+		id, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil {
+			return nil, nil, ErrCalDAVObjectNotFound
+		}
+		todoID = uint(id)
+	default:
+		return nil, nil, err
+	}
+
+	todo, err := s.todoService.GetTodoByID(ctx, userID, todoID)
+	if errors.Is(err, ErrTodoNotFound) || errors.Is(err, ErrForbidden) {
+		return nil, nil, ErrCalDAVObjectNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return todo, resource, nil
+}
+
+// resourcesOf loads the CalDAV resources of todos and of the todos with ids, keyed by todo ID
+func (s *calDAVService) resourcesOf(ctx context.Context, todos []models.Todo, ids ...uint) (map[uint]*models.CalDAVResource, error) {
+	for _, todo := range todos {
+		ids = append(ids, todo.ID)
+	}
+	resources, err := s.calDAVRepo.FindResourcesByTodoIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byTodoID := make(map[uint]*models.CalDAVResource, len(resources))
+	for i := range resources {
+		byTodoID[resources[i].TodoID] = &resources[i]
+	}
+	return byTodoID, nil
+}
+
+func calDAVName(todoID uint, resource *models.CalDAVResource) string {
+	if resource != nil {
+		return resource.Name
+	}
+	return fmt.Sprintf("todo-%d.ics", todoID)
+}
+
+// calDAVObject renders a todo as a calendar object holding a single VTODO
+func calDAVObject(todo *models.Todo, resource *models.CalDAVResource) (*models.CalDAVObject, error) {
+	uid := todoICalUID(todo)
+	if resource != nil {
+		uid = resource.UID
+	}
+
+	var b bytes.Buffer
+	iw := utils.NewICalWriter(&b)
+	writeICalHeader(iw, "")
+	writeVTodo(iw, todo, uid, time.UTC)
+	writeICalFooter(iw)
+	if err := iw.Err(); err != nil {
+		return nil, err
+	}
+
+	return &models.CalDAVObject{
+		Name:         calDAVName(todo.ID, resource),
+		ETag:         fmt.Sprintf(`"%d-%x"`, todo.ID, todo.UpdatedAt.UnixNano()),
+		LastModified: todo.UpdatedAt,
+		Data:         b.Bytes(),
+	}, nil
+}
+
+// preconditionsHold evaluates If-Match and If-None-Match against the current object, nil when
+// the resource does not exist
+func preconditionsHold(current *models.CalDAVObject, preconditions models.CalDAVPreconditions) bool {
+	if preconditions.IfMatch != "" && (current == nil || !etagListed(preconditions.IfMatch, current.ETag)) {
+		return false
+	}
+	if preconditions.IfNoneMatch != "" && current != nil && etagListed(preconditions.IfNoneMatch, current.ETag) {
+		return false
+	}
+	return true
+}
+
+// etagListed reports whether an If-Match or If-None-Match header lists etag or is "*"
+func etagListed(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// singleVTodo returns the VTODO of a calendar object. Time zone definitions may accompany it.
+func singleVTodo(calendar *utils.ICalComponent) (*utils.ICalComponent, error) {
+	if calendar.Name != "VCALENDAR" {
+		return nil, fmt.Errorf("%w: expected a VCALENDAR", ErrInvalidCalendarObject)
+	}
+	var vtodo *utils.ICalComponent
+	for _, component := range calendar.Components {
+		switch component.Name {
+		case "VTIMEZONE":
+		case "VTODO":
+			if vtodo != nil {
+				return nil, ErrUnsupportedComponent
+			}
+			vtodo = component
+		default:
+			return nil, ErrUnsupportedComponent
+		}
+	}
+	if vtodo == nil {
+		return nil, ErrUnsupportedComponent
+	}
+	return vtodo, nil
+}
+
+// todoFromVTodo reads the todo fields, STATUS and UID of a VTODO; dates without a time zone
+// are read in loc. STATUS is one of the values icalStatus exports.
+func todoFromVTodo(vtodo *utils.ICalComponent, loc *time.Location) (models.CreateTodoRequest, string, string, error) {
+	var req models.CreateTodoRequest
+
+	uid := vtodo.Property("UID")
+	if uid == nil || uid.Value == "" {
+		return req, "", "", fmt.Errorf("%w: UID is required", ErrInvalidCalendarObject)
+	}
+	if summary := vtodo.Property("SUMMARY"); summary != nil {
+		req.Title = strings.TrimSpace(summary.Text())
+	}
+	if description := vtodo.Property("DESCRIPTION"); description != nil {
+		req.Description = description.Text()
+	}
+	if due := vtodo.Property("DUE"); due != nil {
+		dueDate, err := due.Time(loc)
+		if err != nil {
+			return req, "", "", fmt.Errorf("%w: invalid DUE: %v", ErrInvalidCalendarObject, err)
+		}
+		req.DueDate = &dueDate
+	}
+
+	status := "NEEDS-ACTION"
+	if prop := vtodo.Property("STATUS"); prop != nil {
+		switch strings.ToUpper(prop.Value) {
+		case "IN-PROCESS":
+			status = "IN-PROCESS"
+		case "COMPLETED", "CANCELLED":
+			status = "COMPLETED"
+		}
+	} else if vtodo.Property("COMPLETED") != nil {
+		status = "COMPLETED"
+	}
+	return req, status, uid.Value, nil
+}
+
+// matchCalendarObject evaluates a calendar-query filter against an object (RFC 4791, 9.7)
+func matchCalendarObject(object *models.CalDAVObject, filter models.CalDAVCompFilter, loc *time.Location) (bool, error) {
+	calendar, err := utils.ParseICalendar(bytes.NewReader(object.Data))
+	if err != nil {
+		return false, err
+	}
+	if !strings.EqualFold(filter.Name, calendar.Name) {
+		return filter.IsNotDefined != nil, nil
+	}
+	return matchCompFilter(calendar, filter, loc)
+}
+
+func matchCompFilter(component *utils.ICalComponent, filter models.CalDAVCompFilter, loc *time.Location) (bool, error) {
+	if filter.IsNotDefined != nil {
+		return false, nil
+	}
+	if filter.TimeRange != nil && component.Name == "VTODO" {
+		matched, err := vtodoInTimeRange(component, *filter.TimeRange, loc)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	for _, propFilter := range filter.PropFilters {
+		matched, err := matchPropFilter(component, propFilter, loc)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	for _, childFilter := range filter.CompFilters {
+		children := component.Children(strings.ToUpper(childFilter.Name))
+		if len(children) == 0 {
+			if childFilter.IsNotDefined == nil {
+				return false, nil
+			}
+			continue
+		}
+		matched := false
+		for _, child := range children {
+			ok, err := matchCompFilter(child, childFilter, loc)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func matchPropFilter(component *utils.ICalComponent, filter models.CalDAVPropFilter, loc *time.Location) (bool, error) {
+	var props []utils.ICalProperty
+	for _, prop := range component.Properties {
+		if strings.EqualFold(prop.Name, filter.Name) {
+			props = append(props, prop)
+		}
+	}
+	if filter.IsNotDefined != nil {
+		return len(props) == 0, nil
+	}
+	if len(props) == 0 {
+		return false, nil
+	}
+
+	if filter.TimeRange != nil {
+		start, end, err := parseTimeRange(*filter.TimeRange)
+		if err != nil {
+			return false, err
+		}
+		inRange := false
+		for _, prop := range props {
+			t, err := prop.Time(loc)
+			if err == nil && (start.IsZero() || !t.Before(start)) && (end.IsZero() || t.Before(end)) {
+				inRange = true
+				break
+			}
+		}
+		if !inRange {
+			return false, nil
+		}
+	}
+	if filter.TextMatch != nil {
+		needle := strings.ToLower(filter.TextMatch.Value)
+		found := false
+		for _, prop := range props {
+			if strings.Contains(strings.ToLower(prop.Text()), needle) {
+				found = true
+				break
+			}
+		}
+		if found == (filter.TextMatch.NegateCondition == "yes") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// vtodoInTimeRange applies the VTODO overlap rules of RFC 4791, 9.9 for todos, which have
+// no DTSTART or DURATION
+func vtodoInTimeRange(vtodo *utils.ICalComponent, timeRange models.CalDAVTimeRange, loc *time.Location) (bool, error) {
+	start, end, err := parseTimeRange(timeRange)
+	if err != nil {
+		return false, err
+	}
+	propTime := func(name string) *time.Time {
+		prop := vtodo.Property(name)
+		if prop == nil {
+			return nil
+		}
+		t, err := prop.Time(loc)
+		if err != nil {
+			return nil
+		}
+		return &t
+	}
+	// startsBy reports start <= t and endsAfter reports end > t, open ends always holding
+	startsBy := func(t time.Time) bool { return start.IsZero() || !start.After(t) }
+	endsAfter := func(t time.Time) bool { return end.IsZero() || end.After(t) }
+	endsBy := func(t time.Time) bool { return end.IsZero() || !end.Before(t) }
+
+	due, completed, created := propTime("DUE"), propTime("COMPLETED"), propTime("CREATED")
+	switch {
+	case due != nil:
+		return startsBy(*due) && endsAfter(*due), nil
+	case completed != nil && created != nil:
+		return (startsBy(*created) || startsBy(*completed)) && (endsBy(*created) || endsBy(*completed)), nil
+	case completed != nil:
+		return startsBy(*completed) && endsBy(*completed), nil
+	case created != nil:
+		return endsAfter(*created), nil
+	default:
+		return true, nil
+	}
+}
+
+func parseTimeRange(timeRange models.CalDAVTimeRange) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	if timeRange.Start != "" {
+		if start, err = time.Parse("20060102T150405Z", timeRange.Start); err != nil {
+			return start, end, fmt.Errorf("%w: invalid time-range start", ErrInvalidCalendarQuery)
+		}
+	}
+	if timeRange.End != "" {
+		if end, err = time.Parse("20060102T150405Z", timeRange.End); err != nil {
+			return start, end, fmt.Errorf("%w: invalid time-range end", ErrInvalidCalendarQuery)
+		}
+	}
+	return start, end, nil
+}
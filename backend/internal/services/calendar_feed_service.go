@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	calendarFeedTokenBytes          = 32
+	calendarFeedPrefixDisplayLength = len(models.CalendarFeedTokenPrefix) + 6
+	// calendarFeedRefreshInterval is the polling interval suggested to calendar apps
+	calendarFeedRefreshInterval = "PT1H"
+	// calendarFeedZoneSpan bounds the years of offset changes described by a feed's VTIMEZONE
+	calendarFeedZoneSpan = 50
+)
+
+var (
+	ErrCalendarFeedNotFound     = errors.New("calendar feed not found")
+	ErrInvalidCalendarFeedToken = errors.New("invalid calendar feed link")
+	ErrCalendarFeedLabelFilter  = errors.New("todos have no labels to filter the feed by")
+)
+
+// CalendarFeedService manages the read-only iCalendar feed of a user's dated todos, which
+// calendar apps subscribe to by URL
+type CalendarFeedService interface {
+	GetFeed(ctx context.Context, userID uint) (*models.CalendarFeed, error)
+	// CreateFeed issues a new feed URL, revoking the previous one
+	CreateFeed(ctx context.Context, userID uint) (*models.CreatedCalendarFeedResponse, error)
+	RevokeFeed(ctx context.Context, userID uint) error
+	// OpenFeed resolves a feed token and identifies the feed's current content
+	OpenFeed(ctx context.Context, token string, query models.CalendarFeedQuery) (*models.CalendarFeedSnapshot, error)
+	// WriteFeed writes the todos of an opened feed that have a due date as iCalendar
+	WriteFeed(ctx context.Context, snapshot *models.CalendarFeedSnapshot, w io.Writer) error
+}
+
+type calendarFeedService struct {
+	feedRepo repositories.CalendarFeedRepository
+	todoRepo repositories.TodoRepository
+	cfg      *config.Config
+}
+
+func NewCalendarFeedService(feedRepo repositories.CalendarFeedRepository, todoRepo repositories.TodoRepository, cfg *config.Config) CalendarFeedService {
+	return &calendarFeedService{feedRepo: feedRepo, todoRepo: todoRepo, cfg: cfg}
+}
+
+func (s *calendarFeedService) GetFeed(ctx context.Context, userID uint) (*models.CalendarFeed, error) {
+	feed, err := s.feedRepo.FindFeedByUserID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCalendarFeedNotFound
+	}
+	return feed, err
+}
+
+func (s *calendarFeedService) CreateFeed(ctx context.Context, userID uint) (*models.CreatedCalendarFeedResponse, error) {
+	raw, err := utils.GenerateRandomToken(models.CalendarFeedTokenPrefix, calendarFeedTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &models.CalendarFeed{
+		CreatedAt: time.Now(),
+		UserID:    userID,
+		Prefix:    raw[:calendarFeedPrefixDisplayLength],
+		TokenHash: utils.HashToken(raw),
+	}
+	if err := s.feedRepo.SaveFeed(ctx, feed); err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimRight(s.cfg.APIBaseURL, "/") + "/api/calendar/" + raw + ".ics"
+	webcalURL := url
+	if scheme, rest, ok := strings.Cut(url, "://"); ok && (scheme == "http" || scheme == "https") {
+		webcalURL = "webcal://" + rest
+	}
+	return &models.CreatedCalendarFeedResponse{URL: url, WebcalURL: webcalURL, CalendarFeed: *feed}, nil
+}
+
+func (s *calendarFeedService) RevokeFeed(ctx context.Context, userID uint) error {
+	err := s.feedRepo.DeleteFeed(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrCalendarFeedNotFound
+	}
+	return err
+}
+
+func (s *calendarFeedService) OpenFeed(ctx context.Context, token string, query models.CalendarFeedQuery) (*models.CalendarFeedSnapshot, error) {
+	if query.Label != "" {
+		return nil, ErrCalendarFeedLabelFilter
+	}
+	if !strings.HasPrefix(token, models.CalendarFeedTokenPrefix) {
+		return nil, ErrInvalidCalendarFeedToken
+	}
+
+	feed, err := s.feedRepo.FindFeedByHash(ctx, utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCalendarFeedToken
+		}
+		return nil, err
+	}
+	if feed.User.IsDisabled() {
+		return nil, ErrInvalidCalendarFeedToken
+	}
+
+	now := time.Now()
+	if feed.LastFetchedAt == nil || now.Sub(*feed.LastFetchedAt) >= lastUsedResolution {
+		if err := s.feedRepo.UpdateLastFetched(ctx, feed.ID, now); err != nil {
+			log.Printf("WARNING: Failed to update last fetch of calendar feed %d: %v", feed.ID, err)
+		}
+	}
+
+	// The feed changes with the user's todos and with their timezone setting
+	lastModified := feed.User.UpdatedAt
+	var seq uint64
+	change, err := s.todoRepo.FindLatestTenantChange(repositories.WithTenant(ctx, models.Tenant{UserID: feed.UserID}))
+	switch {
+	case err == nil:
+		seq = change.Seq
+		if change.CreatedAt.After(lastModified) {
+			lastModified = change.CreatedAt
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	prefs := preferencesOf(&feed.User, s.cfg)
+	version := fmt.Sprintf("%d|%d|%d|%s|%s|%s", feed.UserID, seq, feed.User.UpdatedAt.UnixNano(), prefs.Location, query.Status, query.Component)
+	sum := sha256.Sum256([]byte(version))
+
+	return &models.CalendarFeedSnapshot{
+		UserID:       feed.UserID,
+		Query:        query,
+		Location:     prefs.Location,
+		ETag:         `"` + hex.EncodeToString(sum[:16]) + `"`,
+		LastModified: lastModified.UTC().Truncate(time.Second),
+	}, nil
+}
+
+func (s *calendarFeedService) WriteFeed(ctx context.Context, snapshot *models.CalendarFeedSnapshot, w io.Writer) error {
+	personal := repositories.WithTenant(ctx, models.Tenant{UserID: snapshot.UserID})
+	todos, err := s.todoRepo.FindTodos(personal, models.TodoFilter{Status: snapshot.Query.Status, Sort: models.SortDueAsc})
+	if err != nil {
+		return err
+	}
+
+	dated := todos[:0]
+	var earliest, latest time.Time
+	for _, todo := range todos {
+		if todo.DueDate == nil {
+			continue
+		}
+		if len(dated) == 0 || todo.DueDate.Before(earliest) {
+			earliest = *todo.DueDate
+		}
+		if len(dated) == 0 || todo.DueDate.After(latest) {
+			latest = *todo.DueDate
+		}
+		dated = append(dated, todo)
+	}
+
+	loc := snapshot.Location
+	iw := utils.NewICalWriter(w)
+	writeICalHeader(iw, "Todos")
+	iw.Property("X-WR-TIMEZONE", loc.String())
+	iw.Property("REFRESH-INTERVAL;VALUE=DURATION", calendarFeedRefreshInterval)
+	iw.Property("X-PUBLISHED-TTL", calendarFeedRefreshInterval)
+	if len(dated) > 0 {
+		if latest.Sub(earliest) > calendarFeedZoneSpan*365*24*time.Hour {
+			earliest = latest.AddDate(-calendarFeedZoneSpan, 0, 0)
+		}
+		iw.TimeZone(loc, earliest.AddDate(0, 0, -1), latest.AddDate(0, 0, 1))
+	}
+
+	for i := range dated {
+		if snapshot.Query.Component == models.CalendarFeedTodos {
+			writeVTodo(iw, &dated[i], todoICalUID(&dated[i]), loc)
+		} else {
+			writeDueEvent(iw, &dated[i], loc)
+		}
+		if err := iw.Err(); err != nil {
+			return err
+		}
+	}
+
+	writeICalFooter(iw)
+	return iw.Err()
+}
+
+// writeDueEvent writes the due date of a todo as a VEVENT that does not block time. Todos due
+// at midnight in loc are shown as all-day events.
+func writeDueEvent(iw *utils.ICalWriter, todo *models.Todo, loc *time.Location) {
+	due := todo.DueDate.In(loc)
+
+	iw.Begin("VEVENT")
+	iw.Text("UID", todoICalUID(todo))
+	iw.Time("DTSTAMP", todo.UpdatedAt)
+	iw.Time("LAST-MODIFIED", todo.UpdatedAt)
+	if due.Hour() == 0 && due.Minute() == 0 && due.Second() == 0 {
+		iw.Property("DTSTART;VALUE=DATE", due.Format("20060102"))
+		iw.Property("DTEND;VALUE=DATE", due.AddDate(0, 0, 1).Format("20060102"))
+	} else {
+		iw.LocalTime("DTSTART", due, loc)
+	}
+	summary := todo.Title
+	if todo.IsDone() {
+		summary = "✓ " + summary
+	}
+	iw.Text("SUMMARY", summary)
+	if todo.Description != "" {
+		iw.Text("DESCRIPTION", todo.Description)
+	}
+	iw.Property("TRANSP", "TRANSPARENT")
+	iw.End("VEVENT")
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCommentNotFound      = errors.New("comment not found")
+	ErrCommentPermission    = errors.New("only the author can change this comment")
+	ErrInvalidParentComment = errors.New("parent comment not found on this todo")
+)
+
+// mentionPattern matches @email and @name mentions that do not follow a word character, so
+// email addresses written in the body are not read as mentions
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.@])@([\w.+\-]+(?:@[\w\-]+(?:\.[\w\-]+)+)?)`)
+
+type CommentService interface {
+	CreateComment(ctx context.Context, userID, todoID uint, req models.CreateCommentRequest) (*models.Comment, error)
+	ListComments(ctx context.Context, userID, todoID uint, filter models.CommentFilter) (*models.CommentListResponse, error)
+	UpdateComment(ctx context.Context, userID, todoID, commentID uint, body string) (*models.Comment, error)
+	// DeleteComment removes a comment; authors may delete their own and workspace managers any
+	DeleteComment(ctx context.Context, userID, todoID, commentID uint) error
+}
+
+type commentService struct {
+	commentRepo   repositories.CommentRepository
+	workspaceRepo repositories.WorkspaceRepository
+	userRepo      repositories.UserRepository
+	todoService   TodoService
+	events        EventBus
+}
+
+func NewCommentService(commentRepo repositories.CommentRepository, workspaceRepo repositories.WorkspaceRepository, userRepo repositories.UserRepository, todoService TodoService, events EventBus) CommentService {
+	return &commentService{commentRepo: commentRepo, workspaceRepo: workspaceRepo, userRepo: userRepo, todoService: todoService, events: events}
+}
+
+func (s *commentService) CreateComment(ctx context.Context, userID, todoID uint, req models.CreateCommentRequest) (*models.Comment, error) {
+	todo, err := s.todoService.GetTodoByID(ctx, userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := &models.Comment{TodoID: todo.ID, UserID: userID, Body: strings.TrimSpace(req.Body)}
+	if req.ParentID != nil {
+		parent, err := s.findComment(ctx, todo.ID, *req.ParentID)
+		if err != nil {
+			if errors.Is(err, ErrCommentNotFound) {
+				return nil, ErrInvalidParentComment
+			}
+			return nil, err
+		}
+		// Threads are one level deep; a reply to a reply joins its thread
+		comment.ParentID = &parent.ID
+		if parent.ParentID != nil {
+			comment.ParentID = parent.ParentID
+		}
+	}
+
+	mentioned, err := s.resolveMentions(ctx, todo, comment.Body)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range mentioned {
+		comment.Mentions = append(comment.Mentions, models.CommentMention{UserID: id})
+	}
+
+	events := []models.TodoEvent{{TodoID: todo.ID, UserID: userID, Type: models.TodoEventCommented}}
+	events = append(events, mentionEvents(todo.ID, userID, mentioned)...)
+	if err := s.commentRepo.CreateComment(ctx, comment, events); err != nil {
+		return nil, err
+	}
+	s.events.Publish(ctx, todoEvents(todo, events)...)
+	return comment, nil
+}
+
+func (s *commentService) ListComments(ctx context.Context, userID, todoID uint, filter models.CommentFilter) (*models.CommentListResponse, error) {
+	if _, err := s.todoService.GetTodoByID(ctx, userID, todoID); err != nil {
+		return nil, err
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = models.DefaultCommentPageSize
+	}
+	filter.PageSize = min(filter.PageSize, models.MaxCommentPageSize)
+
+	comments, total, err := s.commentRepo.FindComments(ctx, todoID, filter.Page, filter.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	if comments == nil {
+		comments = []models.Comment{}
+	}
+	return &models.CommentListResponse{Comments: comments, Total: total, Page: filter.Page, PageSize: filter.PageSize}, nil
+}
+
+func (s *commentService) UpdateComment(ctx context.Context, userID, todoID, commentID uint, body string) (*models.Comment, error) {
+	todo, err := s.todoService.GetTodoByID(ctx, userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := s.findComment(ctx, todo.ID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.UserID != userID || comment.Deleted {
+		return nil, ErrCommentPermission
+	}
+
+	body = strings.TrimSpace(body)
+	if body == comment.Body {
+		return comment, nil
+	}
+	mentioned, err := s.resolveMentions(ctx, todo, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only users who were not mentioned before are told about the edit
+	previously := make(map[uint]bool, len(comment.Mentions))
+	for _, mention := range comment.Mentions {
+		previously[mention.UserID] = true
+	}
+	var added []uint
+	comment.Mentions = comment.Mentions[:0]
+	for _, id := range mentioned {
+		comment.Mentions = append(comment.Mentions, models.CommentMention{UserID: id})
+		if !previously[id] {
+			added = append(added, id)
+		}
+	}
+
+	comment.Body = body
+	comment.Edited = true
+	events := mentionEvents(todo.ID, userID, added)
+	if err := s.commentRepo.UpdateComment(ctx, comment, events); err != nil {
+		return nil, err
+	}
+	s.events.Publish(ctx, todoEvents(todo, events)...)
+	return comment, nil
+}
+
+func (s *commentService) DeleteComment(ctx context.Context, userID, todoID, commentID uint) error {
+	todo, err := s.todoService.GetTodoByID(ctx, userID, todoID)
+	if err != nil {
+		return err
+	}
+	comment, err := s.findComment(ctx, todo.ID, commentID)
+	if err != nil {
+		return err
+	}
+	if comment.UserID != userID {
+		tenant, _ := repositories.TenantFromContext(ctx)
+		if !tenant.Role.CanManage() {
+			return ErrCommentPermission
+		}
+	}
+
+	// A thread stays readable when its first comment is removed
+	replies, err := s.commentRepo.CountReplies(ctx, comment.ID)
+	if err != nil {
+		return err
+	}
+	if replies > 0 {
+		return s.commentRepo.MarkCommentDeleted(ctx, comment.ID)
+	}
+	if err := s.commentRepo.DeleteComment(ctx, comment.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCommentNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// findComment loads a comment and checks it belongs to the todo
+func (s *commentService) findComment(ctx context.Context, todoID, commentID uint) (*models.Comment, error) {
+	comment, err := s.commentRepo.FindCommentByID(ctx, commentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+	if comment.TodoID != todoID {
+		return nil, ErrCommentNotFound
+	}
+	return comment, nil
+}
+
+// resolveMentions returns the users with access to the todo mentioned in body. A mention is an
+// email address or a display name without spaces; names shared by several users are ignored.
+func (s *commentService) resolveMentions(ctx context.Context, todo *models.Todo, body string) ([]uint, error) {
+	matches := mentionPattern.FindAllStringSubmatch(body, -1)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	candidates, err := s.usersWithAccess(ctx, todo)
+	if err != nil {
+		return nil, err
+	}
+
+	var mentioned []uint
+	seen := make(map[uint]bool)
+	for _, match := range matches {
+		handle := strings.TrimRight(match[1], ".")
+		id, ok := matchMention(candidates, handle)
+		if ok && !seen[id] {
+			seen[id] = true
+			mentioned = append(mentioned, id)
+		}
+	}
+	return mentioned, nil
+}
+
+// usersWithAccess lists the owner of a personal todo, or the members of the todo's workspace
+func (s *commentService) usersWithAccess(ctx context.Context, todo *models.Todo) ([]models.WorkspaceMemberResponse, error) {
+	if todo.WorkspaceID != nil {
+		return s.workspaceRepo.FindMembers(ctx, *todo.WorkspaceID)
+	}
+	owner, err := s.userRepo.FindByID(ctx, todo.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return []models.WorkspaceMemberResponse{{UserID: owner.ID, Email: owner.Email, DisplayName: owner.DisplayName}}, nil
+}
+
+func matchMention(candidates []models.WorkspaceMemberResponse, handle string) (uint, bool) {
+	var found []uint
+	for _, candidate := range candidates {
+		if strings.Contains(handle, "@") {
+			if strings.EqualFold(candidate.Email, handle) {
+				return candidate.UserID, true
+			}
+			continue
+		}
+		name := strings.Join(strings.Fields(candidate.DisplayName), "")
+		if name != "" && strings.EqualFold(name, handle) {
+			found = append(found, candidate.UserID)
+		}
+	}
+	if len(found) != 1 {
+		return 0, false
+	}
+	return found[0], true
+}
+
+func mentionEvents(todoID, userID uint, mentioned []uint) []models.TodoEvent {
+	events := make([]models.TodoEvent, 0, len(mentioned))
+	for _, id := range mentioned {
+		events = append(events, models.TodoEvent{TodoID: todoID, UserID: userID, Type: models.TodoEventMentioned, SubjectID: &id})
+	}
+	return events
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	htmltemplate "html/template"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// digestTimeLayout is the format of a user's digest time of day
+const digestTimeLayout = "15:04"
+
+// digestTodoLimit bounds the number of todos listed in one digest
+const digestTodoLimit = 100
+
+var ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe link")
+
+//go:embed templates/digest.txt templates/digest.html
+var digestTemplates embed.FS
+
+var (
+	digestTextTemplate = texttemplate.Must(texttemplate.ParseFS(digestTemplates, "templates/digest.txt"))
+	digestHTMLTemplate = htmltemplate.Must(htmltemplate.ParseFS(digestTemplates, "templates/digest.html"))
+)
+
+// DigestService sends the opt-in daily digest email of overdue, due and recently completed todos
+type DigestService interface {
+	// DispatchDigests queues a digest job for every subscriber whose digest time has passed
+	// today in their timezone and who has not been sent today's digest
+	DispatchDigests(ctx context.Context, now time.Time) (int, error)
+	// SendDigest emails the user's digest for date, a local date in YYYY-MM-DD form. Nothing is
+	// sent when the user has unsubscribed or there is nothing to report.
+	SendDigest(ctx context.Context, userID uint, date string) error
+	// Unsubscribe turns off the digest of the user a signed unsubscribe token was issued to
+	Unsubscribe(ctx context.Context, token string) error
+}
+
+// digestJob is the payload of JobSendDigest
+type digestJob struct {
+	UserID uint   `json:"user_id"`
+	Date   string `json:"date"`
+}
+
+type digestItem struct {
+	Title string
+	Due   string
+}
+
+type digestData struct {
+	Name           string
+	Date           string
+	Overdue        []digestItem
+	DueToday       []digestItem
+	Completed      []digestItem
+	Truncated      bool
+	Limit          int
+	AppURL         string
+	UnsubscribeURL string
+}
+
+type digestService struct {
+	userRepo repositories.UserRepository
+	todoRepo repositories.TodoRepository
+	jobs     JobQueue
+	mailer   utils.Mailer
+	signer   *utils.Signer
+	cfg      *config.Config
+}
+
+func NewDigestService(userRepo repositories.UserRepository, todoRepo repositories.TodoRepository, jobs JobQueue, mailer utils.Mailer, cfg *config.Config) DigestService {
+	return &digestService{
+		userRepo: userRepo,
+		todoRepo: todoRepo,
+		jobs:     jobs,
+		mailer:   mailer,
+		signer:   utils.NewSigner(cfg.JWTSecret, "digest-unsubscribe"),
+		cfg:      cfg,
+	}
+}
+
+func (s *digestService) DispatchDigests(ctx context.Context, now time.Time) (int, error) {
+	users, err := s.userRepo.FindDigestSubscribers(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, user := range users {
+		local := now.In(preferencesOf(&user, s.cfg).Location)
+		date := local.Format(time.DateOnly)
+		if user.DigestSentOn == date || local.Format(digestTimeLayout) < user.DigestTime {
+			continue
+		}
+		// Recording the date first keeps a later dispatch from queueing the same digest again
+		marked, err := s.userRepo.MarkDigestSent(ctx, user.ID, date)
+		if err != nil {
+			return queued, err
+		}
+		if !marked {
+			continue
+		}
+		_, err = s.jobs.Enqueue(ctx, JobSendDigest, digestJob{UserID: user.ID, Date: date}, JobOptions{
+			UniqueKey: fmt.Sprintf("digest:%d:%s", user.ID, date),
+		})
+		if err != nil {
+			log.Printf("ERROR: Failed to queue the %s digest of user %d: %v", date, user.ID, err)
+			continue
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+func (s *digestService) SendDigest(ctx context.Context, userID uint, date string) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.DigestEnabled || user.IsDisabled() {
+		return nil
+	}
+
+	location := preferencesOf(user, s.cfg).Location
+	today, err := time.ParseInLocation(time.DateOnly, date, location)
+	if err != nil {
+		return fmt.Errorf("invalid digest date %q: %w", date, err)
+	}
+	tomorrow, yesterday := today.AddDate(0, 0, 1), today.AddDate(0, 0, -1)
+
+	todos, err := s.todoRepo.FindDigestTodos(ctx, user.ID, tomorrow, yesterday, today, digestTodoLimit)
+	if err != nil {
+		return err
+	}
+	if len(todos) == 0 {
+		return nil
+	}
+
+	data := digestData{
+		Name:           user.DisplayName,
+		Date:           today.Format("Monday, January 2"),
+		Truncated:      len(todos) == digestTodoLimit,
+		Limit:          digestTodoLimit,
+		AppURL:         strings.TrimRight(s.cfg.AppBaseURL, "/"),
+		UnsubscribeURL: s.unsubscribeURL(user.ID),
+	}
+	if data.Name == "" {
+		data.Name = user.Email
+	}
+	for _, todo := range todos {
+		item := digestItem{Title: todo.Title}
+		if todo.DueDate != nil {
+			item.Due = todo.DueDate.In(location).Format("Mon Jan 2 15:04")
+		}
+		switch {
+		case todo.IsDone():
+			data.Completed = append(data.Completed, item)
+		case todo.DueDate.Before(today):
+			data.Overdue = append(data.Overdue, item)
+		default:
+			data.DueToday = append(data.DueToday, item)
+		}
+	}
+
+	var text, html bytes.Buffer
+	if err := digestTextTemplate.Execute(&text, data); err != nil {
+		return fmt.Errorf("failed to render digest: %w", err)
+	}
+	if err := digestHTMLTemplate.Execute(&html, data); err != nil {
+		return fmt.Errorf("failed to render digest: %w", err)
+	}
+
+	return s.mailer.SendMessage(ctx, utils.Message{
+		To:      user.Email,
+		Subject: fmt.Sprintf("Your todo digest for %s", data.Date),
+		Text:    text.String(),
+		HTML:    html.String(),
+		// Lets mail clients offer one-click unsubscribe (RFC 8058)
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
+
+// unsubscribeURL links to the API endpoint that turns off the user's digest without signing in
+func (s *digestService) unsubscribeURL(userID uint) string {
+	token := s.signer.Sign(strconv.FormatUint(uint64(userID), 10))
+	return strings.TrimRight(s.cfg.APIBaseURL, "/") + "/api/digest/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+func (s *digestService) Unsubscribe(ctx context.Context, token string) error {
+	value, ok := s.signer.Verify(token)
+	if !ok {
+		return ErrInvalidUnsubscribeToken
+	}
+	userID, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return ErrInvalidUnsubscribeToken
+	}
+
+	if err := s.userRepo.SetDigestEnabled(ctx, uint(userID), false); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidUnsubscribeToken
+		}
+		return err
+	}
+	return nil
+}
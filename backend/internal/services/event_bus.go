@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"sync"
+)
+
+type EventType string
+
+const (
+	EventTodoAssigned         EventType = "todo.assigned"
+	EventTodoUnassigned       EventType = "todo.unassigned"
+	EventTodoCommented        EventType = "todo.commented"
+	EventTodoMentioned        EventType = "todo.mentioned"
+	EventTodoDueSoon          EventType = "todo.due_soon"
+	EventWorkspaceMemberAdded EventType = "workspace.member_added"
+)
+
+// Event describes a change a service has committed, for other parts of the application to react to
+type Event struct {
+	Type EventType
+	// ActorID is the user who made the change, zero for changes made by the application
+	ActorID uint
+	// SubjectID is the user the event is about, such as the assignee or the added member
+	SubjectID   uint
+	TodoID      uint
+	CommentID   *uint
+	WorkspaceID *uint
+	// Title is the title of the todo, or the name of the workspace
+	Title string
+}
+
+// EventHandler receives the events of one change together
+type EventHandler func(ctx context.Context, events []Event)
+
+// EventBus delivers events to every subscriber, synchronously and in subscription order.
+// Handlers must not fail the change that published the events, so they handle their own errors.
+type EventBus interface {
+	Subscribe(handler EventHandler)
+	Publish(ctx context.Context, events ...Event)
+}
+
+type eventBus struct {
+	mu       sync.RWMutex
+	handlers []EventHandler
+}
+
+func NewEventBus() EventBus {
+	return &eventBus{}
+}
+
+func (b *eventBus) Subscribe(handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+func (b *eventBus) Publish(ctx context.Context, events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(ctx, events)
+	}
+}
+
+// todoEvents converts the recorded events of a change to todo into bus events
+func todoEvents(todo *models.Todo, recorded []models.TodoEvent) []Event {
+	events := make([]Event, 0, len(recorded))
+	for _, event := range recorded {
+		published := Event{
+			ActorID:     event.UserID,
+			TodoID:      todo.ID,
+			CommentID:   event.CommentID,
+			WorkspaceID: todo.WorkspaceID,
+			Title:       todo.Title,
+		}
+		if event.SubjectID != nil {
+			published.SubjectID = *event.SubjectID
+		}
+		switch event.Type {
+		case models.TodoEventAssigned:
+			published.Type = EventTodoAssigned
+		case models.TodoEventUnassigned:
+			published.Type = EventTodoUnassigned
+		case models.TodoEventCommented:
+			published.Type = EventTodoCommented
+		case models.TodoEventMentioned:
+			published.Type = EventTodoMentioned
+		default:
+			continue
+		}
+		events = append(events, published)
+	}
+	return events
+}
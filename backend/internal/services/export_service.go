@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnsupportedExportFormat = errors.New("unsupported export format")
+)
+
+// exportCSVHeader lists the CSV columns; the import endpoint maps the same names by default
+var exportCSVHeader = []string{"id", "title", "description", "status", "due_date", "image_url", "created_at", "updated_at"}
+
+type ExportService interface {
+	ExportTodos(ctx context.Context, userID uint, format models.ExportFormat, filter models.TodoFilter, w io.Writer) error
+}
+
+type exportService struct {
+	todoRepo repositories.TodoRepository
+	userRepo repositories.UserRepository
+	cfg      *config.Config
+}
+
+func NewExportService(todoRepo repositories.TodoRepository, userRepo repositories.UserRepository, cfg *config.Config) ExportService {
+	return &exportService{todoRepo: todoRepo, userRepo: userRepo, cfg: cfg}
+}
+
+// ExportTodos streams the user's todos matching the filter to w in the requested format.
+// Human-readable formats show dates in the user's timezone.
+func (s *exportService) ExportTodos(ctx context.Context, userID uint, format models.ExportFormat, filter models.TodoFilter, w io.Writer) error {
+	prefs := loadPreferences(ctx, s.userRepo, userID, s.cfg)
+	prefs.applyToFilter(&filter, time.Now())
+
+	switch format {
+	case models.ExportJSON:
+		return s.exportJSON(ctx, filter, w)
+	case models.ExportCSV:
+		return s.exportCSV(ctx, filter, prefs.Location, w)
+	case models.ExportMarkdown:
+		return s.exportMarkdown(ctx, filter, prefs.Location, w)
+	case models.ExportICal:
+		return s.exportICal(ctx, filter, w)
+	default:
+		return ErrUnsupportedExportFormat
+	}
+}
+
+func (s *exportService) exportJSON(ctx context.Context, filter models.TodoFilter, w io.Writer) error {
+	header, err := json.Marshal(models.TodoExportDocument{
+		Kind:       models.TodoExportKind,
+		Version:    models.TodoExportVersion,
+		ExportedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	// Re-open the envelope after "todos":null so the items can be streamed into the array
+	header = header[:len(header)-len(`null}`)]
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	first := true
+	err = s.todoRepo.StreamTodos(ctx, filter, func(todo *models.Todo) error {
+		item, err := json.Marshal(models.NewExportedTodo(todo))
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = w.Write(item)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+func (s *exportService) exportCSV(ctx context.Context, filter models.TodoFilter, loc *time.Location, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportCSVHeader); err != nil {
+		return err
+	}
+
+	err := s.todoRepo.StreamTodos(ctx, filter, func(todo *models.Todo) error {
+		return cw.Write([]string{
+			fmt.Sprint(todo.ID),
+			todo.Title,
+			todo.Description,
+			string(todo.Status),
+			formatOptionalTime(todo.DueDate, loc),
+			todo.ImageURL,
+			todo.CreatedAt.In(loc).Format(time.RFC3339),
+			todo.UpdatedAt.In(loc).Format(time.RFC3339),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func (s *exportService) exportMarkdown(ctx context.Context, filter models.TodoFilter, loc *time.Location, w io.Writer) error {
+	if _, err := io.WriteString(w, "# Todos\n\n"); err != nil {
+		return err
+	}
+
+	return s.todoRepo.StreamTodos(ctx, filter, func(todo *models.Todo) error {
+		var b strings.Builder
+		checkbox := " "
+		if todo.IsDone() {
+			checkbox = "x"
+		}
+		fmt.Fprintf(&b, "- [%s] %s", checkbox, escapeMarkdown(todo.Title))
+		if !todo.IsDone() && todo.Status != models.StatusPending {
+			fmt.Fprintf(&b, " _(%s)_", escapeMarkdown(string(todo.Status)))
+		}
+		if todo.DueDate != nil {
+			fmt.Fprintf(&b, " — due %s", todo.DueDate.In(loc).Format("Mon, 02 Jan 2006 15:04 MST"))
+		}
+		b.WriteString("\n")
+		if todo.Description != "" {
+			for _, line := range strings.Split(todo.Description, "\n") {
+				fmt.Fprintf(&b, "  %s\n", line)
+			}
+		}
+		if todo.ImageURL != "" {
+			fmt.Fprintf(&b, "  ![image](%s)\n", todo.ImageURL)
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	})
+}
+
+// exportICal writes todos that have a due date as VTODO entries
+func (s *exportService) exportICal(ctx context.Context, filter models.TodoFilter, w io.Writer) error {
+	iw := utils.NewICalWriter(w)
+	writeICalHeader(iw, "Todos")
+
+	err := s.todoRepo.StreamTodos(ctx, filter, func(todo *models.Todo) error {
+		if todo.DueDate == nil {
+			return nil
+		}
+		writeVTodo(iw, todo, todoICalUID(todo), time.UTC)
+		return iw.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	writeICalFooter(iw)
+	return iw.Err()
+}
+
+func formatOptionalTime(t *time.Time, loc *time.Location) string {
+	if t == nil {
+		return ""
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "`", "\\`")
+
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
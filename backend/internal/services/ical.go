@@ -0,0 +1,67 @@
+package services
+
+import (
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"time"
+)
+
+const icalProductID = "-//TodoList//TodoList App//EN"
+
+// todoICalUID returns the stable iCalendar UID of a todo
+func todoICalUID(todo *models.Todo) string {
+	return fmt.Sprintf("todo-%d@todolist", todo.ID)
+}
+
+// icalStatus maps a todo's status to the VTODO STATUS property. Todos in a done status are
+// COMPLETED; of the open statuses only In Progress has its own value.
+func icalStatus(todo *models.Todo) string {
+	switch {
+	case todo.IsDone():
+		return "COMPLETED"
+	case todo.Status == models.StatusInProgress:
+		return "IN-PROCESS"
+	default:
+		return "NEEDS-ACTION"
+	}
+}
+
+func writeICalHeader(iw *utils.ICalWriter, name string) {
+	iw.Begin("VCALENDAR")
+	iw.Property("VERSION", "2.0")
+	iw.Property("PRODID", icalProductID)
+	iw.Property("CALSCALE", "GREGORIAN")
+	if name != "" {
+		iw.Text("X-WR-CALNAME", name)
+	}
+}
+
+func writeICalFooter(iw *utils.ICalWriter) {
+	iw.End("VCALENDAR")
+}
+
+// writeVTodo writes a todo as a VTODO component identified by uid, with its due date in loc
+func writeVTodo(iw *utils.ICalWriter, todo *models.Todo, uid string, loc *time.Location) {
+	iw.Begin("VTODO")
+	iw.Text("UID", uid)
+	iw.Time("DTSTAMP", todo.UpdatedAt)
+	iw.Time("CREATED", todo.CreatedAt)
+	iw.Time("LAST-MODIFIED", todo.UpdatedAt)
+	iw.Text("SUMMARY", todo.Title)
+	if todo.Description != "" {
+		iw.Text("DESCRIPTION", todo.Description)
+	}
+	if todo.DueDate != nil {
+		iw.LocalTime("DUE", *todo.DueDate, loc)
+	}
+	iw.Property("STATUS", icalStatus(todo))
+	if todo.IsDone() {
+		iw.Property("PERCENT-COMPLETE", "100")
+		iw.Time("COMPLETED", *todo.CompletedAt)
+	}
+	if todo.ImageURL != "" {
+		iw.Property("ATTACH", todo.ImageURL)
+	}
+	iw.End("VTODO")
+}
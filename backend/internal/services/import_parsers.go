@@ -0,0 +1,301 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"io"
+	"strings"
+	"time"
+)
+
+// importRow is a single todo read from an import file, before validation
+type importRow struct {
+	Row  int
+	Todo models.CreateTodoRequest
+	// Status is resolved against the list's statuses when the row is imported
+	Status      models.TodoStatus
+	CompletedAt *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Errors      []models.ImportRowError
+}
+
+// importFields lists the todo fields that CSV columns can be mapped to
+var importFields = []string{"title", "description", "status", "due_date", "image_url"}
+
+var importDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseImportDate accepts RFC 3339 and common date layouts; values without a zone are read as UTC
+func parseImportDate(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("unrecognized date %q", value)
+}
+
+// parseImportStatus maps common status spellings onto the default statuses; empty means
+// Pending. Other values are kept as the name of a status the list may define.
+func parseImportStatus(value string) models.TodoStatus {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "pending", "todo", "to do", "open", "needs-action":
+		return models.StatusPending
+	case "in progress", "in-progress", "in-process", "doing", "started":
+		return models.StatusInProgress
+	case "done", "completed", "complete", "closed", "finished":
+		return models.StatusDone
+	}
+	return models.TodoStatus(strings.TrimSpace(value))
+}
+
+// readCSV calls fn for every record after the header. get looks up a cell by case-insensitive column name.
+func readCSV(r io.Reader, fn func(row int, get func(column string) string) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%w: file is empty", ErrInvalidImportFile)
+		}
+		return fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for row := 2; ; row++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+		get := func(column string) string {
+			i, ok := columns[strings.ToLower(column)]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		if err := fn(row, get); err != nil {
+			return err
+		}
+	}
+}
+
+// parseImportMapping decodes the field-to-column mapping, defaulting to the export column names
+func parseImportMapping(raw string) (map[string]string, error) {
+	mapping := make(map[string]string, len(importFields))
+	for _, field := range importFields {
+		mapping[field] = field
+	}
+	if raw == "" {
+		return mapping, nil
+	}
+
+	var custom map[string]string
+	if err := json.Unmarshal([]byte(raw), &custom); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImportMapping, err)
+	}
+	for field, column := range custom {
+		if _, ok := mapping[field]; !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidImportMapping, field)
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+func parseMappedCSV(r io.Reader, mapping map[string]string, fn func(importRow) error) error {
+	return readCSV(r, func(row int, get func(string) string) error {
+		parsed := importRow{
+			Row: row,
+			Todo: models.CreateTodoRequest{
+				Title:       get(mapping["title"]),
+				Description: get(mapping["description"]),
+				ImageURL:    get(mapping["image_url"]),
+			},
+		}
+		parsed.Status = parseImportStatus(get(mapping["status"]))
+		dueDate, err := parseImportDate(get(mapping["due_date"]))
+		if err != nil {
+			parsed.Errors = append(parsed.Errors, models.ImportRowError{Row: row, Field: "due_date", Message: err.Error()})
+		}
+		parsed.Todo.DueDate = dueDate
+		return fn(parsed)
+	})
+}
+
+// parseTodoistCSV reads a Todoist project CSV export. Only task rows are imported; Todoist
+// recurring or natural-language dates that can't be parsed are dropped rather than rejected.
+func parseTodoistCSV(r io.Reader, fn func(importRow) error) error {
+	return readCSV(r, func(row int, get func(string) string) error {
+		if !strings.EqualFold(get("TYPE"), "task") {
+			return nil
+		}
+		dueDate, _ := parseImportDate(get("DATE"))
+		return fn(importRow{
+			Row:    row,
+			Status: models.StatusPending,
+			Todo: models.CreateTodoRequest{
+				Title:       get("CONTENT"),
+				Description: get("DESCRIPTION"),
+				DueDate:     dueDate,
+			},
+		})
+	})
+}
+
+// trelloBoard holds the parts of a Trello board JSON export used by the import
+type trelloBoard struct {
+	Lists []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"lists"`
+	Cards []struct {
+		Name        string     `json:"name"`
+		Desc        string     `json:"desc"`
+		Due         *time.Time `json:"due"`
+		DueComplete bool       `json:"dueComplete"`
+		Closed      bool       `json:"closed"`
+		IDList      string     `json:"idList"`
+	} `json:"cards"`
+}
+
+// trelloListStatus guesses a status from the name of the Trello list a card is in
+func trelloListStatus(listName string) models.TodoStatus {
+	name := strings.ToLower(listName)
+	switch {
+	case strings.Contains(name, "done"), strings.Contains(name, "complete"):
+		return models.StatusDone
+	case strings.Contains(name, "doing"), strings.Contains(name, "progress"):
+		return models.StatusInProgress
+	default:
+		return models.StatusPending
+	}
+}
+
+// parseTrelloJSON reads a Trello board export; archived cards are skipped and rows are numbered by card
+func parseTrelloJSON(r io.Reader, fn func(importRow) error) error {
+	var board trelloBoard
+	if err := json.NewDecoder(r).Decode(&board); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+
+	listNames := make(map[string]string, len(board.Lists))
+	for _, list := range board.Lists {
+		listNames[list.ID] = list.Name
+	}
+
+	for i, card := range board.Cards {
+		if card.Closed {
+			continue
+		}
+		status := trelloListStatus(listNames[card.IDList])
+		if card.DueComplete {
+			status = models.StatusDone
+		}
+		err := fn(importRow{
+			Row:    i + 1,
+			Status: status,
+			Todo: models.CreateTodoRequest{
+				Title:       card.Name,
+				Description: card.Desc,
+				DueDate:     card.Due,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseExportJSON streams the todos array of a document produced by the JSON export
+func parseExportJSON(r io.Reader, fn func(importRow) error) error {
+	dec := json.NewDecoder(r)
+	invalid := func(err error) error {
+		return fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return invalid(errors.New("expected a JSON object"))
+	}
+	for dec.More() {
+		keyToken, err := dec.Token()
+		if err != nil {
+			return invalid(err)
+		}
+		switch key, _ := keyToken.(string); key {
+		case "kind":
+			var kind string
+			if err := dec.Decode(&kind); err != nil {
+				return invalid(err)
+			}
+			if kind != models.TodoExportKind {
+				return invalid(fmt.Errorf("unexpected kind %q", kind))
+			}
+		case "version":
+			var version int
+			if err := dec.Decode(&version); err != nil {
+				return invalid(err)
+			}
+			if version > models.TodoExportVersion {
+				return invalid(fmt.Errorf("unsupported export version %d", version))
+			}
+		case "todos":
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+				return invalid(errors.New("expected todos to be an array"))
+			}
+			for row := 1; dec.More(); row++ {
+				var todo models.ExportedTodo
+				if err := dec.Decode(&todo); err != nil {
+					return invalid(fmt.Errorf("todo %d: %v", row, err))
+				}
+				parsed := importRow{
+					Row:         row,
+					Status:      parseImportStatus(string(todo.Status)),
+					CompletedAt: todo.CompletedAt,
+					CreatedAt:   todo.CreatedAt,
+					UpdatedAt:   todo.UpdatedAt,
+					Todo: models.CreateTodoRequest{
+						Title:       todo.Title,
+						Description: todo.Description,
+						ImageURL:    todo.ImageURL,
+						DueDate:     todo.DueDate,
+					},
+				}
+				if err := fn(parsed); err != nil {
+					return err
+				}
+			}
+			if _, err := dec.Token(); err != nil {
+				return invalid(err)
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return invalid(err)
+			}
+		}
+	}
+	return nil
+}
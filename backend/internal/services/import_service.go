@@ -0,0 +1,406 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxImportFileSize is the largest file accepted by the import endpoint
+	MaxImportFileSize = 20 * 1024 * 1024
+	// AsyncImportThreshold is the file size above which imports run as a background job
+	AsyncImportThreshold = 1024 * 1024
+
+	maxImportRows          = 50000
+	maxReportedImportError = 100
+	importPreviewSize      = 20
+	importProgressInterval = 500
+)
+
+var (
+	ErrInvalidImportFile    = errors.New("invalid import file")
+	ErrInvalidImportMapping = errors.New("invalid column mapping")
+	ErrImportTooManyRows    = fmt.Errorf("import files are limited to %d rows", maxImportRows)
+	ErrImportJobNotFound    = errors.New("import job not found")
+)
+
+type ImportService interface {
+	ImportTodos(ctx context.Context, userID uint, req models.ImportRequest, src io.Reader) (*models.ImportResult, error)
+	// StartImportJob stores the file read from src and queues its import as a background job
+	StartImportJob(ctx context.Context, userID uint, req models.ImportRequest, filename string, src io.Reader) (*models.ImportJob, error)
+	// RunImportJob imports the file of a queued import job
+	RunImportJob(ctx context.Context, job ImportJobPayload) error
+	GetImportJob(ctx context.Context, userID uint, jobID string) (*models.ImportJob, error)
+}
+
+// ImportJobPayload is the job queue payload of a background import. The tenant is carried along
+// because the job runs outside the request that started it.
+type ImportJobPayload struct {
+	JobID   string               `json:"job_id"`
+	Request models.ImportRequest `json:"request"`
+	Tenant  models.Tenant        `json:"tenant"`
+}
+
+type importService struct {
+	todoRepo      repositories.TodoRepository
+	statusRepo    repositories.StatusRepository
+	importJobRepo repositories.ImportJobRepository
+	jobs          JobQueue
+	cfg           *config.Config
+	validate      *validator.Validate
+}
+
+func NewImportService(todoRepo repositories.TodoRepository, statusRepo repositories.StatusRepository, importJobRepo repositories.ImportJobRepository, jobs JobQueue, cfg *config.Config) ImportService {
+	validate := validator.New()
+	// Report JSON field names in row errors
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	})
+	return &importService{todoRepo: todoRepo, statusRepo: statusRepo, importJobRepo: importJobRepo, jobs: jobs, cfg: cfg, validate: validate}
+}
+
+// ImportTodos parses and validates every row, then creates all todos in one transaction.
+// Nothing is written when the request is a dry run or when any row is invalid.
+func (s *importService) ImportTodos(ctx context.Context, userID uint, req models.ImportRequest, src io.Reader) (*models.ImportResult, error) {
+	return s.run(ctx, userID, req, src, nil, nil)
+}
+
+// run parses and imports src. finish, when set, records the result; when todos are created it runs
+// in their transaction, so a job is never left unfinished with its todos already imported.
+func (s *importService) run(ctx context.Context, userID uint, req models.ImportRequest, src io.Reader, progress func(processed int), finish func(ctx context.Context, result *models.ImportResult) error) (*models.ImportResult, error) {
+	if finish == nil {
+		finish = func(context.Context, *models.ImportResult) error { return nil }
+	}
+
+	result := &models.ImportResult{DryRun: req.DryRun, Errors: []models.ImportRowError{}}
+	var todos []models.Todo
+	statuses, err := loadStatuses(ctx, s.statusRepo)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	collect := func(row importRow) error {
+		result.TotalRows++
+		if result.TotalRows > maxImportRows {
+			return ErrImportTooManyRows
+		}
+
+		rowErrors := append(row.Errors, s.validateRow(row)...)
+		status := importStatus(statuses, row.Status)
+		if status == nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row.Row, Field: "status", Message: "unknown status"})
+		}
+		if len(rowErrors) > 0 {
+			result.ErrorCount++
+			if room := maxReportedImportError - len(result.Errors); room > 0 {
+				result.Errors = append(result.Errors, rowErrors[:min(room, len(rowErrors))]...)
+			}
+		} else {
+			result.ValidRows++
+			todo := models.Todo{
+				CreatedAt:   row.CreatedAt,
+				UpdatedAt:   row.UpdatedAt,
+				Title:       row.Todo.Title,
+				Description: row.Todo.Description,
+				ImageURL:    row.Todo.ImageURL,
+				DueDate:     row.Todo.DueDate,
+				Status:      status.Name,
+				UserID:      userID,
+			}
+			if status.IsDone {
+				todo.CompletedAt = importCompletedAt(row, now)
+			}
+			todos = append(todos, todo)
+			if len(result.Preview) < importPreviewSize {
+				result.Preview = append(result.Preview, models.ImportPreviewItem{
+					Row:         row.Row,
+					Title:       row.Todo.Title,
+					Description: row.Todo.Description,
+					ImageURL:    row.Todo.ImageURL,
+					Status:      status.Name,
+					DueDate:     row.Todo.DueDate,
+				})
+			}
+		}
+
+		if progress != nil && result.TotalRows%importProgressInterval == 0 {
+			progress(result.TotalRows)
+		}
+		return nil
+	}
+
+	if err := s.parse(req, src, collect); err != nil {
+		return nil, err
+	}
+
+	if req.DryRun || result.ErrorCount > 0 || len(todos) == 0 {
+		return result, finish(ctx, result)
+	}
+
+	err = s.todoRepo.InTransaction(ctx, userID, func(ctx context.Context) error {
+		if err := checkTodoQuota(ctx, s.todoRepo, len(todos)); err != nil {
+			return err
+		}
+		// Imported todos go to the end of their columns, in file order
+		next := make(map[models.TodoStatus]int)
+		for i := range todos {
+			position, ok := next[todos[i].Status]
+			if !ok {
+				var err error
+				if position, err = s.todoRepo.NextPosition(ctx, todos[i].Status); err != nil {
+					return err
+				}
+			}
+			todos[i].Position = position
+			next[todos[i].Status] = position + 1
+		}
+		if err := s.todoRepo.CreateTodos(ctx, userID, todos); err != nil {
+			return fmt.Errorf("failed to create imported todos: %w", err)
+		}
+		result.ImportedRows = len(todos)
+		return finish(ctx, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// importStatus returns the list's status a row's status names. Default statuses the list has
+// renamed or removed map to its first open or done status; other unknown names give nil.
+func importStatus(statuses []models.StatusDefinition, name models.TodoStatus) *models.StatusDefinition {
+	if status := findStatus(statuses, name); status != nil {
+		return status
+	}
+	switch name {
+	case models.StatusPending, models.StatusInProgress:
+		return firstStatus(statuses, false)
+	case models.StatusDone:
+		return firstStatus(statuses, true)
+	}
+	return nil
+}
+
+// importCompletedAt returns when a done row was completed, falling back to its last update
+func importCompletedAt(row importRow, now time.Time) *time.Time {
+	switch {
+	case row.CompletedAt != nil:
+		return row.CompletedAt
+	case !row.UpdatedAt.IsZero():
+		return &row.UpdatedAt
+	}
+	return &now
+}
+
+func (s *importService) parse(req models.ImportRequest, src io.Reader, fn func(importRow) error) error {
+	switch req.Format {
+	case models.ImportCSV:
+		mapping, err := parseImportMapping(req.Mapping)
+		if err != nil {
+			return err
+		}
+		return parseMappedCSV(src, mapping, fn)
+	case models.ImportJSON:
+		return parseExportJSON(src, fn)
+	case models.ImportTodoist:
+		return parseTodoistCSV(src, fn)
+	case models.ImportTrello:
+		return parseTrelloJSON(src, fn)
+	default:
+		return fmt.Errorf("%w: unsupported format %q", ErrInvalidImportFile, req.Format)
+	}
+}
+
+// validateRow applies the same rules as the create endpoint
+func (s *importService) validateRow(row importRow) []models.ImportRowError {
+	err := s.validate.Struct(row.Todo)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []models.ImportRowError{{Row: row.Row, Message: err.Error()}}
+	}
+	rowErrors := make([]models.ImportRowError, 0, len(validationErrors))
+	for _, fieldErr := range validationErrors {
+		message := fmt.Sprintf("failed '%s' validation", fieldErr.Tag())
+		if fieldErr.Param() != "" {
+			message = fmt.Sprintf("failed '%s=%s' validation", fieldErr.Tag(), fieldErr.Param())
+		}
+		rowErrors = append(rowErrors, models.ImportRowError{Row: row.Row, Field: fieldErr.Field(), Message: message})
+	}
+	return rowErrors
+}
+
+func (s *importService) StartImportJob(ctx context.Context, userID uint, req models.ImportRequest, filename string, src io.Reader) (*models.ImportJob, error) {
+	tenant, ok := repositories.TenantFromContext(ctx)
+	if !ok {
+		return nil, repositories.ErrMissingTenant
+	}
+	job := &models.ImportJob{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		WorkspaceID: tenant.WorkspaceID,
+		Format:      req.Format,
+		Filename:    filename,
+		Status:      models.ImportJobPending,
+		ImportResult: models.ImportResult{
+			DryRun: req.DryRun,
+			Errors: []models.ImportRowError{},
+		},
+	}
+
+	// Workers read the file from IMPORT_UPLOAD_DIR, which they share with the API processes
+	path := s.uploadPath(job.ID)
+	if err := saveImportFile(path, src); err != nil {
+		return nil, fmt.Errorf("failed to save import file: %w", err)
+	}
+	if err := s.importJobRepo.CreateImportJob(ctx, job); err != nil {
+		removeImportFile(path)
+		return nil, err
+	}
+
+	payload := ImportJobPayload{JobID: job.ID, Request: req, Tenant: tenant}
+	if _, err := s.jobs.Enqueue(ctx, JobRunImport, payload, JobOptions{}); err != nil {
+		job.Status = models.ImportJobFailed
+		job.Message = "Import failed"
+		if err := s.importJobRepo.UpdateImportJob(ctx, job); err != nil {
+			log.Printf("ERROR: Failed to mark import job %s as failed: %v", job.ID, err)
+		}
+		removeImportFile(path)
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *importService) uploadPath(jobID string) string {
+	return filepath.Join(s.cfg.ImportUploadDir, jobID)
+}
+
+func saveImportFile(path string, src io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, src); err != nil {
+		file.Close()
+		removeImportFile(path)
+		return err
+	}
+	return file.Close()
+}
+
+func removeImportFile(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("WARNING: Failed to remove import file %s: %v", path, err)
+	}
+}
+
+// RunImportJob returns an error only when the job's outcome could not be recorded, so the queue
+// retries it. The job is completed in the transaction that creates its todos, so a job
+// interrupted while running, such as by a restart, has imported nothing and is run again from
+// its file.
+func (s *importService) RunImportJob(ctx context.Context, payload ImportJobPayload) error {
+	ctx = repositories.WithTenant(ctx, payload.Tenant)
+	path := s.uploadPath(payload.JobID)
+
+	job, err := s.importJobRepo.FindImportJobByID(ctx, payload.JobID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			removeImportFile(path)
+			return nil
+		}
+		return err
+	}
+	if job.Status == models.ImportJobCompleted || job.Status == models.ImportJobFailed {
+		removeImportFile(path)
+		return nil
+	}
+
+	job.Status = models.ImportJobRunning
+	if err := s.importJobRepo.UpdateImportJob(ctx, job); err != nil {
+		return fmt.Errorf("failed to mark import job %s as running: %w", job.ID, err)
+	}
+
+	var finishErr error
+	_, err = s.runFile(ctx, *job, payload.Request, path, func(ctx context.Context, result *models.ImportResult) error {
+		now := time.Now()
+		completed := *job
+		completed.Status = models.ImportJobCompleted
+		completed.FinishedAt = &now
+		completed.ImportResult = *result
+		completed.ProcessedRows = result.TotalRows
+		if finishErr = s.importJobRepo.UpdateImportJob(ctx, &completed); finishErr != nil {
+			return finishErr
+		}
+		*job = completed
+		return nil
+	})
+	if finishErr != nil {
+		return fmt.Errorf("failed to save result of import job %s: %w", job.ID, finishErr)
+	}
+	if err != nil {
+		log.Printf("ERROR: Import job %s failed: %v", job.ID, err)
+		now := time.Now()
+		job.FinishedAt = &now
+		job.Status = models.ImportJobFailed
+		job.Message = "Import failed"
+		if errors.Is(err, ErrInvalidImportFile) || errors.Is(err, ErrInvalidImportMapping) || errors.Is(err, ErrImportTooManyRows) || errors.Is(err, ErrWorkspaceTodoQuota) {
+			job.Message = err.Error()
+		}
+		if err := s.importJobRepo.UpdateImportJob(ctx, job); err != nil {
+			return fmt.Errorf("failed to save result of import job %s: %w", job.ID, err)
+		}
+	}
+	removeImportFile(path)
+	return nil
+}
+
+func (s *importService) runFile(ctx context.Context, job models.ImportJob, req models.ImportRequest, path string, finish func(ctx context.Context, result *models.ImportResult) error) (*models.ImportResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return s.run(ctx, job.UserID, req, file, func(processed int) {
+		if err := s.importJobRepo.UpdateImportProgress(ctx, job.ID, processed); err != nil {
+			log.Printf("WARNING: Failed to update progress of import job %s: %v", job.ID, err)
+		}
+	}, finish)
+}
+
+func (s *importService) GetImportJob(ctx context.Context, userID uint, jobID string) (*models.ImportJob, error) {
+	job, err := s.importJobRepo.FindImportJobByID(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImportJobNotFound
+		}
+		return nil, err
+	}
+	// Don't reveal other users' jobs
+	if job.UserID != userID {
+		return nil, ErrImportJobNotFound
+	}
+	return job, nil
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"log"
+	mathrand "math/rand/v2"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxJobRetryDelay caps the exponential backoff between attempts
+const maxJobRetryDelay = 6 * time.Hour
+
+var ErrUnknownJobType = errors.New("no handler registered for job type")
+
+// JobHandler runs one job. Returning an error retries the job with backoff until it runs out
+// of attempts and is moved to the dead-letter state.
+type JobHandler func(ctx context.Context, payload []byte) error
+
+// JobOptions adjusts how a job is queued; the zero value runs it now with the default attempts
+type JobOptions struct {
+	RunAt       time.Time
+	MaxAttempts int
+	// UniqueKey keeps a second copy of the job from being queued until the first finishes
+	UniqueKey string
+}
+
+// JobQueue is a durable queue of background jobs stored in Postgres. Any number of API or
+// worker processes can run it; each job is claimed by one of them.
+type JobQueue interface {
+	// Handle registers the handler of a job type. Register every type before Run.
+	Handle(jobType string, handler JobHandler)
+	// Enqueue queues a job with payload encoded as JSON. It reports false when a job with the
+	// same unique key is already queued.
+	Enqueue(ctx context.Context, jobType string, payload any, opts JobOptions) (bool, error)
+	// Schedule queues jobType on a cron schedule, such as "0 3 * * *" or "@every 15m",
+	// evaluated in the server's TIME_ZONE
+	Schedule(name, spec, jobType string) error
+	// PurgeFinished deletes succeeded jobs older than the configured retention
+	PurgeFinished(ctx context.Context) (int64, error)
+	// Run claims and runs jobs and fires schedules until ctx is done
+	Run(ctx context.Context)
+}
+
+type jobSchedule struct {
+	name     string
+	jobType  string
+	schedule *utils.CronSchedule
+}
+
+type jobQueue struct {
+	jobRepo   repositories.JobRepository
+	cfg       *config.Config
+	workerID  string
+	location  *time.Location
+	mu        sync.RWMutex
+	handlers  map[string]JobHandler
+	schedules []jobSchedule
+}
+
+func NewJobQueue(jobRepo repositories.JobRepository, cfg *config.Config) JobQueue {
+	location, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		log.Printf("WARNING: Unknown TIME_ZONE %q, job schedules use UTC: %v", cfg.TimeZone, err)
+		location = time.UTC
+	}
+	return &jobQueue{
+		jobRepo:  jobRepo,
+		cfg:      cfg,
+		workerID: newWorkerID(),
+		location: location,
+		handlers: make(map[string]JobHandler),
+	}
+}
+
+// newWorkerID identifies this process in the locked_by column of the jobs it runs
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+func (q *jobQueue) Handle(jobType string, handler JobHandler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+func (q *jobQueue) Enqueue(ctx context.Context, jobType string, payload any, opts JobOptions) (bool, error) {
+	job, err := q.newJob(jobType, payload, opts)
+	if err != nil {
+		return false, err
+	}
+	return q.jobRepo.EnqueueJob(ctx, job)
+}
+
+func (q *jobQueue) newJob(jobType string, payload any, opts JobOptions) (*models.Job, error) {
+	encoded := []byte("{}")
+	if payload != nil {
+		var err error
+		if encoded, err = json.Marshal(payload); err != nil {
+			return nil, fmt.Errorf("failed to encode %s job payload: %w", jobType, err)
+		}
+	}
+
+	job := &models.Job{
+		Type:        jobType,
+		Payload:     string(encoded),
+		Status:      models.JobPending,
+		RunAt:       opts.RunAt,
+		MaxAttempts: opts.MaxAttempts,
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = q.cfg.JobMaxAttempts
+	}
+	if opts.UniqueKey != "" {
+		job.UniqueKey = &opts.UniqueKey
+	}
+	return job, nil
+}
+
+func (q *jobQueue) Schedule(name, spec, jobType string) error {
+	schedule, err := utils.ParseCron(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule for %s: %w", name, err)
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return fmt.Errorf("schedule %q of %s never runs", spec, name)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.schedules = append(q.schedules, jobSchedule{name: name, jobType: jobType, schedule: schedule})
+	return nil
+}
+
+func (q *jobQueue) PurgeFinished(ctx context.Context) (int64, error) {
+	return q.jobRepo.DeleteFinishedJobs(ctx, time.Now().Add(-q.cfg.JobRetention))
+}
+
+func (q *jobQueue) Run(ctx context.Context) {
+	q.mu.RLock()
+	schedules := q.schedules
+	q.mu.RUnlock()
+
+	now := time.Now().In(q.location)
+	for _, s := range schedules {
+		if err := q.jobRepo.EnsureSchedule(ctx, s.name, s.schedule.Next(now)); err != nil {
+			log.Printf("ERROR: Failed to register job schedule %s: %v", s.name, err)
+		}
+	}
+
+	log.Printf("INFO: Job worker %s started with %d concurrent job(s)", q.workerID, q.cfg.JobWorkerConcurrency)
+	var wg sync.WaitGroup
+	for range max(q.cfg.JobWorkerConcurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	q.tend(ctx, schedules)
+	wg.Wait()
+	log.Printf("INFO: Job worker %s stopped", q.workerID)
+}
+
+// work claims and runs one job at a time, waiting a poll interval whenever the queue is empty
+func (q *jobQueue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		jobs, err := q.jobRepo.ClaimJobs(ctx, q.workerID, 1, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("ERROR: Failed to claim jobs: %v", err)
+		}
+		if len(jobs) == 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(q.cfg.JobPollInterval):
+			}
+			continue
+		}
+		// A claimed job is finished even while shutting down so it is not left locked
+		q.runJob(context.WithoutCancel(ctx), &jobs[0])
+	}
+}
+
+// tend fires due schedules and releases jobs of dead workers until ctx is done
+func (q *jobQueue) tend(ctx context.Context, schedules []jobSchedule) {
+	ticker := time.NewTicker(q.cfg.JobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now().In(q.location)
+		for _, s := range schedules {
+			q.fire(ctx, s, now)
+		}
+		// A job is only stale once its handler's deadline has passed
+		requeued, buried, err := q.jobRepo.RequeueStaleJobs(ctx, now.Add(-q.cfg.JobTimeout-time.Minute), now)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("ERROR: Failed to requeue stale jobs: %v", err)
+			}
+		} else {
+			if requeued > 0 {
+				log.Printf("WARNING: Requeued %d job(s) left running by a stopped worker", requeued)
+			}
+			if buried > 0 {
+				log.Printf("ERROR: Moved %d job(s) left running by a stopped worker on their last attempt to the dead-letter state", buried)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *jobQueue) fire(ctx context.Context, s jobSchedule, now time.Time) {
+	job, err := q.newJob(s.jobType, nil, JobOptions{RunAt: now, UniqueKey: "schedule:" + s.name})
+	if err != nil {
+		log.Printf("ERROR: Failed to create job for schedule %s: %v", s.name, err)
+		return
+	}
+	if _, err := q.jobRepo.FireSchedule(ctx, s.name, now, s.schedule.Next(now), job); err != nil && ctx.Err() == nil {
+		log.Printf("ERROR: Failed to fire job schedule %s: %v", s.name, err)
+	}
+}
+
+func (q *jobQueue) runJob(ctx context.Context, job *models.Job) {
+	q.mu.RLock()
+	handler, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+
+	var err error
+	if !ok {
+		err = fmt.Errorf("%w: %s", ErrUnknownJobType, job.Type)
+	} else {
+		err = q.call(ctx, handler, job)
+	}
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		err = q.jobRepo.CompleteJob(ctx, job.ID, q.workerID, now)
+	case job.Attempts >= job.MaxAttempts:
+		log.Printf("ERROR: Job %d (%s) failed on its last attempt and was moved to the dead-letter state: %v", job.ID, job.Type, err)
+		err = q.jobRepo.BuryJob(ctx, job.ID, q.workerID, err.Error(), now)
+	default:
+		delay := retryDelay(q.cfg.JobRetryBaseDelay, job.Attempts)
+		log.Printf("WARNING: Job %d (%s) failed on attempt %d/%d, retrying in %s: %v", job.ID, job.Type, job.Attempts, job.MaxAttempts, delay, err)
+		err = q.jobRepo.RetryJob(ctx, job.ID, q.workerID, now.Add(delay), err.Error())
+	}
+	if errors.Is(err, repositories.ErrJobNotLocked) {
+		log.Printf("WARNING: Job %d (%s) was released as stale while running; its outcome is left to the worker that claimed it again", job.ID, job.Type)
+	} else if err != nil {
+		log.Printf("ERROR: Failed to record the outcome of job %d: %v", job.ID, err)
+	}
+}
+
+// call runs handler under the job timeout, turning a panic into an error
+func (q *jobQueue) call(ctx context.Context, handler JobHandler, job *models.Job) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, q.cfg.JobTimeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, []byte(job.Payload))
+}
+
+// retryDelay doubles the base delay with every attempt, with up to 10% jitter so jobs that
+// failed together do not retry together
+func retryDelay(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxJobRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxJobRetryDelay)
+	return delay + time.Duration(mathrand.Int64N(int64(delay)/10+1))
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"log"
+	"time"
+)
+
+// Job types of the background work run by the job queue
+const (
+	JobSendDueReminders    = "todos.send_due_reminders"
+	JobDispatchDigests     = "digests.dispatch"
+	JobSendDigest          = "digests.send"
+	JobSendPush            = "push.send"
+	JobPurgeDueAccounts    = "accounts.purge_due"
+	JobPurgeExpiredExports = "exports.purge_expired"
+	JobPurgeFinishedJobs   = "jobs.purge_finished"
+	JobPurgeSyncReceipts   = "sync.purge_receipts"
+	JobRunImport           = "imports.run"
+	JobRunDataExport       = "exports.run"
+)
+
+// RegisterJobs registers the handlers and schedules of the application's background jobs. Every
+// process running the queue registers them, so any worker can run any job.
+func RegisterJobs(queue JobQueue, todoService TodoService, syncService SyncService, importService ImportService, accountService AccountService, digestService DigestService, pushService PushService, cfg *config.Config) error {
+	queue.Handle(JobSendDueReminders, func(ctx context.Context, _ []byte) error {
+		sent, err := todoService.SendDueReminders(ctx, time.Now())
+		if sent > 0 {
+			log.Printf("INFO: Sent %d due reminder(s)", sent)
+		}
+		return err
+	})
+	queue.Handle(JobDispatchDigests, func(ctx context.Context, _ []byte) error {
+		_, err := digestService.DispatchDigests(ctx, time.Now())
+		return err
+	})
+	queue.Handle(JobSendDigest, func(ctx context.Context, payload []byte) error {
+		var job digestJob
+		if err := json.Unmarshal(payload, &job); err != nil {
+			return fmt.Errorf("invalid digest job payload: %w", err)
+		}
+		return digestService.SendDigest(ctx, job.UserID, job.Date)
+	})
+	queue.Handle(JobSendPush, func(ctx context.Context, payload []byte) error {
+		var job pushJob
+		if err := json.Unmarshal(payload, &job); err != nil {
+			return fmt.Errorf("invalid push job payload: %w", err)
+		}
+		return pushService.Deliver(ctx, job.SubscriptionID, job.Message)
+	})
+	queue.Handle(JobRunImport, func(ctx context.Context, payload []byte) error {
+		var job ImportJobPayload
+		if err := json.Unmarshal(payload, &job); err != nil {
+			return fmt.Errorf("invalid import job payload: %w", err)
+		}
+		return importService.RunImportJob(ctx, job)
+	})
+	queue.Handle(JobRunDataExport, func(ctx context.Context, payload []byte) error {
+		var job dataExportJob
+		if err := json.Unmarshal(payload, &job); err != nil {
+			return fmt.Errorf("invalid data export job payload: %w", err)
+		}
+		return accountService.RunDataExport(ctx, job.ExportID)
+	})
+	queue.Handle(JobPurgeDueAccounts, func(ctx context.Context, _ []byte) error {
+		purged, err := accountService.PurgeDueAccounts(ctx)
+		if purged > 0 {
+			log.Printf("INFO: Deleted %d account(s) after their cooling-off period", purged)
+		}
+		return err
+	})
+	queue.Handle(JobPurgeExpiredExports, func(ctx context.Context, _ []byte) error {
+		purged, err := accountService.PurgeExpiredExports(ctx)
+		if purged > 0 {
+			log.Printf("INFO: Removed %d expired data export(s)", purged)
+		}
+		return err
+	})
+	queue.Handle(JobPurgeSyncReceipts, func(ctx context.Context, _ []byte) error {
+		purged, err := syncService.PurgeReceipts(ctx, time.Now())
+		if purged > 0 {
+			log.Printf("INFO: Removed %d old sync receipt(s)", purged)
+		}
+		return err
+	})
+	queue.Handle(JobPurgeFinishedJobs, func(ctx context.Context, _ []byte) error {
+		purged, err := queue.PurgeFinished(ctx)
+		if purged > 0 {
+			log.Printf("INFO: Removed %d finished job(s)", purged)
+		}
+		return err
+	})
+
+	schedules := []struct{ name, spec, jobType string }{
+		{"due-reminders", fmt.Sprintf("@every %s", cfg.DueReminderInterval), JobSendDueReminders},
+		{"digests", fmt.Sprintf("@every %s", cfg.DigestCheckInterval), JobDispatchDigests},
+		{"account-deletions", fmt.Sprintf("@every %s", cfg.AccountMaintenanceInterval), JobPurgeDueAccounts},
+		{"expired-exports", fmt.Sprintf("@every %s", cfg.AccountMaintenanceInterval), JobPurgeExpiredExports},
+		{"job-cleanup", cfg.JobCleanupSchedule, JobPurgeFinishedJobs},
+		{"sync-receipts", cfg.JobCleanupSchedule, JobPurgeSyncReceipts},
+	}
+	for _, s := range schedules {
+		if err := queue.Schedule(s.name, s.spec, s.jobType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// loginDelayThreshold is the number of failures allowed before attempts are delayed
+	loginDelayThreshold = 3
+	loginBaseDelay      = time.Second
+	loginMaxDelay       = 30 * time.Second
+)
+
+var (
+	ErrAccountLocked        = errors.New("account is temporarily locked after too many failed login attempts")
+	ErrTooManyLoginAttempts = errors.New("too many failed login attempts, try again later")
+	ErrInvalidUnlockToken   = errors.New("invalid or expired unlock token")
+)
+
+// LoginBlockedError is returned when a login attempt is refused before checking credentials
+type LoginBlockedError struct {
+	Reason     error
+	RetryAfter time.Duration
+}
+
+func (e *LoginBlockedError) Error() string {
+	return e.Reason.Error()
+}
+
+func (e *LoginBlockedError) Unwrap() error {
+	return e.Reason
+}
+
+// LoginGuard tracks failed logins per account and per client IP. Repeated failures delay
+// further attempts progressively and eventually lock the account.
+type LoginGuard interface {
+	// Check refuses logins to a locked or throttled account without counting an attempt
+	Check(ctx context.Context, email string, client models.ClientInfo) error
+	// BeginAttempt is Check for an attempt that is about to verify a secret. It counts the attempt
+	// as failed in the same step, so parallel attempts cannot all pass the check; end it with
+	// RecordFailure, RecordSuccess or ReleaseAttempt.
+	BeginAttempt(ctx context.Context, email string, client models.ClientInfo) error
+	// RecordFailure locks the account once a failed attempt used up its failures
+	RecordFailure(ctx context.Context, email string, user *models.User, client models.ClientInfo) error
+	RecordSuccess(ctx context.Context, email string) error
+	// ReleaseAttempt takes back an attempt whose secret was right but that did not log in yet,
+	// such as a password awaiting the second factor
+	ReleaseAttempt(ctx context.Context, email string) error
+	UnlockWithToken(ctx context.Context, token string, client models.ClientInfo) error
+	UnlockAccount(ctx context.Context, email string, client models.ClientInfo) error
+	// ClearLockout lifts a lockout without recording it, for callers that record who lifted it
+	ClearLockout(ctx context.Context, email string) error
+	// ForgetAccount drops the failure counters kept for an erased account
+	ForgetAccount(ctx context.Context, email string) error
+}
+
+type loginGuard struct {
+	store     repositories.LoginThrottleStore
+	userRepo  repositories.UserRepository
+	eventRepo repositories.SecurityEventRepository
+	mailer    utils.Mailer
+	keys      *utils.KeyRing
+	cfg       *config.Config
+}
+
+func NewLoginGuard(store repositories.LoginThrottleStore, userRepo repositories.UserRepository, eventRepo repositories.SecurityEventRepository, mailer utils.Mailer, keys *utils.KeyRing, cfg *config.Config) LoginGuard {
+	return &loginGuard{store: store, userRepo: userRepo, eventRepo: eventRepo, mailer: mailer, keys: keys, cfg: cfg}
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// progressiveLoginDelay doubles the wait after each failure past the threshold
+func progressiveLoginDelay(failures int) time.Duration {
+	if failures < loginDelayThreshold {
+		return 0
+	}
+	delay := loginBaseDelay
+	for i := loginDelayThreshold; i < failures && delay < loginMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, loginMaxDelay)
+}
+
+// throttleAllows returns the check an attempt must pass against its counter: the counter is not
+// locked and its progressive delay has passed. A counter that used up its failures and was never
+// locked is refused as locked, since the lock is being set by the attempt that used them up.
+func throttleAllows(cfg *config.Config, now time.Time, locked, delayed error) func(throttle *models.LoginThrottle) error {
+	return func(throttle *models.LoginThrottle) error {
+		if throttle.IsLocked(now) {
+			return &LoginBlockedError{Reason: locked, RetryAfter: throttle.LockedUntil.Sub(now)}
+		}
+		if throttle.LastFailureAt.Before(now.Add(-cfg.LoginFailureWindow)) {
+			return nil
+		}
+		if throttle.LockedUntil == nil && throttle.Failures >= cfg.LoginMaxFailures {
+			return &LoginBlockedError{Reason: locked, RetryAfter: cfg.LoginLockoutDuration}
+		}
+		if retryAt := throttle.LastFailureAt.Add(progressiveLoginDelay(throttle.Failures)); retryAt.After(now) {
+			return &LoginBlockedError{Reason: delayed, RetryAfter: retryAt.Sub(now)}
+		}
+		return nil
+	}
+}
+
+func (g *loginGuard) Check(ctx context.Context, email string, client models.ClientInfo) error {
+	now := time.Now()
+
+	account, err := g.store.Get(ctx, accountThrottleKey(email))
+	if err != nil {
+		return err
+	}
+	if err := throttleAllows(g.cfg, now, ErrAccountLocked, ErrTooManyLoginAttempts)(account); err != nil {
+		return err
+	}
+	return g.checkIP(ctx, client, now)
+}
+
+func (g *loginGuard) BeginAttempt(ctx context.Context, email string, client models.ClientInfo) error {
+	now := time.Now()
+	if err := g.checkIP(ctx, client, now); err != nil {
+		return err
+	}
+	_, err := g.store.Reserve(ctx, accountThrottleKey(email), now, g.cfg.LoginFailureWindow, throttleAllows(g.cfg, now, ErrAccountLocked, ErrTooManyLoginAttempts))
+	return err
+}
+
+func (g *loginGuard) checkIP(ctx context.Context, client models.ClientInfo, now time.Time) error {
+	if client.IP == "" {
+		return nil
+	}
+	ip, err := g.store.Get(ctx, ipThrottleKey(client.IP))
+	if err != nil {
+		return err
+	}
+	if ip.Failures >= g.cfg.LoginIPMaxFailures {
+		if retryAt := ip.LastFailureAt.Add(g.cfg.LoginFailureWindow); retryAt.After(now) {
+			return &LoginBlockedError{Reason: ErrTooManyLoginAttempts, RetryAfter: retryAt.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// RecordFailure ends an attempt begun with BeginAttempt, which already counted it against the
+// account, and counts it against the client IP; user is nil when the email does not belong to an
+// account
+func (g *loginGuard) RecordFailure(ctx context.Context, email string, user *models.User, client models.ClientInfo) error {
+	now := time.Now()
+
+	account, err := g.store.Get(ctx, accountThrottleKey(email))
+	if err != nil {
+		return err
+	}
+	if account.Failures >= g.cfg.LoginMaxFailures && !account.IsLocked(now) {
+		if err := g.lockAccount(ctx, email, user, account.Failures, now, client); err != nil {
+			return err
+		}
+	}
+
+	if client.IP == "" {
+		return nil
+	}
+	ip, err := g.store.RecordFailure(ctx, ipThrottleKey(client.IP), now, g.cfg.LoginFailureWindow)
+	if err != nil {
+		return err
+	}
+	if ip.Failures == g.cfg.LoginIPMaxFailures {
+		g.recordEvent(ctx, &models.SecurityEvent{
+			Type:      models.SecurityEventIPThrottled,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+			Details:   fmt.Sprintf("%d failed logins within %s", ip.Failures, g.cfg.LoginFailureWindow),
+		})
+	}
+	return nil
+}
+
+func (g *loginGuard) lockAccount(ctx context.Context, email string, user *models.User, failures int, now time.Time, client models.ClientInfo) error {
+	until := now.Add(g.cfg.LoginLockoutDuration)
+	if err := g.store.Lock(ctx, accountThrottleKey(email), until); err != nil {
+		return err
+	}
+
+	event := &models.SecurityEvent{
+		Type:      models.SecurityEventAccountLocked,
+		Email:     email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   fmt.Sprintf("%d failed logins, locked until %s", failures, until.UTC().Format(time.RFC3339)),
+	}
+	if user != nil {
+		event.UserID = &user.ID
+	}
+	g.recordEvent(ctx, event)
+
+	// Emails are only sent for real accounts so lockouts do not reveal which emails are registered
+	if user != nil {
+		if err := g.sendUnlockEmail(ctx, user, until); err != nil {
+			log.Printf("WARNING: Failed to send unlock email to user %d: %v", user.ID, err)
+		}
+	}
+	return nil
+}
+
+func (g *loginGuard) sendUnlockEmail(ctx context.Context, user *models.User, until time.Time) error {
+	token, err := utils.GeneratePurposeJWT(g.keys, user.ID, utils.PurposeAccountUnlock, g.cfg.LoginLockoutDuration, g.cfg)
+	if err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(g.cfg.AppBaseURL, "/") + "/unlock?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Your account was locked after too many failed login attempts.\n\n"+
+		"It unlocks automatically at %s. If this was you, you can unlock it now:\n%s\n\n"+
+		"If this was not you, consider changing your password.",
+		until.UTC().Format(time.RFC1123), link)
+	return g.mailer.Send(ctx, user.Email, "Your account has been locked", body)
+}
+
+func (g *loginGuard) RecordSuccess(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, accountThrottleKey(email))
+}
+
+func (g *loginGuard) ReleaseAttempt(ctx context.Context, email string) error {
+	return g.store.Release(ctx, accountThrottleKey(email))
+}
+
+func (g *loginGuard) UnlockWithToken(ctx context.Context, token string, client models.ClientInfo) error {
+	claims, err := utils.ValidatePurposeJWT(g.keys, token, utils.PurposeAccountUnlock)
+	if err != nil {
+		return ErrInvalidUnlockToken
+	}
+
+	user, err := g.userRepo.FindByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidUnlockToken
+		}
+		return err
+	}
+	return g.unlock(ctx, user.Email, &user.ID, "unlocked with emailed token", client)
+}
+
+// UnlockAccount lifts a lockout by email for an operator, as the unlock-account command does
+func (g *loginGuard) UnlockAccount(ctx context.Context, email string, client models.ClientInfo) error {
+	user, err := g.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return g.unlock(ctx, user.Email, &user.ID, "unlocked by administrator", client)
+}
+
+func (g *loginGuard) ClearLockout(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, accountThrottleKey(email))
+}
+
+func (g *loginGuard) ForgetAccount(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, accountThrottleKey(email))
+}
+
+func (g *loginGuard) unlock(ctx context.Context, email string, userID *uint, details string, client models.ClientInfo) error {
+	if err := g.store.Reset(ctx, accountThrottleKey(email)); err != nil {
+		return err
+	}
+	g.recordEvent(ctx, &models.SecurityEvent{
+		Type:      models.SecurityEventAccountUnlocked,
+		UserID:    userID,
+		Email:     email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   details,
+	})
+	return nil
+}
+
+func (g *loginGuard) recordEvent(ctx context.Context, event *models.SecurityEvent) {
+	recordSecurityEvent(ctx, g.eventRepo, event)
+}
+
+// recordSecurityEvent stores a security event; failures are logged so they never block the action audited
+func recordSecurityEvent(ctx context.Context, eventRepo repositories.SecurityEventRepository, event *models.SecurityEvent) {
+	log.Printf("INFO: Security event %s (email=%q ip=%s): %s", event.Type, event.Email, event.IP, event.Details)
+	if err := eventRepo.CreateSecurityEvent(ctx, event); err != nil {
+		log.Printf("ERROR: Failed to record security event %s: %v", event.Type, err)
+	}
+}
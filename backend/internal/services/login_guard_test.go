@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoginGuardBeginAttemptAdmitsParallelBurstOnlyUpToDelay(t *testing.T) {
+	cfg := &config.Config{LoginFailureWindow: 15 * time.Minute, LoginMaxFailures: 10, LoginLockoutDuration: 15 * time.Minute, LoginIPMaxFailures: 100}
+	guard := NewLoginGuard(repositories.NewMemoryLoginThrottleStore(), nil, nil, nil, nil, cfg)
+
+	var admitted, throttled atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := guard.BeginAttempt(context.Background(), "alice@example.com", models.ClientInfo{})
+			var blocked *LoginBlockedError
+			switch {
+			case err == nil:
+				admitted.Add(1)
+			case errors.As(err, &blocked) && errors.Is(err, ErrTooManyLoginAttempts):
+				throttled.Add(1)
+			default:
+				t.Errorf("BeginAttempt: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Attempts are counted as they are admitted, so the progressive delay starts after the
+	// threshold even though none of the attempts has been reported as failed yet
+	if admitted.Load() != loginDelayThreshold || throttled.Load() != 50-loginDelayThreshold {
+		t.Fatalf("admitted %d and throttled %d attempts, want %d and %d", admitted.Load(), throttled.Load(), loginDelayThreshold, 50-loginDelayThreshold)
+	}
+}
+
+func TestLoginGuardReleaseAttemptUncountsRightPassword(t *testing.T) {
+	cfg := &config.Config{LoginFailureWindow: 15 * time.Minute, LoginMaxFailures: 10, LoginLockoutDuration: 15 * time.Minute}
+	store := repositories.NewMemoryLoginThrottleStore()
+	guard := NewLoginGuard(store, nil, nil, nil, nil, cfg)
+	ctx := context.Background()
+
+	if err := guard.BeginAttempt(ctx, "bob@example.com", models.ClientInfo{}); err != nil {
+		t.Fatalf("BeginAttempt: %v", err)
+	}
+	if err := guard.ReleaseAttempt(ctx, "bob@example.com"); err != nil {
+		t.Fatalf("ReleaseAttempt: %v", err)
+	}
+	throttle, _ := store.Get(ctx, accountThrottleKey("bob@example.com"))
+	if throttle.Failures != 0 {
+		t.Fatalf("released attempt left %d failures", throttle.Failures)
+	}
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFANotEnrolled    = errors.New("two-factor enrollment has not been started")
+	ErrInvalidMFACode    = errors.New("invalid authentication code")
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type MFAService interface {
+	BeginTOTPEnrollment(ctx context.Context, userID uint) (*models.TOTPEnrollmentResponse, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userID uint, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID uint, password, code, recoveryCode string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID uint, password, code, recoveryCode string) ([]string, error)
+	VerifySecondFactor(ctx context.Context, user *models.User, code, recoveryCode string) error
+}
+
+type mfaService struct {
+	userRepo         repositories.UserRepository
+	recoveryCodeRepo repositories.RecoveryCodeRepository
+	secrets          *utils.SecretBox
+	cfg              *config.Config
+}
+
+func NewMFAService(userRepo repositories.UserRepository, recoveryCodeRepo repositories.RecoveryCodeRepository, secrets *utils.SecretBox, cfg *config.Config) MFAService {
+	return &mfaService{userRepo: userRepo, recoveryCodeRepo: recoveryCodeRepo, secrets: secrets, cfg: cfg}
+}
+
+func (s *mfaService) findUser(ctx context.Context, userID uint) (*models.User, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// BeginTOTPEnrollment stores a new pending secret; 2FA is enabled once a code from it is confirmed
+func (s *mfaService) BeginTOTPEnrollment(ctx context.Context, userID uint) (*models.TOTPEnrollmentResponse, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.secrets.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPSecret = sealed
+	user.TOTPLastCounter = 0
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &models.TOTPEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(s.cfg.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+func (s *mfaService) ConfirmTOTPEnrollment(ctx context.Context, userID uint, code string) ([]string, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	if err := s.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reload to keep the counter advanced by verifyTOTP
+	user, err = s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled = true
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *mfaService) DisableTOTP(ctx context.Context, userID uint, password, code, recoveryCode string) error {
+	user, err := s.reauthenticate(ctx, userID, password, code, recoveryCode)
+	if err != nil {
+		return err
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastCounter = 0
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+	return s.recoveryCodeRepo.DeleteRecoveryCodes(ctx, user.ID)
+}
+
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, userID uint, password, code, recoveryCode string) ([]string, error) {
+	user, err := s.reauthenticate(ctx, userID, password, code, recoveryCode)
+	if err != nil {
+		return nil, err
+	}
+	return s.replaceRecoveryCodes(ctx, user.ID)
+}
+
+// VerifySecondFactor accepts either a current TOTP code or an unused recovery code
+func (s *mfaService) VerifySecondFactor(ctx context.Context, user *models.User, code, recoveryCode string) error {
+	if !user.TOTPEnabled {
+		return ErrMFANotEnabled
+	}
+	if code != "" {
+		return s.verifyTOTP(ctx, user, code)
+	}
+
+	used, err := s.recoveryCodeRepo.UseRecoveryCode(ctx, user.ID, utils.HashToken(normalizeRecoveryCode(recoveryCode)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// reauthenticate requires the password and a second factor before 2FA settings can change
+func (s *mfaService) reauthenticate(ctx context.Context, userID uint, password, code, recoveryCode string) (*models.User, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return nil, ErrInvalidCredentials
+	}
+	if err := s.VerifySecondFactor(ctx, user, code, recoveryCode); err != nil {
+		return nil, err
+	}
+	return s.findUser(ctx, userID)
+}
+
+func (s *mfaService) verifyTOTP(ctx context.Context, user *models.User, code string) error {
+	secret, err := s.secrets.Open(user.TOTPSecret)
+	if err != nil {
+		return fmt.Errorf("failed to read TOTP secret of user %d: %w", user.ID, err)
+	}
+
+	counter, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	advanced, err := s.userRepo.AdvanceTOTPCounter(ctx, user.ID, counter)
+	if err != nil {
+		return err
+	}
+	if !advanced {
+		// The code was already used
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *mfaService) replaceRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = utils.HashToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.recoveryCodeRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
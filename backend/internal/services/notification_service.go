@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"log"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotificationNotFound    = errors.New("notification not found")
+	ErrUnknownNotificationType = errors.New("unknown notification type")
+)
+
+// NotificationService turns service events into in-app notifications, pushed to the devices of
+// recipients for some types, and lets users read them
+type NotificationService interface {
+	// HandleEvents creates the notifications of a change; subscribe it to the EventBus
+	HandleEvents(ctx context.Context, events []Event)
+	ListNotifications(ctx context.Context, userID uint, filter models.NotificationFilter) (*models.NotificationListResponse, error)
+	MarkRead(ctx context.Context, userID, notificationID uint) error
+	MarkAllRead(ctx context.Context, userID uint) (int64, error)
+	GetPreferences(ctx context.Context, userID uint) (models.NotificationPreferences, error)
+	// UpdatePreferences changes the given types and leaves the others as they are
+	UpdatePreferences(ctx context.Context, userID uint, preferences models.NotificationPreferences) (models.NotificationPreferences, error)
+}
+
+type notificationService struct {
+	notificationRepo repositories.NotificationRepository
+	todoRepo         repositories.TodoRepository
+	workspaceRepo    repositories.WorkspaceRepository
+	userRepo         repositories.UserRepository
+	push             PushService
+}
+
+func NewNotificationService(notificationRepo repositories.NotificationRepository, todoRepo repositories.TodoRepository, workspaceRepo repositories.WorkspaceRepository, userRepo repositories.UserRepository, push PushService) NotificationService {
+	return &notificationService{
+		notificationRepo: notificationRepo,
+		todoRepo:         todoRepo,
+		workspaceRepo:    workspaceRepo,
+		userRepo:         userRepo,
+		push:             push,
+	}
+}
+
+func (s *notificationService) HandleEvents(ctx context.Context, events []Event) {
+	// Users mentioned in a comment are not also told they were commented at
+	mentioned := make(map[uint]map[uint]bool)
+	for _, event := range events {
+		if event.Type == EventTodoMentioned && event.CommentID != nil {
+			if mentioned[*event.CommentID] == nil {
+				mentioned[*event.CommentID] = make(map[uint]bool)
+			}
+			mentioned[*event.CommentID][event.SubjectID] = true
+		}
+	}
+
+	var notifications []models.Notification
+	for _, event := range events {
+		notificationType, recipients, err := s.recipients(ctx, event, mentioned)
+		if err != nil {
+			log.Printf("ERROR: Failed to find recipients of %s event on todo %d: %v", event.Type, event.TodoID, err)
+			continue
+		}
+		if len(recipients) == 0 {
+			continue
+		}
+
+		disabled, err := s.notificationRepo.FindDisabledUserIDs(ctx, recipients, notificationType)
+		if err != nil {
+			log.Printf("ERROR: Failed to load notification preferences: %v", err)
+			continue
+		}
+		message := s.message(ctx, notificationType, event)
+		for _, recipient := range recipients {
+			if slices.Contains(disabled, recipient) {
+				continue
+			}
+			notification := models.Notification{
+				UserID:      recipient,
+				Type:        notificationType,
+				Message:     message,
+				CommentID:   event.CommentID,
+				WorkspaceID: event.WorkspaceID,
+			}
+			if event.ActorID != 0 {
+				notification.ActorID = &event.ActorID
+			}
+			if event.TodoID != 0 {
+				notification.TodoID = &event.TodoID
+			}
+			notifications = append(notifications, notification)
+		}
+	}
+
+	if err := s.notificationRepo.CreateNotifications(ctx, notifications); err != nil {
+		log.Printf("ERROR: Failed to create %d notification(s): %v", len(notifications), err)
+		return
+	}
+	s.push.PushNotifications(ctx, notifications)
+}
+
+// recipients returns the notification type of event and who receives it. The actor is never
+// notified of their own change, and only current members hear about a workspace.
+func (s *notificationService) recipients(ctx context.Context, event Event, mentioned map[uint]map[uint]bool) (models.NotificationType, []uint, error) {
+	var notificationType models.NotificationType
+	var candidates []uint
+	switch event.Type {
+	case EventTodoAssigned:
+		notificationType, candidates = models.NotificationAssigned, []uint{event.SubjectID}
+	case EventTodoMentioned:
+		notificationType, candidates = models.NotificationMentioned, []uint{event.SubjectID}
+	case EventTodoDueSoon:
+		notificationType, candidates = models.NotificationDueSoon, []uint{event.SubjectID}
+	case EventWorkspaceMemberAdded:
+		notificationType, candidates = models.NotificationWorkspaceInvite, []uint{event.SubjectID}
+	case EventTodoCommented:
+		notificationType = models.NotificationCommented
+		watchers, err := s.todoRepo.FindWatchers(ctx, event.TodoID)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, watcher := range watchers {
+			if event.CommentID == nil || !mentioned[*event.CommentID][watcher.UserID] {
+				candidates = append(candidates, watcher.UserID)
+			}
+		}
+	default:
+		return "", nil, nil
+	}
+
+	recipients := make([]uint, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate == 0 || candidate == event.ActorID {
+			continue
+		}
+		if event.WorkspaceID != nil {
+			if _, err := s.workspaceRepo.FindMembership(ctx, *event.WorkspaceID, candidate); err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue
+				}
+				return "", nil, err
+			}
+		}
+		recipients = append(recipients, candidate)
+	}
+	return notificationType, recipients, nil
+}
+
+func (s *notificationService) message(ctx context.Context, notificationType models.NotificationType, event Event) string {
+	actor := "Someone"
+	if event.ActorID != 0 {
+		if user, err := s.userRepo.FindByID(ctx, event.ActorID); err == nil {
+			actor = user.Email
+			if user.DisplayName != "" {
+				actor = user.DisplayName
+			}
+		}
+	}
+
+	switch notificationType {
+	case models.NotificationAssigned:
+		return fmt.Sprintf("%s assigned you to %q", actor, event.Title)
+	case models.NotificationMentioned:
+		return fmt.Sprintf("%s mentioned you on %q", actor, event.Title)
+	case models.NotificationCommented:
+		return fmt.Sprintf("%s commented on %q", actor, event.Title)
+	case models.NotificationDueSoon:
+		return fmt.Sprintf("%q is due soon", event.Title)
+	default:
+		return fmt.Sprintf("%s added you to the workspace %q", actor, event.Title)
+	}
+}
+
+func (s *notificationService) ListNotifications(ctx context.Context, userID uint, filter models.NotificationFilter) (*models.NotificationListResponse, error) {
+	if filter.PageSize <= 0 {
+		filter.PageSize = models.DefaultNotificationPageSize
+	}
+	filter.PageSize = min(filter.PageSize, models.MaxNotificationPageSize)
+
+	notifications, total, err := s.notificationRepo.FindNotifications(ctx, userID, filter.Unread, filter.Page, filter.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := s.notificationRepo.CountUnread(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+	return &models.NotificationListResponse{
+		Notifications: notifications,
+		Total:         total,
+		UnreadCount:   unread,
+		Page:          filter.Page,
+		PageSize:      filter.PageSize,
+	}, nil
+}
+
+func (s *notificationService) MarkRead(ctx context.Context, userID, notificationID uint) error {
+	if err := s.notificationRepo.MarkRead(ctx, userID, notificationID, time.Now()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotificationNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *notificationService) MarkAllRead(ctx context.Context, userID uint) (int64, error) {
+	return s.notificationRepo.MarkAllRead(ctx, userID, time.Now())
+}
+
+func (s *notificationService) GetPreferences(ctx context.Context, userID uint) (models.NotificationPreferences, error) {
+	stored, err := s.notificationRepo.FindPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	preferences := make(models.NotificationPreferences, len(models.NotificationTypes))
+	for _, notificationType := range models.NotificationTypes {
+		preferences[notificationType] = true
+	}
+	for _, preference := range stored {
+		preferences[preference.Type] = preference.Enabled
+	}
+	return preferences, nil
+}
+
+func (s *notificationService) UpdatePreferences(ctx context.Context, userID uint, preferences models.NotificationPreferences) (models.NotificationPreferences, error) {
+	changed := make([]models.NotificationPreference, 0, len(preferences))
+	for notificationType, enabled := range preferences {
+		if !slices.Contains(models.NotificationTypes, notificationType) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownNotificationType, notificationType)
+		}
+		changed = append(changed, models.NotificationPreference{UserID: userID, Type: notificationType, Enabled: enabled})
+	}
+	if err := s.notificationRepo.SavePreferences(ctx, changed); err != nil {
+		return nil, err
+	}
+	return s.GetPreferences(ctx, userID)
+}
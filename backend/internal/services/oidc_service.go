@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// OIDCStateExpiresIn bounds how long a user may take at the identity provider
+const OIDCStateExpiresIn = 10 * time.Minute
+
+var (
+	ErrOIDCProviderNotFound = errors.New("unknown login provider")
+	ErrOIDCInvalidState     = errors.New("login session expired or is invalid, please try again")
+	ErrOIDCEmailNotVerified = errors.New("the identity provider did not return a verified email address")
+	ErrOIDCLoginFailed      = errors.New("login with the identity provider failed")
+)
+
+// oidcStateClaims carries the values that must survive the round trip to the provider
+type oidcStateClaims struct {
+	Purpose      string `json:"purpose"`
+	Provider     string `json:"provider"`
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	jwt.RegisteredClaims
+}
+
+type OIDCService interface {
+	Providers() []models.OIDCProviderInfo
+	// BeginLogin returns the provider URL to redirect to and a signed state token to keep in a cookie.
+	// With reauth the provider signs the user in again, so the new session counts as recently authenticated.
+	BeginLogin(ctx context.Context, provider string, reauth bool) (authURL, stateToken string, err error)
+	CompleteLogin(ctx context.Context, provider, code, state, stateToken string, client models.ClientInfo) (*LoginResult, error)
+}
+
+type oidcService struct {
+	clients      map[string]*utils.OIDCClient
+	providers    []config.OIDCProviderConfig
+	userRepo     repositories.UserRepository
+	identityRepo repositories.IdentityRepository
+	eventRepo    repositories.SecurityEventRepository
+	loginGuard   LoginGuard
+	sessions     SessionService
+	keys         *utils.KeyRing
+	cfg          *config.Config
+}
+
+func NewOIDCService(userRepo repositories.UserRepository, identityRepo repositories.IdentityRepository, eventRepo repositories.SecurityEventRepository, loginGuard LoginGuard, sessions SessionService, keys *utils.KeyRing, cfg *config.Config) OIDCService {
+	clients := make(map[string]*utils.OIDCClient, len(cfg.OIDCProviders))
+	for _, provider := range cfg.OIDCProviders {
+		clients[provider.Name] = utils.NewOIDCClient(provider, oidcCallbackURL(cfg, provider.Name))
+	}
+	return &oidcService{
+		clients:      clients,
+		providers:    cfg.OIDCProviders,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		eventRepo:    eventRepo,
+		loginGuard:   loginGuard,
+		sessions:     sessions,
+		keys:         keys,
+		cfg:          cfg,
+	}
+}
+
+func oidcCallbackURL(cfg *config.Config, provider string) string {
+	return strings.TrimRight(cfg.APIBaseURL, "/") + "/api/auth/oidc/" + provider + "/callback"
+}
+
+func (s *oidcService) Providers() []models.OIDCProviderInfo {
+	infos := make([]models.OIDCProviderInfo, len(s.providers))
+	for i, provider := range s.providers {
+		infos[i] = models.OIDCProviderInfo{
+			Name:        provider.Name,
+			DisplayName: provider.DisplayName,
+			LoginURL:    strings.TrimRight(s.cfg.APIBaseURL, "/") + "/api/auth/oidc/" + provider.Name + "/login",
+		}
+	}
+	return infos
+}
+
+func (s *oidcService) BeginLogin(ctx context.Context, provider string, reauth bool) (string, string, error) {
+	client, ok := s.clients[provider]
+	if !ok {
+		return "", "", ErrOIDCProviderNotFound
+	}
+
+	state, err := utils.GenerateRandomToken("", 24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := utils.GenerateRandomToken("", 24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := utils.GeneratePKCEVerifier()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := client.AuthCodeURL(ctx, state, nonce, challenge, reauth)
+	if err != nil {
+		return "", "", fmt.Errorf("provider %s: %w", provider, err)
+	}
+
+	now := time.Now()
+	stateToken, err := s.keys.SignPurpose(&oidcStateClaims{
+		Purpose:      utils.PurposeOIDCState,
+		Provider:     provider,
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{utils.PurposeAudience(utils.PurposeOIDCState)},
+			ExpiresAt: jwt.NewNumericDate(now.Add(OIDCStateExpiresIn)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, stateToken, nil
+}
+
+func (s *oidcService) CompleteLogin(ctx context.Context, provider, code, state, stateToken string, client models.ClientInfo) (*LoginResult, error) {
+	oidcClient, ok := s.clients[provider]
+	if !ok {
+		return nil, ErrOIDCProviderNotFound
+	}
+
+	var claims oidcStateClaims
+	if err := s.keys.ParsePurpose(stateToken, utils.PurposeOIDCState, &claims); err != nil {
+		return nil, ErrOIDCInvalidState
+	}
+	if claims.Purpose != utils.PurposeOIDCState || claims.Provider != provider ||
+		subtle.ConstantTimeCompare([]byte(claims.State), []byte(state)) != 1 {
+		return nil, ErrOIDCInvalidState
+	}
+
+	rawIDToken, err := oidcClient.Exchange(ctx, code, claims.CodeVerifier)
+	if err != nil {
+		log.Printf("ERROR: OIDC code exchange with %s failed: %v", provider, err)
+		return nil, ErrOIDCLoginFailed
+	}
+	idToken, err := oidcClient.VerifyIDToken(ctx, rawIDToken, claims.Nonce)
+	if err != nil {
+		log.Printf("ERROR: OIDC ID token from %s rejected: %v", provider, err)
+		return nil, ErrOIDCLoginFailed
+	}
+
+	user, err := s.resolveUser(ctx, provider, idToken, client)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsDisabled() {
+		return nil, ErrAccountDisabled
+	}
+	// A lockout after failed password logins holds for every way of signing in
+	if err := s.loginGuard.Check(ctx, user.Email, client); err != nil {
+		return nil, err
+	}
+
+	// Identity provider logins still require the second factor when the user enabled one
+	if user.TOTPEnabled {
+		mfaToken, err := utils.GeneratePurposeJWT(s.keys, user.ID, utils.PurposeMFAPending, s.cfg.MFAPendingExpiresIn, s.cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFAToken: mfaToken}, nil
+	}
+
+	// Without auth_time the provider may have reused an old login, so the session is not taken as
+	// recently authenticated
+	var authenticatedAt time.Time
+	if idToken.AuthTime != nil && !idToken.AuthTime.After(time.Now()) {
+		authenticatedAt = idToken.AuthTime.Time
+	}
+	token, err := s.sessions.StartSession(ctx, user, client, authenticatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	return &LoginResult{Token: token, User: user}, nil
+}
+
+// resolveUser finds the user linked to the identity, linking or creating one by verified email
+func (s *oidcService) resolveUser(ctx context.Context, provider string, idToken *utils.OIDCIDTokenClaims, client models.ClientInfo) (*models.User, error) {
+	identity, err := s.identityRepo.FindIdentity(ctx, idToken.Issuer, idToken.Subject)
+	if err == nil {
+		user, err := s.userRepo.FindByID(ctx, identity.UserID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("ERROR: %s identity %s is linked to missing user %d", provider, idToken.Subject, identity.UserID)
+			return nil, ErrOIDCLoginFailed
+		}
+		return user, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if idToken.Email == "" || !bool(idToken.EmailVerified) {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	identity = &models.UserIdentity{
+		Provider: provider,
+		Issuer:   idToken.Issuer,
+		Subject:  idToken.Subject,
+		Email:    idToken.Email,
+	}
+
+	user, err := s.userRepo.FindByEmail(ctx, idToken.Email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user = &models.User{Email: idToken.Email}
+		if err := s.identityRepo.CreateUserWithIdentity(ctx, user, identity); err != nil {
+			return nil, err
+		}
+		log.Printf("INFO: Created user %d from %s identity", user.ID, provider)
+		return user, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	identity.UserID = user.ID
+	if err := s.identityRepo.CreateIdentity(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	recordSecurityEvent(ctx, s.eventRepo, &models.SecurityEvent{
+		Type:      models.SecurityEventIdentityLinked,
+		UserID:    &user.ID,
+		Email:     user.Email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   fmt.Sprintf("linked %s identity %s", provider, idToken.Subject),
+	})
+	return user, nil
+}
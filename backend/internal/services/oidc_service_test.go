@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	mockOIDCProvider = "mock"
+	mockOIDCClientID = "todo-app"
+	mockOIDCCode     = "auth-code"
+)
+
+// mockIssuer is a local OpenID provider that issues one ID token for the code it hands out
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	subject       string
+	email         string
+	emailVerified bool
+	// nonce and challenge are taken from the authorization URL by beginLogin
+	nonce     string
+	challenge string
+	// forgedNonce replaces the nonce in issued ID tokens when set
+	forgedNonce string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	issuer := &mockIssuer{key: key, subject: "subject-1", email: "ada@example.com", emailVerified: true}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, utils.OIDCDiscovery{
+			Issuer:                issuer.server.URL,
+			AuthorizationEndpoint: issuer.server.URL + "/authorize",
+			TokenEndpoint:         issuer.server.URL + "/token",
+			JWKSURI:               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, utils.JWKSet{Keys: []utils.JWK{{
+			Kty: "RSA",
+			Kid: "mock-key",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", issuer.token)
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if r.PostForm.Get("code") != mockOIDCCode || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	nonce := m.nonce
+	if m.forgedNonce != "" {
+		nonce = m.forgedNonce
+	}
+	now := time.Now()
+	claims := utils.OIDCIDTokenClaims{
+		Nonce:         nonce,
+		Email:         m.email,
+		EmailVerified: utils.OIDCBool(m.emailVerified),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.server.URL,
+			Subject:   m.subject,
+			Audience:  jwt.ClaimStrings{mockOIDCClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "mock-key"
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type fakeUserRepo struct {
+	repositories.UserRepository
+	users map[uint]*models.User
+}
+
+func (r *fakeUserRepo) FindByID(_ context.Context, id uint) (*models.User, error) {
+	if user, ok := r.users[id]; ok {
+		return user, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) FindByEmail(_ context.Context, email string) (*models.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+type fakeIdentityRepo struct {
+	repositories.IdentityRepository
+	users      *fakeUserRepo
+	identities []models.UserIdentity
+}
+
+func (r *fakeIdentityRepo) FindIdentity(_ context.Context, issuer, subject string) (*models.UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeIdentityRepo) CreateIdentity(_ context.Context, identity *models.UserIdentity) error {
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+func (r *fakeIdentityRepo) CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.UserIdentity) error {
+	user.ID = uint(len(r.users.users) + 1)
+	r.users.users[user.ID] = user
+	identity.UserID = user.ID
+	return r.CreateIdentity(ctx, identity)
+}
+
+type fakeSecurityEventRepo struct {
+	repositories.SecurityEventRepository
+	events []models.SecurityEvent
+}
+
+func (r *fakeSecurityEventRepo) CreateSecurityEvent(_ context.Context, event *models.SecurityEvent) error {
+	r.events = append(r.events, *event)
+	return nil
+}
+
+type fakeLoginGuard struct {
+	LoginGuard
+	blocked error
+}
+
+func (g *fakeLoginGuard) Check(context.Context, string, models.ClientInfo) error {
+	return g.blocked
+}
+
+type fakeSessions struct {
+	SessionService
+}
+
+func (fakeSessions) StartSession(_ context.Context, user *models.User, _ models.ClientInfo, _ time.Time) (string, error) {
+	return "session-for-" + user.Email, nil
+}
+
+type oidcFixture struct {
+	issuer     *mockIssuer
+	keys       *utils.KeyRing
+	users      *fakeUserRepo
+	identities *fakeIdentityRepo
+	events     *fakeSecurityEventRepo
+	guard      *fakeLoginGuard
+	service    OIDCService
+}
+
+func newOIDCFixture(t *testing.T) *oidcFixture {
+	t.Helper()
+	issuer := newMockIssuer(t)
+	users := &fakeUserRepo{users: map[uint]*models.User{}}
+	f := &oidcFixture{
+		issuer:     issuer,
+		users:      users,
+		identities: &fakeIdentityRepo{users: users},
+		events:     &fakeSecurityEventRepo{},
+		guard:      &fakeLoginGuard{},
+	}
+	cfg := &config.Config{
+		APIBaseURL:          "http://api.test",
+		JWTSecret:           "test-secret",
+		JWTSigningAlg:       utils.SigningAlgHS256,
+		MFAPendingExpiresIn: 5 * time.Minute,
+		OIDCProviders: []config.OIDCProviderConfig{{
+			Name:     mockOIDCProvider,
+			Issuer:   issuer.server.URL,
+			ClientID: mockOIDCClientID,
+			Scopes:   []string{"openid", "email"},
+		}},
+	}
+	keys, err := utils.NewKeyRing(cfg)
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	f.keys = keys
+	f.service = NewOIDCService(users, f.identities, f.events, f.guard, fakeSessions{}, keys, cfg)
+	return f
+}
+
+// login runs the whole flow: it starts a login, lets the provider see the authorization request
+// and completes the login with the code and the state sent back by the provider
+func (f *oidcFixture) login(t *testing.T) (*LoginResult, error) {
+	t.Helper()
+	ctx := context.Background()
+	authURL, stateToken, err := f.service.BeginLogin(ctx, mockOIDCProvider, false)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authorization URL: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != mockOIDCClientID {
+		t.Fatalf("unexpected authorization URL %s", authURL)
+	}
+	f.issuer.nonce = query.Get("nonce")
+	f.issuer.challenge = query.Get("code_challenge")
+
+	return f.service.CompleteLogin(ctx, mockOIDCProvider, mockOIDCCode, query.Get("state"), stateToken, models.ClientInfo{IP: "127.0.0.1"})
+}
+
+func TestOIDCLoginCreatesUserFromVerifiedEmail(t *testing.T) {
+	f := newOIDCFixture(t)
+
+	result, err := f.login(t)
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if result.Token != "session-for-ada@example.com" || result.User == nil {
+		t.Fatalf("unexpected login result %+v", result)
+	}
+	if len(f.identities.identities) != 1 || f.identities.identities[0].Subject != "subject-1" {
+		t.Fatalf("identity not recorded: %+v", f.identities.identities)
+	}
+
+	// The second login finds the user through the identity
+	if _, err := f.login(t); err != nil {
+		t.Fatalf("second CompleteLogin: %v", err)
+	}
+	if len(f.users.users) != 1 {
+		t.Fatalf("expected one user, got %d", len(f.users.users))
+	}
+}
+
+func TestOIDCLoginLinksExistingAccount(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.users.users[7] = &models.User{ID: 7, Email: "ada@example.com"}
+
+	result, err := f.login(t)
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if result.User.ID != 7 || f.identities.identities[0].UserID != 7 {
+		t.Fatalf("identity not linked to the existing user: %+v", f.identities.identities)
+	}
+	if len(f.events.events) != 1 || f.events.events[0].Type != models.SecurityEventIdentityLinked {
+		t.Fatalf("expected an identity linked event, got %+v", f.events.events)
+	}
+}
+
+func TestOIDCLoginRejectsUnverifiedEmail(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.issuer.emailVerified = false
+
+	if _, err := f.login(t); !errors.Is(err, ErrOIDCEmailNotVerified) {
+		t.Fatalf("expected ErrOIDCEmailNotVerified, got %v", err)
+	}
+}
+
+func TestOIDCLoginRejectsNonceMismatch(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.issuer.forgedNonce = "other-nonce"
+
+	if _, err := f.login(t); !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Fatalf("expected ErrOIDCLoginFailed, got %v", err)
+	}
+}
+
+func TestOIDCLoginRejectsTamperedState(t *testing.T) {
+	f := newOIDCFixture(t)
+	_, stateToken, err := f.service.BeginLogin(context.Background(), mockOIDCProvider, false)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+
+	_, err = f.service.CompleteLogin(context.Background(), mockOIDCProvider, mockOIDCCode, "forged-state", stateToken, models.ClientInfo{})
+	if !errors.Is(err, ErrOIDCInvalidState) {
+		t.Fatalf("expected ErrOIDCInvalidState, got %v", err)
+	}
+}
+
+func TestOIDCStateTokenIsNotAnAccessToken(t *testing.T) {
+	f := newOIDCFixture(t)
+	_, stateToken, err := f.service.BeginLogin(context.Background(), mockOIDCProvider, false)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+
+	if _, err := utils.ValidateJWT(f.keys, stateToken); err == nil {
+		t.Fatal("state token was accepted as an access token")
+	}
+}
+
+func TestOIDCLoginRespectsLockout(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.guard.blocked = &LoginBlockedError{Reason: ErrAccountLocked, RetryAfter: time.Minute}
+
+	if _, err := f.login(t); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("expected ErrAccountLocked, got %v", err)
+	}
+}
+
+func TestOIDCLoginWithIdentityOfMissingUser(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.identities.identities = []models.UserIdentity{{
+		Provider: mockOIDCProvider,
+		Issuer:   f.issuer.server.URL,
+		Subject:  "subject-1",
+		UserID:   42,
+	}}
+
+	if _, err := f.login(t); !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Fatalf("expected ErrOIDCLoginFailed, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"log"
+	"sync"
+	"time"
+)
+
+// UserPreferences are the per-user settings applied wherever dates or default orderings are computed
+type UserPreferences struct {
+	Location    *time.Location
+	WeekStart   time.Weekday
+	DefaultSort models.TodoSort
+}
+
+// locations caches loaded time zones, since time.LoadLocation reads the zone database on every call
+var locations sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// preferencesOf resolves the preferences of user, falling back to the server's TIME_ZONE
+func preferencesOf(user *models.User, cfg *config.Config) UserPreferences {
+	prefs := UserPreferences{
+		Location:    time.UTC,
+		WeekStart:   user.WeekStart.Time(),
+		DefaultSort: user.DefaultSort,
+	}
+	for _, name := range []string{user.Timezone, cfg.TimeZone} {
+		if name == "" {
+			continue
+		}
+		loc, err := loadLocation(name)
+		if err != nil {
+			log.Printf("WARNING: Unknown time zone %q for user %d: %v", name, user.ID, err)
+			continue
+		}
+		prefs.Location = loc
+		break
+	}
+	return prefs
+}
+
+// loadPreferences loads the user's preferences; lookup failures fall back to the server defaults
+func loadPreferences(ctx context.Context, userRepo repositories.UserRepository, userID uint, cfg *config.Config) UserPreferences {
+	user, err := userRepo.FindByID(ctx, userID)
+	if err != nil {
+		log.Printf("WARNING: Failed to load preferences of user %d: %v", userID, err)
+		user = &models.User{ID: userID}
+	}
+	return preferencesOf(user, cfg)
+}
+
+// StartOfDay returns midnight of the day containing t in the user's timezone
+func (p UserPreferences) StartOfDay(t time.Time) time.Time {
+	t = t.In(p.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, p.Location)
+}
+
+// StartOfWeek returns midnight of the first day of the week containing t
+func (p UserPreferences) StartOfWeek(t time.Time) time.Time {
+	day := p.StartOfDay(t)
+	offset := (int(day.Weekday()) - int(p.WeekStart) + 7) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// applyToFilter fills in the default sort and resolves the due filter into a time range at now
+func (p UserPreferences) applyToFilter(filter *models.TodoFilter, now time.Time) {
+	if filter.Sort == "" {
+		filter.Sort = p.DefaultSort
+	}
+
+	var after, before time.Time
+	switch filter.Due {
+	case models.DueOverdue:
+		before = now
+		filter.DueBefore = &before
+		filter.ExcludeDone = true
+	case models.DueToday:
+		after = p.StartOfDay(now)
+		before = after.AddDate(0, 0, 1)
+		filter.DueAfter, filter.DueBefore = &after, &before
+	case models.DueThisWeek:
+		after = p.StartOfWeek(now)
+		before = after.AddDate(0, 0, 7)
+		filter.DueAfter, filter.DueBefore = &after, &before
+	}
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIncorrectPassword       = errors.New("current password is incorrect")
+	ErrEmailUnchanged          = errors.New("new email is the same as the current email")
+	ErrInvalidEmailChangeToken = errors.New("invalid or expired email confirmation token")
+	ErrNoProfileFieldsProvided = errors.New("no profile fields provided")
+	ErrInvalidTimezone         = errors.New("unknown timezone, use an IANA name such as Europe/Berlin")
+	ErrInvalidDigestTime       = errors.New("digest time must be a time of day such as 08:00")
+	// ErrReauthenticationRequired is returned to accounts without a password that change their
+	// credentials without a recent identity provider login or a TOTP code
+	ErrReauthenticationRequired = errors.New("sign in again with your identity provider or enter an authentication code to confirm this change")
+)
+
+// ProfileService lets users manage their own account
+type ProfileService interface {
+	GetProfile(ctx context.Context, userID uint) (*models.User, error)
+	UpdateProfile(ctx context.Context, userID uint, req models.UpdateProfileRequest) (*models.User, error)
+	// ChangePassword signs out every session except currentSessionID and revokes every personal access
+	// token. Accounts without a password confirm it is them with code or a recent login in currentSessionID.
+	ChangePassword(ctx context.Context, userID uint, currentSessionID, currentPassword, code, newPassword string, client models.ClientInfo) error
+	// RequestEmailChange sends a confirmation link to newEmail; the email changes once it is used
+	RequestEmailChange(ctx context.Context, userID uint, currentSessionID, newEmail, currentPassword, code string, client models.ClientInfo) error
+	ConfirmEmailChange(ctx context.Context, token string, client models.ClientInfo) (*models.User, error)
+}
+
+type profileService struct {
+	userRepo     repositories.UserRepository
+	eventRepo    repositories.SecurityEventRepository
+	sessions     SessionService
+	accessTokens AccessTokenService
+	reauth       reauthenticator
+	mailer       utils.Mailer
+	cfg          *config.Config
+}
+
+func NewProfileService(userRepo repositories.UserRepository, eventRepo repositories.SecurityEventRepository, sessions SessionService, accessTokens AccessTokenService, mfa MFAService, loginGuard LoginGuard, mailer utils.Mailer, cfg *config.Config) ProfileService {
+	return &profileService{
+		userRepo:     userRepo,
+		eventRepo:    eventRepo,
+		sessions:     sessions,
+		accessTokens: accessTokens,
+		reauth:       reauthenticator{sessions: sessions, mfa: mfa, loginGuard: loginGuard, cfg: cfg},
+		mailer:       mailer,
+		cfg:          cfg,
+	}
+}
+
+func (s *profileService) GetProfile(ctx context.Context, userID uint) (*models.User, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *profileService) UpdateProfile(ctx context.Context, userID uint, req models.UpdateProfileRequest) (*models.User, error) {
+	user, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := false
+	if req.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*req.DisplayName)
+		updated = true
+	}
+	if req.AvatarURL != nil {
+		user.AvatarURL = *req.AvatarURL
+		updated = true
+	}
+	if req.Timezone != nil {
+		if *req.Timezone != "" {
+			if _, err := loadLocation(*req.Timezone); err != nil || *req.Timezone == "Local" {
+				return nil, ErrInvalidTimezone
+			}
+		}
+		user.Timezone = *req.Timezone
+		updated = true
+	}
+	if req.Locale != nil {
+		user.Locale = *req.Locale
+		updated = true
+	}
+	if req.WeekStart != nil {
+		user.WeekStart = *req.WeekStart
+		updated = true
+	}
+	if req.DefaultSort != nil {
+		user.DefaultSort = *req.DefaultSort
+		updated = true
+	}
+	if req.DigestEnabled != nil {
+		user.DigestEnabled = *req.DigestEnabled
+		updated = true
+	}
+	if req.DigestTime != nil {
+		// Stored zero-padded so digest times compare as strings
+		digestTime, err := time.Parse(digestTimeLayout, *req.DigestTime)
+		if err != nil {
+			return nil, ErrInvalidDigestTime
+		}
+		user.DigestTime = digestTime.Format(digestTimeLayout)
+		updated = true
+	}
+	if !updated {
+		return nil, ErrNoProfileFieldsProvided
+	}
+
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// reauthenticator confirms the account holder is present before their credentials change
+type reauthenticator struct {
+	sessions   SessionService
+	mfa        MFAService
+	loginGuard LoginGuard
+	cfg        *config.Config
+}
+
+// verify checks the current password. Accounts created through an identity provider have none, so
+// they give a TOTP code when they enabled one, or make the change from a session whose provider
+// login is at most REAUTH_MAX_AGE old. Codes count towards the login lockout like at login.
+func (r reauthenticator) verify(ctx context.Context, user *models.User, sessionID, password, code string, client models.ClientInfo) error {
+	if user.Password != "" {
+		if !utils.CheckPasswordHash(password, user.Password) {
+			return ErrIncorrectPassword
+		}
+		return nil
+	}
+
+	if user.TOTPEnabled && code != "" {
+		if err := r.loginGuard.BeginAttempt(ctx, user.Email, client); err != nil {
+			return err
+		}
+		if err := r.mfa.VerifySecondFactor(ctx, user, code, ""); err != nil {
+			if errors.Is(err, ErrInvalidMFACode) {
+				if err := r.loginGuard.RecordFailure(ctx, user.Email, user, client); err != nil {
+					return err
+				}
+			}
+			return err
+		}
+		return r.loginGuard.ReleaseAttempt(ctx, user.Email)
+	}
+
+	if sessionID == "" {
+		return ErrReauthenticationRequired
+	}
+	authenticatedAt, err := r.sessions.AuthenticatedAt(ctx, user.ID, sessionID)
+	if err != nil {
+		return err
+	}
+	if authenticatedAt.IsZero() || time.Since(authenticatedAt) > r.cfg.ReauthMaxAge {
+		return ErrReauthenticationRequired
+	}
+	return nil
+}
+
+func (s *profileService) ChangePassword(ctx context.Context, userID uint, currentSessionID, currentPassword, code, newPassword string, client models.ClientInfo) error {
+	user, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.reauth.verify(ctx, user, currentSessionID, currentPassword, code, client); err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	revoked, err := s.sessions.RevokeOtherSessions(ctx, user.ID, currentSessionID)
+	if err != nil {
+		return err
+	}
+	revokedTokens, err := s.accessTokens.RevokeAllAccessTokens(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	recordSecurityEvent(ctx, s.eventRepo, &models.SecurityEvent{
+		Type:      models.SecurityEventPasswordChanged,
+		UserID:    &user.ID,
+		Email:     user.Email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   fmt.Sprintf("password changed by the user, %d other session(s) and %d access token(s) revoked", revoked, revokedTokens),
+	})
+	return nil
+}
+
+func (s *profileService) RequestEmailChange(ctx context.Context, userID uint, currentSessionID, newEmail, currentPassword, code string, client models.ClientInfo) error {
+	user, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.reauth.verify(ctx, user, currentSessionID, currentPassword, code, client); err != nil {
+		return err
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return ErrEmailUnchanged
+	}
+	if err := s.ensureEmailAvailable(ctx, newEmail); err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateRandomToken("", 32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(s.cfg.EmailChangeExpiresIn)
+	user.PendingEmail = newEmail
+	user.EmailChangeTokenHash = utils.HashToken(token)
+	user.EmailChangeExpiresAt = &expiresAt
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	recordSecurityEvent(ctx, s.eventRepo, &models.SecurityEvent{
+		Type:      models.SecurityEventEmailChangeReq,
+		UserID:    &user.ID,
+		Email:     user.Email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   "change to " + newEmail + " requested",
+	})
+
+	link := strings.TrimRight(s.cfg.AppBaseURL, "/") + "/confirm-email?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Confirm that you want to use this address for your account before %s:\n%s\n\n"+
+		"If you did not request this, ignore this email.",
+		expiresAt.UTC().Format(time.RFC1123), link)
+	if err := s.mailer.Send(ctx, newEmail, "Confirm your new email address", body); err != nil {
+		return fmt.Errorf("failed to send confirmation email: %w", err)
+	}
+
+	notice := fmt.Sprintf("A change of your account email to %s was requested. It takes effect once confirmed from the new address.\n\n"+
+		"If this was not you, change your password now.", newEmail)
+	if err := s.mailer.Send(ctx, user.Email, "Your account email is being changed", notice); err != nil {
+		log.Printf("WARNING: Failed to send email change notice to user %d: %v", user.ID, err)
+	}
+	return nil
+}
+
+func (s *profileService) ConfirmEmailChange(ctx context.Context, token string, client models.ClientInfo) (*models.User, error) {
+	user, err := s.userRepo.FindByEmailChangeTokenHash(ctx, utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidEmailChangeToken
+		}
+		return nil, err
+	}
+	if user.PendingEmail == "" || user.EmailChangeExpiresAt == nil || time.Now().After(*user.EmailChangeExpiresAt) {
+		return nil, ErrInvalidEmailChangeToken
+	}
+	// Another account may have taken the address since the change was requested
+	if err := s.ensureEmailAvailable(ctx, user.PendingEmail); err != nil {
+		return nil, err
+	}
+
+	previous := user.Email
+	user.Email = user.PendingEmail
+	user.PendingEmail = ""
+	user.EmailChangeTokenHash = ""
+	user.EmailChangeExpiresAt = nil
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	recordSecurityEvent(ctx, s.eventRepo, &models.SecurityEvent{
+		Type:      models.SecurityEventEmailChanged,
+		UserID:    &user.ID,
+		Email:     user.Email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   "changed from " + previous,
+	})
+	return user, nil
+}
+
+func (s *profileService) ensureEmailAvailable(ctx context.Context, email string) error {
+	_, err := s.userRepo.FindByEmail(ctx, email)
+	if err == nil {
+		return ErrUserAlreadyExists
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"testing"
+	"time"
+)
+
+type authenticatedSessions struct {
+	SessionService
+	authenticatedAt map[string]time.Time
+}
+
+func (s authenticatedSessions) AuthenticatedAt(_ context.Context, _ uint, sessionID string) (time.Time, error) {
+	at, ok := s.authenticatedAt[sessionID]
+	if !ok {
+		return time.Time{}, ErrSessionNotFound
+	}
+	return at, nil
+}
+
+func TestReauthenticatorRequiresRecentLoginWithoutPassword(t *testing.T) {
+	now := time.Now()
+	reauth := reauthenticator{
+		sessions: authenticatedSessions{authenticatedAt: map[string]time.Time{
+			"fresh":   now.Add(-time.Minute),
+			"stale":   now.Add(-time.Hour),
+			"unknown": {},
+		}},
+		cfg: &config.Config{ReauthMaxAge: 10 * time.Minute},
+	}
+	oidcUser := &models.User{ID: 1, Email: "oidc@example.com"}
+
+	tests := []struct {
+		sessionID string
+		want      error
+	}{
+		{sessionID: "fresh", want: nil},
+		{sessionID: "stale", want: ErrReauthenticationRequired},
+		{sessionID: "unknown", want: ErrReauthenticationRequired},
+		{sessionID: "", want: ErrReauthenticationRequired},
+	}
+	for _, tt := range tests {
+		err := reauth.verify(context.Background(), oidcUser, tt.sessionID, "", "", models.ClientInfo{})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("session %q: got %v, want %v", tt.sessionID, err, tt.want)
+		}
+	}
+}
+
+func TestReauthenticatorChecksPasswordWhenSet(t *testing.T) {
+	hash, err := utils.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reauth := reauthenticator{cfg: &config.Config{ReauthMaxAge: 10 * time.Minute}}
+	user := &models.User{ID: 1, Email: "user@example.com", Password: hash}
+
+	if err := reauth.verify(context.Background(), user, "", "wrong", "", models.ClientInfo{}); !errors.Is(err, ErrIncorrectPassword) {
+		t.Fatalf("wrong password: got %v, want %v", err, ErrIncorrectPassword)
+	}
+	if err := reauth.verify(context.Background(), user, "", "correct horse", "", models.ClientInfo{}); err != nil {
+		t.Fatalf("correct password: %v", err)
+	}
+}
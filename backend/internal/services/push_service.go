@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPushSubscriptionNotFound = errors.New("push subscription not found")
+	ErrInvalidPushSubscription  = errors.New("invalid push subscription")
+	ErrPushEndpointInUse        = errors.New("push endpoint is subscribed by another account")
+)
+
+// pushNotificationTypes are the notification types also delivered as browser push messages
+var pushNotificationTypes = []models.NotificationType{
+	models.NotificationDueSoon,
+	models.NotificationMentioned,
+}
+
+// PushService manages the Web Push subscriptions of users' devices and delivers notifications to them
+type PushService interface {
+	VAPIDPublicKey() string
+	// Subscribe registers a device of the user, or refreshes the keys of an endpoint the user
+	// already subscribed
+	Subscribe(ctx context.Context, userID uint, req models.CreatePushSubscriptionRequest, userAgent string) (*models.PushSubscription, error)
+	ListSubscriptions(ctx context.Context, userID uint) ([]models.PushSubscription, error)
+	Unsubscribe(ctx context.Context, userID, subscriptionID uint) error
+	// PushNotifications queues a push message to every device of the recipients of notifications
+	// whose type is delivered by push
+	PushNotifications(ctx context.Context, notifications []models.Notification)
+	// Deliver sends a queued message to one device, deleting the subscription when the push
+	// service reports it has expired
+	Deliver(ctx context.Context, subscriptionID uint, message models.PushMessage) error
+}
+
+// pushJob is the payload of JobSendPush
+type pushJob struct {
+	SubscriptionID uint               `json:"subscription_id"`
+	Message        models.PushMessage `json:"message"`
+}
+
+type pushService struct {
+	pushRepo repositories.PushRepository
+	sender   utils.PushSender
+	keys     *utils.VAPIDKeys
+	jobs     JobQueue
+	cfg      *config.Config
+}
+
+func NewPushService(pushRepo repositories.PushRepository, sender utils.PushSender, keys *utils.VAPIDKeys, jobs JobQueue, cfg *config.Config) PushService {
+	return &pushService{
+		pushRepo: pushRepo,
+		sender:   sender,
+		keys:     keys,
+		jobs:     jobs,
+		cfg:      cfg,
+	}
+}
+
+func (s *pushService) VAPIDPublicKey() string {
+	return s.keys.PublicKey
+}
+
+func (s *pushService) Subscribe(ctx context.Context, userID uint, req models.CreatePushSubscriptionRequest, userAgent string) (*models.PushSubscription, error) {
+	// The server posts to the endpoint, so only public push services reachable over TLS on the
+	// standard port are accepted; the sender also refuses internal addresses when it connects
+	endpoint, err := url.Parse(req.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, fmt.Errorf("%w: endpoint must be an https URL", ErrInvalidPushSubscription)
+	}
+	if port := endpoint.Port(); (port != "" && port != "443") || !utils.IsPublicHost(endpoint.Hostname()) {
+		return nil, fmt.Errorf("%w: endpoint must be a public push service", ErrInvalidPushSubscription)
+	}
+	target := utils.PushTarget{Endpoint: req.Endpoint, P256dh: req.Keys.P256dh, Auth: req.Keys.Auth}
+	if err := target.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPushSubscription, err)
+	}
+
+	subscription := &models.PushSubscription{
+		UserID:    userID,
+		Endpoint:  req.Endpoint,
+		P256dh:    strings.TrimRight(req.Keys.P256dh, "="),
+		Auth:      strings.TrimRight(req.Keys.Auth, "="),
+		UserAgent: userAgent,
+	}
+	if err := s.pushRepo.SaveSubscription(ctx, subscription); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrPushEndpointInUse
+		}
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func (s *pushService) ListSubscriptions(ctx context.Context, userID uint) ([]models.PushSubscription, error) {
+	subscriptions, err := s.pushRepo.FindSubscriptions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if subscriptions == nil {
+		subscriptions = []models.PushSubscription{}
+	}
+	return subscriptions, nil
+}
+
+func (s *pushService) Unsubscribe(ctx context.Context, userID, subscriptionID uint) error {
+	if err := s.pushRepo.DeleteSubscription(ctx, userID, subscriptionID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPushSubscriptionNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *pushService) PushNotifications(ctx context.Context, notifications []models.Notification) {
+	byUser := make(map[uint][]models.Notification)
+	var userIDs []uint
+	for _, notification := range notifications {
+		if !slices.Contains(pushNotificationTypes, notification.Type) {
+			continue
+		}
+		if byUser[notification.UserID] == nil {
+			userIDs = append(userIDs, notification.UserID)
+		}
+		byUser[notification.UserID] = append(byUser[notification.UserID], notification)
+	}
+	if len(userIDs) == 0 {
+		return
+	}
+
+	subscriptions, err := s.pushRepo.FindSubscriptionsByUserIDs(ctx, userIDs)
+	if err != nil {
+		log.Printf("ERROR: Failed to load push subscriptions: %v", err)
+		return
+	}
+	for _, subscription := range subscriptions {
+		for _, notification := range byUser[subscription.UserID] {
+			job := pushJob{SubscriptionID: subscription.ID, Message: s.message(notification)}
+			if _, err := s.jobs.Enqueue(ctx, JobSendPush, job, JobOptions{}); err != nil {
+				log.Printf("ERROR: Failed to queue push message for subscription %d: %v", subscription.ID, err)
+			}
+		}
+	}
+}
+
+func (s *pushService) message(notification models.Notification) models.PushMessage {
+	message := models.PushMessage{
+		Title:          "Todo reminder",
+		Body:           notification.Message,
+		Type:           notification.Type,
+		NotificationID: notification.ID,
+		TodoID:         notification.TodoID,
+		WorkspaceID:    notification.WorkspaceID,
+		URL:            strings.TrimRight(s.cfg.AppBaseURL, "/") + "/",
+	}
+	if notification.Type == models.NotificationMentioned {
+		message.Title = "You were mentioned"
+	}
+	return message
+}
+
+func (s *pushService) Deliver(ctx context.Context, subscriptionID uint, message models.PushMessage) error {
+	subscription, err := s.pushRepo.FindSubscriptionByID(ctx, subscriptionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Unsubscribed after the message was queued
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	target := utils.PushTarget{Endpoint: subscription.Endpoint, P256dh: subscription.P256dh, Auth: subscription.Auth}
+	err = s.sender.Send(ctx, target, payload, s.cfg.PushTTL)
+	if errors.Is(err, utils.ErrPushSubscriptionGone) {
+		log.Printf("INFO: Removing expired push subscription %d of user %d", subscription.ID, subscription.UserID)
+		return s.pushRepo.PruneSubscription(ctx, subscription.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return s.pushRepo.MarkPushed(ctx, subscription.ID, time.Now())
+}
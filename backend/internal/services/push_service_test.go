@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type fakePushRepo struct {
+	repositories.PushRepository
+	subscriptions map[uint]*models.PushSubscription
+	pruned        []uint
+	pushed        []uint
+}
+
+func (r *fakePushRepo) FindSubscriptionByID(_ context.Context, id uint) (*models.PushSubscription, error) {
+	if subscription, ok := r.subscriptions[id]; ok {
+		return subscription, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakePushRepo) PruneSubscription(_ context.Context, id uint) error {
+	delete(r.subscriptions, id)
+	r.pruned = append(r.pruned, id)
+	return nil
+}
+
+func (r *fakePushRepo) MarkPushed(_ context.Context, id uint, _ time.Time) error {
+	r.pushed = append(r.pushed, id)
+	return nil
+}
+
+// pushDevice plays the browser side of a subscription: it holds the keys the payload is
+// encrypted for and decrypts what the push service receives
+type pushDevice struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newPushDevice(t *testing.T) *pushDevice {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate device key: %v", err)
+	}
+	auth := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		t.Fatalf("generate auth secret: %v", err)
+	}
+	return &pushDevice{key: key, auth: auth}
+}
+
+func (d *pushDevice) subscription(id uint, endpoint string) *models.PushSubscription {
+	return &models.PushSubscription{
+		ID:       id,
+		UserID:   1,
+		Endpoint: endpoint,
+		P256dh:   base64.RawURLEncoding.EncodeToString(d.key.PublicKey().Bytes()),
+		Auth:     base64.RawURLEncoding.EncodeToString(d.auth),
+	}
+}
+
+// decrypt reverses EncryptPushPayload as a browser does (RFC 8291)
+func (d *pushDevice) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+	if len(body) < 21 || len(body) < 21+int(body[20]) {
+		t.Fatalf("encrypted body of %d bytes is too short", len(body))
+	}
+	salt, keyIDLength := body[:16], int(body[20])
+	serverPublic, ciphertext := body[21:21+keyIDLength], body[21+keyIDLength:]
+
+	serverKey, err := ecdh.P256().NewPublicKey(serverPublic)
+	if err != nil {
+		t.Fatalf("invalid sender key: %v", err)
+	}
+	sharedSecret, err := d.key.ECDH(serverKey)
+	if err != nil {
+		t.Fatalf("ECDH: %v", err)
+	}
+	keyInfo := "WebPush: info\x00" + string(d.key.PublicKey().Bytes()) + string(serverPublic)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, d.auth, keyInfo, 32)
+	if err != nil {
+		t.Fatalf("derive IKM: %v", err)
+	}
+	contentKey, _ := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		t.Fatalf("cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("GCM: %v", err)
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 0x02 {
+		t.Fatalf("missing last-record delimiter")
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+func newTestPushService(t *testing.T, repo *fakePushRepo, client *http.Client) PushService {
+	t.Helper()
+	keys, err := utils.GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("GenerateVAPIDKeys: %v", err)
+	}
+	sender := utils.NewWebPushSender(keys, "mailto:admin@example.com")
+	if client != nil {
+		sender = sender.WithClient(client)
+	}
+	cfg := &config.Config{PushTTL: time.Hour, AppBaseURL: "https://app.example.com"}
+	return NewPushService(repo, sender, keys, nil, cfg)
+}
+
+func TestPushDeliverEncryptsMessageForDevice(t *testing.T) {
+	device := newPushDevice(t)
+	var received []byte
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(server.Close)
+
+	repo := &fakePushRepo{subscriptions: map[uint]*models.PushSubscription{3: device.subscription(3, server.URL+"/push/abc")}}
+	service := newTestPushService(t, repo, server.Client())
+
+	todoID := uint(9)
+	message := models.PushMessage{Title: "Todo reminder", Body: "Pay rent is due soon", Type: models.NotificationDueSoon, TodoID: &todoID}
+	if err := service.Deliver(context.Background(), 3, message); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+
+	if headers.Get("Content-Encoding") != "aes128gcm" || headers.Get("TTL") != "3600" {
+		t.Fatalf("unexpected push headers %v", headers)
+	}
+	var got models.PushMessage
+	if err := json.Unmarshal(device.decrypt(t, received), &got); err != nil {
+		t.Fatalf("decrypted payload is not a push message: %v", err)
+	}
+	if got.Body != message.Body || got.TodoID == nil || *got.TodoID != todoID || got.Type != message.Type {
+		t.Fatalf("decrypted %+v, want %+v", got, message)
+	}
+	if len(repo.pushed) != 1 || len(repo.pruned) != 0 {
+		t.Fatalf("expected the subscription to be marked pushed, got pushed=%v pruned=%v", repo.pushed, repo.pruned)
+	}
+}
+
+func TestPushDeliverPrunesGoneSubscription(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}))
+			t.Cleanup(server.Close)
+
+			device := newPushDevice(t)
+			repo := &fakePushRepo{subscriptions: map[uint]*models.PushSubscription{5: device.subscription(5, server.URL+"/push/gone")}}
+			service := newTestPushService(t, repo, server.Client())
+
+			if err := service.Deliver(context.Background(), 5, models.PushMessage{Title: "Todo reminder"}); err != nil {
+				t.Fatalf("Deliver: %v", err)
+			}
+			if len(repo.pruned) != 1 || repo.pruned[0] != 5 {
+				t.Fatalf("expected subscription 5 to be pruned, got %v", repo.pruned)
+			}
+		})
+	}
+}
+
+func TestPushDeliverRefusesInternalAddresses(t *testing.T) {
+	reached := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	t.Cleanup(server.Close)
+
+	device := newPushDevice(t)
+	repo := &fakePushRepo{subscriptions: map[uint]*models.PushSubscription{7: device.subscription(7, server.URL+"/internal")}}
+	service := newTestPushService(t, repo, nil)
+
+	err := service.Deliver(context.Background(), 7, models.PushMessage{Title: "Todo reminder"})
+	if !errors.Is(err, utils.ErrNonPublicAddress) || reached {
+		t.Fatalf("expected the loopback endpoint to be refused, got %v (reached=%v)", err, reached)
+	}
+}
+
+func TestPushSubscribeRejectsNonPublicEndpoints(t *testing.T) {
+	device := newPushDevice(t)
+	keys := device.subscription(0, "")
+	service := newTestPushService(t, &fakePushRepo{}, nil)
+
+	for _, endpoint := range []string{
+		"http://push.example.com/abc",
+		"https://localhost/abc",
+		"https://127.0.0.1/abc",
+		"https://[::1]/abc",
+		"https://10.0.0.8/abc",
+		"https://169.254.169.254/latest/meta-data",
+		"https://metadata.google.internal/abc",
+		"https://push.example.com:8443/abc",
+	} {
+		req := models.CreatePushSubscriptionRequest{Endpoint: endpoint}
+		req.Keys.P256dh, req.Keys.Auth = keys.P256dh, keys.Auth
+		if _, err := service.Subscribe(context.Background(), 1, req, ""); !errors.Is(err, ErrInvalidPushSubscription) {
+			t.Errorf("Subscribe(%s): expected ErrInvalidPushSubscription, got %v", endpoint, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionRevoked  = errors.New("session has been revoked or expired")
+)
+
+type SessionService interface {
+	// StartSession records a login from client, in which the user authenticated at authenticatedAt,
+	// and returns an access token bound to it
+	StartSession(ctx context.Context, user *models.User, client models.ClientInfo, authenticatedAt time.Time) (string, error)
+	ValidateSession(ctx context.Context, sessionID string, userID uint) error
+	// AuthenticatedAt returns when the user last authenticated for the session
+	AuthenticatedAt(ctx context.Context, userID uint, sessionID string) (time.Time, error)
+	ListSessions(ctx context.Context, userID uint, currentSessionID string) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID uint, sessionID string) error
+	RevokeOtherSessions(ctx context.Context, userID uint, currentSessionID string) (int64, error)
+	RevokeAllSessions(ctx context.Context, userID uint) (int64, error)
+	// StartImpersonation records a session in which admin acts as user; the token names admin as its actor
+	StartImpersonation(ctx context.Context, admin, user *models.User, client models.ClientInfo) (string, time.Time, error)
+}
+
+type sessionService struct {
+	sessionRepo repositories.SessionRepository
+	keys        *utils.KeyRing
+	cfg         *config.Config
+}
+
+func NewSessionService(sessionRepo repositories.SessionRepository, keys *utils.KeyRing, cfg *config.Config) SessionService {
+	return &sessionService{sessionRepo: sessionRepo, keys: keys, cfg: cfg}
+}
+
+func (s *sessionService) StartSession(ctx context.Context, user *models.User, client models.ClientInfo, authenticatedAt time.Time) (string, error) {
+	now := time.Now()
+	session := &models.Session{
+		ID:              uuid.NewString(),
+		UserID:          user.ID,
+		UserAgent:       client.UserAgent,
+		IP:              client.IP,
+		LastSeenAt:      now,
+		ExpiresAt:       now.Add(s.cfg.JWTExpiresInDuration),
+		AuthenticatedAt: authenticatedAt,
+	}
+	if err := s.sessionRepo.CreateSession(ctx, session); err != nil {
+		return "", err
+	}
+	return utils.GenerateSessionJWT(s.keys, user.ID, session.ID, s.cfg)
+}
+
+func (s *sessionService) StartImpersonation(ctx context.Context, admin, user *models.User, client models.ClientInfo) (string, time.Time, error) {
+	now := time.Now()
+	session := &models.Session{
+		ID:             uuid.NewString(),
+		UserID:         user.ID,
+		UserAgent:      client.UserAgent,
+		IP:             client.IP,
+		LastSeenAt:     now,
+		ExpiresAt:      now.Add(s.cfg.ImpersonationExpiresIn),
+		ImpersonatorID: &admin.ID,
+	}
+	if err := s.sessionRepo.CreateSession(ctx, session); err != nil {
+		return "", time.Time{}, err
+	}
+	token, err := utils.GenerateImpersonationJWT(s.keys, user.ID, session.ID, admin.ID, s.cfg.ImpersonationExpiresIn, s.cfg)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, session.ExpiresAt, nil
+}
+
+// ValidateSession rejects revoked sessions and records activity at most once per SESSION_LAST_SEEN_INTERVAL
+func (s *sessionService) ValidateSession(ctx context.Context, sessionID string, userID uint) error {
+	session, err := s.sessionRepo.FindSessionByID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+
+	now := time.Now()
+	if session.UserID != userID || !session.IsActive(now) {
+		return ErrSessionRevoked
+	}
+
+	if now.Sub(session.LastSeenAt) >= s.cfg.SessionLastSeenInterval {
+		if err := s.sessionRepo.UpdateLastSeen(ctx, session.ID, now); err != nil {
+			log.Printf("WARNING: Failed to update last seen of session %s: %v", session.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *sessionService) AuthenticatedAt(ctx context.Context, userID uint, sessionID string) (time.Time, error) {
+	session, err := s.sessionRepo.FindSessionByID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, ErrSessionNotFound
+		}
+		return time.Time{}, err
+	}
+	if session.UserID != userID || !session.IsActive(time.Now()) {
+		return time.Time{}, ErrSessionRevoked
+	}
+	return session.AuthenticatedAt, nil
+}
+
+func (s *sessionService) ListSessions(ctx context.Context, userID uint, currentSessionID string) ([]models.Session, error) {
+	sessions, err := s.sessionRepo.FindActiveSessionsByUserID(ctx, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+func (s *sessionService) RevokeSession(ctx context.Context, userID uint, sessionID string) error {
+	err := s.sessionRepo.RevokeSession(ctx, userID, sessionID, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSessionNotFound
+	}
+	return err
+}
+
+func (s *sessionService) RevokeOtherSessions(ctx context.Context, userID uint, currentSessionID string) (int64, error) {
+	return s.sessionRepo.RevokeOtherSessions(ctx, userID, currentSessionID, time.Now())
+}
+
+func (s *sessionService) RevokeAllSessions(ctx context.Context, userID uint) (int64, error) {
+	return s.sessionRepo.RevokeOtherSessions(ctx, userID, "", time.Now())
+}
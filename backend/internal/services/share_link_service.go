@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"github.com/xNatthapol/todo-list/internal/utils"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	shareLinkTokenBytes          = 32
+	shareLinkPrefixDisplayLength = len(models.ShareLinkTokenPrefix) + 6
+)
+
+var (
+	ErrShareLinkNotFound      = errors.New("share link not found")
+	ErrInvalidShareLink       = errors.New("invalid or expired share link")
+	ErrShareLinkPassword      = errors.New("a valid password is required to open this share link")
+	ErrShareLinkThrottled     = errors.New("too many wrong passwords for this share link, try again later")
+	ErrInvalidShareLinkExpiry = errors.New("expiry must be in the future")
+	ErrShareLinkPermission    = errors.New("only the creator or a workspace manager can revoke this share link")
+)
+
+// ShareLinkService manages public read-only links to a todo or to a whole list. The list of a
+// link is its tenant: the creator's personal todos or the todos of a workspace.
+type ShareLinkService interface {
+	// CreateLink shares a todo, or the tenant's whole list when req.TodoID is nil; in a workspace
+	// only managers may share the whole list
+	CreateLink(ctx context.Context, userID uint, req models.CreateShareLinkRequest) (*models.CreatedShareLinkResponse, error)
+	ListLinks(ctx context.Context, todoID *uint) ([]models.ShareLink, error)
+	// RevokeLink deletes a link; creators may revoke their own and workspace managers any
+	RevokeLink(ctx context.Context, userID, linkID uint) error
+	// OpenLink returns the read-only view behind a link token and records the access. Wrong
+	// passwords are throttled per link like failed logins, returning a *LoginBlockedError.
+	OpenLink(ctx context.Context, token, password string) (*models.SharedView, error)
+}
+
+type shareLinkService struct {
+	linkRepo      repositories.ShareLinkRepository
+	todoRepo      repositories.TodoRepository
+	workspaceRepo repositories.WorkspaceRepository
+	todoService   TodoService
+	uploader      *utils.GCSUploader
+	throttle      repositories.LoginThrottleStore
+	cfg           *config.Config
+}
+
+func NewShareLinkService(linkRepo repositories.ShareLinkRepository, todoRepo repositories.TodoRepository, workspaceRepo repositories.WorkspaceRepository, todoService TodoService, uploader *utils.GCSUploader, throttle repositories.LoginThrottleStore, cfg *config.Config) ShareLinkService {
+	return &shareLinkService{linkRepo: linkRepo, todoRepo: todoRepo, workspaceRepo: workspaceRepo, todoService: todoService, uploader: uploader, throttle: throttle, cfg: cfg}
+}
+
+func shareLinkThrottleKey(linkID uint) string {
+	return "share:" + strconv.FormatUint(uint64(linkID), 10)
+}
+
+func (s *shareLinkService) CreateLink(ctx context.Context, userID uint, req models.CreateShareLinkRequest) (*models.CreatedShareLinkResponse, error) {
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidShareLinkExpiry
+	}
+
+	link := &models.ShareLink{UserID: userID, ExpiresAt: req.ExpiresAt}
+	if req.TodoID != nil {
+		todo, err := s.todoService.GetTodoByID(ctx, userID, *req.TodoID)
+		if err != nil {
+			return nil, err
+		}
+		link.TodoID = &todo.ID
+	} else if tenant, _ := repositories.TenantFromContext(ctx); tenant.WorkspaceID != nil && !tenant.Role.CanManage() {
+		return nil, ErrWorkspacePermission
+	}
+
+	if req.Password != "" {
+		hash, err := utils.HashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
+		link.PasswordHash = hash
+		link.HasPassword = true
+	}
+
+	raw, err := utils.GenerateRandomToken(models.ShareLinkTokenPrefix, shareLinkTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	link.Prefix = raw[:shareLinkPrefixDisplayLength]
+	link.TokenHash = utils.HashToken(raw)
+
+	if err := s.linkRepo.CreateLink(ctx, link); err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimRight(s.cfg.APIBaseURL, "/") + "/api/shared/" + raw
+	return &models.CreatedShareLinkResponse{URL: url, ShareLink: *link}, nil
+}
+
+func (s *shareLinkService) ListLinks(ctx context.Context, todoID *uint) ([]models.ShareLink, error) {
+	return s.linkRepo.FindLinks(ctx, todoID)
+}
+
+func (s *shareLinkService) RevokeLink(ctx context.Context, userID, linkID uint) error {
+	link, err := s.linkRepo.FindLinkByID(ctx, linkID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrShareLinkNotFound
+		}
+		return err
+	}
+	if link.UserID != userID {
+		tenant, _ := repositories.TenantFromContext(ctx)
+		if !tenant.Role.CanManage() {
+			return ErrShareLinkPermission
+		}
+	}
+
+	if err := s.linkRepo.DeleteLink(ctx, link.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrShareLinkNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *shareLinkService) OpenLink(ctx context.Context, token, password string) (*models.SharedView, error) {
+	if !strings.HasPrefix(token, models.ShareLinkTokenPrefix) {
+		return nil, ErrInvalidShareLink
+	}
+
+	link, err := s.linkRepo.FindLinkByHash(ctx, utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidShareLink
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if link.IsExpired(now) || link.User.IsDisabled() {
+		return nil, ErrInvalidShareLink
+	}
+	// A workspace link stops working when its creator leaves the workspace
+	if link.WorkspaceID != nil {
+		if _, err := s.workspaceRepo.FindMembership(ctx, *link.WorkspaceID, link.UserID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrInvalidShareLink
+			}
+			return nil, err
+		}
+	}
+	if link.HasPassword {
+		if err := s.checkPassword(ctx, link, password, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.linkRepo.RecordAccess(ctx, link.ID, now); err != nil {
+		log.Printf("WARNING: Failed to record access to share link %d: %v", link.ID, err)
+	}
+
+	// Attachment URLs do not outlive the link
+	attachmentTTL := s.cfg.ShareAttachmentURLTTL
+	if link.ExpiresAt != nil && link.ExpiresAt.Sub(now) < attachmentTTL {
+		attachmentTTL = link.ExpiresAt.Sub(now)
+	}
+
+	view := &models.SharedView{ExpiresAt: link.ExpiresAt}
+	shared := func(todo *models.Todo) models.SharedTodo {
+		item := models.SharedTodo{
+			Title:         todo.Title,
+			Description:   todo.Description,
+			Status:        todo.Status,
+			DueDate:       todo.DueDate,
+			CompletedAt:   todo.CompletedAt,
+			CreatedAt:     todo.CreatedAt,
+			UpdatedAt:     todo.UpdatedAt,
+			AttachmentURL: s.attachmentURL(todo, attachmentTTL),
+		}
+		if item.AttachmentURL != "" && view.AttachmentsExpireAt == nil {
+			expiresAt := now.Add(attachmentTTL)
+			view.AttachmentsExpireAt = &expiresAt
+		}
+		return item
+	}
+
+	tenantCtx := repositories.WithTenant(ctx, models.Tenant{UserID: link.UserID, WorkspaceID: link.WorkspaceID})
+	if link.TodoID != nil {
+		todo, err := s.todoRepo.FindTodoByID(tenantCtx, *link.TodoID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrInvalidShareLink
+			}
+			return nil, err
+		}
+		item := shared(todo)
+		view.Kind = models.SharedTodoKind
+		view.Todo = &item
+		return view, nil
+	}
+
+	view.Kind = models.SharedListKind
+	if link.WorkspaceID != nil {
+		view.Name = link.Workspace.Name
+	}
+	prefs := preferencesOf(&link.User, s.cfg)
+	todos, err := s.todoRepo.FindTodos(tenantCtx, models.TodoFilter{Sort: prefs.DefaultSort})
+	if err != nil {
+		return nil, err
+	}
+	view.Todos = make([]models.SharedTodo, 0, len(todos))
+	for i := range todos {
+		view.Todos = append(view.Todos, shared(&todos[i]))
+	}
+	return view, nil
+}
+
+// checkPassword applies the login throttle to a link: after LoginMaxFailures wrong passwords
+// within the failure window the link is locked for everyone until the lockout ends. The attempt
+// is counted before the password is compared, so parallel guesses cannot all pass the throttle.
+func (s *shareLinkService) checkPassword(ctx context.Context, link *models.ShareLink, password string, now time.Time) error {
+	key := shareLinkThrottleKey(link.ID)
+	throttle, err := s.throttle.Reserve(ctx, key, now, s.cfg.LoginFailureWindow, throttleAllows(s.cfg, now, ErrShareLinkThrottled, ErrShareLinkThrottled))
+	if err != nil {
+		return err
+	}
+
+	if utils.CheckPasswordHash(password, link.PasswordHash) {
+		return s.throttle.Reset(ctx, key)
+	}
+	if throttle.Failures >= s.cfg.LoginMaxFailures {
+		if err := s.throttle.Lock(ctx, key, now.Add(s.cfg.LoginLockoutDuration)); err != nil {
+			return err
+		}
+	}
+	return ErrShareLinkPassword
+}
+
+// attachmentURL returns a URL of the todo's image valid for ttl. Only images uploaded by the
+// todo's creator are handed out; other image URLs are left out of shared views.
+func (s *shareLinkService) attachmentURL(todo *models.Todo, ttl time.Duration) string {
+	if s.uploader == nil || todo.ImageURL == "" {
+		return ""
+	}
+	name, ok := s.uploader.ObjectName(todo.ImageURL)
+	if !ok || !strings.HasPrefix(name, userUploadPrefix(todo.UserID)) {
+		return ""
+	}
+	url, err := s.uploader.SignedURL(name, ttl)
+	if err != nil {
+		log.Printf("WARNING: Failed to sign attachment URL of todo %d: %v", todo.ID, err)
+		return ""
+	}
+	return url
+}
@@ -0,0 +1,473 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// defaultBoardColumnLimit bounds the todos returned per board column when no limit is given
+const defaultBoardColumnLimit = 100
+
+var (
+	ErrStatusNotFound       = errors.New("status not found")
+	ErrUnknownStatus        = errors.New("status is not defined for this list")
+	ErrDuplicateStatus      = errors.New("a status with this name already exists")
+	ErrStatusInUse          = errors.New("status still has todos; choose a status to move them to")
+	ErrStatusRequired       = errors.New("a list needs at least one open and one done status")
+	ErrInvalidStatusOrder   = errors.New("status order must list every status of the list exactly once")
+	ErrInvalidStatusMove    = errors.New("todos cannot be moved to the status being deleted")
+	ErrWIPLimitReached      = errors.New("status has reached its WIP limit")
+	ErrNoStatusFields       = errors.New("no status fields provided")
+	ErrTransitionNotFound   = errors.New("status transition not found")
+	ErrInvalidTransition    = errors.New("a transition needs two different statuses of the list")
+	ErrDuplicateTransition  = errors.New("this status transition already exists")
+	ErrTransitionNotAllowed = errors.New("status transition is not allowed")
+)
+
+// TransitionError is returned when the workflow rules of a list keep a todo from moving to a
+// status. Allowed lists the statuses the todo can move to instead, in board order.
+type TransitionError struct {
+	From    models.TodoStatus
+	To      models.TodoStatus
+	Reason  string
+	Allowed []models.TodoStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot move todo from %s to %s: %s", e.From, e.To, e.Reason)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrTransitionNotAllowed
+}
+
+// StatusService manages the statuses of the request's tenant, its list, and shows its todos as a
+// board. Lists without statuses are given the default statuses on first use. In a workspace only
+// managers may change statuses.
+type StatusService interface {
+	ListStatuses(ctx context.Context) ([]models.StatusDefinition, error)
+	CreateStatus(ctx context.Context, req models.CreateStatusRequest) (*models.StatusDefinition, error)
+	// UpdateStatus changes a status; a new name or done flag is applied to its todos
+	UpdateStatus(ctx context.Context, statusID uint, req models.UpdateStatusRequest) (*models.StatusDefinition, error)
+	ReorderStatuses(ctx context.Context, req models.ReorderStatusesRequest) ([]models.StatusDefinition, error)
+	// DeleteStatus removes a status. Its todos move to moveTo, which is required when it has any.
+	DeleteStatus(ctx context.Context, statusID uint, moveTo *uint) error
+	// GetBoard returns the todos grouped by status, each column in its own order
+	GetBoard(ctx context.Context, filter models.BoardFilter) (*models.Board, error)
+	ListTransitions(ctx context.Context) ([]models.StatusTransition, error)
+	// CreateTransition adds a workflow rule; once a status has rules, todos can only enter it
+	// through one of them
+	CreateTransition(ctx context.Context, req models.CreateStatusTransitionRequest) (*models.StatusTransition, error)
+	DeleteTransition(ctx context.Context, transitionID uint) error
+}
+
+type statusService struct {
+	statusRepo repositories.StatusRepository
+	todoRepo   repositories.TodoRepository
+}
+
+func NewStatusService(statusRepo repositories.StatusRepository, todoRepo repositories.TodoRepository) StatusService {
+	return &statusService{statusRepo: statusRepo, todoRepo: todoRepo}
+}
+
+// loadStatuses returns the statuses of the request's tenant, seeding the defaults for lists that
+// have none yet
+func loadStatuses(ctx context.Context, statusRepo repositories.StatusRepository) ([]models.StatusDefinition, error) {
+	statuses, err := statusRepo.FindStatuses(ctx)
+	if err != nil || len(statuses) > 0 {
+		return statuses, err
+	}
+
+	tenant, ok := repositories.TenantFromContext(ctx)
+	if !ok {
+		return nil, repositories.ErrMissingTenant
+	}
+	defaults := models.DefaultStatuses()
+	if tenant.WorkspaceID == nil {
+		for i := range defaults {
+			defaults[i].UserID = &tenant.UserID
+		}
+	}
+	if err := statusRepo.CreateDefaultStatuses(ctx, defaults); err != nil {
+		return nil, err
+	}
+	return statusRepo.FindStatuses(ctx)
+}
+
+// findStatus returns the status named name, ignoring case
+func findStatus(statuses []models.StatusDefinition, name models.TodoStatus) *models.StatusDefinition {
+	for i := range statuses {
+		if strings.EqualFold(string(statuses[i].Name), strings.TrimSpace(string(name))) {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// firstStatus returns the first status in board order whose done flag is done
+func firstStatus(statuses []models.StatusDefinition, done bool) *models.StatusDefinition {
+	for i := range statuses {
+		if statuses[i].IsDone == done {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// checkStatusManager fails unless the user may change the statuses of the request's tenant
+func checkStatusManager(ctx context.Context) error {
+	if tenant, _ := repositories.TenantFromContext(ctx); tenant.WorkspaceID != nil && !tenant.Role.CanManage() {
+		return ErrWorkspacePermission
+	}
+	return nil
+}
+
+func (s *statusService) ListStatuses(ctx context.Context) ([]models.StatusDefinition, error) {
+	return loadStatuses(ctx, s.statusRepo)
+}
+
+func (s *statusService) CreateStatus(ctx context.Context, req models.CreateStatusRequest) (*models.StatusDefinition, error) {
+	if err := checkStatusManager(ctx); err != nil {
+		return nil, err
+	}
+	statuses, err := loadStatuses(ctx, s.statusRepo)
+	if err != nil {
+		return nil, err
+	}
+	name := models.TodoStatus(strings.TrimSpace(string(req.Name)))
+	if name == "" {
+		return nil, ErrUnknownStatus
+	}
+	if findStatus(statuses, name) != nil {
+		return nil, ErrDuplicateStatus
+	}
+
+	status := &models.StatusDefinition{
+		Name:     name,
+		Color:    req.Color,
+		IsDone:   req.IsDone,
+		WIPLimit: req.WIPLimit,
+		Position: len(statuses),
+	}
+	if status.Color == "" {
+		status.Color = models.DefaultStatusColor
+	}
+	if tenant, _ := repositories.TenantFromContext(ctx); tenant.WorkspaceID == nil {
+		status.UserID = &tenant.UserID
+	}
+	if err := s.statusRepo.CreateStatus(ctx, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (s *statusService) UpdateStatus(ctx context.Context, statusID uint, req models.UpdateStatusRequest) (*models.StatusDefinition, error) {
+	if req.Name == nil && req.Color == nil && req.IsDone == nil && req.WIPLimit == nil {
+		return nil, ErrNoStatusFields
+	}
+	if err := checkStatusManager(ctx); err != nil {
+		return nil, err
+	}
+	statuses, err := loadStatuses(ctx, s.statusRepo)
+	if err != nil {
+		return nil, err
+	}
+	status := statusByID(statuses, statusID)
+	if status == nil {
+		return nil, ErrStatusNotFound
+	}
+	previous := *status
+
+	if req.Name != nil {
+		name := models.TodoStatus(strings.TrimSpace(string(*req.Name)))
+		if name == "" {
+			return nil, ErrUnknownStatus
+		}
+		if other := findStatus(statuses, name); other != nil && other.ID != status.ID {
+			return nil, ErrDuplicateStatus
+		}
+		status.Name = name
+	}
+	if req.Color != nil {
+		status.Color = *req.Color
+	}
+	if req.WIPLimit != nil {
+		status.WIPLimit = *req.WIPLimit
+	}
+	if req.IsDone != nil {
+		status.IsDone = *req.IsDone
+		if err := checkStatusKinds(statuses); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.statusRepo.UpdateStatus(ctx, status, previous, time.Now()); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (s *statusService) ReorderStatuses(ctx context.Context, req models.ReorderStatusesRequest) ([]models.StatusDefinition, error) {
+	if err := checkStatusManager(ctx); err != nil {
+		return nil, err
+	}
+	statuses, err := loadStatuses(ctx, s.statusRepo)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.StatusIDs) != len(statuses) {
+		return nil, ErrInvalidStatusOrder
+	}
+
+	ordered := make([]models.StatusDefinition, 0, len(statuses))
+	for position, id := range req.StatusIDs {
+		status := statusByID(statuses, id)
+		if status == nil {
+			return nil, ErrInvalidStatusOrder
+		}
+		status.Position = position
+		ordered = append(ordered, *status)
+	}
+	if err := s.statusRepo.SaveOrder(ctx, ordered); err != nil {
+		return nil, err
+	}
+	return ordered, nil
+}
+
+func (s *statusService) DeleteStatus(ctx context.Context, statusID uint, moveTo *uint) error {
+	if err := checkStatusManager(ctx); err != nil {
+		return err
+	}
+	statuses, err := loadStatuses(ctx, s.statusRepo)
+	if err != nil {
+		return err
+	}
+	status := statusByID(statuses, statusID)
+	if status == nil {
+		return ErrStatusNotFound
+	}
+
+	remaining := make([]models.StatusDefinition, 0, len(statuses)-1)
+	for _, other := range statuses {
+		if other.ID != status.ID {
+			remaining = append(remaining, other)
+		}
+	}
+	if err := checkStatusKinds(remaining); err != nil {
+		return err
+	}
+
+	var target *models.StatusDefinition
+	if moveTo != nil {
+		if *moveTo == status.ID {
+			return ErrInvalidStatusMove
+		}
+		if target = statusByID(statuses, *moveTo); target == nil {
+			return ErrUnknownStatus
+		}
+	} else {
+		counts, err := s.todoRepo.CountTodosByStatus(ctx, models.TodoFilter{Status: status.Name})
+		if err != nil {
+			return err
+		}
+		if counts[status.Name] > 0 {
+			return ErrStatusInUse
+		}
+	}
+
+	return s.statusRepo.DeleteStatus(ctx, status, target, time.Now())
+}
+
+func (s *statusService) GetBoard(ctx context.Context, filter models.BoardFilter) (*models.Board, error) {
+	statuses, err := loadStatuses(ctx, s.statusRepo)
+	if err != nil {
+		return nil, err
+	}
+	limit := filter.Limit
+	if limit == 0 {
+		limit = defaultBoardColumnLimit
+	}
+
+	// WIP limits apply to every todo of a column, whatever the search
+	totals, err := s.todoRepo.CountTodosByStatus(ctx, models.TodoFilter{})
+	if err != nil {
+		return nil, err
+	}
+	counts := totals
+	if filter.Search != "" {
+		if counts, err = s.todoRepo.CountTodosByStatus(ctx, models.TodoFilter{Search: filter.Search}); err != nil {
+			return nil, err
+		}
+	}
+
+	board := &models.Board{Columns: make([]models.BoardColumn, 0, len(statuses))}
+	for _, status := range statuses {
+		column := models.BoardColumn{Status: status, Todos: []models.Todo{}, Count: counts[status.Name]}
+		if column.Count > 0 {
+			todos, err := s.todoRepo.FindTodos(ctx, models.TodoFilter{
+				Status: status.Name,
+				Search: filter.Search,
+				Sort:   models.SortPosition,
+				Limit:  limit,
+			})
+			if err != nil {
+				return nil, err
+			}
+			column.Todos = todos
+		}
+		column.OverLimit = status.WIPLimit > 0 && totals[status.Name] > int64(status.WIPLimit)
+		board.Columns = append(board.Columns, column)
+	}
+	return board, nil
+}
+
+func (s *statusService) ListTransitions(ctx context.Context) ([]models.StatusTransition, error) {
+	return s.statusRepo.FindTransitions(ctx)
+}
+
+func (s *statusService) CreateTransition(ctx context.Context, req models.CreateStatusTransitionRequest) (*models.StatusTransition, error) {
+	if err := checkStatusManager(ctx); err != nil {
+		return nil, err
+	}
+	statuses, err := loadStatuses(ctx, s.statusRepo)
+	if err != nil {
+		return nil, err
+	}
+	if statusByID(statuses, req.ToStatusID) == nil {
+		return nil, ErrInvalidTransition
+	}
+	if req.FromStatusID != nil && (*req.FromStatusID == req.ToStatusID || statusByID(statuses, *req.FromStatusID) == nil) {
+		return nil, ErrInvalidTransition
+	}
+
+	rules, err := s.statusRepo.FindTransitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		sameFrom := (rule.FromStatusID == nil && req.FromStatusID == nil) ||
+			(rule.FromStatusID != nil && req.FromStatusID != nil && *rule.FromStatusID == *req.FromStatusID)
+		if sameFrom && rule.ToStatusID == req.ToStatusID {
+			return nil, ErrDuplicateTransition
+		}
+	}
+
+	transition := &models.StatusTransition{
+		FromStatusID:     req.FromStatusID,
+		ToStatusID:       req.ToStatusID,
+		RequiresAssignee: req.RequiresAssignee,
+	}
+	if tenant, _ := repositories.TenantFromContext(ctx); tenant.WorkspaceID == nil {
+		transition.UserID = &tenant.UserID
+	}
+	if err := s.statusRepo.CreateTransition(ctx, transition); err != nil {
+		return nil, err
+	}
+	return transition, nil
+}
+
+func (s *statusService) DeleteTransition(ctx context.Context, transitionID uint) error {
+	if err := checkStatusManager(ctx); err != nil {
+		return err
+	}
+	if err := s.statusRepo.DeleteTransition(ctx, transitionID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTransitionNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// todoTransitions evaluates the workflow rules for moving the todo from its status to every
+// other status of the list
+func todoTransitions(statuses []models.StatusDefinition, rules []models.StatusTransition, todo *models.Todo) models.TodoTransitions {
+	from := findStatus(statuses, todo.Status)
+	transitions := models.TodoTransitions{Current: todo.Status, Transitions: make([]models.TodoTransition, 0, len(statuses))}
+	for i := range statuses {
+		to := &statuses[i]
+		if from != nil && to.ID == from.ID {
+			continue
+		}
+		reason := transitionBlocked(rules, from, to, todo)
+		transitions.Transitions = append(transitions.Transitions, models.TodoTransition{
+			StatusID: to.ID,
+			Status:   to.Name,
+			IsDone:   to.IsDone,
+			Allowed:  reason == "",
+			Reason:   reason,
+		})
+	}
+	return transitions
+}
+
+// transitionBlocked returns why the rules keep the todo from moving from its status, from, to
+// the status to, or "" when they allow it
+func transitionBlocked(rules []models.StatusTransition, from, to *models.StatusDefinition, todo *models.Todo) string {
+	restricted, needsAssignee := false, false
+	for _, rule := range rules {
+		if rule.ToStatusID != to.ID {
+			continue
+		}
+		restricted = true
+		if rule.FromStatusID != nil && (from == nil || *rule.FromStatusID != from.ID) {
+			continue
+		}
+		if rule.RequiresAssignee && todo.AssigneeID == nil {
+			needsAssignee = true
+			continue
+		}
+		return ""
+	}
+	switch {
+	case !restricted:
+		return ""
+	case needsAssignee:
+		return "the todo must be assigned first"
+	}
+	return fmt.Sprintf("%s cannot be entered from %s", to.Name, todo.Status)
+}
+
+// checkTransition returns a TransitionError unless the rules let the todo move to status to
+func checkTransition(statuses []models.StatusDefinition, rules []models.StatusTransition, todo *models.Todo, to *models.StatusDefinition) error {
+	transitions := todoTransitions(statuses, rules, todo)
+	var blocked *models.TodoTransition
+	allowed := make([]models.TodoStatus, 0, len(transitions.Transitions))
+	for i, transition := range transitions.Transitions {
+		if transition.Allowed {
+			allowed = append(allowed, transition.Status)
+		} else if transition.StatusID == to.ID {
+			blocked = &transitions.Transitions[i]
+		}
+	}
+	if blocked == nil {
+		return nil
+	}
+	return &TransitionError{From: todo.Status, To: to.Name, Reason: blocked.Reason, Allowed: allowed}
+}
+
+// statusByID returns the status with id from statuses
+func statusByID(statuses []models.StatusDefinition, id uint) *models.StatusDefinition {
+	for i := range statuses {
+		if statuses[i].ID == id {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// checkStatusKinds fails unless statuses has both an open and a done status, so todos can
+// always be reopened and completed
+func checkStatusKinds(statuses []models.StatusDefinition) error {
+	if firstStatus(statuses, false) == nil || firstStatus(statuses, true) == nil {
+		return ErrStatusRequired
+	}
+	return nil
+}
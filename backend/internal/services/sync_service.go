@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"log"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultSyncPullLimit = 500
+	MaxSyncPullLimit     = 1000
+
+	// syncReceiptRetention is how long a client can retry a push and get the earlier results
+	syncReceiptRetention = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidSyncCursor = errors.New("invalid sync cursor")
+	ErrSyncTitleRequired = errors.New("title is required to create a todo")
+)
+
+type SyncService interface {
+	Pull(ctx context.Context, userID uint, cursor string, limit int) (*models.SyncPullResponse, error)
+	Push(ctx context.Context, userID uint, changes []models.SyncClientChange) (*models.SyncPushResponse, error)
+	// PurgeReceipts forgets the client changes applied long enough ago that clients no longer retry them
+	PurgeReceipts(ctx context.Context, now time.Time) (int64, error)
+}
+
+type syncService struct {
+	todoRepo    repositories.TodoRepository
+	todoService TodoService
+}
+
+func NewSyncService(todoRepo repositories.TodoRepository, todoService TodoService) SyncService {
+	return &syncService{todoRepo: todoRepo, todoService: todoService}
+}
+
+func parseSyncCursor(cursor string) (uint64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidSyncCursor
+	}
+	return seq, nil
+}
+
+func formatSyncCursor(seq uint64) string {
+	return strconv.FormatUint(seq, 10)
+}
+
+// Pull returns the latest state of every todo changed after the cursor. A todo changed several
+// times within the page is reported once, at the position of its latest change.
+func (s *syncService) Pull(ctx context.Context, userID uint, cursor string, limit int) (*models.SyncPullResponse, error) {
+	since, err := parseSyncCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultSyncPullLimit
+	}
+	if limit > MaxSyncPullLimit {
+		limit = MaxSyncPullLimit
+	}
+
+	// Fetch one extra change to know whether another page follows
+	changes, err := s.todoRepo.FindChangesSince(ctx, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	hasMore := len(changes) > limit
+	if hasMore {
+		changes = changes[:limit]
+	}
+	if len(changes) == 0 {
+		return &models.SyncPullResponse{Changes: []models.SyncChange{}, Cursor: formatSyncCursor(since)}, nil
+	}
+
+	latest := make(map[uint]uint64, len(changes))
+	ids := make([]uint, 0, len(changes))
+	for _, change := range changes {
+		if _, seen := latest[change.TodoID]; !seen {
+			ids = append(ids, change.TodoID)
+		}
+		latest[change.TodoID] = change.Seq
+	}
+
+	todos, err := s.todoRepo.FindTodosByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	todosByID := make(map[uint]*models.Todo, len(todos))
+	for i := range todos {
+		todosByID[todos[i].ID] = &todos[i]
+	}
+
+	result := make([]models.SyncChange, 0, len(latest))
+	for _, change := range changes {
+		if latest[change.TodoID] != change.Seq {
+			continue
+		}
+		result = append(result, toSyncChange(change, todosByID[change.TodoID]))
+	}
+
+	return &models.SyncPullResponse{
+		Changes: result,
+		Cursor:  formatSyncCursor(changes[len(changes)-1].Seq),
+		HasMore: hasMore,
+	}, nil
+}
+
+// toSyncChange builds the client view of a change; a missing todo is reported as a tombstone
+func toSyncChange(change models.TodoChange, todo *models.Todo) models.SyncChange {
+	syncChange := models.SyncChange{
+		Seq:       change.Seq,
+		Operation: change.Operation,
+		TodoID:    change.TodoID,
+	}
+	if change.Operation == models.ChangeDelete || todo == nil {
+		syncChange.Deleted = true
+		return syncChange
+	}
+	syncChange.Todo = todo
+	return syncChange
+}
+
+// Push applies offline changes in order. Updates and deletes made against an older version than
+// the server's latest change are not applied and are reported as conflicts. Changes the server
+// already applied, identified by their client ID, are not applied again.
+func (s *syncService) Push(ctx context.Context, userID uint, changes []models.SyncClientChange) (*models.SyncPushResponse, error) {
+	results := make([]models.SyncChangeResult, 0, len(changes))
+	for _, change := range changes {
+		results = append(results, s.apply(ctx, userID, change))
+	}
+	return &models.SyncPushResponse{Results: results}, nil
+}
+
+func (s *syncService) apply(ctx context.Context, userID uint, change models.SyncClientChange) models.SyncChangeResult {
+	result := models.SyncChangeResult{ClientID: change.ClientID, TodoID: change.TodoID}
+
+	// The receipt is looked up and written under the tenant's write lock, in the transaction of the
+	// change itself, so a retried push never applies a change twice and a change is never applied
+	// without its receipt
+	var todoID uint
+	var conflict *models.SyncChange
+	err := s.todoRepo.InTransaction(ctx, userID, func(ctx context.Context) error {
+		// A retried push reports the change as applied to the same todo, with its current state
+		receipt, err := s.todoRepo.FindSyncReceipt(ctx, userID, change.ClientID)
+		if err == nil {
+			todoID = receipt.TodoID
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if change.Operation != models.ChangeCreate {
+			latest, err := s.todoRepo.FindLatestChange(ctx, change.TodoID)
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					err = ErrTodoNotFound
+				}
+				return err
+			}
+			if latest.WorkspaceID == nil && latest.UserID != userID {
+				return ErrForbidden
+			}
+			if latest.Seq > change.BaseSeq {
+				conflict, err = s.serverVersion(ctx, latest)
+				return err
+			}
+		}
+
+		if todoID, err = s.applyChange(ctx, userID, change); err != nil {
+			return err
+		}
+		return s.todoRepo.CreateSyncReceipt(ctx, &models.SyncReceipt{UserID: userID, ClientID: change.ClientID, TodoID: todoID})
+	})
+	if err != nil {
+		return rejectSyncChange(result, err)
+	}
+	if conflict != nil {
+		result.Status = models.SyncConflict
+		result.Server = conflict
+		return result
+	}
+	return s.applied(ctx, result, todoID)
+}
+
+// applied reports a change as applied to the todo, along with the todo's latest server version
+func (s *syncService) applied(ctx context.Context, result models.SyncChangeResult, todoID uint) models.SyncChangeResult {
+	result.Status = models.SyncApplied
+	result.TodoID = todoID
+	latest, err := s.todoRepo.FindLatestChange(ctx, todoID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load latest change for synced todo %d: %v", todoID, err)
+		return result
+	}
+	server, err := s.serverVersion(ctx, latest)
+	if err != nil {
+		log.Printf("ERROR: Failed to load server version for synced todo %d: %v", todoID, err)
+		return result
+	}
+	result.Server = server
+	return result
+}
+
+// applyChange performs the change through TodoService so the usual ownership rules apply. It
+// runs in the transaction of apply, so a change whose status is refused leaves nothing behind.
+func (s *syncService) applyChange(ctx context.Context, userID uint, change models.SyncClientChange) (uint, error) {
+	switch change.Operation {
+	case models.ChangeCreate:
+		if change.Title == nil {
+			return 0, ErrSyncTitleRequired
+		}
+		todo, err := s.todoService.CreateTodo(ctx, userID, *change.Title, valueOrEmpty(change.Description), valueOrEmpty(change.ImageURL), change.DueDate)
+		if err != nil {
+			return 0, err
+		}
+		if change.Status != nil && *change.Status != todo.Status {
+			if _, err := s.todoService.UpdateTodoStatus(ctx, userID, todo.ID, *change.Status, false); err != nil {
+				return 0, err
+			}
+		}
+		return todo.ID, nil
+
+	case models.ChangeUpdate:
+		hasContent := change.Title != nil || change.Description != nil || change.ImageURL != nil || change.DueDate != nil
+		if !hasContent && change.Status == nil {
+			return 0, ErrNoUpdateFieldsProvided
+		}
+		if hasContent {
+			if _, err := s.todoService.UpdateTodo(ctx, userID, change.TodoID, change.Title, change.Description, change.ImageURL, change.DueDate); err != nil {
+				return 0, err
+			}
+		}
+		if change.Status != nil {
+			if _, err := s.todoService.UpdateTodoStatus(ctx, userID, change.TodoID, *change.Status, false); err != nil {
+				return 0, err
+			}
+		}
+		return change.TodoID, nil
+
+	default:
+		return change.TodoID, s.todoService.DeleteTodo(ctx, userID, change.TodoID)
+	}
+}
+
+func (s *syncService) serverVersion(ctx context.Context, change *models.TodoChange) (*models.SyncChange, error) {
+	var todo *models.Todo
+	if change.Operation != models.ChangeDelete {
+		todos, err := s.todoRepo.FindTodosByIDs(ctx, []uint{change.TodoID})
+		if err != nil {
+			return nil, err
+		}
+		if len(todos) > 0 {
+			todo = &todos[0]
+		}
+	}
+	syncChange := toSyncChange(*change, todo)
+	return &syncChange, nil
+}
+
+func (s *syncService) PurgeReceipts(ctx context.Context, now time.Time) (int64, error) {
+	return s.todoRepo.PurgeSyncReceipts(ctx, now.Add(-syncReceiptRetention))
+}
+
+// rejectSyncChange reports known business errors to the client and hides internal ones
+func rejectSyncChange(result models.SyncChangeResult, err error) models.SyncChangeResult {
+	result.Status = models.SyncRejected
+	switch {
+	case errors.Is(err, ErrTodoNotFound), errors.Is(err, ErrForbidden),
+		errors.Is(err, ErrNoUpdateFieldsProvided), errors.Is(err, ErrSyncTitleRequired),
+		errors.Is(err, ErrUnknownStatus), errors.Is(err, ErrWIPLimitReached), errors.Is(err, ErrTransitionNotAllowed),
+		errors.Is(err, ErrTodoBlocked):
+		result.Error = err.Error()
+	default:
+		log.Printf("ERROR: Failed to apply sync change %s: %v", result.ClientID, err)
+		result.Error = "failed to apply change"
+	}
+	return result
+}
+
+func valueOrEmpty(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// fakeSyncRepo keeps the writes made in a transaction pending and commits them only when the
+// transaction's function succeeds, like InTransaction does
+type fakeSyncRepo struct {
+	repositories.TodoRepository
+	receiptErr error
+	receipts   map[string]uint
+	pending    []string
+	committed  []string
+}
+
+func (r *fakeSyncRepo) InTransaction(ctx context.Context, _ uint, fn func(ctx context.Context) error) error {
+	r.pending = nil
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	r.committed = append(r.committed, r.pending...)
+	return nil
+}
+
+func (r *fakeSyncRepo) FindSyncReceipt(_ context.Context, _ uint, clientID string) (*models.SyncReceipt, error) {
+	if todoID, ok := r.receipts[clientID]; ok {
+		return &models.SyncReceipt{ClientID: clientID, TodoID: todoID}, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeSyncRepo) CreateSyncReceipt(_ context.Context, receipt *models.SyncReceipt) error {
+	if r.receiptErr != nil {
+		return r.receiptErr
+	}
+	r.receipts[receipt.ClientID] = receipt.TodoID
+	r.pending = append(r.pending, "receipt "+receipt.ClientID)
+	return nil
+}
+
+func (r *fakeSyncRepo) FindLatestChange(_ context.Context, todoID uint) (*models.TodoChange, error) {
+	return &models.TodoChange{Seq: 1, TodoID: todoID, Operation: models.ChangeCreate}, nil
+}
+
+func (r *fakeSyncRepo) FindTodosByIDs(_ context.Context, ids []uint) ([]models.Todo, error) {
+	return []models.Todo{{ID: ids[0]}}, nil
+}
+
+// fakeSyncTodos creates todo 11 and refuses moves into statuses at their WIP limit
+type fakeSyncTodos struct {
+	TodoService
+	repo *fakeSyncRepo
+	full models.TodoStatus
+}
+
+func (s *fakeSyncTodos) CreateTodo(_ context.Context, userID uint, title, _, _ string, _ *time.Time) (*models.Todo, error) {
+	s.repo.pending = append(s.repo.pending, "create "+title)
+	return &models.Todo{ID: 11, UserID: userID, Title: title, Status: models.StatusPending}, nil
+}
+
+func (s *fakeSyncTodos) UpdateTodoStatus(_ context.Context, _, todoID uint, status models.TodoStatus, _ bool) (*models.Todo, error) {
+	if status == s.full {
+		return nil, ErrWIPLimitReached
+	}
+	s.repo.pending = append(s.repo.pending, "status "+string(status))
+	return &models.Todo{ID: todoID, Status: status}, nil
+}
+
+func TestSyncPushAppliesChangeAndReceiptTogether(t *testing.T) {
+	title, status := "Pay rent", models.StatusInProgress
+	create := models.SyncClientChange{ClientID: "c1", Operation: models.ChangeCreate, Title: &title, Status: &status}
+
+	tests := []struct {
+		name       string
+		full       models.TodoStatus
+		receiptErr error
+		want       models.SyncResultStatus
+		committed  []string
+	}{
+		{name: "applied", want: models.SyncApplied, committed: []string{"create Pay rent", "status " + string(models.StatusInProgress), "receipt c1"}},
+		{name: "status refused", full: models.StatusInProgress, want: models.SyncRejected},
+		{name: "receipt not saved", receiptErr: errors.New("connection reset"), want: models.SyncRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeSyncRepo{receipts: map[string]uint{}, receiptErr: tt.receiptErr}
+			service := NewSyncService(repo, &fakeSyncTodos{repo: repo, full: tt.full})
+
+			resp, err := service.Push(context.Background(), 1, []models.SyncClientChange{create, create})
+			if err != nil {
+				t.Fatalf("Push: %v", err)
+			}
+			if resp.Results[0].Status != tt.want {
+				t.Fatalf("status = %s (%s), want %s", resp.Results[0].Status, resp.Results[0].Error, tt.want)
+			}
+			// The second copy is a retry: it must not create the todo again
+			if !slices.Equal(repo.committed, tt.committed) {
+				t.Fatalf("committed %v, want %v", repo.committed, tt.committed)
+			}
+		})
+	}
+}
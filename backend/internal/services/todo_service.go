@@ -3,8 +3,12 @@ package services
 import (
 	"context"
 	"errors"
+	"github.com/xNatthapol/todo-list/internal/config"
 	"github.com/xNatthapol/todo-list/internal/models"
 	"github.com/xNatthapol/todo-list/internal/repositories"
+	"log"
+	"slices"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -13,46 +17,107 @@ var (
 	ErrTodoNotFound           = errors.New("todo not found")
 	ErrForbidden              = errors.New("user does not have permission to access this resource")
 	ErrNoUpdateFieldsProvided = errors.New("no update fields provided")
+	ErrUserNotInTodoScope     = errors.New("user is not a member of the todo's workspace")
+	ErrWatcherNotFound        = errors.New("user is not watching this todo")
+	ErrSelfDependency         = errors.New("a todo cannot block itself")
+	ErrDependencyExists       = errors.New("todo is already blocked by this todo")
+	ErrDependencyCycle        = errors.New("dependency would create a cycle")
+	ErrDependencyNotFound     = errors.New("todo is not blocked by this todo")
+	ErrTodoBlocked            = errors.New("todo still has open blockers; pass force to complete it anyway")
 )
 
 type TodoService interface {
-	CreateTodo(ctx context.Context, userID uint, title string, description string, imageURL string) (*models.Todo, error)
-	GetTodosByUserID(ctx context.Context, userID uint) ([]models.Todo, error)
+	CreateTodo(ctx context.Context, userID uint, title string, description string, imageURL string, dueDate *time.Time) (*models.Todo, error)
+	GetTodosByUserID(ctx context.Context, userID uint, filter models.TodoFilter) ([]models.Todo, error)
 	GetTodoByID(ctx context.Context, userID, todoID uint) (*models.Todo, error)
-	UpdateTodo(ctx context.Context, userID, todoID uint, title *string, description *string, imageURL *string) (*models.Todo, error)
-	UpdateTodoStatus(ctx context.Context, userID, todoID uint, status models.TodoStatus) (*models.Todo, error)
+	UpdateTodo(ctx context.Context, userID, todoID uint, title *string, description *string, imageURL *string, dueDate *time.Time) (*models.Todo, error)
+	// UpdateTodoStatus moves the todo to the end of the column of status, one of the list's
+	// statuses; entering a done status completes the todo and leaving it reopens the todo. Moves
+	// the list's workflow rules do not allow fail with a *TransitionError. Completing a todo with
+	// open blockers fails with ErrTodoBlocked unless force is set.
+	UpdateTodoStatus(ctx context.Context, userID, todoID uint, status models.TodoStatus, force bool) (*models.Todo, error)
+	// MoveTodo places the todo at a position in a board column, changing its status like
+	// UpdateTodoStatus when the column is another status
+	MoveTodo(ctx context.Context, userID, todoID uint, req models.MoveTodoRequest) (*models.Todo, error)
+	// GetTransitions tells which statuses the workflow rules let the todo move to
+	GetTransitions(ctx context.Context, userID, todoID uint) (*models.TodoTransitions, error)
+	// ResolveStatus maps a status from another system onto the list's statuses: the status of
+	// that name when its done flag matches done, else the first done or first open status
+	ResolveStatus(ctx context.Context, name models.TodoStatus, done bool) (models.TodoStatus, error)
 	DeleteTodo(ctx context.Context, userID, todoID uint) error
+	// AssignTodo makes assigneeID responsible for the todo, or unassigns it when assigneeID is nil.
+	// The assignee starts watching the todo.
+	AssignTodo(ctx context.Context, userID, todoID uint, assigneeID *uint) (*models.Todo, error)
+	ListWatchers(ctx context.Context, userID, todoID uint) ([]models.TodoWatcherResponse, error)
+	AddWatcher(ctx context.Context, userID, todoID, watcherID uint) ([]models.TodoWatcherResponse, error)
+	RemoveWatcher(ctx context.Context, userID, todoID, watcherID uint) error
+	// AddBlocker records that blockerID blocks the todo and returns the updated todo. Links that
+	// would make a todo depend on itself, directly or through others, are refused.
+	AddBlocker(ctx context.Context, userID, todoID, blockerID uint) (*models.Todo, error)
+	RemoveBlocker(ctx context.Context, userID, todoID, blockerID uint) error
+	// GetDependencyGraph returns the tenant's todos that take part in dependencies, the links
+	// between them, and an order in which every todo comes after its blockers
+	GetDependencyGraph(ctx context.Context) (*models.DependencyGraph, error)
+	// SendDueReminders publishes a due-soon event for every unfinished todo due within the
+	// configured window that has not been reminded of its due date yet
+	SendDueReminders(ctx context.Context, now time.Time) (int, error)
 }
 
 type todoService struct {
-	todoRepo repositories.TodoRepository
+	todoRepo      repositories.TodoRepository
+	statusRepo    repositories.StatusRepository
+	userRepo      repositories.UserRepository
+	workspaceRepo repositories.WorkspaceRepository
+	events        EventBus
+	cfg           *config.Config
 }
 
-func NewTodoService(todoRepo repositories.TodoRepository) TodoService {
-	return &todoService{todoRepo: todoRepo}
+func NewTodoService(todoRepo repositories.TodoRepository, statusRepo repositories.StatusRepository, userRepo repositories.UserRepository, workspaceRepo repositories.WorkspaceRepository, events EventBus, cfg *config.Config) TodoService {
+	return &todoService{todoRepo: todoRepo, statusRepo: statusRepo, userRepo: userRepo, workspaceRepo: workspaceRepo, events: events, cfg: cfg}
 }
 
-func (s *todoService) CreateTodo(ctx context.Context, userID uint, title string, description string, imageURL string) (*models.Todo, error) {
+// dueReminderBatchSize bounds the todos reminded per query
+const dueReminderBatchSize = 200
+
+func (s *todoService) CreateTodo(ctx context.Context, userID uint, title string, description string, imageURL string, dueDate *time.Time) (*models.Todo, error) {
 	todo := &models.Todo{
 		Title:       title,
 		Description: description,
 		ImageURL:    imageURL,
+		DueDate:     dueDate,
 		UserID:      userID,
-		Status:      models.StatusPending,
 	}
 
-	err := s.todoRepo.CreateTodo(ctx, todo)
+	if err := checkTodoQuota(ctx, s.todoRepo, 1); err != nil {
+		return nil, err
+	}
+	// New todos go to the end of the first open status
+	statuses, err := loadStatuses(ctx, s.statusRepo)
+	if err != nil {
+		return nil, err
+	}
+	status := firstStatus(statuses, false)
+	if status == nil {
+		return nil, ErrStatusRequired
+	}
+	todo.Status = status.Name
+	if todo.Position, err = s.todoRepo.NextPosition(ctx, status.Name); err != nil {
+		return nil, err
+	}
+	err = s.todoRepo.CreateTodo(ctx, todo)
 	if err != nil {
 		return nil, err
 	}
 	return todo, nil
 }
 
-func (s *todoService) GetTodosByUserID(ctx context.Context, userID uint) ([]models.Todo, error) {
-	return s.todoRepo.FindTodosByUserID(ctx, userID)
+func (s *todoService) GetTodosByUserID(ctx context.Context, userID uint, filter models.TodoFilter) ([]models.Todo, error) {
+	loadPreferences(ctx, s.userRepo, userID, s.cfg).applyToFilter(&filter, time.Now())
+	return s.todoRepo.FindTodos(ctx, filter)
 }
 
-// checkOwnership verifies if the todo exists and belongs to the user
+// checkOwnership verifies if the todo exists and belongs to the request's tenant: the user's
+// personal space, or a workspace they are a member of
 func (s *todoService) checkOwnership(ctx context.Context, userID, todoID uint) (*models.Todo, error) {
 	todo, err := s.todoRepo.FindTodoByID(ctx, todoID)
 	if err != nil {
@@ -62,7 +127,8 @@ func (s *todoService) checkOwnership(ctx context.Context, userID, todoID uint) (
 		return nil, err
 	}
 
-	if todo.UserID != userID {
+	// The tenant scope already hides other tenants' todos; this guards against a missing scope
+	if todo.WorkspaceID == nil && todo.UserID != userID {
 		return nil, ErrForbidden
 	}
 	return todo, nil
@@ -76,8 +142,8 @@ func (s *todoService) GetTodoByID(ctx context.Context, userID, todoID uint) (*mo
 	return todo, nil
 }
 
-func (s *todoService) UpdateTodo(ctx context.Context, userID, todoID uint, title *string, description *string, imageURL *string) (*models.Todo, error) {
-	if title == nil && description == nil && imageURL == nil {
+func (s *todoService) UpdateTodo(ctx context.Context, userID, todoID uint, title *string, description *string, imageURL *string, dueDate *time.Time) (*models.Todo, error) {
+	if title == nil && description == nil && imageURL == nil && dueDate == nil {
 		return nil, ErrNoUpdateFieldsProvided
 	}
 
@@ -102,6 +168,10 @@ func (s *todoService) UpdateTodo(ctx context.Context, userID, todoID uint, title
 		todo.ImageURL = *imageURL
 		updated = true
 	}
+	if dueDate != nil && (todo.DueDate == nil || !todo.DueDate.Equal(*dueDate)) {
+		todo.DueDate = dueDate
+		updated = true
+	}
 
 	// Only save if something actually changed
 	if !updated {
@@ -115,15 +185,23 @@ func (s *todoService) UpdateTodo(ctx context.Context, userID, todoID uint, title
 	return todo, nil
 }
 
-func (s *todoService) UpdateTodoStatus(ctx context.Context, userID, todoID uint, status models.TodoStatus) (*models.Todo, error) {
+func (s *todoService) UpdateTodoStatus(ctx context.Context, userID, todoID uint, status models.TodoStatus, force bool) (*models.Todo, error) {
 	// checkOwnership verifies if the todo exists and belongs to the user
 	todo, err := s.checkOwnership(ctx, userID, todoID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Update status
-	todo.Status = status
+	target, err := s.targetStatus(ctx, todo, status, force)
+	if err != nil {
+		return nil, err
+	}
+	if target.Name != todo.Status {
+		if todo.Position, err = s.todoRepo.NextPosition(ctx, target.Name); err != nil {
+			return nil, err
+		}
+	}
+	setStatus(todo, target)
 
 	err = s.todoRepo.UpdateTodo(ctx, todo)
 	if err != nil {
@@ -132,6 +210,119 @@ func (s *todoService) UpdateTodoStatus(ctx context.Context, userID, todoID uint,
 	return todo, nil
 }
 
+func (s *todoService) MoveTodo(ctx context.Context, userID, todoID uint, req models.MoveTodoRequest) (*models.Todo, error) {
+	todo, err := s.checkOwnership(ctx, userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.targetStatus(ctx, todo, req.Status, req.Force)
+	if err != nil {
+		return nil, err
+	}
+
+	column, err := s.todoRepo.FindTodos(ctx, models.TodoFilter{Status: target.Name, Sort: models.SortPosition})
+	if err != nil {
+		return nil, err
+	}
+	others := make([]models.Todo, 0, len(column)+1)
+	for _, other := range column {
+		if other.ID != todo.ID {
+			others = append(others, other)
+		}
+	}
+	position := min(req.Position, len(others))
+	column = slices.Insert(others, position, *todo)
+
+	setStatus(todo, target)
+	todo.Position = position
+	if err := s.todoRepo.MoveTodo(ctx, todo, column); err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+func (s *todoService) GetTransitions(ctx context.Context, userID, todoID uint) (*models.TodoTransitions, error) {
+	todo, err := s.checkOwnership(ctx, userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := loadStatuses(ctx, s.statusRepo)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := s.statusRepo.FindTransitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transitions := todoTransitions(statuses, rules, todo)
+	return &transitions, nil
+}
+
+// targetStatus returns the list's status named name that the todo is moving to. Moving into
+// another status fails when the workflow rules do not allow it or the status is at its WIP limit,
+// and completing the todo fails while it has open blockers unless force is set.
+func (s *todoService) targetStatus(ctx context.Context, todo *models.Todo, name models.TodoStatus, force bool) (*models.StatusDefinition, error) {
+	statuses, err := loadStatuses(ctx, s.statusRepo)
+	if err != nil {
+		return nil, err
+	}
+	target := findStatus(statuses, name)
+	if target == nil {
+		return nil, ErrUnknownStatus
+	}
+	if target.Name == todo.Status {
+		return target, nil
+	}
+	if target.IsDone && !todo.IsDone() && !force && todo.HasOpenBlockers() {
+		return nil, ErrTodoBlocked
+	}
+
+	rules, err := s.statusRepo.FindTransitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTransition(statuses, rules, todo, target); err != nil {
+		return nil, err
+	}
+	if target.WIPLimit == 0 {
+		return target, nil
+	}
+
+	counts, err := s.todoRepo.CountTodosByStatus(ctx, models.TodoFilter{Status: target.Name})
+	if err != nil {
+		return nil, err
+	}
+	if counts[target.Name] >= int64(target.WIPLimit) {
+		return nil, ErrWIPLimitReached
+	}
+	return target, nil
+}
+
+// setStatus puts the todo in status, keeping the completion time of todos that were already done
+func setStatus(todo *models.Todo, status *models.StatusDefinition) {
+	if status.IsDone && todo.CompletedAt == nil {
+		now := time.Now()
+		todo.CompletedAt = &now
+	} else if !status.IsDone {
+		todo.CompletedAt = nil
+	}
+	todo.Status = status.Name
+}
+
+func (s *todoService) ResolveStatus(ctx context.Context, name models.TodoStatus, done bool) (models.TodoStatus, error) {
+	statuses, err := loadStatuses(ctx, s.statusRepo)
+	if err != nil {
+		return "", err
+	}
+	if status := findStatus(statuses, name); status != nil && status.IsDone == done {
+		return status.Name, nil
+	}
+	if status := firstStatus(statuses, done); status != nil {
+		return status.Name, nil
+	}
+	return "", ErrStatusRequired
+}
+
 func (s *todoService) DeleteTodo(ctx context.Context, userID, todoID uint) error {
 	_, err := s.checkOwnership(ctx, userID, todoID)
 	if err != nil {
@@ -147,3 +338,259 @@ func (s *todoService) DeleteTodo(ctx context.Context, userID, todoID uint) error
 	}
 	return nil
 }
+
+// checkInScope verifies memberID can see the todo: its owner for a personal todo, or a member of
+// the todo's workspace
+func (s *todoService) checkInScope(ctx context.Context, todo *models.Todo, memberID uint) error {
+	if todo.WorkspaceID == nil {
+		if memberID != todo.UserID {
+			return ErrUserNotInTodoScope
+		}
+		return nil
+	}
+	if _, err := s.workspaceRepo.FindMembership(ctx, *todo.WorkspaceID, memberID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotInTodoScope
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *todoService) AssignTodo(ctx context.Context, userID, todoID uint, assigneeID *uint) (*models.Todo, error) {
+	todo, err := s.checkOwnership(ctx, userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := todo.AssigneeID
+	if (previous == nil && assigneeID == nil) || (previous != nil && assigneeID != nil && *previous == *assigneeID) {
+		return todo, nil
+	}
+
+	event := &models.TodoEvent{TodoID: todo.ID, UserID: userID, Type: models.TodoEventAssigned, SubjectID: assigneeID}
+	if assigneeID == nil {
+		event.Type = models.TodoEventUnassigned
+		event.SubjectID = previous
+	} else if err := s.checkInScope(ctx, todo, *assigneeID); err != nil {
+		return nil, err
+	}
+
+	todo.AssigneeID = assigneeID
+	if err := s.todoRepo.AssignTodo(ctx, todo, event); err != nil {
+		return nil, err
+	}
+	s.events.Publish(ctx, todoEvents(todo, []models.TodoEvent{*event})...)
+
+	if assigneeID != nil {
+		if err := s.todoRepo.AddWatcher(ctx, &models.TodoWatcher{TodoID: todo.ID, UserID: *assigneeID}); err != nil {
+			log.Printf("ERROR: Failed to add assignee %d as watcher of todo %d: %v", *assigneeID, todo.ID, err)
+		}
+	}
+	return todo, nil
+}
+
+func (s *todoService) ListWatchers(ctx context.Context, userID, todoID uint) ([]models.TodoWatcherResponse, error) {
+	if _, err := s.checkOwnership(ctx, userID, todoID); err != nil {
+		return nil, err
+	}
+	return s.todoRepo.FindWatchers(ctx, todoID)
+}
+
+func (s *todoService) AddWatcher(ctx context.Context, userID, todoID, watcherID uint) ([]models.TodoWatcherResponse, error) {
+	todo, err := s.checkOwnership(ctx, userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkInScope(ctx, todo, watcherID); err != nil {
+		return nil, err
+	}
+	if err := s.todoRepo.AddWatcher(ctx, &models.TodoWatcher{TodoID: todoID, UserID: watcherID}); err != nil {
+		return nil, err
+	}
+	return s.todoRepo.FindWatchers(ctx, todoID)
+}
+
+func (s *todoService) RemoveWatcher(ctx context.Context, userID, todoID, watcherID uint) error {
+	if _, err := s.checkOwnership(ctx, userID, todoID); err != nil {
+		return err
+	}
+	if err := s.todoRepo.RemoveWatcher(ctx, todoID, watcherID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrWatcherNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *todoService) AddBlocker(ctx context.Context, userID, todoID, blockerID uint) (*models.Todo, error) {
+	if _, err := s.checkOwnership(ctx, userID, todoID); err != nil {
+		return nil, err
+	}
+	if _, err := s.checkOwnership(ctx, userID, blockerID); err != nil {
+		return nil, err
+	}
+	if blockerID == todoID {
+		return nil, ErrSelfDependency
+	}
+
+	// The checks run under the list's write lock, so concurrent requests cannot both pass them
+	dependency := &models.TodoDependency{UserID: userID, BlockerID: blockerID, BlockedID: todoID}
+	err := s.todoRepo.CreateDependency(ctx, dependency, func(dependencies []models.TodoDependency) error {
+		for _, existing := range dependencies {
+			if existing.BlockerID == blockerID && existing.BlockedID == todoID {
+				return ErrDependencyExists
+			}
+		}
+		// The link closes a cycle when the blocker already waits on the todo
+		if dependsOn(dependencies, blockerID, todoID) {
+			return ErrDependencyCycle
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrDependencyExists
+		}
+		return nil, err
+	}
+	return s.todoRepo.FindTodoByID(ctx, todoID)
+}
+
+func (s *todoService) RemoveBlocker(ctx context.Context, userID, todoID, blockerID uint) error {
+	if _, err := s.checkOwnership(ctx, userID, todoID); err != nil {
+		return err
+	}
+	if err := s.todoRepo.DeleteDependency(ctx, blockerID, todoID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDependencyNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *todoService) GetDependencyGraph(ctx context.Context) (*models.DependencyGraph, error) {
+	dependencies, err := s.todoRepo.FindDependencies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint
+	seen := make(map[uint]bool)
+	for _, dependency := range dependencies {
+		for _, id := range []uint{dependency.BlockerID, dependency.BlockedID} {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	nodes, err := s.todoRepo.FindTodoReferences(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if nodes == nil {
+		nodes = []models.TodoReference{}
+	}
+	if dependencies == nil {
+		dependencies = []models.TodoDependency{}
+	}
+	order, cyclic := topologicalOrder(nodes, dependencies)
+	return &models.DependencyGraph{Nodes: nodes, Edges: dependencies, Order: order, Cyclic: cyclic}, nil
+}
+
+// dependsOn reports whether todo from waits on todo to, directly or through other todos
+func dependsOn(dependencies []models.TodoDependency, from, to uint) bool {
+	blockers := make(map[uint][]uint)
+	for _, dependency := range dependencies {
+		blockers[dependency.BlockedID] = append(blockers[dependency.BlockedID], dependency.BlockerID)
+	}
+	visited := map[uint]bool{from: true}
+	queue := []uint{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, blocker := range blockers[id] {
+			if blocker == to {
+				return true
+			}
+			if !visited[blocker] {
+				visited[blocker] = true
+				queue = append(queue, blocker)
+			}
+		}
+	}
+	return false
+}
+
+// topologicalOrder lists the nodes so that every todo follows its blockers. Todos that are ready
+// at the same time are ordered by id, so the order is stable. Todos that wait on a cycle can never
+// be placed; they are returned separately, ordered by id.
+func topologicalOrder(nodes []models.TodoReference, dependencies []models.TodoDependency) (order, unplaced []uint) {
+	waiting := make(map[uint]int, len(nodes))
+	blocking := make(map[uint][]uint)
+	for _, node := range nodes {
+		waiting[node.ID] = 0
+	}
+	for _, dependency := range dependencies {
+		waiting[dependency.BlockedID]++
+		blocking[dependency.BlockerID] = append(blocking[dependency.BlockerID], dependency.BlockedID)
+	}
+
+	var ready []uint
+	for _, node := range nodes {
+		if waiting[node.ID] == 0 {
+			ready = append(ready, node.ID)
+		}
+	}
+	order = make([]uint, 0, len(nodes))
+	for len(ready) > 0 {
+		slices.Sort(ready)
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, id)
+		for _, blocked := range blocking[id] {
+			if waiting[blocked]--; waiting[blocked] == 0 {
+				ready = append(ready, blocked)
+			}
+		}
+	}
+	for _, node := range nodes {
+		if waiting[node.ID] > 0 {
+			unplaced = append(unplaced, node.ID)
+		}
+	}
+	slices.Sort(unplaced)
+	return order, unplaced
+}
+
+func (s *todoService) SendDueReminders(ctx context.Context, now time.Time) (int, error) {
+	sent := 0
+	for {
+		todos, err := s.todoRepo.FindTodosDueForReminder(ctx, now, now.Add(s.cfg.DueSoonWindow), dueReminderBatchSize)
+		if err != nil {
+			return sent, err
+		}
+		for _, todo := range todos {
+			recipient := todo.UserID
+			if todo.AssigneeID != nil {
+				recipient = *todo.AssigneeID
+			}
+			s.events.Publish(ctx, Event{
+				Type:        EventTodoDueSoon,
+				SubjectID:   recipient,
+				TodoID:      todo.ID,
+				WorkspaceID: todo.WorkspaceID,
+				Title:       todo.Title,
+			})
+			if err := s.todoRepo.MarkReminderSent(ctx, todo.ID, *todo.DueDate); err != nil {
+				return sent, err
+			}
+			sent++
+		}
+		if len(todos) < dueReminderBatchSize {
+			return sent, nil
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"github.com/xNatthapol/todo-list/internal/models"
+	"slices"
+	"testing"
+)
+
+func TestTopologicalOrderReportsTodosInCycles(t *testing.T) {
+	var nodes []models.TodoReference
+	for id := uint(1); id <= 5; id++ {
+		nodes = append(nodes, models.TodoReference{ID: id})
+	}
+	// 1 blocks 2; 3 and 4 block each other and 4 blocks 5, so 5 waits on the cycle
+	dependencies := []models.TodoDependency{
+		{BlockerID: 1, BlockedID: 2},
+		{BlockerID: 3, BlockedID: 4},
+		{BlockerID: 4, BlockedID: 3},
+		{BlockerID: 4, BlockedID: 5},
+	}
+
+	order, unplaced := topologicalOrder(nodes, dependencies)
+	if !slices.Equal(order, []uint{1, 2}) {
+		t.Errorf("order = %v, want [1 2]", order)
+	}
+	if !slices.Equal(unplaced, []uint{3, 4, 5}) {
+		t.Errorf("unplaced = %v, want [3 4 5]", unplaced)
+	}
+}
+
+func TestTopologicalOrderPlacesEveryTodoOfAcyclicGraph(t *testing.T) {
+	nodes := []models.TodoReference{{ID: 1}, {ID: 2}, {ID: 3}}
+	dependencies := []models.TodoDependency{{BlockerID: 3, BlockedID: 1}, {BlockerID: 1, BlockedID: 2}}
+
+	order, unplaced := topologicalOrder(nodes, dependencies)
+	if !slices.Equal(order, []uint{3, 1, 2}) || len(unplaced) != 0 {
+		t.Errorf("got order %v and unplaced %v, want [3 1 2] and none", order, unplaced)
+	}
+}
@@ -33,6 +33,11 @@ func NewUploadService(uploader *utils.GCSUploader) UploadService {
 	return &uploadService{uploader: uploader}
 }
 
+// userUploadPrefix is the object name prefix of every file uploaded by the user
+func userUploadPrefix(userID uint) string {
+	return fmt.Sprintf("uploads/%d/", userID)
+}
+
 // UploadImage handles the logic for uploading an image and returning its URL
 func (s *uploadService) UploadImage(ctx context.Context, userID uint, fileHeader *multipart.FileHeader) (string, error) {
 	// Check if uploader was initialized correctly
@@ -50,7 +55,7 @@ func (s *uploadService) UploadImage(ctx context.Context, userID uint, fileHeader
 	// Generate unique object name
 	extension := filepath.Ext(fileHeader.Filename)
 	// Store in uploads folder
-	objectName := fmt.Sprintf("uploads/%d/%s%s", userID, uuid.NewString(), extension)
+	objectName := userUploadPrefix(userID) + uuid.NewString() + extension
 
 	// Determine content type
 	contentType := fileHeader.Header.Get("Content-Type")
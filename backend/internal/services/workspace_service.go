@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"github.com/xNatthapol/todo-list/internal/models"
+	"github.com/xNatthapol/todo-list/internal/repositories"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWorkspaceNotFound       = errors.New("workspace not found")
+	ErrWorkspacePermission     = errors.New("your workspace role does not allow this action")
+	ErrWorkspaceMemberNotFound = errors.New("workspace member not found")
+	ErrAlreadyWorkspaceMember  = errors.New("user is already a member of this workspace")
+	ErrWorkspaceMemberQuota    = errors.New("workspace has reached its member limit")
+	ErrWorkspaceTodoQuota      = errors.New("workspace has reached its todo limit")
+	ErrLastWorkspaceOwner      = errors.New("a workspace must keep at least one owner")
+	ErrNoWorkspaceFields       = errors.New("no workspace fields provided")
+)
+
+// WorkspaceService manages workspaces and their members. Actions are authorized by the
+// acting user's role in the workspace.
+type WorkspaceService interface {
+	CreateWorkspace(ctx context.Context, userID uint, req models.CreateWorkspaceRequest) (*models.Workspace, error)
+	ListWorkspaces(ctx context.Context, userID uint) ([]models.Workspace, error)
+	GetWorkspace(ctx context.Context, userID, workspaceID uint) (*models.Workspace, error)
+	UpdateWorkspace(ctx context.Context, userID, workspaceID uint, req models.UpdateWorkspaceRequest) (*models.Workspace, error)
+	DeleteWorkspace(ctx context.Context, userID, workspaceID uint) error
+	ListMembers(ctx context.Context, userID, workspaceID uint) ([]models.WorkspaceMemberResponse, error)
+	AddMember(ctx context.Context, userID, workspaceID uint, req models.AddWorkspaceMemberRequest) ([]models.WorkspaceMemberResponse, error)
+	UpdateMemberRole(ctx context.Context, userID, workspaceID, memberID uint, role models.WorkspaceRole) error
+	// RemoveMember removes memberID; members may always remove themselves
+	RemoveMember(ctx context.Context, userID, workspaceID, memberID uint) error
+	// UpdateQuota changes the workspace's quotas on behalf of a site administrator
+	UpdateQuota(ctx context.Context, workspaceID uint, req models.UpdateWorkspaceQuotaRequest) (*models.Workspace, error)
+}
+
+type workspaceService struct {
+	workspaceRepo repositories.WorkspaceRepository
+	userRepo      repositories.UserRepository
+	events        EventBus
+	cfg           *config.Config
+}
+
+func NewWorkspaceService(workspaceRepo repositories.WorkspaceRepository, userRepo repositories.UserRepository, events EventBus, cfg *config.Config) WorkspaceService {
+	return &workspaceService{workspaceRepo: workspaceRepo, userRepo: userRepo, events: events, cfg: cfg}
+}
+
+// checkTodoQuota fails when adding todos would take the request's workspace over its quota
+func checkTodoQuota(ctx context.Context, todoRepo repositories.TodoRepository, adding int) error {
+	tenant, ok := repositories.TenantFromContext(ctx)
+	if !ok || tenant.MaxTodos == 0 {
+		return nil
+	}
+	count, err := todoRepo.CountTodos(ctx)
+	if err != nil {
+		return err
+	}
+	if count+int64(adding) > int64(tenant.MaxTodos) {
+		return ErrWorkspaceTodoQuota
+	}
+	return nil
+}
+
+func (s *workspaceService) CreateWorkspace(ctx context.Context, userID uint, req models.CreateWorkspaceRequest) (*models.Workspace, error) {
+	workspace := &models.Workspace{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		MaxMembers:  s.cfg.WorkspaceMaxMembers,
+		MaxTodos:    s.cfg.WorkspaceMaxTodos,
+	}
+	if err := s.workspaceRepo.CreateWorkspace(ctx, workspace, userID); err != nil {
+		return nil, err
+	}
+	workspace.Role = models.WorkspaceRoleOwner
+	return workspace, nil
+}
+
+func (s *workspaceService) ListWorkspaces(ctx context.Context, userID uint) ([]models.Workspace, error) {
+	return s.workspaceRepo.FindWorkspacesByUserID(ctx, userID)
+}
+
+// membership returns the user's membership of the workspace. Non-members get ErrWorkspaceNotFound
+// so the existence of other workspaces is not revealed.
+func (s *workspaceService) membership(ctx context.Context, userID, workspaceID uint) (*models.WorkspaceMember, error) {
+	member, err := s.workspaceRepo.FindMembership(ctx, workspaceID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, err
+	}
+	member.Workspace.Role = member.Role
+	return member, nil
+}
+
+func (s *workspaceService) managerMembership(ctx context.Context, userID, workspaceID uint) (*models.WorkspaceMember, error) {
+	member, err := s.membership(ctx, userID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if !member.Role.CanManage() {
+		return nil, ErrWorkspacePermission
+	}
+	return member, nil
+}
+
+func (s *workspaceService) GetWorkspace(ctx context.Context, userID, workspaceID uint) (*models.Workspace, error) {
+	member, err := s.membership(ctx, userID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	return &member.Workspace, nil
+}
+
+func (s *workspaceService) UpdateWorkspace(ctx context.Context, userID, workspaceID uint, req models.UpdateWorkspaceRequest) (*models.Workspace, error) {
+	if req.Name == nil && req.Description == nil {
+		return nil, ErrNoWorkspaceFields
+	}
+	member, err := s.managerMembership(ctx, userID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	workspace := &member.Workspace
+	if req.Name != nil {
+		workspace.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		workspace.Description = *req.Description
+	}
+	if err := s.workspaceRepo.UpdateWorkspace(ctx, workspace); err != nil {
+		return nil, err
+	}
+	return workspace, nil
+}
+
+func (s *workspaceService) DeleteWorkspace(ctx context.Context, userID, workspaceID uint) error {
+	member, err := s.membership(ctx, userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	if member.Role != models.WorkspaceRoleOwner {
+		return ErrWorkspacePermission
+	}
+	return s.workspaceRepo.DeleteWorkspace(ctx, workspaceID)
+}
+
+func (s *workspaceService) ListMembers(ctx context.Context, userID, workspaceID uint) ([]models.WorkspaceMemberResponse, error) {
+	if _, err := s.membership(ctx, userID, workspaceID); err != nil {
+		return nil, err
+	}
+	return s.workspaceRepo.FindMembers(ctx, workspaceID)
+}
+
+func (s *workspaceService) AddMember(ctx context.Context, userID, workspaceID uint, req models.AddWorkspaceMemberRequest) ([]models.WorkspaceMemberResponse, error) {
+	member, err := s.managerMembership(ctx, userID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByEmail(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if _, err := s.workspaceRepo.FindMembership(ctx, workspaceID, user.ID); err == nil {
+		return nil, ErrAlreadyWorkspaceMember
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if limit := member.Workspace.MaxMembers; limit > 0 {
+		count, err := s.workspaceRepo.CountMembers(ctx, workspaceID, "")
+		if err != nil {
+			return nil, err
+		}
+		if count >= int64(limit) {
+			return nil, ErrWorkspaceMemberQuota
+		}
+	}
+
+	err = s.workspaceRepo.CreateMember(ctx, &models.WorkspaceMember{
+		WorkspaceID: workspaceID,
+		UserID:      user.ID,
+		Role:        req.Role,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.events.Publish(ctx, Event{
+		Type:        EventWorkspaceMemberAdded,
+		ActorID:     userID,
+		SubjectID:   user.ID,
+		WorkspaceID: &workspaceID,
+		Title:       member.Workspace.Name,
+	})
+	return s.workspaceRepo.FindMembers(ctx, workspaceID)
+}
+
+// targetMembership loads memberID's membership and checks the actor may change it. Only owners
+// may change owners or make someone an owner.
+func (s *workspaceService) targetMembership(ctx context.Context, actor *models.WorkspaceMember, memberID uint, newRole models.WorkspaceRole) (*models.WorkspaceMember, error) {
+	target, err := s.workspaceRepo.FindMembership(ctx, actor.WorkspaceID, memberID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWorkspaceMemberNotFound
+		}
+		return nil, err
+	}
+	if (target.Role == models.WorkspaceRoleOwner || newRole == models.WorkspaceRoleOwner) && actor.Role != models.WorkspaceRoleOwner {
+		return nil, ErrWorkspacePermission
+	}
+	return target, nil
+}
+
+// ensureAnotherOwner fails when member is the workspace's last owner
+func (s *workspaceService) ensureAnotherOwner(ctx context.Context, member *models.WorkspaceMember) error {
+	if member.Role != models.WorkspaceRoleOwner {
+		return nil
+	}
+	owners, err := s.workspaceRepo.CountMembers(ctx, member.WorkspaceID, models.WorkspaceRoleOwner)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastWorkspaceOwner
+	}
+	return nil
+}
+
+func (s *workspaceService) UpdateMemberRole(ctx context.Context, userID, workspaceID, memberID uint, role models.WorkspaceRole) error {
+	actor, err := s.managerMembership(ctx, userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	target, err := s.targetMembership(ctx, actor, memberID, role)
+	if err != nil {
+		return err
+	}
+	if target.Role == role {
+		return nil
+	}
+	if err := s.ensureAnotherOwner(ctx, target); err != nil {
+		return err
+	}
+	return s.workspaceRepo.UpdateMemberRole(ctx, workspaceID, memberID, role)
+}
+
+func (s *workspaceService) RemoveMember(ctx context.Context, userID, workspaceID, memberID uint) error {
+	actor, err := s.membership(ctx, userID, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	target := actor
+	if memberID != userID {
+		if !actor.Role.CanManage() {
+			return ErrWorkspacePermission
+		}
+		if target, err = s.targetMembership(ctx, actor, memberID, ""); err != nil {
+			return err
+		}
+	}
+	if err := s.ensureAnotherOwner(ctx, target); err != nil {
+		return err
+	}
+
+	if err := s.workspaceRepo.DeleteMember(ctx, workspaceID, memberID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrWorkspaceMemberNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *workspaceService) UpdateQuota(ctx context.Context, workspaceID uint, req models.UpdateWorkspaceQuotaRequest) (*models.Workspace, error) {
+	if req.MaxMembers == nil && req.MaxTodos == nil {
+		return nil, ErrNoWorkspaceFields
+	}
+	workspace, err := s.workspaceRepo.FindWorkspaceByID(ctx, workspaceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, err
+	}
+
+	if req.MaxMembers != nil {
+		workspace.MaxMembers = *req.MaxMembers
+	}
+	if req.MaxTodos != nil {
+		workspace.MaxTodos = *req.MaxTodos
+	}
+	if err := s.workspaceRepo.UpdateWorkspace(ctx, workspace); err != nil {
+		return nil, err
+	}
+	return workspace, nil
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SecretBox encrypts small secrets for storage with AES-256-GCM.
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// NewSecretBox derives an AES-256 key from the configured passphrase.
+func NewSecretBox(passphrase string) (*SecretBox, error) {
+	if passphrase == "" {
+		return nil, errors.New("encryption key is required")
+	}
+	key := sha256.Sum256([]byte(passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+// Seal encrypts plaintext and returns base64(nonce || ciphertext).
+func (b *SecretBox) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value produced by Seal.
+func (b *SecretBox) Open(encoded string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode secret: %w", err)
+	}
+	nonceSize := b.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", errors.New("sealed secret is too short")
+	}
+	plaintext, err := b.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Signer authenticates values embedded in links, such as unsubscribe links, with HMAC-SHA256
+type Signer struct {
+	key []byte
+}
+
+// NewSigner derives a key for one purpose from secret, so signatures of one purpose are not
+// accepted for another
+func NewSigner(secret, purpose string) *Signer {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return &Signer{key: mac.Sum(nil)}
+}
+
+// Sign returns value followed by its signature, safe for use in URLs
+func (s *Signer) Sign(value string) string {
+	return value + "." + base64.RawURLEncoding.EncodeToString(s.mac(value))
+}
+
+// Verify returns the value of a token produced by Sign, or false when the signature is invalid
+func (s *Signer) Verify(token string) (string, bool) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return "", false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil || !hmac.Equal(signature, s.mac(token[:i])) {
+		return "", false
+	}
+	return token[:i], true
+}
+
+func (s *Signer) mac(value string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
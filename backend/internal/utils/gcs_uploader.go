@@ -2,12 +2,16 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	neturl "net/url"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -60,21 +64,83 @@ func (g *GCSUploader) UploadFile(ctx context.Context, objectName string, fileRea
 		return "", fmt.Errorf("GCS Writer.Close: %w", err)
 	}
 
+	url, err := g.SignedURL(objectName, 168*time.Hour)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate signed URL for object '%s' in bucket '%s': %v", objectName, g.BucketName, err)
+		return "", err
+	}
+
+	return url, nil
+}
+
+// SignedURL returns a URL that lets anyone read an object until expiresIn has passed
+func (g *GCSUploader) SignedURL(objectName string, expiresIn time.Duration) (string, error) {
 	opts := &storage.SignedURLOptions{
 		Scheme:  storage.SigningSchemeV4,
 		Method:  "GET",
-		Expires: time.Now().Add(168 * time.Hour),
+		Expires: time.Now().Add(expiresIn),
 	}
 
 	url, err := g.Client.Bucket(g.BucketName).SignedURL(objectName, opts)
 	if err != nil {
-		log.Printf("ERROR: Failed to generate signed URL for object '%s' in bucket '%s': %v", objectName, g.BucketName, err)
 		return "", fmt.Errorf("failed to generate GCS signed URL for object '%s': %w", objectName, err)
 	}
-
 	return url, nil
 }
 
+// ObjectName returns the name of the object in this bucket a URL points to, such as a signed
+// URL returned by UploadFile. It returns false for URLs of other buckets and sites.
+func (g *GCSUploader) ObjectName(rawURL string) (string, bool) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil || u.Scheme != "https" {
+		return "", false
+	}
+	var name string
+	switch u.Host {
+	case "storage.googleapis.com":
+		rest, ok := strings.CutPrefix(u.Path, "/"+g.BucketName+"/")
+		if !ok {
+			return "", false
+		}
+		name = rest
+	case g.BucketName + ".storage.googleapis.com":
+		name = strings.TrimPrefix(u.Path, "/")
+	default:
+		return "", false
+	}
+	return name, name != ""
+}
+
+// ListObjects returns the names of all objects whose name starts with prefix
+func (g *GCSUploader) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	it := g.Client.Bucket(g.BucketName).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return names, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("listing objects under '%s': %w", prefix, err)
+		}
+		names = append(names, attrs.Name)
+	}
+}
+
+// OpenObject returns a reader for the contents of an object
+func (g *GCSUploader) OpenObject(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	return g.Client.Bucket(g.BucketName).Object(objectName).NewReader(ctx)
+}
+
+// DeleteObject removes an object; objects that no longer exist are not an error
+func (g *GCSUploader) DeleteObject(ctx context.Context, objectName string) error {
+	err := g.Client.Bucket(g.BucketName).Object(objectName).Delete(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("deleting object '%s': %w", objectName, err)
+	}
+	return nil
+}
+
 // Close releases resources associated with the GCS client.
 func (g *GCSUploader) Close() error {
 	if g.Client != nil {
@@ -0,0 +1,366 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	icalLineLimit       = 75
+	icalTimeFormat      = "20060102T150405Z"
+	icalLocalTimeFormat = "20060102T150405"
+	// icalZoneScanStep is the interval at which TimeZone samples UTC offsets; zones change
+	// offset far less often
+	icalZoneScanStep = 24 * time.Hour
+)
+
+var icalTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// ICalWriter writes RFC 5545 content lines, folding long lines and remembering the first write error.
+type ICalWriter struct {
+	w   io.Writer
+	err error
+}
+
+// NewICalWriter creates a writer that emits iCalendar content lines to w.
+func NewICalWriter(w io.Writer) *ICalWriter {
+	return &ICalWriter{w: w}
+}
+
+// Begin opens a component such as VCALENDAR or VTODO.
+func (iw *ICalWriter) Begin(component string) {
+	iw.Property("BEGIN", component)
+}
+
+// End closes a component opened with Begin.
+func (iw *ICalWriter) End(component string) {
+	iw.Property("END", component)
+}
+
+// Property writes a raw property value; name may include parameters (e.g. "DTSTART;VALUE=DATE").
+func (iw *ICalWriter) Property(name, value string) {
+	iw.writeLine(name + ":" + value)
+}
+
+// Text writes a TEXT property, escaping special characters.
+func (iw *ICalWriter) Text(name, value string) {
+	iw.Property(name, icalTextEscaper.Replace(value))
+}
+
+// Time writes a DATE-TIME property in UTC.
+func (iw *ICalWriter) Time(name string, t time.Time) {
+	iw.Property(name, FormatICalTime(t))
+}
+
+// LocalTime writes a DATE-TIME property as local time in loc, referring to the VTIMEZONE
+// written with TimeZone. Times in UTC are written in UTC form.
+func (iw *ICalWriter) LocalTime(name string, t time.Time, loc *time.Location) {
+	if loc == time.UTC {
+		iw.Time(name, t)
+		return
+	}
+	iw.Property(name+";TZID="+loc.String(), t.In(loc).Format(icalLocalTimeFormat))
+}
+
+// TimeZone writes a VTIMEZONE component for loc, listing each change of its UTC offset between
+// from and to as an observance of its own. Nothing is written for UTC.
+func (iw *ICalWriter) TimeZone(loc *time.Location, from, to time.Time) {
+	if loc == time.UTC {
+		return
+	}
+	iw.Begin("VTIMEZONE")
+	iw.Property("TZID", loc.String())
+
+	at := from.In(loc)
+	name, offset := at.Zone()
+	iw.observance(at.IsDST(), at, offset, offset, name)
+	for at.Before(to) {
+		next := at.Add(icalZoneScanStep).In(loc)
+		if _, nextOffset := next.Zone(); nextOffset == offset {
+			at = next
+			continue
+		}
+
+		// Narrow down the change to the second
+		for next.Sub(at) > time.Second {
+			mid := at.Add(next.Sub(at) / 2).In(loc)
+			if _, midOffset := mid.Zone(); midOffset == offset {
+				at = mid
+			} else {
+				next = mid
+			}
+		}
+		nextName, nextOffset := next.Zone()
+		iw.observance(next.IsDST(), next, offset, nextOffset, nextName)
+		at, offset = next, nextOffset
+	}
+	iw.End("VTIMEZONE")
+}
+
+// observance writes a STANDARD or DAYLIGHT component starting at the instant at, whose local
+// time is given in the offset in effect before it
+func (iw *ICalWriter) observance(dst bool, at time.Time, offsetFrom, offsetTo int, name string) {
+	component := "STANDARD"
+	if dst {
+		component = "DAYLIGHT"
+	}
+	iw.Begin(component)
+	iw.Property("DTSTART", at.UTC().Add(time.Duration(offsetFrom)*time.Second).Format(icalLocalTimeFormat))
+	iw.Property("TZOFFSETFROM", formatICalOffset(offsetFrom))
+	iw.Property("TZOFFSETTO", formatICalOffset(offsetTo))
+	if name != "" {
+		iw.Text("TZNAME", name)
+	}
+	iw.End(component)
+}
+
+// formatICalOffset formats a UTC offset in seconds as a UTC-OFFSET value such as +0530
+func formatICalOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	value := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+	if seconds := offset % 60; seconds != 0 {
+		value += fmt.Sprintf("%02d", seconds)
+	}
+	return value
+}
+
+// Err returns the first error encountered while writing.
+func (iw *ICalWriter) Err() error {
+	return iw.err
+}
+
+// writeLine folds the line at 75 octets without splitting UTF-8 sequences and terminates it with CRLF.
+func (iw *ICalWriter) writeLine(line string) {
+	if iw.err != nil {
+		return
+	}
+
+	var b strings.Builder
+	limit := icalLineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isUTF8Start(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		limit = icalLineLimit - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+
+	_, iw.err = io.WriteString(iw.w, b.String())
+}
+
+func isUTF8Start(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// FormatICalTime formats t as an iCalendar UTC DATE-TIME value.
+func FormatICalTime(t time.Time) string {
+	return t.UTC().Format(icalTimeFormat)
+}
+
+// icalMaxLineSize bounds a single unfolded content line when parsing
+const icalMaxLineSize = 1 << 20
+
+var icalTextUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+// ICalProperty is a content line of a parsed iCalendar object. Names and parameter names are
+// upper case.
+type ICalProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Text returns the value of a TEXT property with escapes resolved.
+func (p *ICalProperty) Text() string {
+	return icalTextUnescaper.Replace(p.Value)
+}
+
+// Time parses a DATE or DATE-TIME value. UTC times are returned as is, times with a TZID are
+// read in that zone when it is known, and dates and floating times are read in loc.
+func (p *ICalProperty) Time(loc *time.Location) (time.Time, error) {
+	if p.Params["VALUE"] == "DATE" || len(p.Value) == len("20060102") {
+		return time.ParseInLocation("20060102", p.Value, loc)
+	}
+	if strings.HasSuffix(p.Value, "Z") {
+		return time.Parse(icalTimeFormat, p.Value)
+	}
+	if tzid := strings.TrimPrefix(p.Params["TZID"], "/"); tzid != "" {
+		// Zones outside the tz database, such as Windows zone names, fall back to loc
+		if zone, err := time.LoadLocation(tzid); err == nil {
+			loc = zone
+		}
+	}
+	return time.ParseInLocation(icalLocalTimeFormat, p.Value, loc)
+}
+
+// ICalComponent is a parsed component such as VCALENDAR or VTODO.
+type ICalComponent struct {
+	Name       string
+	Properties []ICalProperty
+	Components []*ICalComponent
+}
+
+// Property returns the first property named name, or nil.
+func (c *ICalComponent) Property(name string) *ICalProperty {
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// Children returns the subcomponents named name.
+func (c *ICalComponent) Children(name string) []*ICalComponent {
+	var children []*ICalComponent
+	for _, child := range c.Components {
+		if child.Name == name {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// ParseICalendar parses an RFC 5545 stream holding a single top-level component, usually a
+// VCALENDAR.
+func ParseICalendar(r io.Reader) (*ICalComponent, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), icalMaxLineSize)
+
+	var (
+		root   *ICalComponent
+		stack  []*ICalComponent
+		line   string
+		lineNo int
+	)
+	handle := func(line string) error {
+		prop, err := parseICalLine(line)
+		if err != nil {
+			return err
+		}
+		switch prop.Name {
+		case "BEGIN":
+			if root != nil && len(stack) == 0 {
+				return errors.New("content after the end of the top-level component")
+			}
+			component := &ICalComponent{Name: strings.ToUpper(prop.Value)}
+			if len(stack) == 0 {
+				root = component
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, component)
+			}
+			stack = append(stack, component)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return fmt.Errorf("unexpected END:%s", prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return fmt.Errorf("property %s outside of a component", prop.Name)
+			}
+			current := stack[len(stack)-1]
+			current.Properties = append(current.Properties, prop)
+		}
+		return nil
+	}
+
+	for scanner.Scan() {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		// Lines starting with whitespace continue the previous line
+		if strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") {
+			if len(line)+len(text) > icalMaxLineSize {
+				return nil, fmt.Errorf("line %d: content line too long", lineNo)
+			}
+			line += text[1:]
+			continue
+		}
+		if line != "" {
+			if err := handle(line); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+		}
+		line = text
+		lineNo++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if line != "" {
+		if err := handle(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("no iCalendar component found")
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("component %s is not closed", stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+// parseICalLine splits a content line into its name, parameters and value. Parameter values
+// may be quoted to contain ':', ';' and ','.
+func parseICalLine(line string) (ICalProperty, error) {
+	prop := ICalProperty{Params: map[string]string{}}
+
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return prop, fmt.Errorf("malformed content line %q", line)
+	}
+	prop.Name = strings.ToUpper(line[:i])
+
+	for line[i] == ';' {
+		rest := line[i+1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return prop, fmt.Errorf("malformed parameter of %s", prop.Name)
+		}
+		name := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return prop, fmt.Errorf("unterminated quoted parameter of %s", prop.Name)
+			}
+			value = rest[1 : end+1]
+			rest = rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, ";:")
+			if end < 0 {
+				return prop, fmt.Errorf("property %s has no value", prop.Name)
+			}
+			value = rest[:end]
+			rest = rest[end:]
+		}
+		if rest == "" {
+			return prop, fmt.Errorf("property %s has no value", prop.Name)
+		}
+		prop.Params[name] = value
+		i = len(line) - len(rest)
+	}
+	if line[i] != ':' {
+		return prop, fmt.Errorf("malformed content line %q", line)
+	}
+	prop.Value = line[i+1:]
+	return prop, nil
+}
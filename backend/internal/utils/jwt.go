@@ -8,24 +8,74 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	// PurposeMFAPending marks tokens that only allow completing a two-factor login
+	PurposeMFAPending = "mfa_pending"
+	// PurposeAccountUnlock marks tokens emailed to unlock an account after a lockout
+	PurposeAccountUnlock = "account_unlock"
+	// PurposeOIDCState marks the cookie that carries OIDC login state between redirects
+	PurposeOIDCState = "oidc_state"
+)
+
 type Claims struct {
 	UserID uint `json:"user_id"`
+	// Purpose is empty for access tokens; other tokens are only accepted by the flow they were issued for
+	Purpose string `json:"purpose,omitempty"`
+	// SessionID links an access token to the login session that can revoke it
+	SessionID string `json:"sid,omitempty"`
+	// Actor identifies the administrator impersonating the user (RFC 8693)
+	Actor *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID uint, cfg *config.Config) (string, error) {
-	expirationTime := time.Now().Add(cfg.JWTExpiresInDuration)
-	claims := &Claims{
-		UserID: userID,
+// Actor is the party acting on behalf of the token subject
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// GenerateSessionJWT issues an access token bound to a login session
+func GenerateSessionJWT(keys *KeyRing, userID uint, sessionID string, cfg *config.Config) (string, error) {
+	claims := newClaims(userID, "", cfg.JWTExpiresInDuration, cfg)
+	claims.SessionID = sessionID
+	return signClaims(keys.Sign, claims)
+}
+
+// GenerateImpersonationJWT issues a session token for userID that records actorID as the acting administrator
+func GenerateImpersonationJWT(keys *KeyRing, userID uint, sessionID string, actorID uint, expiresIn time.Duration, cfg *config.Config) (string, error) {
+	claims := newClaims(userID, "", expiresIn, cfg)
+	claims.SessionID = sessionID
+	claims.Actor = &Actor{Subject: fmt.Sprint(actorID)}
+	return signClaims(keys.Sign, claims)
+}
+
+// GeneratePurposeJWT issues a token restricted to a single flow, such as completing a two-factor login
+func GeneratePurposeJWT(keys *KeyRing, userID uint, purpose string, expiresIn time.Duration, cfg *config.Config) (string, error) {
+	claims := newClaims(userID, purpose, expiresIn, cfg)
+	claims.Audience = jwt.ClaimStrings{PurposeAudience(purpose)}
+	return signClaims(keys.SignPurpose, claims)
+}
+
+// PurposeAudience is the aud claim of tokens issued for purpose, which access tokens never carry
+func PurposeAudience(purpose string) string {
+	return "todo-list:" + purpose
+}
+
+func newClaims(userID uint, purpose string, expiresIn time.Duration, cfg *config.Config) *Claims {
+	expirationTime := time.Now().Add(expiresIn)
+	return &Claims{
+		UserID:  userID,
+		Purpose: purpose,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    cfg.APIBaseURL,
 			Subject:   fmt.Sprint(userID),
 		},
 	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(cfg.JWTSecret))
+func signClaims(sign func(jwt.Claims) (string, error), claims jwt.Claims) (string, error) {
+	tokenString, err := sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -33,22 +83,26 @@ func GenerateJWT(userID uint, cfg *config.Config) (string, error) {
 	return tokenString, nil
 }
 
-func ValidateJWT(tokenString string, cfg *config.Config) (*Claims, error) {
+// ValidateJWT verifies an access token with the key selected by its kid header
+func ValidateJWT(keys *KeyRing, tokenString string) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(cfg.JWTSecret), nil
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse token: %w", err)
+	if err := keys.Parse(tokenString, claims); err != nil {
+		return nil, err
 	}
-
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("token is not an access token")
 	}
+	return claims, nil
+}
 
+// ValidatePurposeJWT validates a token issued by GeneratePurposeJWT and checks that it was issued for purpose
+func ValidatePurposeJWT(keys *KeyRing, tokenString, purpose string) (*Claims, error) {
+	claims := &Claims{}
+	if err := keys.ParsePurpose(tokenString, purpose, claims); err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("token was not issued for this purpose")
+	}
 	return claims, nil
 }
@@ -0,0 +1,289 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported JWT_SIGNING_ALG values
+const (
+	SigningAlgHS256 = "HS256"
+	SigningAlgRS256 = "RS256"
+	SigningAlgEdDSA = "EdDSA"
+)
+
+const ephemeralKeyID = "ephemeral"
+
+// SigningKey is an asymmetric key identified by its kid header. Keys loaded from a
+// public PEM file have no private half and only verify tokens issued before a rotation.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeyRing signs tokens with the active key and verifies them with any known key.
+type KeyRing struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+	// hmacSecret signs tokens in HS256 mode and verifies legacy HS256 tokens otherwise; nil when rejected
+	hmacSecret []byte
+	// purposeSecret signs single-flow tokens, which only this application verifies
+	purposeSecret []byte
+}
+
+// NewKeyRing builds a key ring from JWT_SIGNING_ALG, JWT_KEYS_DIR and JWT_ACTIVE_KEY_ID.
+// Every *.pem file in the directory is a key whose ID is the file name without extension.
+func NewKeyRing(cfg *config.Config) (*KeyRing, error) {
+	ring := &KeyRing{keys: make(map[string]*SigningKey), purposeSecret: NewSigner(cfg.JWTSecret, "purpose-tokens").key}
+
+	if cfg.JWTSigningAlg == SigningAlgHS256 {
+		ring.hmacSecret = []byte(cfg.JWTSecret)
+		return ring, nil
+	}
+	if cfg.JWTAcceptHS256 {
+		ring.hmacSecret = []byte(cfg.JWTSecret)
+	}
+
+	if cfg.JWTKeysDir != "" {
+		paths, err := filepath.Glob(filepath.Join(cfg.JWTKeysDir, "*.pem"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			key, err := loadSigningKey(path)
+			if err != nil {
+				return nil, err
+			}
+			ring.keys[key.ID] = key
+		}
+	}
+
+	if len(ring.keys) == 0 {
+		log.Printf("WARNING: No keys found in JWT_KEYS_DIR; generating an ephemeral %s key. Tokens will not survive restarts or verify across replicas.", cfg.JWTSigningAlg)
+		key, err := generateSigningKey(cfg.JWTSigningAlg)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys[key.ID] = key
+		ring.active = key
+		return ring, nil
+	}
+
+	activeID := cfg.JWTActiveKeyID
+	if activeID == "" {
+		if len(ring.keys) > 1 {
+			return nil, errors.New("JWT_ACTIVE_KEY_ID is required when JWT_KEYS_DIR holds more than one key")
+		}
+		for id := range ring.keys {
+			activeID = id
+		}
+	}
+	active, ok := ring.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active JWT key %q not found in %s", activeID, cfg.JWTKeysDir)
+	}
+	if active.Private == nil {
+		return nil, fmt.Errorf("active JWT key %q has no private key", activeID)
+	}
+	if active.Method.Alg() != cfg.JWTSigningAlg {
+		return nil, fmt.Errorf("active JWT key %q is a %s key but JWT_SIGNING_ALG is %s", activeID, active.Method.Alg(), cfg.JWTSigningAlg)
+	}
+	ring.active = active
+
+	log.Printf("INFO: Signing JWTs with %s key %q; %d key(s) accepted for verification", active.Method.Alg(), active.ID, len(ring.keys))
+	return ring, nil
+}
+
+// Sign signs claims with the active key, adding its kid header
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	if r.active == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString(r.hmacSecret)
+	}
+	token := jwt.NewWithClaims(r.active.Method, claims)
+	token.Header["kid"] = r.active.ID
+	return token.SignedString(r.active.Private)
+}
+
+// Parse verifies a token with the key named by its kid header and decodes it into claims
+func (r *KeyRing) Parse(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, r.keyFunc, jwt.WithValidMethods(r.validMethods()))
+	if err != nil {
+		return fmt.Errorf("failed to parse token: %w", err)
+	}
+	if !token.Valid {
+		return fmt.Errorf("invalid token")
+	}
+	return nil
+}
+
+// SignPurpose signs the claims of a single-flow token with a private HMAC key that is never
+// published, so verifiers trusting the JWKS cannot take it for an access token
+func (r *KeyRing) SignPurpose(claims jwt.Claims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(r.purposeSecret)
+}
+
+// ParsePurpose verifies a token signed by SignPurpose that was issued for purpose
+func (r *KeyRing) ParsePurpose(tokenString, purpose string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (interface{}, error) {
+		return r.purposeSecret, nil
+	}, jwt.WithValidMethods([]string{SigningAlgHS256}), jwt.WithAudience(PurposeAudience(purpose)))
+	if err != nil {
+		return fmt.Errorf("failed to parse token: %w", err)
+	}
+	if !token.Valid {
+		return fmt.Errorf("invalid token")
+	}
+	return nil
+}
+
+func (r *KeyRing) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if r.hmacSecret == nil {
+			return nil, errors.New("HS256 tokens are no longer accepted")
+		}
+		return r.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := r.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.Method.Alg() != token.Method.Alg() {
+		return nil, fmt.Errorf("signing key %q does not use %s", kid, token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+func (r *KeyRing) validMethods() []string {
+	var methods []string
+	if r.hmacSecret != nil {
+		methods = append(methods, SigningAlgHS256)
+	}
+	if len(r.keys) > 0 {
+		methods = append(methods, SigningAlgRS256, SigningAlgEdDSA)
+	}
+	return methods
+}
+
+// JWKS returns the public keys that verify tokens issued by this application
+func (r *KeyRing) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		key := r.keys[id]
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func loadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+
+	id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var private crypto.Signer
+	var public crypto.PublicKey
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported private key", path)
+		}
+		private, public = signer, signer.Public()
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		private, public = parsed, parsed.Public()
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+
+	key := &SigningKey{ID: id, Private: private, Public: public}
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("%s: RSA keys must be at least 2048 bits", path)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%s: only RSA and Ed25519 keys are supported", path)
+	}
+	return key, nil
+}
+
+func generateSigningKey(alg string) (*SigningKey, error) {
+	switch alg {
+	case SigningAlgRS256:
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate RSA key: %w", err)
+		}
+		return &SigningKey{ID: ephemeralKeyID, Method: jwt.SigningMethodRS256, Private: private, Public: private.Public()}, nil
+	case SigningAlgEdDSA:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+		}
+		return &SigningKey{ID: ephemeralKeyID, Method: jwt.SigningMethodEdDSA, Private: private, Public: public}, nil
+	}
+	return nil, fmt.Errorf("unsupported JWT signing algorithm %q", alg)
+}
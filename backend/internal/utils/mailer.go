@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain-text body and an optional HTML alternative
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers are extra header fields, such as List-Unsubscribe
+	Headers map[string]string
+}
+
+// Mailer sends emails to users
+type Mailer interface {
+	// Send sends a plain-text email
+	Send(ctx context.Context, to, subject, body string) error
+	SendMessage(ctx context.Context, msg Message) error
+}
+
+// NewMailer returns the mail transport selected by MAIL_TRANSPORT
+func NewMailer(cfg *config.Config) (Mailer, error) {
+	switch cfg.MailTransport {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "file":
+		return NewFileMailer(cfg.MailFileDir, cfg.MailFrom)
+	default:
+		return NewLogMailer(), nil
+	}
+}
+
+// LogMailer writes emails to the application log instead of delivering them. It is only
+// allowed in development, and masks the tokens of links since logs are often shipped elsewhere.
+type LogMailer struct{}
+
+// logMailTokenPattern matches the token parameter of links to unlock, reset or confirm actions
+var logMailTokenPattern = regexp.MustCompile(`([?&]token=)[^&\s]+`)
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(_ context.Context, to, subject, body string) error {
+	body = logMailTokenPattern.ReplaceAllString(body, "${1}[redacted]")
+	log.Printf("INFO: Email to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+func (m *LogMailer) SendMessage(ctx context.Context, msg Message) error {
+	return m.Send(ctx, msg.To, msg.Subject, msg.Text)
+}
+
+// SMTPMailer delivers emails through an SMTP relay, upgrading to TLS when the server offers STARTTLS
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(cfg *config.Config) *SMTPMailer {
+	m := &SMTPMailer{addr: net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort), from: cfg.MailFrom}
+	if cfg.SMTPUsername != "" {
+		m.auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	return m.SendMessage(ctx, Message{To: to, Subject: subject, Text: body})
+}
+
+func (m *SMTPMailer) SendMessage(_ context.Context, msg Message) error {
+	data, err := buildMessage(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	sender, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid MAIL_FROM address: %w", err)
+	}
+	if err := smtp.SendMail(m.addr, m.auth, sender.Address, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("failed to send email via %s: %w", m.addr, err)
+	}
+	return nil
+}
+
+// FileMailer writes each email as an .eml file to a directory, for inspecting outgoing mail
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, to, subject, body string) error {
+	return m.SendMessage(ctx, Message{To: to, Subject: subject, Text: body})
+}
+
+func (m *FileMailer) SendMessage(_ context.Context, msg Message) error {
+	now := time.Now()
+	data, err := buildMessage(m.from, msg, now)
+	if err != nil {
+		return err
+	}
+	name, err := GenerateRandomToken(now.UTC().Format("20060102T150405")+"-", 6)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(m.dir, name+".eml"), data, 0o640)
+}
+
+// buildMessage encodes msg as a MIME message, as multipart/alternative when it has an HTML body
+func buildMessage(from string, msg Message, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	messageID, err := GenerateRandomToken("", 16)
+	if err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if _, host, ok := strings.Cut(addr.Address, "@"); ok {
+			domain = host
+		}
+	}
+
+	headers := map[string]string{
+		"From":         from,
+		"To":           msg.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":         now.Format(time.RFC1123Z),
+		"Message-ID":   fmt.Sprintf("<%s@%s>", messageID, domain),
+		"MIME-Version": "1.0",
+	}
+	for name, value := range msg.Headers {
+		headers[textproto.CanonicalMIMEHeaderKey(name)] = value
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		// Header values must not break out of their line
+		value := strings.NewReplacer("\r", "", "\n", "").Replace(headers[name])
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+
+	if msg.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
@@ -0,0 +1,299 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcHTTPTimeout = 10 * time.Second
+	// oidcMetadataTTL is how long discovery documents and keys are cached
+	oidcMetadataTTL = time.Hour
+	// oidcJWKSRefreshInterval limits refetching keys when a token names an unknown key ID
+	oidcJWKSRefreshInterval = time.Minute
+	oidcMaxResponseSize     = 1 << 20
+)
+
+// oidcSigningMethods are the ID token algorithms accepted from providers
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// OIDCDiscovery holds the fields used from a provider's discovery document
+type OIDCDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCBool accepts both JSON booleans and the string form some providers send for email_verified
+type OIDCBool bool
+
+func (b *OIDCBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+// OIDCIDTokenClaims are the ID token claims used to identify the user
+type OIDCIDTokenClaims struct {
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified OIDCBool `json:"email_verified"`
+	Name          string   `json:"name"`
+	// AuthTime is when the user last authenticated with the provider, which may be long before
+	// this login when the provider reuses its own session
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// OIDCClient performs the authorization code flow with PKCE against one provider
+type OIDCClient struct {
+	provider    config.OIDCProviderConfig
+	redirectURL string
+	httpClient  *http.Client
+
+	mu            sync.Mutex
+	discovery     *OIDCDiscovery
+	discoveredAt  time.Time
+	jwks          *JWKSet
+	jwksFetchedAt time.Time
+}
+
+func NewOIDCClient(provider config.OIDCProviderConfig, redirectURL string) *OIDCClient {
+	return &OIDCClient{
+		provider:    provider,
+		redirectURL: redirectURL,
+		httpClient:  &http.Client{Timeout: oidcHTTPTimeout},
+	}
+}
+
+// GeneratePKCEVerifier returns a code verifier and its S256 challenge (RFC 7636)
+func GeneratePKCEVerifier() (verifier, challenge string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate PKCE verifier: %w", err)
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// AuthCodeURL builds the provider URL the browser is redirected to. With reauth the provider is
+// asked to authenticate the user again rather than reuse its session, and to report auth_time.
+func (c *OIDCClient) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string, reauth bool) (string, error) {
+	discovery, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", c.provider.ClientID)
+	params.Set("redirect_uri", c.redirectURL)
+	params.Set("scope", strings.Join(c.provider.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+	if reauth {
+		params.Set("prompt", "login")
+		params.Set("max_age", "0")
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the raw ID token
+func (c *OIDCClient) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	discovery, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.redirectURL)
+	form.Set("client_id", c.provider.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if c.provider.ClientSecret != "" {
+		form.Set("client_secret", c.provider.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := c.doJSON(req, &token)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	if status != http.StatusOK || token.Error != "" {
+		return "", fmt.Errorf("token request failed with status %d: %s %s", status, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return token.IDToken, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token
+func (c *OIDCClient) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*OIDCIDTokenClaims, error) {
+	claims := &OIDCIDTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods(oidcSigningMethods),
+		jwt.WithIssuer(c.provider.Issuer),
+		jwt.WithAudience(c.provider.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid ID token: missing subject")
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	return claims, nil
+}
+
+func (c *OIDCClient) discover(ctx context.Context) (*OIDCDiscovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.discovery != nil && time.Since(c.discoveredAt) < oidcMetadataTTL {
+		return c.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.provider.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var discovery OIDCDiscovery
+	status, err := c.doJSON(req, &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery failed with status %d", status)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != c.provider.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match configured issuer %q", discovery.Issuer, c.provider.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+
+	c.discovery = &discovery
+	c.discoveredAt = time.Now()
+	return c.discovery, nil
+}
+
+// publicKey returns the provider key for kid, refetching the key set when kid is unknown
+func (c *OIDCClient) publicKey(ctx context.Context, kid string) (interface{}, error) {
+	discovery, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stale := c.jwks == nil || time.Since(c.jwksFetchedAt) >= oidcMetadataTTL
+	if !stale {
+		if key, ok := c.selectKey(kid); ok {
+			return key.PublicKey()
+		}
+		stale = time.Since(c.jwksFetchedAt) >= oidcJWKSRefreshInterval
+	}
+	if stale {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+		if err != nil {
+			return nil, err
+		}
+		var jwks JWKSet
+		status, err := c.doJSON(req, &jwks)
+		if err != nil {
+			return nil, fmt.Errorf("fetching keys failed: %w", err)
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("fetching keys failed with status %d", status)
+		}
+		c.jwks = &jwks
+		c.jwksFetchedAt = time.Now()
+	}
+
+	key, ok := c.selectKey(kid)
+	if !ok {
+		return nil, fmt.Errorf("no provider key with ID %q", kid)
+	}
+	return key.PublicKey()
+}
+
+// selectKey finds kid in the cached key set; tokens without kid are accepted when there is a single key
+func (c *OIDCClient) selectKey(kid string) (JWK, bool) {
+	if c.jwks == nil {
+		return JWK{}, false
+	}
+	if kid == "" {
+		if len(c.jwks.Keys) == 1 {
+			return c.jwks.Keys[0], true
+		}
+		return JWK{}, false
+	}
+	return c.jwks.Find(kid)
+}
+
+func (c *OIDCClient) doJSON(req *http.Request, v interface{}) (int, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, oidcMaxResponseSize))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("invalid JSON response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
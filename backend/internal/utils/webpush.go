@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/xNatthapol/todo-list/internal/config"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// pushRecordSize is the record size of encrypted push messages; push services accept at least 4096
+const pushRecordSize = 4096
+
+// MaxPushPayloadSize is the largest payload that fits in a single encrypted record
+const MaxPushPayloadSize = pushRecordSize - 16 - 4 - 1 - 65 - 16 - 1
+
+// ErrPushSubscriptionGone is returned when the push service reports that a subscription has
+// expired or was removed; it will never accept messages again
+var ErrPushSubscriptionGone = errors.New("push subscription is no longer valid")
+
+// PushTarget is the endpoint and keys a browser created for one push subscription
+type PushTarget struct {
+	Endpoint string
+	// P256dh and Auth are the unpadded base64url keys from the browser's PushSubscription
+	P256dh string
+	Auth   string
+}
+
+// Validate checks that the subscription keys are a P-256 public key and a 16-byte auth secret
+func (t PushTarget) Validate() error {
+	_, _, err := t.keys()
+	return err
+}
+
+func (t PushTarget) keys() (*ecdh.PublicKey, []byte, error) {
+	clientKeyBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(t.P256dh, "="))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	clientKey, err := ecdh.P256().NewPublicKey(clientKeyBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(t.Auth, "="))
+	if err != nil || len(authSecret) != 16 {
+		return nil, nil, errors.New("invalid auth secret")
+	}
+	return clientKey, authSecret, nil
+}
+
+// PushSender delivers encrypted Web Push messages
+type PushSender interface {
+	Send(ctx context.Context, target PushTarget, payload []byte, ttl time.Duration) error
+}
+
+// VAPIDKeys identify this server to push services (RFC 8292)
+type VAPIDKeys struct {
+	private *ecdsa.PrivateKey
+	// PublicKey is the uncompressed public key as unpadded base64url, the applicationServerKey
+	// browsers subscribe with
+	PublicKey string
+	// PrivateKey is the raw private scalar as unpadded base64url
+	PrivateKey string
+}
+
+// LoadVAPIDKeys reads VAPID_PUBLIC_KEY and VAPID_PRIVATE_KEY. Without them an ephemeral pair
+// is generated, and every subscription stops working when the server restarts.
+func LoadVAPIDKeys(cfg *config.Config) (*VAPIDKeys, error) {
+	if cfg.VAPIDPrivateKey == "" {
+		log.Println("WARNING: VAPID_PRIVATE_KEY not set; generating an ephemeral VAPID key pair. Push subscriptions will not survive restarts; run the generate-vapid-keys command to create a permanent pair.")
+		return GenerateVAPIDKeys()
+	}
+	keys, err := parseVAPIDPrivateKey(cfg.VAPIDPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.VAPIDPublicKey != "" && cfg.VAPIDPublicKey != keys.PublicKey {
+		return nil, errors.New("VAPID_PUBLIC_KEY does not match VAPID_PRIVATE_KEY")
+	}
+	return keys, nil
+}
+
+// GenerateVAPIDKeys creates a new P-256 key pair
+func GenerateVAPIDKeys() (*VAPIDKeys, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate VAPID key: %w", err)
+	}
+	return vapidKeysFrom(key), nil
+}
+
+func parseVAPIDPrivateKey(encoded string) (*VAPIDKeys, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID_PRIVATE_KEY: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID_PRIVATE_KEY: %w", err)
+	}
+	return vapidKeysFrom(key), nil
+}
+
+func vapidKeysFrom(key *ecdh.PrivateKey) *VAPIDKeys {
+	public := key.PublicKey().Bytes()
+	return &VAPIDKeys{
+		private: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(public[1:33]),
+				Y:     new(big.Int).SetBytes(public[33:]),
+			},
+			D: new(big.Int).SetBytes(key.Bytes()),
+		},
+		PublicKey:  base64.RawURLEncoding.EncodeToString(public),
+		PrivateKey: base64.RawURLEncoding.EncodeToString(key.Bytes()),
+	}
+}
+
+// WebPushSender sends messages encrypted with aes128gcm (RFC 8291) and signed with VAPID
+type WebPushSender struct {
+	keys    *VAPIDKeys
+	subject string
+	client  *http.Client
+}
+
+// NewWebPushSender signs requests with keys; subject is the mailto: or https: contact push
+// services can use to reach the operator. Endpoints come from browsers, so requests only go to
+// public addresses.
+func NewWebPushSender(keys *VAPIDKeys, subject string) *WebPushSender {
+	return &WebPushSender{keys: keys, subject: subject, client: NewPublicHTTPClient(30 * time.Second)}
+}
+
+// WithClient returns a copy of the sender that sends requests with client, such as the client of
+// a test server
+func (s *WebPushSender) WithClient(client *http.Client) *WebPushSender {
+	sender := *s
+	sender.client = client
+	return &sender
+}
+
+func (s *WebPushSender) Send(ctx context.Context, target PushTarget, payload []byte, ttl time.Duration) error {
+	endpoint, err := url.Parse(target.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return fmt.Errorf("invalid push endpoint %q", target.Endpoint)
+	}
+	body, err := EncryptPushPayload(target, payload)
+	if err != nil {
+		return err
+	}
+
+	// The token is scoped to the push service's origin
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": s.subject,
+	}).SignedString(s.keys.private)
+	if err != nil {
+		return fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "vapid t="+token+", k="+s.keys.PublicKey)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach push service: %w", err)
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrPushSubscriptionGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("push service returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// EncryptPushPayload encrypts payload for target as a single aes128gcm record (RFC 8291)
+func EncryptPushPayload(target PushTarget, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPushPayloadSize {
+		return nil, fmt.Errorf("push payload of %d bytes exceeds %d bytes", len(payload), MaxPushPayloadSize)
+	}
+	clientKey, authSecret, err := target.keys()
+	if err != nil {
+		return nil, err
+	}
+	clientKeyBytes := clientKey.Bytes()
+
+	// Each message uses a new sender key pair and salt
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := serverKey.ECDH(clientKey)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	serverPublic := serverKey.PublicKey().Bytes()
+
+	keyInfo := "WebPush: info\x00" + string(clientKeyBytes) + string(serverPublic)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	contentKey, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: salt, record size, key ID length and the sender's public key as key ID
+	header := make([]byte, 0, 16+4+1+len(serverPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, pushRecordSize)
+	header = append(header, byte(len(serverPublic)))
+	header = append(header, serverPublic...)
+
+	// The 0x02 delimiter marks the last (and only) record
+	plaintext := append(append(make([]byte, 0, len(payload)+1), payload...), 0x02)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}